@@ -0,0 +1,203 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+type AuditAction string
+
+const (
+	AuditFileDownload   AuditAction = "file.download"
+	AuditFileUpload     AuditAction = "file.upload"
+	AuditFileRename     AuditAction = "file.rename"
+	AuditFileMove       AuditAction = "file.move"
+	AuditFileCopy       AuditAction = "file.copy"
+	AuditFileDelete     AuditAction = "file.delete"
+	AuditFileShare      AuditAction = "file.share"
+	AuditFileUnshare    AuditAction = "file.unshare"
+	AuditFileGrant      AuditAction = "file.grant"
+	AuditFileRevoke     AuditAction = "file.revoke"
+	AuditFileExpire     AuditAction = "file.expire"
+	AuditFileQuarantine AuditAction = "file.quarantine"
+	AuditFileRelease    AuditAction = "file.release"
+
+	AuditSignIn         AuditAction = "auth.signin"
+	AuditSignInFailed   AuditAction = "auth.signin_failed"
+	AuditSignUp         AuditAction = "auth.signup"
+	AuditPasswordReset  AuditAction = "auth.password_reset"
+	AuditPasswordChange AuditAction = "auth.password_change"
+
+	AuditAdminEditUser   AuditAction = "admin.edit_user"
+	AuditAdminDeleteUser AuditAction = "admin.delete_user"
+)
+
+const (
+	AuditTargetFile  = "file"
+	AuditTargetUser  = "user"
+	AuditTargetShare = "share"
+)
+
+// AuditLog is an entry of the append-only audit trail. Actor and target
+// names are copied, so entries stay readable after users or files are gone.
+// Before and After hold the state of the target as JSON.
+type AuditLog struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"index"`
+
+	// ActorID is 0 for anonymous requests, e.g. failed sign-ins
+	ActorID     uint `gorm:"index"`
+	ActorName   string
+	IP          string
+	Action      AuditAction `gorm:"index"`
+	TargetType  string
+	TargetID    uint
+	TargetName  string
+	TargetOwner uint
+	Before      string `gorm:"type:text"`
+	After       string `gorm:"type:text"`
+}
+
+func NewFileAuditLog(action AuditAction, f *File) *AuditLog {
+	return &AuditLog{
+		Action:      action,
+		TargetType:  AuditTargetFile,
+		TargetID:    f.ID,
+		TargetName:  f.FilePath(),
+		TargetOwner: f.Owner,
+	}
+}
+
+// FileAuditState is the state of f kept in the audit log.
+func FileAuditState(f *File) map[string]interface{} {
+	return map[string]interface{}{
+		"path":    f.FilePath(),
+		"size":    f.FileSize,
+		"version": f.Version,
+	}
+}
+
+func NewUserAuditLog(action AuditAction, u *User) *AuditLog {
+	return &AuditLog{
+		Action:      action,
+		TargetType:  AuditTargetUser,
+		TargetID:    u.ID,
+		TargetName:  u.Username,
+		TargetOwner: u.ID,
+	}
+}
+
+// CreateAuditLog appends l to the audit trail, entries are never changed
+// afterwards and only removed by the sweeper once they are older than the
+// retention.
+func CreateAuditLog(l *AuditLog) error {
+	l.ID = 0
+	return engine.Create(l).Error
+}
+
+// PruneAuditLogs removes the entries created before the time before.
+func PruneAuditLogs(before time.Time) error {
+	return engine.Where("created_at<?", before).Delete(&AuditLog{}).Error
+}
+
+// RecordAuditLog appends l to the audit trail, before and after are stored
+// as JSON if they aren't nil. Failures are only logged as the action took
+// place already.
+func RecordAuditLog(l *AuditLog, before, after interface{}) {
+	if before != nil {
+		data, err := json.Marshal(before)
+		if err != nil {
+			log.Error("Failed to encode audit log", zap.String("action", string(l.Action)), zap.Error(err))
+		}
+		l.Before = string(data)
+	}
+
+	if after != nil {
+		data, err := json.Marshal(after)
+		if err != nil {
+			log.Error("Failed to encode audit log", zap.String("action", string(l.Action)), zap.Error(err))
+		}
+		l.After = string(data)
+	}
+
+	if err := CreateAuditLog(l); err != nil {
+		log.Error("Failed to record audit log", zap.String("action", string(l.Action)), zap.Uint("actor", l.ActorID), zap.Uint("target", l.TargetID), zap.Error(err))
+	}
+}
+
+type SearchAuditLogOptions struct {
+	ListOptions
+	ActorID *uint
+	Actions []AuditAction
+	Since   *time.Time
+	Until   *time.Time
+}
+
+func (opts *SearchAuditLogOptions) Apply(e *gorm.DB) *gorm.DB {
+	if opts.ActorID != nil {
+		e = e.Where("actor_id=?", *opts.ActorID)
+	}
+
+	if len(opts.Actions) != 0 {
+		e = e.Where("action IN (?)", opts.Actions)
+	}
+
+	if opts.Since != nil {
+		e = e.Where("created_at>=?", *opts.Since)
+	}
+
+	if opts.Until != nil {
+		e = e.Where("created_at<?", *opts.Until)
+	}
+	return e
+}
+
+// SearchAuditLogs returns the entries matching opts, the newest first.
+func SearchAuditLogs(opts *SearchAuditLogOptions) ([]*AuditLog, int64, error) {
+	var count int64
+	if err := opts.Apply(engine.Model(&AuditLog{})).Count(&count).Error; err != nil {
+		return nil, 0, fmt.Errorf("Count: %v", err)
+	}
+
+	db := opts.Apply(engine).Order("id DESC")
+	if opts.Page != 0 {
+		db = opts.SetEnginePagination(db)
+	}
+
+	logs := make([]*AuditLog, 0, opts.PageSize)
+	if err := db.Find(&logs).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, 0, err
+	}
+	return logs, count, nil
+}
+
+// IterateAuditLogs calls fn with the entries matching opts in batches, the
+// oldest first. Pagination of opts is ignored.
+func IterateAuditLogs(opts *SearchAuditLogOptions, batchSize int, fn func([]*AuditLog) error) error {
+	var last uint
+	for {
+		logs := make([]*AuditLog, 0, batchSize)
+		err := opts.Apply(engine).Where("id>?", last).Order("id ASC").Limit(batchSize).Find(&logs).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+
+		if len(logs) == 0 {
+			return nil
+		}
+
+		if err := fn(logs); err != nil {
+			return err
+		}
+
+		if len(logs) < batchSize {
+			return nil
+		}
+		last = logs[len(logs)-1].ID
+	}
+}
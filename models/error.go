@@ -117,8 +117,190 @@ func (err ErrFileParentNotDirectory) Error() string {
 	return fmt.Sprintf("parent is not a directory [id: %d, path: %s]", err.ID, err.Path)
 }
 
+type ErrFileMoveIntoItself struct {
+	ID    uint
+	DirID uint
+}
+
+func IsErrFileMoveIntoItself(err error) bool {
+	_, ok := err.(ErrFileMoveIntoItself)
+	return ok
+}
+
+func (err ErrFileMoveIntoItself) Error() string {
+	return fmt.Sprintf("cannot move or copy a directory into itself or its descendant [id: %d, dir_id: %d]", err.ID, err.DirID)
+}
+
+type ErrBatchOperationAborted struct {
+	Index       int
+	FailedIndex int
+}
+
+func IsErrBatchOperationAborted(err error) bool {
+	_, ok := err.(ErrBatchOperationAborted)
+	return ok
+}
+
+func (err ErrBatchOperationAborted) Error() string {
+	return fmt.Sprintf("batch operation is aborted [index: %d, failed_index: %d]", err.Index, err.FailedIndex)
+}
+
+type ErrBatchOperationUnknown struct {
+	Type BatchOperationType
+}
+
+func IsErrBatchOperationUnknown(err error) bool {
+	_, ok := err.(ErrBatchOperationUnknown)
+	return ok
+}
+
+func (err ErrBatchOperationUnknown) Error() string {
+	return fmt.Sprintf("unknown batch operation [type: %s]", err.Type)
+}
+
+type ErrExtractTaskNotExist struct {
+	ID    uint
+	Owner uint
+}
+
+func IsErrExtractTaskNotExist(err error) bool {
+	_, ok := err.(ErrExtractTaskNotExist)
+	return ok
+}
+
+func (err ErrExtractTaskNotExist) Error() string {
+	return fmt.Sprintf("extract task does not exist [id: %d, owner: %d]", err.ID, err.Owner)
+}
+
+type ErrThumbnailNotExist struct {
+	FileID uint
+	Size   int
+}
+
+func IsErrThumbnailNotExist(err error) bool {
+	_, ok := err.(ErrThumbnailNotExist)
+	return ok
+}
+
+func (err ErrThumbnailNotExist) Error() string {
+	return fmt.Sprintf("thumbnail does not exist [file_id: %d, size: %d]", err.FileID, err.Size)
+}
+
+type ErrArchiveInvalid struct {
+	Reason string
+}
+
+func IsErrArchiveInvalid(err error) bool {
+	_, ok := err.(ErrArchiveInvalid)
+	return ok
+}
+
+func (err ErrArchiveInvalid) Error() string {
+	return fmt.Sprintf("archive is invalid [reason: %s]", err.Reason)
+}
+
+type ErrFilePermissionDenied struct {
+	ID     uint
+	UserID uint
+}
+
+func IsErrFilePermissionDenied(err error) bool {
+	_, ok := err.(ErrFilePermissionDenied)
+	return ok
+}
+
+func (err ErrFilePermissionDenied) Error() string {
+	return fmt.Sprintf("file permission denied [id: %d, uid: %d]", err.ID, err.UserID)
+}
+
+type ErrFileGrantNotExist struct {
+	FileID uint
+	UserID uint
+}
+
+func IsErrFileGrantNotExist(err error) bool {
+	_, ok := err.(ErrFileGrantNotExist)
+	return ok
+}
+
+func (err ErrFileGrantNotExist) Error() string {
+	return fmt.Sprintf("file grant does not exist [file_id: %d, uid: %d]", err.FileID, err.UserID)
+}
+
+type ErrTeamNotExist struct {
+	ID   uint
+	Name string
+}
+
+func IsErrTeamNotExist(err error) bool {
+	_, ok := err.(ErrTeamNotExist)
+	return ok
+}
+
+func (err ErrTeamNotExist) Error() string {
+	return fmt.Sprintf("team does not exist [id: %d, name: %s]", err.ID, err.Name)
+}
+
+type ErrTeamMemberNotExist struct {
+	TeamID uint
+	UserID uint
+}
+
+func IsErrTeamMemberNotExist(err error) bool {
+	_, ok := err.(ErrTeamMemberNotExist)
+	return ok
+}
+
+func (err ErrTeamMemberNotExist) Error() string {
+	return fmt.Sprintf("team member does not exist [team_id: %d, uid: %d]", err.TeamID, err.UserID)
+}
+
+type ErrTeamLastOwner struct {
+	TeamID uint
+	UserID uint
+}
+
+func IsErrTeamLastOwner(err error) bool {
+	_, ok := err.(ErrTeamLastOwner)
+	return ok
+}
+
+func (err ErrTeamLastOwner) Error() string {
+	return fmt.Sprintf("team needs at least one owner [team_id: %d, uid: %d]", err.TeamID, err.UserID)
+}
+
+type ErrShareLinkNotExist struct {
+	ID    uint
+	Token string
+	Owner uint
+}
+
+func IsErrShareLinkNotExist(err error) bool {
+	_, ok := err.(ErrShareLinkNotExist)
+	return ok
+}
+
+func (err ErrShareLinkNotExist) Error() string {
+	return fmt.Sprintf("share link does not exist [id: %d, token: %s, owner: %d]", err.ID, err.Token, err.Owner)
+}
+
+type ErrShareLinkExhausted struct {
+	ID           uint
+	MaxDownloads int64
+}
+
+func IsErrShareLinkExhausted(err error) bool {
+	_, ok := err.(ErrShareLinkExhausted)
+	return ok
+}
+
+func (err ErrShareLinkExhausted) Error() string {
+	return fmt.Sprintf("share link reached its download limit [id: %d, max_downloads: %d]", err.ID, err.MaxDownloads)
+}
+
 type ErrFileLocked struct {
-	ID uint
+	ID     uint
+	UserID uint
 }
 
 func IsErrFileLocked(err error) bool {
@@ -127,7 +309,89 @@ func IsErrFileLocked(err error) bool {
 }
 
 func (err ErrFileLocked) Error() string {
-	return fmt.Sprintf("file is locked [id: %d]", err.ID)
+	return fmt.Sprintf("file is locked [id: %d, uid: %d]", err.ID, err.UserID)
+}
+
+type ErrFileLockDirectory struct {
+	ID uint
+}
+
+func IsErrFileLockDirectory(err error) bool {
+	_, ok := err.(ErrFileLockDirectory)
+	return ok
+}
+
+func (err ErrFileLockDirectory) Error() string {
+	return fmt.Sprintf("directory cannot be locked [id: %d]", err.ID)
+}
+
+type ErrFileModified struct {
+	ID      uint
+	Version int64
+}
+
+func IsErrFileModified(err error) bool {
+	_, ok := err.(ErrFileModified)
+	return ok
+}
+
+func (err ErrFileModified) Error() string {
+	return fmt.Sprintf("file has been modified [id: %d, version: %d]", err.ID, err.Version)
+}
+
+type ErrFileChangeCursorExpired struct {
+	Owner uint
+	Seq   int64
+}
+
+func IsErrFileChangeCursorExpired(err error) bool {
+	_, ok := err.(ErrFileChangeCursorExpired)
+	return ok
+}
+
+func (err ErrFileChangeCursorExpired) Error() string {
+	return fmt.Sprintf("file change cursor is expired [owner: %d, seq: %d]", err.Owner, err.Seq)
+}
+
+type ErrInvalidDirCursor struct {
+	Cursor string
+}
+
+func IsErrInvalidDirCursor(err error) bool {
+	_, ok := err.(ErrInvalidDirCursor)
+	return ok
+}
+
+func (err ErrInvalidDirCursor) Error() string {
+	return fmt.Sprintf("invalid directory cursor [cursor: %s]", err.Cursor)
+}
+
+type ErrWebhookNotExist struct {
+	ID    uint
+	Owner uint
+}
+
+func IsErrWebhookNotExist(err error) bool {
+	_, ok := err.(ErrWebhookNotExist)
+	return ok
+}
+
+func (err ErrWebhookNotExist) Error() string {
+	return fmt.Sprintf("webhook does not exist [id: %d, owner: %d]", err.ID, err.Owner)
+}
+
+type ErrWebhookDeliveryNotExist struct {
+	ID        uint
+	WebhookID uint
+}
+
+func IsErrWebhookDeliveryNotExist(err error) bool {
+	_, ok := err.(ErrWebhookDeliveryNotExist)
+	return ok
+}
+
+func (err ErrWebhookDeliveryNotExist) Error() string {
+	return fmt.Sprintf("webhook delivery does not exist [id: %d, webhook_id: %d]", err.ID, err.WebhookID)
 }
 
 type ErrFileUnlockFailed struct {
@@ -157,6 +421,110 @@ func (err ErrUserMaxFileCapacityLimit) Error() string {
 	return fmt.Sprintf("user file capacity is fulled [id: %d]", err.UserID)
 }
 
+type ErrUserMaxFileCountLimit struct {
+	UserID   uint
+	MaxCount int64
+}
+
+func IsErrUserMaxFileCountLimit(err error) bool {
+	_, ok := err.(ErrUserMaxFileCountLimit)
+	return ok
+}
+
+func (err ErrUserMaxFileCountLimit) Error() string {
+	return fmt.Sprintf("user file count limit is reached [id: %d, max: %d]", err.UserID, err.MaxCount)
+}
+
+type ErrFileTooLarge struct {
+	Name    string
+	Size    int64
+	MaxSize int64
+}
+
+func IsErrFileTooLarge(err error) bool {
+	_, ok := err.(ErrFileTooLarge)
+	return ok
+}
+
+func (err ErrFileTooLarge) Error() string {
+	return fmt.Sprintf("file is too large [name: %s, size: %d, max: %d]", err.Name, err.Size, err.MaxSize)
+}
+
+type ErrFileTypeNotAllowed struct {
+	Name        string
+	ContentType string
+}
+
+func IsErrFileTypeNotAllowed(err error) bool {
+	_, ok := err.(ErrFileTypeNotAllowed)
+	return ok
+}
+
+func (err ErrFileTypeNotAllowed) Error() string {
+	return fmt.Sprintf("file type is not allowed [name: %s, content_type: %s]", err.Name, err.ContentType)
+}
+
+type ErrDirectoryQuotaExceeded struct {
+	ID    uint
+	Path  string
+	Quota int64
+}
+
+func IsErrDirectoryQuotaExceeded(err error) bool {
+	_, ok := err.(ErrDirectoryQuotaExceeded)
+	return ok
+}
+
+func (err ErrDirectoryQuotaExceeded) Error() string {
+	return fmt.Sprintf("directory quota is exceeded [id: %d, path: %s, quota: %d]", err.ID, err.Path, err.Quota)
+}
+
+type ErrFileScanFailed struct {
+	Reason string
+}
+
+func IsErrFileScanFailed(err error) bool {
+	_, ok := err.(ErrFileScanFailed)
+	return ok
+}
+
+func (err ErrFileScanFailed) Error() string {
+	return fmt.Sprintf("failed to scan file [reason: %s]", err.Reason)
+}
+
+type ErrFileNotQuarantined struct {
+	ID uint
+}
+
+func IsErrFileNotQuarantined(err error) bool {
+	_, ok := err.(ErrFileNotQuarantined)
+	return ok
+}
+
+func (err ErrFileNotQuarantined) Error() string {
+	return fmt.Sprintf("file is not quarantined [id: %d]", err.ID)
+}
+
+type ErrFileQuarantined struct {
+	ID     uint
+	Status FileScanStatus
+}
+
+func IsErrFileQuarantined(err error) bool {
+	_, ok := err.(ErrFileQuarantined)
+	return ok
+}
+
+func (err ErrFileQuarantined) Error() string {
+	return fmt.Sprintf("file is not downloadable [id: %d, scan_status: %s]", err.ID, err.Status)
+}
+
+// IsErrUploadPolicy reports whether err is a violation of the upload
+// policies, see upload_policy.go.
+func IsErrUploadPolicy(err error) bool {
+	return IsErrUserMaxFileCountLimit(err) || IsErrFileTooLarge(err) || IsErrFileTypeNotAllowed(err) || IsErrDirectoryQuotaExceeded(err)
+}
+
 type ErrOAuth2TokenNotExist struct {
 	Code         string
 	AccessToken  string
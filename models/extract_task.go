@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type ExtractTaskStatus int
+
+const (
+	ExtractTaskPending ExtractTaskStatus = iota
+	ExtractTaskRunning
+	ExtractTaskDone
+	ExtractTaskFailed
+)
+
+func (s ExtractTaskStatus) String() string {
+	switch s {
+	case ExtractTaskRunning:
+		return "running"
+	case ExtractTaskDone:
+		return "done"
+	case ExtractTaskFailed:
+		return "failed"
+	}
+	return "pending"
+}
+
+// ExtractTask records the extraction of an archive file into a directory.
+type ExtractTask struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Owner         uint `sql:"index"`
+	ArchiveID     uint
+	DirectoryID   uint
+	Conflict      ConflictPolicy
+	RemoveArchive bool
+
+	Status    ExtractTaskStatus
+	FileCount int
+	Message   string
+}
+
+func CreateExtractTask(t *ExtractTask) error {
+	return engine.Create(t).Error
+}
+
+func SaveExtractTask(t *ExtractTask) error {
+	return engine.Save(t).Error
+}
+
+func GetExtractTask(id uint, uid uint) (*ExtractTask, error) {
+	task := new(ExtractTask)
+	query := engine.Where("id=?", id)
+	if uid != 0 {
+		query = query.Where("owner=?", uid)
+	}
+
+	if err := query.First(task).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrExtractTaskNotExist{ID: id, Owner: uid}
+		}
+		return nil, err
+	}
+	return task, nil
+}
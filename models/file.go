@@ -1,10 +1,13 @@
 package models
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"mime/multipart"
-	"os"
 	"path"
 	"path/filepath"
 	"strings"
@@ -14,6 +17,7 @@ import (
 	"github.com/czhj/ahfs/modules/log"
 	"github.com/czhj/ahfs/modules/setting"
 	"github.com/czhj/ahfs/modules/storage"
+	"github.com/czhj/ahfs/modules/typesniffer"
 	"github.com/czhj/ahfs/modules/utils"
 	"github.com/jinzhu/gorm"
 	"go.uber.org/zap"
@@ -32,16 +36,58 @@ type File struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt *time.Time `sql:"index"`
+	// DeletedID is the id of a deleted entry and 0 otherwise, it keeps
+	// deleted entries out of the unique names of a directory, see
+	// AddFileNameUniqueIndex
+	DeletedID uint
 
 	FileID   string `gorm:"unique_index"`
+	TreePath string `gorm:"index"`
 	FileDir  string
 	FileName string
 
-	FileType FileType
-	FileSize int64
+	FileType    FileType
+	FileSize    int64
+	ContentType string
+
+	// TotalSize, FileCount and DirCount aggregate the entries below a
+	// directory, see file_stats.go
+	TotalSize int64
+	FileCount int64
+	DirCount  int64
+	// Quota limits the TotalSize of a directory, 0 is unlimited
+	Quota int64
+
+	// Version is increased by every change of the entry, see ETag
+	Version int64
+
+	// ExpiresAt is the time the entry is deleted by the expiry sweeper, see
+	// file_expiration.go
+	ExpiresAt      *time.Time `gorm:"index"`
+	ExpiryNotified bool
+
+	// ScanStatus is the verdict of the content scanner, see file_scan.go
+	ScanStatus FileScanStatus `gorm:"index"`
+	ScanResult string
 
 	Owner    uint
 	ParentID uint
+
+	// Lock is only set by LoadFileLocks
+	Lock *FileLock `gorm:"-"`
+}
+
+// MimeType returns the sniffed content type of the file, files stored
+// before types were sniffed fall back to their extension.
+func (f *File) MimeType() string {
+	if f.IsDir() {
+		return ""
+	}
+
+	if len(f.ContentType) != 0 {
+		return f.ContentType
+	}
+	return typesniffer.ByName(f.FileName)
 }
 
 func (f *File) IsRoot() bool {
@@ -61,19 +107,25 @@ func (f *File) FilePath() string {
 }
 
 type ReadDirOption struct {
+	MetadataFilter
 	OnlyDir bool
 }
 
 func (f *File) ReadDir(opts ReadDirOption) ([]*File, error) {
+	return readDir(engine, f, opts)
+}
+
+func readDir(e *gorm.DB, f *File, opts ReadDirOption) ([]*File, error) {
 	if !f.IsDir() {
 		return nil, ErrFileNotDirectory{ID: f.ID, Path: f.FilePath()}
 	}
 
 	files := make([]*File, 0)
-	query := engine.Where("parent_id=?", f.ID)
+	query := e.Where("parent_id=?", f.ID)
 	if opts.OnlyDir {
 		query = query.Where("file_type=?", FileTypeDir)
 	}
+	query = opts.MetadataFilter.apply(query)
 	err := query.Find(&files).Error
 	if err != nil {
 		if gorm.IsRecordNotFoundError(err) {
@@ -89,6 +141,7 @@ func CreateUserRootFile(u *User) *File {
 		FileID:   fmt.Sprintf("%d-root", u.ID),
 		FileName: "/",
 		FileType: FileTypeDir,
+		TreePath: "/",
 		ParentID: 0,
 		Owner:    u.ID,
 	}
@@ -96,7 +149,7 @@ func CreateUserRootFile(u *User) *File {
 
 func GetUserRootFile(uid uint) (*File, error) {
 	file := new(File)
-	result := engine.Where("id=? AND file_id=?", uid, fmt.Sprintf("%d-root", uid)).First(file)
+	result := engine.Where("owner=? AND file_id=?", uid, fmt.Sprintf("%d-root", uid)).First(file)
 	if err := result.Error; err != nil {
 		if gorm.IsRecordNotFoundError(err) {
 			return nil, ErrFileNotExist{Owner: uid}
@@ -106,6 +159,56 @@ func GetUserRootFile(uid uint) (*File, error) {
 	return file, nil
 }
 
+// GetFileByPath resolves p, a slash separated path, from the root directory
+// of the user uid.
+func GetFileByPath(uid uint, p string) (*File, error) {
+	file, err := GetUserRootFile(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err = getFileByRelativePath(engine, file, p)
+	if err != nil {
+		if IsErrFileNotExist(err) {
+			return nil, ErrFileNotExist{Path: path.Clean("/" + p), Owner: uid}
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// GetFileByRelativePath resolves p, a slash separated path, from the
+// directory dir, the result is always dir or one of its descendants.
+func GetFileByRelativePath(dir *File, p string) (*File, error) {
+	return getFileByRelativePath(engine, dir, p)
+}
+
+func getFileByRelativePath(e *gorm.DB, dir *File, p string) (*File, error) {
+	p = path.Clean("/" + p)
+
+	file := dir
+	for _, name := range strings.Split(p, "/") {
+		if len(name) == 0 {
+			continue
+		}
+
+		if !file.IsDir() {
+			return nil, ErrFileNotExist{Path: p, Owner: dir.Owner}
+		}
+
+		var err error
+		file, err = getChildByName(e, file, name)
+		if err != nil {
+			if IsErrFileNotExist(err) {
+				return nil, ErrFileNotExist{Path: p, Owner: dir.Owner}
+			}
+			return nil, err
+		}
+	}
+
+	return file, nil
+}
+
 func GetFileByID(id uint, uid uint) (*File, error) {
 	return getFileByID(engine, id, uid)
 }
@@ -147,20 +250,22 @@ func createFile(e *gorm.DB, f *File) error {
 	return e.Create(f).Error
 }
 
-func DeleteFile(f *File) error {
+// DeleteFile deletes f as the user uid, a non empty etag must match f, see
+// MatchETag.
+func DeleteFile(uid uint, f *File, etag string) error {
 
 	if f.IsRoot() {
 		return ErrModifyRootFile{ID: f.ID, Owner: f.Owner}
 	}
 
-	uid := f.Owner
-	id, err := LockUserFile(context.Background(), uid)
+	owner := f.Owner
+	id, err := LockUserFile(context.Background(), owner)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		if err := UnlockUserFile(context.Background(), uid, id); err != nil {
-			log.Error("Failed to unlock user file", zap.Uint("id", f.ID), zap.Uint("uid", uid), zap.Error(err))
+		if err := UnlockUserFile(context.Background(), owner, id); err != nil {
+			log.Error("Failed to unlock user file", zap.Uint("id", f.ID), zap.Uint("uid", owner), zap.Error(err))
 		}
 	}()
 
@@ -170,43 +275,180 @@ func DeleteFile(f *File) error {
 	}
 	defer tx.RollbackUnlessCommitted()
 
+	if err := reloadFile(tx, f, etag); err != nil {
+		return err
+	}
+
+	if err := checkFileLocks(tx, f, uid); err != nil {
+		return err
+	}
+
 	if err := deleteFile(tx, f); err != nil {
 		return err
 	}
 
-	return tx.Commit().Error
+	if err := recordFileChange(tx, newFileChange(FileChangeDelete, f)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	afterFileChange(owner)
+	return nil
+}
+
+// replaceFile deletes f, which is replaced by another entry of the user uid.
+func replaceFile(e *gorm.DB, uid uint, f *File) error {
+	if err := checkFileLocks(e, f, uid); err != nil {
+		return err
+	}
+
+	if err := deleteFile(e, f); err != nil {
+		return err
+	}
+	return recordFileChange(e, newFileChange(FileChangeDelete, f))
 }
 
 func deleteFile(e *gorm.DB, f *File) error {
 
+	files := []*File{f}
 	if f.IsDir() {
-		files, err := f.ReadDir(ReadDirOption{})
+		descendants, err := getDescendants(e, f)
 		if err != nil {
 			return err
 		}
+		files = append(files, descendants...)
+	}
 
-		for _, file := range files {
-			if err := deleteFile(e, file); err != nil {
-				return err
-			}
+	if err := markFilesDeleted(e.Where("id=? OR tree_path LIKE ?", f.ID, f.ChildTreePath()+"%")); err != nil {
+		return err
+	}
+
+	var stats fileStats
+	for _, file := range files {
+		if file.IsDir() {
+			stats.Dirs++
+		} else {
+			stats.Files++
+			stats.Size += file.FileSize
 		}
 	}
 
-	if err := e.Delete(f).Error; err != nil {
+	if err := updateAncestorStats(e, f.TreePath, stats.neg()); err != nil {
 		return err
 	}
 
-	localPath := f.LocalPath()
-	if err := os.Remove(localPath); err != nil {
-		return fmt.Errorf("Failed to remove file [%s]: %v", localPath, err)
+	size := stats.Size
+	if size != 0 {
+		if err := e.Exec("UPDATE users SET used_file_capacity=used_file_capacity-? WHERE id=?", size, f.Owner).Error; err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func TryUploadFile(u *User, p *File, header *multipart.FileHeader) (*File, error) {
-	uid := u.ID
-	id, err := LockUserFile(context.Background(), u.ID)
+// markFilesDeleted marks the entries matched by db as deleted, they are
+// kept until PurgeDeletedFile removes them.
+func markFilesDeleted(db *gorm.DB) error {
+	return db.Model(&File{}).UpdateColumns(map[string]interface{}{
+		"deleted_at": time.Now(),
+		"deleted_id": gorm.Expr("id"),
+	}).Error
+}
+
+var fileChangedHooks []func(uid uint)
+
+// AddFileChangedHook registers fn to be called with the owner after a change
+// of files was committed, services use it to follow the files of a user.
+func AddFileChangedHook(fn func(uid uint)) {
+	fileChangedHooks = append(fileChangedHooks, fn)
+}
+
+func afterFileChange(uid uint) {
+	notifyFileChanges(uid)
+	for _, fn := range fileChangedHooks {
+		fn(uid)
+	}
+}
+
+// GetDeletedFiles returns the entries with an id greater than afterID which
+// were deleted before the time before, ordered by id.
+func GetDeletedFiles(before time.Time, afterID uint, limit int) ([]*File, error) {
+	files := make([]*File, 0, limit)
+	err := engine.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at<? AND id>?", before, afterID).Order("id ASC").Limit(limit).Find(&files).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return files, nil
+}
+
+// PurgeDeletedFile removes the row, the object and the references of the
+// deleted file f. deleteFile only marks rows as deleted, so deleted files
+// are kept until the sweeper purges them.
+func PurgeDeletedFile(f *File) error {
+	if f.DeletedAt == nil {
+		return fmt.Errorf("file [id: %d] is not deleted", f.ID)
+	}
+
+	if !f.IsDir() {
+		if err := storage.LFS.Delete(storage.ID(f.FileID)); err != nil && err != storage.ErrNotFound {
+			return fmt.Errorf("Failed to remove file [%s]: %v", f.FileID, err)
+		}
+	}
+
+	if err := deleteFileReferences(engine, f.ID); err != nil {
+		return err
+	}
+	return engine.Unscoped().Delete(f).Error
+}
+
+// deleteFileReferences removes the rows of other tables which refer to a
+// purged file.
+func deleteFileReferences(e *gorm.DB, fileID uint) error {
+	if err := deleteFileMetadata(e, fileID); err != nil {
+		return err
+	}
+
+	for _, bean := range []interface{}{&FileStar{}, &FileActivity{}, &ShareLink{}, &FileGrant{}, &FileLock{}, &UploadPolicy{}} {
+		if err := e.Where("file_id=?", fileID).Delete(bean).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TryUploadFile(u *User, p *File, header *multipart.FileHeader, policy ConflictPolicy, etag string, expiresAt *time.Time) (*File, error) {
+	remoteFile, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open remote file: %v", err)
+	}
+	defer remoteFile.Close()
+
+	return UploadFile(u, p, header.Filename, header.Size, remoteFile, policy, etag, expiresAt)
+}
+
+// UploadFile stores size bytes read from r as a file called name in p. u is
+// the uploader, the file belongs to and is accounted to the owner of p. A
+// non empty etag must match the entry replaced by the upload, see MatchETag.
+// A non nil expiresAt is the expiration of the file, see SetFileExpiration.
+func UploadFile(u *User, p *File, name string, size int64, r io.Reader, policy ConflictPolicy, etag string, expiresAt *time.Time) (*File, error) {
+	file, err := storeUploadFile(u, p, name, size, r, policy, etag, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// the scan runs without the lock of the owner
+	scanUploadedFile(file)
+	afterFileChange(file.Owner)
+	return file, nil
+}
+
+func storeUploadFile(u *User, p *File, name string, size int64, r io.Reader, policy ConflictPolicy, etag string, expiresAt *time.Time) (*File, error) {
+	uid := p.Owner
+	id, err := LockUserFile(context.Background(), uid)
 	if err != nil {
 		return nil, err
 	}
@@ -222,7 +464,7 @@ func TryUploadFile(u *User, p *File, header *multipart.FileHeader) (*File, error
 	}
 	defer tx.RollbackUnlessCommitted()
 
-	fid, file, err := tryUploadFile(tx, u, p, header)
+	fid, file, err := uploadFile(tx, u, p, name, size, r, policy, etag, expiresAt)
 	if err != nil {
 		if len(fid) != 0 {
 			if err := storage.LFS.Delete(storage.ID(fid)); err != nil && err != storage.ErrNotFound {
@@ -235,203 +477,597 @@ func TryUploadFile(u *User, p *File, header *multipart.FileHeader) (*File, error
 	if err := tx.Commit().Error; err != nil {
 		return nil, err
 	}
-
 	return file, nil
 }
 
-func tryUploadFile(e *gorm.DB, u *User, p *File, header *multipart.FileHeader) (string, *File, error) {
+func uploadFile(e *gorm.DB, u *User, p *File, name string, size int64, r io.Reader, policy ConflictPolicy, etag string, expiresAt *time.Time) (string, *File, error) {
+	// p may have been moved or removed since it was loaded, the new entry
+	// takes its path and statistics from the current row
+	if err := reloadFile(e, p, ""); err != nil {
+		return "", nil, err
+	}
 
 	if !p.IsDir() {
 		return "", nil, ErrFileNotDirectory{ID: p.ID, Path: p.FilePath()}
 	}
 
-	remoteFile, err := header.Open()
+	filename, replaced, err := resolveNameConflict(e, p, name, false, 0, policy)
 	if err != nil {
-		return "", nil, fmt.Errorf("Failed to open remote file: %v", err)
+		return "", nil, err
+	}
+
+	if len(etag) != 0 && (replaced == nil || !replaced.MatchETag(etag)) {
+		if replaced == nil {
+			return "", nil, ErrFileModified{}
+		}
+		return "", nil, ErrFileModified{ID: replaced.ID, Version: replaced.Version}
+	}
+
+	head := make([]byte, typesniffer.SniffLength)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+
+	contentType := typesniffer.Detect(filename, head)
+	if err := checkUploadPolicy(e, p, filename, size, contentType); err != nil {
+		return "", nil, err
 	}
-	defer remoteFile.Close()
 
 	id, err := storage.LFS.Write(&storage.Object{
-		Size:   header.Size,
-		Reader: remoteFile,
-	}, storage.WithID(u.ID))
+		Size:   size,
+		Reader: ioutil.NopCloser(io.MultiReader(bytes.NewReader(head), r)),
+	}, storage.WithID(p.Owner))
 
 	if err != nil {
 		return "", nil, err
 	}
 
+	// the replaced file is removed only after the capacity check passed,
+	// its size is released by deleteFile.
+	var freed int64
+	if replaced != nil {
+		freed = replaced.FileSize
+	}
+
+	if err := addUsedCapacity(e, p.Owner, size, freed); err != nil {
+		return string(id), nil, err
+	}
+
+	// the replaced file is journaled as updated together with the new one
+	if replaced != nil {
+		if err := checkFileLocks(e, replaced, u.ID); err != nil {
+			return string(id), nil, err
+		}
+
+		if err := deleteFile(e, replaced); err != nil {
+			return string(id), nil, err
+		}
+	}
+
 	file := &File{
-		FileID:   string(id),
-		FileDir:  p.FilePath(),
-		FileName: header.Filename,
-		FileSize: header.Size,
-		FileType: FileTypeFile,
-		Owner:    u.ID,
-		ParentID: p.ID,
+		FileID:      string(id),
+		TreePath:    p.ChildTreePath(),
+		FileDir:     p.FilePath(),
+		FileName:    filename,
+		FileSize:    size,
+		FileType:    FileTypeFile,
+		ContentType: contentType,
+		Owner:       p.Owner,
+		ParentID:    p.ID,
+		ScanStatus:  initialScanStatus(),
+		ExpiresAt:   expiresAt,
 	}
 
-	err = e.Create(file).Error
-	if err != nil {
-		return "", nil, err
+	if err := e.Create(file).Error; err != nil {
+		return string(id), nil, err
 	}
 
-	result := e.Exec("UPDATE users SET used_file_capacity=used_file_capacity+? WHERE id=? AND ((used_file_capacity + ?) <= max_file_capacity)", header.Size, u.ID, header.Size)
-	if err := result.Error; err != nil {
-		return "", nil, err
+	if err := updateAncestorStats(e, file.TreePath, fileStats{Size: size, Files: 1}); err != nil {
+		return string(id), nil, err
 	}
 
-	if result.RowsAffected == 0 {
-		return "", nil, ErrUserMaxFileCapacityLimit{UserID: u.ID}
+	change := newFileChange(FileChangeCreate, file)
+
+	// the lock of the uploader is kept on the new version of the file
+	if replaced != nil {
+		if err := e.Model(&FileLock{}).Where("file_id=?", replaced.ID).UpdateColumn("file_id", file.ID).Error; err != nil {
+			return string(id), nil, err
+		}
+		change.Type = FileChangeUpdate
+		change.OldFileID = replaced.ID
 	}
 
+	if err := recordFileChange(e, change); err != nil {
+		return string(id), nil, err
+	}
+
+	recordFileActivity(e, u.ID, file, FileActivityUpload)
+
 	return string(id), file, nil
 }
 
-func MoveFile(f *File, dir *File) error {
-	uid := f.Owner
-	id, err := LockUserFile(context.Background(), uid)
-	if err != nil {
+// addUsedCapacity adds size to the capacity used by the user uid, freed is
+// the size of the file replaced by the new one, which is released later by
+// deleteFile. It fails with ErrUserMaxFileCapacityLimit if size doesn't fit.
+func addUsedCapacity(e *gorm.DB, uid uint, size, freed int64) error {
+	result := e.Exec("UPDATE users SET used_file_capacity=used_file_capacity+? WHERE id=? AND ((used_file_capacity + ? - ?) <= max_file_capacity)", size, uid, size, freed)
+	if err := result.Error; err != nil {
 		return err
 	}
+
+	if result.RowsAffected == 0 {
+		return ErrUserMaxFileCapacityLimit{UserID: uid}
+	}
+	return nil
+}
+
+// MoveFile moves f into dir and renames it to name, an empty name keeps the
+// current one. It returns the moved entry, which is the existing directory
+// when policy is ConflictMerge and the name was taken. A non empty etag must
+// match f, see MatchETag.
+func MoveFile(uid uint, f *File, dir *File, name string, policy ConflictPolicy, etag string) (*File, error) {
+	owner := f.Owner
+	id, err := LockUserFile(context.Background(), owner)
+	if err != nil {
+		return nil, err
+	}
 	defer func() {
-		if err := UnlockUserFile(context.Background(), uid, id); err != nil {
-			log.Error("Failed to unlock user file", zap.Uint("id", uid), zap.Uint("uid", uid), zap.Error(err))
+		if err := UnlockUserFile(context.Background(), owner, id); err != nil {
+			log.Error("Failed to unlock user file", zap.Uint("id", owner), zap.Uint("uid", owner), zap.Error(err))
 		}
 	}()
 
 	tx := engine.Begin()
 	if err := tx.Error; err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.RollbackUnlessCommitted()
 
-	if err := moveFile(tx, f, dir); err != nil {
-		return err
+	file, err := moveFile(tx, uid, f, dir, name, policy, etag)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
 	}
 
-	return tx.Commit().Error
+	afterFileChange(owner)
+	return file, nil
 }
 
-func moveFile(e *gorm.DB, f *File, dir *File) error {
+func moveFile(e *gorm.DB, uid uint, f *File, dir *File, name string, policy ConflictPolicy, etag string) (*File, error) {
+	// both entries are read again under the lock of the owner, a concurrent
+	// move may have changed their paths since they were loaded
+	if err := reloadFile(e, dir, ""); err != nil {
+		return nil, err
+	}
+
+	if err := reloadFile(e, f, etag); err != nil {
+		return nil, err
+	}
+
 	if !dir.IsDir() {
-		return ErrFileParentNotDirectory{ID: dir.ID, Path: dir.FilePath()}
+		return nil, ErrFileParentNotDirectory{ID: dir.ID, Path: dir.FilePath()}
 	}
 
 	if f.IsRoot() {
-		return ErrModifyRootFile{ID: f.ID, Owner: f.Owner}
+		return nil, ErrModifyRootFile{ID: f.ID, Owner: f.Owner}
+	}
+
+	if f.ID == dir.ID || f.IsAncestorOf(dir) {
+		return nil, ErrFileMoveIntoItself{ID: f.ID, DirID: dir.ID}
 	}
 
+	// files are only moved within the tree of their owner, copyFile is the
+	// way to hand them over to someone else.
+	if f.Owner != dir.Owner {
+		return nil, ErrFilePermissionDenied{ID: dir.ID, UserID: f.Owner}
+	}
+
+	if err := checkFileLocks(e, f, uid); err != nil {
+		return nil, err
+	}
+
+	if len(name) == 0 {
+		name = f.FileName
+	}
+
+	name, exist, err := resolveNameConflict(e, dir, name, f.IsDir(), f.ID, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	// a new extension must pass the type rules as well
+	if !f.IsDir() && name != f.FileName {
+		if err := checkFileType(e, dir, name, f.MimeType()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkMovedFiles(e, f, newAncestorIDs(f.TreePath, dir.ChildTreePath())); err != nil {
+		return nil, err
+	}
+
+	if exist != nil {
+		if policy == ConflictMerge {
+			if err := mergeDirectory(e, uid, f, exist); err != nil {
+				return nil, err
+			}
+			return exist, nil
+		}
+
+		if exist.IsAncestorOf(f) {
+			return nil, ErrFileAlreadyExist{ID: exist.ID, Path: exist.FilePath(), Owner: exist.Owner, FileID: exist.FileID}
+		}
+
+		if err := replaceFile(e, uid, exist); err != nil {
+			return nil, err
+		}
+	}
+
+	stats, err := getFileStats(e, f)
+	if err != nil {
+		return nil, err
+	}
+
+	oldTreePath, oldChildTreePath, oldPath := f.TreePath, f.ChildTreePath(), f.FilePath()
+	change := newFileChange(FileChangeMove, f)
+	change.OldParentID, change.OldName, change.OldPath = f.ParentID, f.FileName, oldPath
+
 	f.ParentID = dir.ID
+	f.TreePath = dir.ChildTreePath()
 	f.FileDir = dir.FilePath()
-	if err := e.Save(f).Error; err != nil {
-		return err
+	f.FileName = name
+	f.Version++
+	if err := e.Omit("total_size", "file_count", "dir_count").Save(f).Error; err != nil {
+		return nil, err
+	}
+
+	if err := moveAncestorStats(e, oldTreePath, f.TreePath, stats); err != nil {
+		return nil, err
+	}
+
+	recordFileActivity(e, f.Owner, f, FileActivityModify)
+
+	if change.OldParentID == f.ParentID {
+		change.Type = FileChangeRename
+	}
+	change.ParentID, change.Name, change.Path = f.ParentID, f.FileName, f.FilePath()
+	if err := recordFileChange(e, change); err != nil {
+		return nil, err
 	}
 
 	if f.IsDir() {
-		files, err := f.ReadDir(ReadDirOption{})
-		if err != nil {
-			return err
+		if err := relocateDescendants(e, f, oldChildTreePath, oldPath); err != nil {
+			return nil, err
 		}
+	}
 
-		for _, file := range files {
-			if err := adjustFilepath(e, file, f); err != nil {
-				return err
-			}
+	return f, nil
+}
+
+// CopyFile copies f into dir as name, an empty name keeps the current one.
+func CopyFile(uid uint, f *File, dir *File, name string, policy ConflictPolicy) (*File, error) {
+	owner := dir.Owner
+	id, err := LockUserFile(context.Background(), owner)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := UnlockUserFile(context.Background(), owner, id); err != nil {
+			log.Error("Failed to unlock user file", zap.Uint("id", owner), zap.Uint("uid", owner), zap.Error(err))
 		}
+	}()
+
+	tx := engine.Begin()
+	if err := tx.Error; err != nil {
+		return nil, err
 	}
+	defer tx.RollbackUnlessCommitted()
 
-	return nil
+	created := make([]string, 0)
+	file, err := copyFile(tx, uid, f, dir, name, policy, &created)
+	if err == nil {
+		err = tx.Commit().Error
+	}
+
+	if err != nil {
+		removeObjects(created)
+		return nil, err
+	}
+
+	afterFileChange(owner)
+	return file, nil
 }
 
-func adjustFilepath(e *gorm.DB, f *File, p *File) error {
-	f.FileDir = p.FilePath()
-	result := e.Model(&File{}).Where("id=?", f.ID).UpdateColumns(map[string]interface{}{
-		"file_dir": f.FileDir,
-	})
+// copyFile copies f recursively, the id of every written object is appended
+// to created so that the caller can remove them if the transaction fails.
+func copyFile(e *gorm.DB, uid uint, f *File, dir *File, name string, policy ConflictPolicy, created *[]string) (*File, error) {
+	// see moveFile
+	if err := reloadFile(e, dir, ""); err != nil {
+		return nil, err
+	}
 
-	if err := result.Error; err != nil {
-		return err
+	if err := reloadFile(e, f, ""); err != nil {
+		return nil, err
+	}
+
+	if !dir.IsDir() {
+		return nil, ErrFileParentNotDirectory{ID: dir.ID, Path: dir.FilePath()}
+	}
+
+	if f.ID == dir.ID || f.IsAncestorOf(dir) {
+		return nil, ErrFileMoveIntoItself{ID: f.ID, DirID: dir.ID}
+	}
+
+	if len(name) == 0 {
+		name = f.FileName
+	}
+
+	name, exist, err := resolveNameConflict(e, dir, name, f.IsDir(), 0, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	var target, replaced *File
+	if exist != nil {
+		if policy == ConflictMerge {
+			target = exist
+		} else if exist.ID == f.ID || exist.IsAncestorOf(f) {
+			return nil, ErrFileAlreadyExist{ID: exist.ID, Path: exist.FilePath(), Owner: exist.Owner, FileID: exist.FileID}
+		} else {
+			replaced = exist
+		}
 	}
 
 	if f.IsDir() {
-		files, err := f.ReadDir(ReadDirOption{})
+		if replaced != nil {
+			if err := replaceFile(e, uid, replaced); err != nil {
+				return nil, err
+			}
+		}
+
+		if target == nil {
+			target = &File{
+				FileID:   utils.GenerateFileID(dir.Owner),
+				TreePath: dir.ChildTreePath(),
+				FileDir:  dir.FilePath(),
+				FileName: name,
+				FileType: FileTypeDir,
+				Owner:    dir.Owner,
+				ParentID: dir.ID,
+			}
+			if err := e.Create(target).Error; err != nil {
+				return nil, err
+			}
+
+			if err := updateAncestorStats(e, target.TreePath, fileStats{Dirs: 1}); err != nil {
+				return nil, err
+			}
+
+			if err := copyFileMetadata(e, f, target); err != nil {
+				return nil, err
+			}
+
+			if err := recordFileChange(e, newFileChange(FileChangeCreate, target)); err != nil {
+				return nil, err
+			}
+		}
+
+		files, err := readDir(e, f, ReadDirOption{})
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		for _, file := range files {
-			if err := adjustFilepath(e, file, f); err != nil {
-				return err
+			if _, err := copyFile(e, uid, file, target, "", ConflictMerge, created); err != nil {
+				return nil, err
 			}
 		}
+
+		// reload the statistics updated by copying the entries
+		if err := e.First(target, target.ID).Error; err != nil {
+			return nil, err
+		}
+	} else {
+		if err := checkUploadPolicy(e, dir, name, f.FileSize, f.MimeType()); err != nil {
+			return nil, err
+		}
+
+		// like an upload, the copy may take the space of the file it
+		// replaces
+		var freed int64
+		if replaced != nil {
+			freed = replaced.FileSize
+		}
+
+		if err := addUsedCapacity(e, dir.Owner, f.FileSize, freed); err != nil {
+			return nil, err
+		}
+
+		if replaced != nil {
+			if err := replaceFile(e, uid, replaced); err != nil {
+				return nil, err
+			}
+		}
+
+		obj, err := storage.LFS.Read(storage.ID(f.FileID))
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := storage.LFS.Write(&storage.Object{
+			Size:   f.FileSize,
+			Reader: obj.Reader,
+		}, storage.WithID(dir.Owner))
+		obj.Reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		*created = append(*created, string(id))
+
+		target = &File{
+			FileID:      string(id),
+			TreePath:    dir.ChildTreePath(),
+			FileDir:     dir.FilePath(),
+			FileName:    name,
+			FileSize:    f.FileSize,
+			FileType:    FileTypeFile,
+			ContentType: f.ContentType,
+			Owner:       dir.Owner,
+			ParentID:    dir.ID,
+			ScanStatus:  f.ScanStatus,
+			ScanResult:  f.ScanResult,
+		}
+		if err := e.Create(target).Error; err != nil {
+			return nil, err
+		}
+
+		if err := updateAncestorStats(e, target.TreePath, fileStats{Size: target.FileSize, Files: 1}); err != nil {
+			return nil, err
+		}
+
+		if err := copyFileMetadata(e, f, target); err != nil {
+			return nil, err
+		}
+
+		recordFileActivity(e, dir.Owner, target, FileActivityUpload)
+
+		if err := recordFileChange(e, newFileChange(FileChangeCreate, target)); err != nil {
+			return nil, err
+		}
 	}
-	return nil
+
+	return target, nil
 }
 
-func RenameFile(f *File) error {
-	uid := f.Owner
-	id, err := LockUserFile(context.Background(), uid)
+func removeObjects(ids []string) {
+	for _, id := range ids {
+		if err := storage.LFS.Delete(storage.ID(id)); err != nil && err != storage.ErrNotFound {
+			log.Error("Failed to remove file", zap.String("id", id), zap.Error(err))
+		}
+	}
+}
+
+// RenameFile renames f to name and returns the renamed entry, which is the
+// existing directory when policy is ConflictMerge and the name was taken. A
+// non empty etag must match f, see MatchETag.
+func RenameFile(uid uint, f *File, name string, policy ConflictPolicy, etag string) (*File, error) {
+	owner := f.Owner
+	id, err := LockUserFile(context.Background(), owner)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() {
-		if err := UnlockUserFile(context.Background(), uid, id); err != nil {
-			log.Error("Failed to unlock user file", zap.Uint("id", uid), zap.Uint("uid", uid), zap.Error(err))
+		if err := UnlockUserFile(context.Background(), owner, id); err != nil {
+			log.Error("Failed to unlock user file", zap.Uint("id", owner), zap.Uint("uid", owner), zap.Error(err))
 		}
 	}()
 
 	tx := engine.Begin()
 	if err := tx.Error; err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.RollbackUnlessCommitted()
 
-	if err := renameFile(tx, f); err != nil {
-		return err
+	file, err := renameFile(tx, uid, f, name, policy, etag)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
 	}
 
-	return tx.Commit().Error
+	afterFileChange(owner)
+	return file, nil
 }
 
-func renameFile(e *gorm.DB, f *File) error {
+func renameFile(e *gorm.DB, uid uint, f *File, name string, policy ConflictPolicy, etag string) (*File, error) {
 	if f.IsRoot() {
-		return ErrModifyRootFile{ID: f.ID, Owner: f.Owner}
+		return nil, ErrModifyRootFile{ID: f.ID, Owner: f.Owner}
 	}
 
-	err := e.Model(&File{}).Where("id=?", f.ID).UpdateColumns(map[string]interface{}{
-		"file_name": f.FileName,
-	}).Error
+	if err := reloadFile(e, f, etag); err != nil {
+		return nil, err
+	}
+
+	if err := checkFileLocks(e, f, uid); err != nil {
+		return nil, err
+	}
 
+	parent, err := getFileByID(e, f.ParentID, f.Owner)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if f.IsDir() {
-		files, err := f.ReadDir(ReadDirOption{})
-		if err != nil {
-			return err
+	name, exist, err := resolveNameConflict(e, parent, name, f.IsDir(), f.ID, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	if !f.IsDir() && name != f.FileName {
+		if err := checkFileType(e, parent, name, f.MimeType()); err != nil {
+			return nil, err
 		}
+	}
 
-		for _, file := range files {
-			if err := adjustFilepath(e, file, f); err != nil {
-				return err
+	if exist != nil {
+		if policy == ConflictMerge {
+			if err := mergeDirectory(e, uid, f, exist); err != nil {
+				return nil, err
 			}
+			return exist, nil
+		}
+
+		if err := replaceFile(e, uid, exist); err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	oldPath := f.FilePath()
+	change := newFileChange(FileChangeRename, f)
+	change.OldParentID, change.OldName, change.OldPath = f.ParentID, f.FileName, oldPath
+
+	f.FileName = name
+	if err := e.Model(&File{}).Where("id=?", f.ID).UpdateColumn("file_name", f.FileName).Error; err != nil {
+		return nil, err
+	}
+
+	// the listing of the parent changed as well
+	if err := touchFile(e, f); err != nil {
+		return nil, err
+	}
+
+	recordFileActivity(e, f.Owner, f, FileActivityModify)
+
+	change.Name, change.Path = f.FileName, f.FilePath()
+	if err := recordFileChange(e, change); err != nil {
+		return nil, err
+	}
+
+	if f.IsDir() {
+		if err := relocateDescendants(e, f, f.ChildTreePath(), oldPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
 
 }
 
-func CreateDirectory(parent *File, dirName string) (*File, error) {
-	uid := parent.Owner
-	id, err := LockUserFile(context.Background(), uid)
+func CreateDirectory(uid uint, parent *File, dirName string, policy ConflictPolicy) (*File, error) {
+	owner := parent.Owner
+	id, err := LockUserFile(context.Background(), owner)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
-		if err := UnlockUserFile(context.Background(), uid, id); err != nil {
-			log.Error("Failed to unlock user file", zap.Uint("id", uid), zap.Uint("uid", uid), zap.Error(err))
+		if err := UnlockUserFile(context.Background(), owner, id); err != nil {
+			log.Error("Failed to unlock user file", zap.Uint("id", owner), zap.Uint("uid", owner), zap.Error(err))
 		}
 	}()
 
@@ -441,7 +1077,7 @@ func CreateDirectory(parent *File, dirName string) (*File, error) {
 	}
 	defer tx.RollbackUnlessCommitted()
 
-	file, err := createDirectory(tx, parent, dirName)
+	file, err := createDirectory(tx, uid, parent, dirName, policy)
 	if err != nil {
 		return nil, err
 	}
@@ -449,27 +1085,34 @@ func CreateDirectory(parent *File, dirName string) (*File, error) {
 	if err := tx.Commit().Error; err != nil {
 		return nil, err
 	}
+
+	afterFileChange(owner)
 	return file, nil
 }
 
-func createDirectory(e *gorm.DB, parent *File, dirName string) (*File, error) {
+func createDirectory(e *gorm.DB, uid uint, parent *File, dirName string, policy ConflictPolicy) (*File, error) {
+	// see uploadFile
+	if err := reloadFile(e, parent, ""); err != nil {
+		return nil, err
+	}
+
 	if !parent.IsDir() {
 		return nil, ErrFileParentNotDirectory{ID: parent.ID, Path: parent.FilePath()}
 	}
 
-	var exist uint
-	err := e.Model(&File{}).Where("parent_id=? AND file_name=? AND file_type=?",
-		parent.ID, dirName, FileTypeDir).Limit(1).Count(&exist).Error
+	dirName, exist, err := resolveNameConflict(e, parent, dirName, true, 0, policy)
 	if err != nil {
 		return nil, err
 	}
 
-	if exist != 0 {
-		return nil, ErrFileAlreadyExist{Path: path.Join(parent.FilePath(), dirName), Owner: parent.Owner}
+	// an existing directory is kept with its entries instead of replacing it
+	if exist != nil {
+		return exist, nil
 	}
 
 	file := &File{
 		FileID:   utils.GenerateFileID(parent.Owner),
+		TreePath: parent.ChildTreePath(),
 		FileDir:  parent.FilePath(),
 		FileName: dirName,
 		FileSize: 0,
@@ -481,6 +1124,14 @@ func createDirectory(e *gorm.DB, parent *File, dirName string) (*File, error) {
 	if err := e.Create(file).Error; err != nil {
 		return nil, err
 	}
+
+	if err := updateAncestorStats(e, file.TreePath, fileStats{Dirs: 1}); err != nil {
+		return nil, err
+	}
+
+	if err := recordFileChange(e, newFileChange(FileChangeCreate, file)); err != nil {
+		return nil, err
+	}
 	return file, nil
 }
 
@@ -494,25 +1145,73 @@ func UnlockUserFile(ctx context.Context, uid uint, id string) error {
 	return locker.Unlock(ctx, key, id)
 }
 
+type FileMatchMode string
+
+const (
+	FileMatchExact     FileMatchMode = "exact"
+	FileMatchSubstring FileMatchMode = "substring"
+	FileMatchPrefix    FileMatchMode = "prefix"
+	FileMatchGlob      FileMatchMode = "glob"
+)
+
 type SearchFileOptions struct {
 	ListOptions
+	MetadataFilter
 	Keyword string
-	Type    FileType
-	FID     uint
-	Owner   uint
-	OrderBy SearchOrderBy
-	Actor   *File
+	// Match is how Keyword is matched against file names, substring when empty
+	Match         FileMatchMode
+	Type          FileType
+	FID           uint
+	Owner         uint
+	MinSize       sql.NullInt64
+	MaxSize       sql.NullInt64
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	// Directory limits the result to the descendants of a directory
+	Directory   *File
+	Extension   string
+	ExcludeRoot bool
+	OrderBy     SearchOrderBy
+	Actor       *File
+}
+
+// likeEscaper escapes the wildcards of LIKE, patterns use '!' as escape
+// character since backslash is treated differently by each database.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func globToLike(glob string) string {
+	var b strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteByte('%')
+		case '?':
+			b.WriteByte('_')
+		default:
+			b.WriteString(likeEscaper.Replace(string(r)))
+		}
+	}
+	return b.String()
 }
 
 func (opts *SearchFileOptions) Apply(e *gorm.DB) *gorm.DB {
-	db := e.Where("type=?", opts.Type)
+	db := e
 	if len(opts.Keyword) > 0 {
 		lowerKeyword := strings.ToLower(opts.Keyword)
-		db = db.Where("(LOWER(file_name) = ?)", lowerKeyword)
+		switch opts.Match {
+		case FileMatchExact:
+			db = db.Where("LOWER(file_name) = ?", lowerKeyword)
+		case FileMatchPrefix:
+			db = db.Where("LOWER(file_name) LIKE ? ESCAPE '!'", likeEscaper.Replace(lowerKeyword)+"%")
+		case FileMatchGlob:
+			db = db.Where("LOWER(file_name) LIKE ? ESCAPE '!'", globToLike(lowerKeyword))
+		default:
+			db = db.Where("LOWER(file_name) LIKE ? ESCAPE '!'", "%"+likeEscaper.Replace(lowerKeyword)+"%")
+		}
 	}
 
 	if opts.Type != FileTypeNone {
-		db = db.Where("type=?", opts.Type)
+		db = db.Where("file_type=?", opts.Type)
 	}
 
 	if opts.Owner != 0 {
@@ -522,7 +1221,36 @@ func (opts *SearchFileOptions) Apply(e *gorm.DB) *gorm.DB {
 	if opts.FID > 0 {
 		db = db.Where("id = ?", opts.FID)
 	}
-	return db
+
+	if opts.MinSize.Valid {
+		db = db.Where("file_size >= ?", opts.MinSize.Int64)
+	}
+
+	if opts.MaxSize.Valid {
+		db = db.Where("file_size <= ?", opts.MaxSize.Int64)
+	}
+
+	if !opts.UpdatedAfter.IsZero() {
+		db = db.Where("updated_at >= ?", opts.UpdatedAfter)
+	}
+
+	if !opts.UpdatedBefore.IsZero() {
+		db = db.Where("updated_at <= ?", opts.UpdatedBefore)
+	}
+
+	if opts.Directory != nil {
+		db = db.Where("tree_path LIKE ?", opts.Directory.ChildTreePath()+"%")
+	}
+
+	if len(opts.Extension) > 0 {
+		ext := strings.ToLower(strings.TrimPrefix(opts.Extension, "."))
+		db = db.Where("file_type=? AND LOWER(file_name) LIKE ? ESCAPE '!'", FileTypeFile, "%."+likeEscaper.Replace(ext))
+	}
+
+	if opts.ExcludeRoot {
+		db = db.Where("parent_id <> 0")
+	}
+	return opts.MetadataFilter.apply(db)
 }
 
 func SearchFile(opts *SearchFileOptions) (files []*File, _ int64, _ error) {
@@ -536,12 +1264,12 @@ func SearchFile(opts *SearchFileOptions) (files []*File, _ int64, _ error) {
 	}
 
 	if len(opts.OrderBy) == 0 {
-		opts.OrderBy = SearchOrderByAlphabetically
+		opts.OrderBy = SearchOrderByFileName
 	}
 
 	db = engine.Model(&File{})
 	db = opts.Apply(db)
-	db = db.Order(opts.OrderBy.String())
+	db = db.Order(opts.OrderBy.String()).Order("id ASC")
 	if opts.Page != 0 {
 		db = opts.SetEnginePagination(db)
 	}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+type FileActivityType string
+
+const (
+	FileActivityUpload   FileActivityType = "upload"
+	FileActivityDownload FileActivityType = "download"
+	FileActivityModify   FileActivityType = "modify"
+)
+
+// FileActivity is the latest access of a user to a file, it feeds the
+// recent files of the user.
+type FileActivity struct {
+	ID         uint `gorm:"primary_key"`
+	UserID     uint `gorm:"unique_index:idx_file_activity_user_file"`
+	FileID     uint `gorm:"unique_index:idx_file_activity_user_file;index"`
+	Type       FileActivityType
+	AccessedAt time.Time `gorm:"index"`
+}
+
+// RecordFileActivity records that the user uid accessed f.
+func RecordFileActivity(uid uint, f *File, typ FileActivityType) error {
+	return upsertFileActivity(engine, uid, f, typ)
+}
+
+// recordFileActivity records the activity within the transaction e of a file
+// operation. Failures are only logged, the savepoint keeps the transaction
+// usable on databases which abort it on errors.
+func recordFileActivity(e *gorm.DB, uid uint, f *File, typ FileActivityType) {
+	if err := e.Exec("SAVEPOINT file_activity").Error; err != nil {
+		log.Error("Failed to record file activity", zap.Uint("uid", uid), zap.Uint("file", f.ID), zap.Error(err))
+		return
+	}
+
+	if err := upsertFileActivity(e, uid, f, typ); err != nil {
+		log.Error("Failed to record file activity", zap.Uint("uid", uid), zap.Uint("file", f.ID), zap.Error(err))
+		if err := e.Exec("ROLLBACK TO SAVEPOINT file_activity").Error; err != nil {
+			log.Error("Failed to roll back file activity", zap.Uint("uid", uid), zap.Uint("file", f.ID), zap.Error(err))
+		}
+		return
+	}
+
+	if err := e.Exec("RELEASE SAVEPOINT file_activity").Error; err != nil {
+		log.Error("Failed to release file activity savepoint", zap.Uint("uid", uid), zap.Uint("file", f.ID), zap.Error(err))
+	}
+}
+
+// upsertFileActivity reads the existing activity first, the affected rows of
+// an update can't tell whether it exists as MySQL doesn't count rows which
+// are left unchanged.
+func upsertFileActivity(e *gorm.DB, uid uint, f *File, typ FileActivityType) error {
+	activity := &FileActivity{}
+	err := e.Where("user_id=? AND file_id=?", uid, f.ID).First(activity).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	activity.UserID, activity.FileID = uid, f.ID
+	activity.Type, activity.AccessedAt = typ, time.Now()
+	if activity.ID == 0 {
+		return e.Create(activity).Error
+	}
+	return e.Save(activity).Error
+}
+
+// GetRecentFiles returns the files accessed by the user uid, the latest
+// accessed first. An empty typ returns all kinds of access.
+func GetRecentFiles(uid uint, typ FileActivityType, opts ListOptions) ([]*File, int64, error) {
+	join := "JOIN file_activities ON file_activities.file_id = files.id AND file_activities.user_id = ?"
+	args := []interface{}{uid}
+	if len(typ) != 0 {
+		join += " AND file_activities.type = ?"
+		args = append(args, typ)
+	}
+
+	var count int64
+	if err := engine.Model(&File{}).Joins(join, args...).Count(&count).Error; err != nil {
+		return nil, 0, fmt.Errorf("Count: %v", err)
+	}
+
+	db := engine.Joins(join, args...).Order("file_activities.accessed_at DESC").Order("files.id ASC")
+	if opts.Page != 0 {
+		db = opts.SetEnginePagination(db)
+	}
+
+	files := make([]*File, 0, opts.PageSize)
+	if err := db.Find(&files).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, 0, err
+	}
+	return files, count, nil
+}
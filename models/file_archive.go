@@ -0,0 +1,87 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+type ArchiveEntry struct {
+	Path string
+	File *File
+}
+
+// GetArchiveEntries lists files together with the content of the directories
+// among them, sorted so that a directory comes before its content. Entries
+// are named relative to the directory containing the selected file, files
+// which are already part of a selected directory are skipped. It also returns
+// the total size of the listed files.
+func GetArchiveEntries(files []*File) ([]*ArchiveEntry, int64, error) {
+	selected := make([]*File, 0, len(files))
+	seen := make(map[uint]bool)
+	for _, f := range files {
+		if seen[f.ID] {
+			continue
+		}
+		seen[f.ID] = true
+
+		covered := false
+		for _, o := range files {
+			if o.IsDir() && o.IsAncestorOf(f) {
+				covered = true
+				break
+			}
+		}
+
+		if !covered {
+			selected = append(selected, f)
+		}
+	}
+
+	var size int64
+	names := make(map[string]bool)
+	entries := make([]*ArchiveEntry, 0, len(selected))
+	for _, f := range selected {
+		if !f.IsDir() {
+			size += f.FileSize
+			entries = append(entries, &ArchiveEntry{Path: uniqueEntryName(names, f.FileName), File: f})
+			continue
+		}
+
+		var name string
+		if !f.IsRoot() {
+			name = uniqueEntryName(names, f.FileName)
+			entries = append(entries, &ArchiveEntry{Path: name, File: f})
+		}
+
+		descendants, err := getDescendants(engine, f)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		prefix := f.FilePath()
+		for _, d := range descendants {
+			size += d.FileSize
+			rel := strings.TrimPrefix(strings.TrimPrefix(d.FilePath(), prefix), "/")
+			entries = append(entries, &ArchiveEntry{Path: path.Join(name, rel), File: d})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	return entries, size, nil
+}
+
+func uniqueEntryName(names map[string]bool, name string) string {
+	candidate := name
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; names[candidate]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	names[candidate] = true
+	return candidate
+}
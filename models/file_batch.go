@@ -0,0 +1,212 @@
+package models
+
+import (
+	"context"
+	"sort"
+
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+type BatchOperationType string
+
+const (
+	BatchOperationDelete BatchOperationType = "delete"
+	BatchOperationMove   BatchOperationType = "move"
+	BatchOperationCopy   BatchOperationType = "copy"
+	BatchOperationRename BatchOperationType = "rename"
+)
+
+type BatchOperation struct {
+	Type        BatchOperationType
+	FileID      uint
+	DirectoryID uint
+	Name        string
+	Conflict    ConflictPolicy
+	// ETag must match the file if it isn't empty, see MatchETag
+	ETag string
+}
+
+type BatchResult struct {
+	// Before is the file as it was before the operation
+	Before *File
+	File   *File
+	Err    error
+}
+
+// BatchFiles runs ops as the user uid on the files uid has access to, under
+// the locks of their owners and a single transaction. In atomic mode the
+// first failure rolls back every operation, otherwise each operation is
+// isolated by a savepoint and failures are only reported in the result of
+// the operation.
+func BatchFiles(uid uint, ops []*BatchOperation, atomic bool) ([]*BatchResult, error) {
+	owners, err := getBatchOwners(uid, ops)
+	if err != nil {
+		return nil, err
+	}
+
+	// the locks are taken in the order of the owners, so concurrent batches
+	// can't wait for each other
+	for _, owner := range owners {
+		id, err := LockUserFile(context.Background(), owner)
+		if err != nil {
+			return nil, err
+		}
+		defer func(owner uint) {
+			if err := UnlockUserFile(context.Background(), owner, id); err != nil {
+				log.Error("Failed to unlock user file", zap.Uint("uid", owner), zap.Error(err))
+			}
+		}(owner)
+	}
+
+	tx := engine.Begin()
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	created := make([]string, 0)
+	results := make([]*BatchResult, len(ops))
+	failed := -1
+
+	for i, op := range ops {
+		if !atomic {
+			if err := tx.Exec("SAVEPOINT batch_operation").Error; err != nil {
+				removeObjects(created)
+				return nil, err
+			}
+		}
+
+		opCreated := make([]string, 0)
+		results[i] = executeBatchOperation(tx, uid, op, &opCreated)
+		err := results[i].Err
+
+		if err == nil {
+			created = append(created, opCreated...)
+			if !atomic {
+				if err := tx.Exec("RELEASE SAVEPOINT batch_operation").Error; err != nil {
+					removeObjects(created)
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		removeObjects(opCreated)
+		if atomic {
+			failed = i
+			break
+		}
+
+		if err := tx.Exec("ROLLBACK TO SAVEPOINT batch_operation").Error; err != nil {
+			removeObjects(created)
+			return nil, err
+		}
+	}
+
+	if failed >= 0 {
+		removeObjects(created)
+		for i := range results {
+			if i != failed {
+				results[i] = &BatchResult{Err: ErrBatchOperationAborted{Index: i, FailedIndex: failed}}
+			}
+		}
+		return results, nil
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		removeObjects(created)
+		return nil, err
+	}
+
+	for _, owner := range owners {
+		afterFileChange(owner)
+	}
+	return results, nil
+}
+
+// getBatchOwners returns the owners of the entries of ops together with uid,
+// whose root is the directory of an id of 0, in ascending order. Entries
+// which don't exist fail in their operation.
+func getBatchOwners(uid uint, ops []*BatchOperation) ([]uint, error) {
+	ids := make([]uint, 0, 2*len(ops))
+	for _, op := range ops {
+		ids = append(ids, op.FileID)
+		if op.DirectoryID != 0 {
+			ids = append(ids, op.DirectoryID)
+		}
+	}
+
+	owners := make([]uint, 0)
+	if err := engine.Model(&File{}).Where("id IN (?)", ids).Pluck("DISTINCT owner", &owners).Error; err != nil {
+		return nil, err
+	}
+
+	found := false
+	for _, owner := range owners {
+		found = found || owner == uid
+	}
+	if !found {
+		owners = append(owners, uid)
+	}
+
+	sort.Slice(owners, func(i, j int) bool {
+		return owners[i] < owners[j]
+	})
+	return owners, nil
+}
+
+func executeBatchOperation(e *gorm.DB, uid uint, op *BatchOperation, created *[]string) *BatchResult {
+	// copies only read their source
+	perm := FilePermissionWrite
+	if op.Type == BatchOperationCopy {
+		perm = FilePermissionRead
+	}
+
+	file, err := getAccessibleFile(e, op.FileID, uid, perm)
+	if err != nil {
+		return &BatchResult{Err: err}
+	}
+
+	// the file is read under the locks of the batch, so it is current
+	if len(op.ETag) != 0 && !file.MatchETag(op.ETag) {
+		return &BatchResult{Err: ErrFileModified{ID: file.ID, Version: file.Version}}
+	}
+
+	before := *file
+	result := &BatchResult{Before: &before}
+	result.File, result.Err = executeBatchFileOperation(e, uid, op, file, created)
+	return result
+}
+
+func executeBatchFileOperation(e *gorm.DB, uid uint, op *BatchOperation, file *File, created *[]string) (*File, error) {
+	switch op.Type {
+	case BatchOperationDelete:
+		if file.IsRoot() {
+			return nil, ErrModifyRootFile{ID: file.ID, Owner: file.Owner}
+		}
+		if err := checkFileLocks(e, file, uid); err != nil {
+			return nil, err
+		}
+		if err := deleteFile(e, file); err != nil {
+			return nil, err
+		}
+		return nil, recordFileChange(e, newFileChange(FileChangeDelete, file))
+	case BatchOperationRename:
+		return renameFile(e, uid, file, op.Name, op.Conflict, "")
+	case BatchOperationMove, BatchOperationCopy:
+		dir, err := getAccessibleFile(e, op.DirectoryID, uid, FilePermissionWrite)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Type == BatchOperationCopy {
+			return copyFile(e, uid, file, dir, op.Name, op.Conflict, created)
+		}
+
+		return moveFile(e, uid, file, dir, op.Name, op.Conflict, "")
+	}
+
+	return nil, ErrBatchOperationUnknown{Type: op.Type}
+}
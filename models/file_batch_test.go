@@ -0,0 +1,122 @@
+package models
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchFiles(t *testing.T) {
+	type op struct {
+		typ  BatchOperationType
+		file string
+		dir  string
+		name string
+	}
+
+	cases := []struct {
+		desc   string
+		atomic bool
+		ops    []op
+		errs   []func(error) bool
+		paths  []string
+		used   int64
+	}{
+		{
+			desc:   "all succeed",
+			atomic: true,
+			ops:    []op{{BatchOperationRename, "/a.txt", "", "c.txt"}, {BatchOperationMove, "/b.txt", "/dir", ""}},
+			errs:   []func(error) bool{nil, nil},
+			paths:  []string{"/big", "/big/1.txt", "/big/2.txt", "/c.txt", "/dir", "/dir/b.txt"},
+			used:   1002,
+		},
+		{
+			desc:   "atomic failure rolls back every operation",
+			atomic: true,
+			ops:    []op{{BatchOperationRename, "/a.txt", "", "c.txt"}, {BatchOperationRename, "/b.txt", "", "c.txt"}, {BatchOperationDelete, "/dir", "", ""}},
+			errs:   []func(error) bool{IsErrBatchOperationAborted, IsErrFileAlreadyExist, IsErrBatchOperationAborted},
+			paths:  []string{"/a.txt", "/b.txt", "/big", "/big/1.txt", "/big/2.txt", "/dir"},
+			used:   1002,
+		},
+		{
+			desc:   "failures only roll back their operation",
+			atomic: false,
+			ops:    []op{{BatchOperationRename, "/a.txt", "", "c.txt"}, {BatchOperationRename, "/b.txt", "", "c.txt"}, {BatchOperationDelete, "/dir", "", ""}},
+			errs:   []func(error) bool{nil, IsErrFileAlreadyExist, nil},
+			paths:  []string{"/b.txt", "/big", "/big/1.txt", "/big/2.txt", "/c.txt"},
+			used:   1002,
+		},
+		{
+			// the first file of the directory fits, the second one doesn't
+			desc:   "partial copy is rolled back to the savepoint",
+			atomic: false,
+			ops:    []op{{BatchOperationCopy, "/big", "/dir", ""}, {BatchOperationCopy, "/a.txt", "/dir", ""}},
+			errs:   []func(error) bool{IsErrFileMaxSizeLimit, nil},
+			paths:  []string{"/a.txt", "/b.txt", "/big", "/big/1.txt", "/big/2.txt", "/dir", "/dir/a.txt"},
+			used:   1003,
+		},
+		{
+			desc:   "missing files fail their operation",
+			atomic: false,
+			ops:    []op{{BatchOperationDelete, "/missing", "", ""}, {BatchOperationDelete, "/b.txt", "", ""}},
+			errs:   []func(error) bool{IsErrFileNotExist, nil},
+			paths:  []string{"/a.txt", "/big", "/big/1.txt", "/big/2.txt", "/dir"},
+			used:   1001,
+		},
+	}
+
+	for _, c := range cases {
+		u, root := newTestUser(t)
+		uploadTestFile(t, u, root, "a.txt", "a")
+		uploadTestFile(t, u, root, "b.txt", "b")
+		createTestDir(t, u, root, "dir")
+		big := createTestDir(t, u, root, "big")
+		uploadTestFile(t, u, big, "1.txt", string(make([]byte, 500)))
+		uploadTestFile(t, u, big, "2.txt", string(make([]byte, 500)))
+		if err := engine.Model(u).UpdateColumn("max_file_capacity", 1600).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		ops := make([]*BatchOperation, len(c.ops))
+		for i, o := range c.ops {
+			// 0 would be the root, missing files get an unused id
+			ops[i] = &BatchOperation{Type: o.typ, FileID: 1 << 30, Name: o.name, Conflict: ConflictReject}
+			if f, err := GetFileByPath(u.ID, o.file); err == nil {
+				ops[i].FileID = f.ID
+			}
+			if len(o.dir) != 0 {
+				ops[i].DirectoryID = getTestFile(t, u, o.dir).ID
+			}
+		}
+
+		results, err := BatchFiles(u.ID, ops, c.atomic)
+		if !assert.NoError(t, err, c.desc) {
+			continue
+		}
+
+		for i, is := range c.errs {
+			if is == nil {
+				assert.NoError(t, results[i].Err, "%s: %d", c.desc, i)
+			} else {
+				assert.True(t, is(results[i].Err), "%s: %d: %v", c.desc, i, results[i].Err)
+			}
+		}
+
+		files := make([]*File, 0)
+		if err := engine.Where("owner=? AND parent_id<>0", u.ID).Find(&files).Error; err != nil {
+			t.Fatal(err)
+		}
+		paths := make([]string, len(files))
+		for i, f := range files {
+			paths[i] = f.FilePath()
+		}
+		sort.Strings(paths)
+		assert.Equal(t, c.paths, paths, c.desc)
+
+		used, err := GetUserByID(u.ID)
+		assert.NoError(t, err, c.desc)
+		assert.Equal(t, c.used, used.UsedFileCapacity, c.desc)
+		assertDirectoryStats(t, u, c.desc)
+	}
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/jinzhu/gorm"
+)
+
+type FileChangeType string
+
+const (
+	FileChangeCreate FileChangeType = "create"
+	// FileChangeUpdate replaces the file OldFileID by FileID at the same path
+	FileChangeUpdate FileChangeType = "update"
+	FileChangeMove   FileChangeType = "move"
+	FileChangeRename FileChangeType = "rename"
+	// FileChangeDelete of a directory implies the deletion of its entries
+	FileChangeDelete FileChangeType = "delete"
+)
+
+// fileChangePruneInterval is the number of changes of a user between two
+// removals of expired changes.
+const fileChangePruneInterval = 100
+
+// FileChange is an entry of the change journal of the files of a user. Seq
+// numbers the changes of every user without gaps, so that a client which
+// missed changes that were pruned already can be told to start over.
+type FileChange struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+
+	Owner       uint  `gorm:"unique_index:idx_file_change_owner_seq"`
+	Seq         int64 `gorm:"unique_index:idx_file_change_owner_seq"`
+	Type        FileChangeType
+	FileID      uint
+	OldFileID   uint
+	IsDir       bool
+	ParentID    uint
+	OldParentID uint
+	Name        string
+	OldName     string
+	Path        string
+	OldPath     string
+	// Dispatched is set once the change was handed to the webhooks
+	Dispatched bool `gorm:"index"`
+}
+
+func newFileChange(typ FileChangeType, f *File) *FileChange {
+	return &FileChange{
+		Owner:    f.Owner,
+		Type:     typ,
+		FileID:   f.ID,
+		IsDir:    f.IsDir(),
+		ParentID: f.ParentID,
+		Name:     f.FileName,
+		Path:     f.FilePath(),
+	}
+}
+
+// recordFileChange appends c to the journal of its owner, the caller must
+// hold the lock of the files of the owner.
+func recordFileChange(e *gorm.DB, c *FileChange) error {
+	seq, err := getLatestFileChangeSeq(e, c.Owner)
+	if err != nil {
+		return err
+	}
+
+	c.Seq = seq + 1
+	if err := e.Create(c).Error; err != nil {
+		return err
+	}
+
+	if c.Seq%fileChangePruneInterval == 0 && setting.Service.FileChangeRetention > 0 {
+		// the latest change is always kept, it carries the sequence on
+		before := time.Now().Add(-setting.Service.FileChangeRetention)
+		if err := e.Where("owner=? AND seq<? AND created_at<?", c.Owner, c.Seq, before).Delete(&FileChange{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getLatestFileChangeSeq(e *gorm.DB, owner uint) (int64, error) {
+	var latest struct {
+		Seq int64
+	}
+	if err := e.Model(&FileChange{}).Select("COALESCE(MAX(seq), 0) AS seq").Where("owner=?", owner).Scan(&latest).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return 0, err
+	}
+	return latest.Seq, nil
+}
+
+// GetLatestFileChangeSeq returns the cursor of the latest change of the
+// files of the user owner.
+func GetLatestFileChangeSeq(owner uint) (int64, error) {
+	return getLatestFileChangeSeq(engine, owner)
+}
+
+// GetFileChanges returns at most limit changes of the files of the user
+// owner after the cursor seq. It fails with ErrFileChangeCursorExpired if
+// changes after seq were pruned already or seq is unknown.
+func GetFileChanges(owner uint, seq int64, limit int) ([]*FileChange, error) {
+	latest, err := getLatestFileChangeSeq(engine, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	if seq < 0 || seq > latest {
+		return nil, ErrFileChangeCursorExpired{Owner: owner, Seq: seq}
+	}
+
+	changes := make([]*FileChange, 0, limit)
+	err = engine.Where("owner=? AND seq>?", owner, seq).Order("seq ASC").Limit(limit).Find(&changes).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	if seq < latest && (len(changes) == 0 || changes[0].Seq != seq+1) {
+		return nil, ErrFileChangeCursorExpired{Owner: owner, Seq: seq}
+	}
+	return changes, nil
+}
+
+// GetUndispatchedFileChanges returns at most limit changes of the files of
+// the user owner which weren't handed to the webhooks yet, the oldest first.
+func GetUndispatchedFileChanges(owner uint, limit int) ([]*FileChange, error) {
+	changes := make([]*FileChange, 0, limit)
+	err := engine.Where("owner=? AND dispatched=?", owner, false).Order("seq ASC").Limit(limit).Find(&changes).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// SetFileChangesDispatched marks the changes of the files of the user owner
+// up to seq as handed to the webhooks.
+func SetFileChangesDispatched(owner uint, seq int64) error {
+	return engine.Model(&FileChange{}).Where("owner=? AND seq<=? AND dispatched=?", owner, seq, false).UpdateColumn("dispatched", true).Error
+}
+
+var fileChangeWaiters = struct {
+	sync.Mutex
+	chans map[uint]chan struct{}
+}{chans: make(map[uint]chan struct{})}
+
+// WatchFileChanges returns a channel which is closed by the next change of
+// the files of the user owner. Only changes made by this process are seen.
+func WatchFileChanges(owner uint) <-chan struct{} {
+	fileChangeWaiters.Lock()
+	defer fileChangeWaiters.Unlock()
+
+	ch, ok := fileChangeWaiters.chans[owner]
+	if !ok {
+		ch = make(chan struct{})
+		fileChangeWaiters.chans[owner] = ch
+	}
+	return ch
+}
+
+func notifyFileChanges(owner uint) {
+	fileChangeWaiters.Lock()
+	if ch, ok := fileChangeWaiters.chans[owner]; ok {
+		close(ch)
+		delete(fileChangeWaiters.chans, owner)
+	}
+	fileChangeWaiters.Unlock()
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// FileChangeCursor is the position of a background service in the change
+// journal of the files of a user, see GetFileChanges.
+type FileChangeCursor struct {
+	ID       uint   `gorm:"primary_key"`
+	Owner    uint   `gorm:"unique_index:idx_file_change_cursor_owner_consumer"`
+	Consumer string `gorm:"unique_index:idx_file_change_cursor_owner_consumer"`
+	Seq      int64
+}
+
+// GetFileChangeCursor returns the position of consumer in the journal of
+// the user owner, ok is false if consumer didn't follow it yet.
+func GetFileChangeCursor(owner uint, consumer string) (seq int64, ok bool, err error) {
+	cursor := &FileChangeCursor{}
+	if err := engine.Where("owner=? AND consumer=?", owner, consumer).First(cursor).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return cursor.Seq, true, nil
+}
+
+// SetFileChangeCursor moves consumer to seq in the journal of the user owner.
+func SetFileChangeCursor(owner uint, consumer string, seq int64) error {
+	return engine.Where(FileChangeCursor{Owner: owner, Consumer: consumer}).
+		Assign(FileChangeCursor{Seq: seq}).FirstOrCreate(&FileChangeCursor{}).Error
+}
+
+// GetChangedFileIDs returns the ids of the files created, replaced or
+// deleted by changes, including the files below deleted directories.
+// Moving and renaming keeps the ids, so those changes are left out.
+func GetChangedFileIDs(changes []*FileChange) ([]uint, error) {
+	seen := make(map[uint]bool)
+	ids := make([]uint, 0, len(changes))
+	add := func(id uint) {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	for _, c := range changes {
+		switch {
+		case !c.IsDir:
+			add(c.FileID)
+			add(c.OldFileID)
+		case c.Type == FileChangeDelete:
+			// the entries below are deleted along with the directory and
+			// keep their tree path until they are purged
+			dir := &File{}
+			if err := engine.Unscoped().Where("id=?", c.FileID).First(dir).Error; err != nil {
+				if gorm.IsRecordNotFoundError(err) {
+					continue
+				}
+				return nil, err
+			}
+
+			descendants := make([]uint, 0)
+			if err := engine.Unscoped().Model(&File{}).Where("tree_path LIKE ? AND file_type=?", dir.ChildTreePath()+"%", FileTypeFile).
+				Pluck("id", &descendants).Error; err != nil {
+				return nil, err
+			}
+			for _, id := range descendants {
+				add(id)
+			}
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileChangeJournal(t *testing.T) {
+	u, root := newTestUser(t)
+	dir := createTestDir(t, u, root, "dir")
+	f := uploadTestFile(t, u, root, "f.txt", "f")
+	g, err := UploadFile(u, root, "f.txt", 2, strings.NewReader("ff"), ConflictOverwrite, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MoveFile(u.ID, g, dir, "", ConflictReject, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RenameFile(u.ID, g, "g.txt", ConflictReject, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteFile(u.ID, dir, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// the journals of other users are numbered on their own
+	other, otherRoot := newTestUser(t)
+	uploadTestFile(t, other, otherRoot, "other.txt", "o")
+
+	changes, err := GetFileChanges(u.ID, 0, 100)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	want := []FileChange{
+		{Seq: 1, Type: FileChangeCreate, FileID: dir.ID, IsDir: true, ParentID: root.ID, Name: "dir", Path: "/dir"},
+		{Seq: 2, Type: FileChangeCreate, FileID: f.ID, ParentID: root.ID, Name: "f.txt", Path: "/f.txt"},
+		{Seq: 3, Type: FileChangeUpdate, FileID: g.ID, OldFileID: f.ID, ParentID: root.ID, Name: "f.txt", Path: "/f.txt"},
+		{Seq: 4, Type: FileChangeMove, FileID: g.ID, ParentID: dir.ID, OldParentID: root.ID, Name: "f.txt", OldName: "f.txt", Path: "/dir/f.txt", OldPath: "/f.txt"},
+		{Seq: 5, Type: FileChangeRename, FileID: g.ID, ParentID: dir.ID, OldParentID: dir.ID, Name: "g.txt", OldName: "f.txt", Path: "/dir/g.txt", OldPath: "/dir/f.txt"},
+		{Seq: 6, Type: FileChangeDelete, FileID: dir.ID, IsDir: true, ParentID: root.ID, Name: "dir", Path: "/dir"},
+	}
+	if !assert.Len(t, changes, len(want)) {
+		return
+	}
+	for i, c := range changes {
+		got := FileChange{
+			Seq: c.Seq, Type: c.Type, FileID: c.FileID, OldFileID: c.OldFileID, IsDir: c.IsDir,
+			ParentID: c.ParentID, OldParentID: c.OldParentID, Name: c.Name, OldName: c.OldName, Path: c.Path, OldPath: c.OldPath,
+		}
+		assert.Equal(t, want[i], got, "change %d", i+1)
+	}
+
+	otherChanges, err := GetFileChanges(other.ID, 0, 100)
+	if assert.NoError(t, err) && assert.Len(t, otherChanges, 1) {
+		assert.Equal(t, int64(1), otherChanges[0].Seq)
+	}
+
+	cursors := []struct {
+		seq     int64
+		limit   int
+		seqs    []int64
+		expired bool
+	}{
+		{seq: 0, limit: 2, seqs: []int64{1, 2}},
+		{seq: 4, limit: 10, seqs: []int64{5, 6}},
+		{seq: 6, limit: 10, seqs: []int64{}},
+		{seq: 7, limit: 10, expired: true},
+		{seq: -1, limit: 10, expired: true},
+	}
+	for _, c := range cursors {
+		changes, err := GetFileChanges(u.ID, c.seq, c.limit)
+		if c.expired {
+			assert.True(t, IsErrFileChangeCursorExpired(err), "cursor %d: %v", c.seq, err)
+			continue
+		}
+		if assert.NoError(t, err, "cursor %d", c.seq) {
+			seqs := make([]int64, len(changes))
+			for i := range changes {
+				seqs[i] = changes[i].Seq
+			}
+			assert.Equal(t, c.seqs, seqs, "cursor %d", c.seq)
+		}
+	}
+
+	// cursors before pruned changes can't be followed anymore
+	if err := engine.Where("owner=? AND seq<=?", u.ID, 3).Delete(&FileChange{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, seq := range []int64{0, 2} {
+		_, err := GetFileChanges(u.ID, seq, 10)
+		assert.True(t, IsErrFileChangeCursorExpired(err), "cursor %d: %v", seq, err)
+	}
+	changes, err = GetFileChanges(u.ID, 3, 10)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 3)
+
+	// new changes go on from the latest one
+	uploadTestFile(t, u, root, "h.txt", "h")
+	seq, err := GetLatestFileChangeSeq(u.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), seq)
+}
@@ -0,0 +1,207 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ConflictPolicy decides what happens when the target directory already
+// contains an entry with the same name.
+type ConflictPolicy string
+
+const (
+	// ConflictReject fails the operation with ErrFileAlreadyExist.
+	ConflictReject ConflictPolicy = "reject"
+	// ConflictOverwrite replaces the existing entry, both sides must have the
+	// same type. A directory being created keeps an existing directory.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictRename picks the first free name like "name (1).txt".
+	ConflictRename ConflictPolicy = "rename"
+	// ConflictMerge merges two directories, conflicts inside them are rejected.
+	ConflictMerge ConflictPolicy = "merge"
+)
+
+// getChildByName returns the entry called name in parent. The owner is part
+// of the lookup since the root directories of all users have the same parent.
+func getChildByName(e *gorm.DB, parent *File, name string) (*File, error) {
+	file := new(File)
+	err := e.Where("parent_id=? AND owner=? AND file_name=?", parent.ID, parent.Owner, name).First(file).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrFileNotExist{Path: name}
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func isFileNameUsed(e *gorm.DB, parent *File, name string) (bool, error) {
+	var count int64
+	err := e.Model(&File{}).Where("parent_id=? AND owner=? AND file_name=?", parent.ID, parent.Owner, name).Limit(1).Count(&count).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return false, err
+	}
+	return count != 0, nil
+}
+
+// availableFileName returns the first name in the form "name (n).ext"
+// which is not used in parent.
+func availableFileName(e *gorm.DB, parent *File, name string) (string, error) {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if len(base) == 0 {
+		base, ext = name, ""
+	}
+
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		used, err := isFileNameUsed(e, parent, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !used {
+			return candidate, nil
+		}
+	}
+}
+
+// resolveNameConflict looks for an entry called name in parent, ignoring the
+// entry excludeID, and applies policy to it. It returns the name the entry
+// should be stored with. The returned file is the existing entry which must
+// be replaced (ConflictOverwrite) or merged into (ConflictMerge).
+func resolveNameConflict(e *gorm.DB, parent *File, name string, isDir bool, excludeID uint, policy ConflictPolicy) (string, *File, error) {
+	exist, err := getChildByName(e, parent, name)
+	if err != nil {
+		if IsErrFileNotExist(err) {
+			return name, nil, nil
+		}
+		return "", nil, err
+	}
+
+	if exist.ID == excludeID {
+		return name, nil, nil
+	}
+
+	switch policy {
+	case ConflictOverwrite:
+		if exist.IsDir() == isDir {
+			return name, exist, nil
+		}
+	case ConflictRename:
+		newName, err := availableFileName(e, parent, name)
+		if err != nil {
+			return "", nil, err
+		}
+		return newName, nil, nil
+	case ConflictMerge:
+		if isDir && exist.IsDir() {
+			return name, exist, nil
+		}
+	}
+
+	return "", nil, ErrFileAlreadyExist{ID: exist.ID, Path: exist.FilePath(), Owner: exist.Owner, FileID: exist.FileID}
+}
+
+// mergeDirectory moves every entry of src into dst and removes src, dst is
+// reloaded with its new statistics.
+func mergeDirectory(e *gorm.DB, uid uint, src *File, dst *File) error {
+	files, err := readDir(e, src, ReadDirOption{})
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if _, err := moveFile(e, uid, file, dst, "", ConflictMerge, ""); err != nil {
+			return err
+		}
+	}
+
+	// src is empty by now, only the directory itself is left to remove
+	if err := updateAncestorStats(e, src.TreePath, fileStats{Dirs: -1}); err != nil {
+		return err
+	}
+
+	if err := markFilesDeleted(e.Where("id=?", src.ID)); err != nil {
+		return err
+	}
+
+	if err := recordFileChange(e, newFileChange(FileChangeDelete, src)); err != nil {
+		return err
+	}
+	return e.First(dst, dst.ID).Error
+}
+
+// AddFileNameUniqueIndex makes the names of the entries of a directory
+// unique. Entries which got the same name before are renamed like with
+// ConflictRename, the oldest one keeps its name. The owner is part of the
+// index since the root directories of all users have the same parent.
+func AddFileNameUniqueIndex(e *gorm.DB) error {
+	// entries from before deleted_id have it NULL, which the index ignores
+	var nulls int
+	if err := e.Unscoped().Model(&File{}).Where("deleted_id IS NULL").Count(&nulls).Error; err != nil {
+		return err
+	}
+
+	if e.Dialect().HasIndex("files", "uix_file_parent_name") {
+		if nulls == 0 {
+			return nil
+		}
+
+		// the index is built again once the duplicates among these entries
+		// are renamed
+		if err := e.Model(&File{}).RemoveIndex("uix_file_parent_name").Error; err != nil {
+			return err
+		}
+	}
+
+	if err := e.Exec("UPDATE files SET deleted_id=0 WHERE deleted_at IS NULL AND deleted_id IS NULL").Error; err != nil {
+		return err
+	}
+
+	if err := e.Exec("UPDATE files SET deleted_id=id WHERE deleted_at IS NOT NULL AND (deleted_id IS NULL OR deleted_id=0)").Error; err != nil {
+		return err
+	}
+
+	dups := make([]*File, 0)
+	err := e.Raw(`SELECT parent_id, file_name, owner FROM files WHERE deleted_at IS NULL
+		GROUP BY parent_id, file_name, owner HAVING COUNT(*)>1`).Scan(&dups).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	for _, dup := range dups {
+		files := make([]*File, 0)
+		if err := e.Where("parent_id=? AND file_name=? AND owner=?", dup.ParentID, dup.FileName, dup.Owner).Order("id ASC").Find(&files).Error; err != nil {
+			return err
+		}
+
+		for _, f := range files[1:] {
+			name, err := availableFileName(e, &File{ID: f.ParentID, Owner: f.Owner}, f.FileName)
+			if err != nil {
+				return err
+			}
+
+			oldPath := f.FilePath()
+			f.FileName = name
+			if err := e.Model(&File{}).Where("id=?", f.ID).UpdateColumn("file_name", name).Error; err != nil {
+				return err
+			}
+
+			if f.IsDir() {
+				if err := relocateDescendants(e, f, f.ChildTreePath(), oldPath); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if e.Dialect().HasIndex("files", "idx_file_parent_name") {
+		if err := e.Model(&File{}).RemoveIndex("idx_file_parent_name").Error; err != nil {
+			return err
+		}
+	}
+	return e.Model(&File{}).AddUniqueIndex("uix_file_parent_name", "parent_id", "file_name", "owner", "deleted_id").Error
+}
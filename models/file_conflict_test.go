@@ -0,0 +1,217 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAvailableFileName(t *testing.T) {
+	u, root := newTestUser(t)
+	for _, name := range []string{"a.txt", "a (1).txt", "b", ".hidden"} {
+		uploadTestFile(t, u, root, name, "x")
+	}
+
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"a.txt", "a (2).txt"},
+		{"b", "b (1)"},
+		{".hidden", ".hidden (1)"},
+		{"c.tar.gz", "c.tar (1).gz"},
+	}
+
+	for _, c := range cases {
+		name, err := availableFileName(engine, root, c.name)
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, c.want, name, c.name)
+	}
+}
+
+func TestGetChildByNameOwner(t *testing.T) {
+	u1, root1 := newTestUser(t)
+	u2, root2 := newTestUser(t)
+	uploadTestFile(t, u1, root1, "a.txt", "x")
+
+	// the roots of all users are children of the id 0
+	for _, root := range []*File{root1, root2} {
+		f, err := getChildByName(engine, &File{Owner: root.Owner}, root.FileName)
+		if assert.NoError(t, err) {
+			assert.Equal(t, root.ID, f.ID)
+		}
+
+		used, err := isFileNameUsed(engine, &File{Owner: root.Owner}, root.FileName)
+		assert.NoError(t, err)
+		assert.True(t, used)
+	}
+
+	used, err := isFileNameUsed(engine, &File{Owner: u2.ID + 1<<20}, root1.FileName)
+	assert.NoError(t, err)
+	assert.False(t, used)
+
+	_, err = getChildByName(engine, &File{ID: root1.ID, Owner: u2.ID}, "a.txt")
+	assert.True(t, IsErrFileNotExist(err))
+}
+
+func TestResolveNameConflict(t *testing.T) {
+	u, root := newTestUser(t)
+	file := uploadTestFile(t, u, root, "doc.txt", "x")
+	dir := createTestDir(t, u, root, "dir")
+
+	cases := []struct {
+		desc      string
+		name      string
+		isDir     bool
+		excludeID uint
+		policy    ConflictPolicy
+		want      string
+		exist     *File
+		err       bool
+	}{
+		{"free name", "new.txt", false, 0, ConflictReject, "new.txt", nil, false},
+		{"reject", "doc.txt", false, 0, ConflictReject, "", nil, true},
+		{"overwrite file", "doc.txt", false, 0, ConflictOverwrite, "doc.txt", file, false},
+		{"overwrite file with directory", "doc.txt", true, 0, ConflictOverwrite, "", nil, true},
+		{"overwrite directory", "dir", true, 0, ConflictOverwrite, "dir", dir, false},
+		{"overwrite directory with file", "dir", false, 0, ConflictOverwrite, "", nil, true},
+		{"rename", "doc.txt", false, 0, ConflictRename, "doc (1).txt", nil, false},
+		{"rename directory", "dir", true, 0, ConflictRename, "dir (1)", nil, false},
+		{"merge directories", "dir", true, 0, ConflictMerge, "dir", dir, false},
+		{"merge file", "doc.txt", false, 0, ConflictMerge, "", nil, true},
+		{"merge directory into file", "doc.txt", true, 0, ConflictMerge, "", nil, true},
+		{"same entry", "doc.txt", false, file.ID, ConflictReject, "doc.txt", nil, false},
+	}
+
+	for _, c := range cases {
+		name, exist, err := resolveNameConflict(engine, root, c.name, c.isDir, c.excludeID, c.policy)
+		if c.err {
+			assert.True(t, IsErrFileAlreadyExist(err), c.desc)
+			continue
+		}
+
+		assert.NoError(t, err, c.desc)
+		assert.Equal(t, c.want, name, c.desc)
+		if c.exist == nil {
+			assert.Nil(t, exist, c.desc)
+		} else if assert.NotNil(t, exist, c.desc) {
+			assert.Equal(t, c.exist.ID, exist.ID, c.desc)
+		}
+	}
+}
+
+func TestConflictPolicies(t *testing.T) {
+	cases := []struct {
+		desc   string
+		policy ConflictPolicy
+		names  []string
+		err    bool
+	}{
+		{"reject", ConflictReject, []string{"a.txt", "b.txt", "dst"}, true},
+		{"overwrite", ConflictOverwrite, []string{"b.txt", "dst"}, false},
+		{"rename", ConflictRename, []string{"b (1).txt", "b.txt", "dst"}, false},
+	}
+
+	for _, c := range cases {
+		u, root := newTestUser(t)
+		src := uploadTestFile(t, u, root, "a.txt", "new")
+		uploadTestFile(t, u, root, "b.txt", "old")
+		createTestDir(t, u, root, "dst")
+
+		_, err := RenameFile(u.ID, src, "b.txt", c.policy, "")
+		if c.err {
+			assert.True(t, IsErrFileAlreadyExist(err), c.desc)
+		} else {
+			assert.NoError(t, err, c.desc)
+		}
+		assert.Equal(t, c.names, listTestDir(t, root), c.desc)
+
+		// the space of an overwritten file is released
+		used, err := GetUserByID(u.ID)
+		assert.NoError(t, err, c.desc)
+		assert.Equal(t, int64(3*(len(c.names)-1)), used.UsedFileCapacity, c.desc)
+	}
+}
+
+func TestMergeDirectory(t *testing.T) {
+	u, root := newTestUser(t)
+	src := createTestDir(t, u, root, "src")
+	uploadTestFile(t, u, src, "only-src.txt", "1")
+	srcSub := createTestDir(t, u, src, "sub")
+	uploadTestFile(t, u, srcSub, "a.txt", "22")
+
+	dst := createTestDir(t, u, root, "dst")
+	uploadTestFile(t, u, dst, "only-dst.txt", "333")
+	dstSub := createTestDir(t, u, dst, "sub")
+	uploadTestFile(t, u, dstSub, "b.txt", "4444")
+
+	merged, err := MoveFile(u.ID, src, root, "dst", ConflictMerge, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, dst.ID, merged.ID)
+	assert.Equal(t, []string{"dst"}, listTestDir(t, root))
+	assert.Equal(t, []string{"only-dst.txt", "only-src.txt", "sub"}, listTestDir(t, merged))
+	assert.Equal(t, []string{"a.txt", "b.txt"}, listTestDir(t, getTestFile(t, u, "/dst/sub")))
+	assert.Equal(t, int64(10), merged.TotalSize)
+	assert.Equal(t, int64(4), merged.FileCount)
+	assert.Equal(t, int64(1), merged.DirCount)
+
+	// conflicting files inside the merged directories are rejected
+	src = createTestDir(t, u, root, "src")
+	uploadTestFile(t, u, src, "only-dst.txt", "5")
+	_, err = MoveFile(u.ID, src, root, "dst", ConflictMerge, "")
+	assert.True(t, IsErrFileAlreadyExist(err))
+	assert.Equal(t, []string{"only-dst.txt"}, listTestDir(t, getTestFile(t, u, "/src")))
+}
+
+func TestAddFileNameUniqueIndexUpgrade(t *testing.T) {
+	e, close := openUpgradeTestDB(t)
+	defer close()
+
+	deleted := time.Now()
+	root := &baselineFile{FileID: "1-root", FileName: "/", FileType: FileTypeDir, Owner: 1}
+	createBaselineFiles(t, e, root)
+	createBaselineFiles(t, e,
+		&baselineFile{FileName: "a.txt", FileType: FileTypeFile, Owner: 1, ParentID: root.ID},
+		&baselineFile{FileID: "dup", FileName: "a.txt", FileType: FileTypeFile, Owner: 1, ParentID: root.ID},
+		&baselineFile{FileID: "gone", FileName: "a.txt", FileType: FileTypeFile, Owner: 1, ParentID: root.ID, DeletedAt: &deleted},
+	)
+
+	// a release which added deleted_id as a nullable column, and the index
+	// on it, ran on the baseline rows before
+	if err := e.Exec("ALTER TABLE files ADD COLUMN deleted_id integer").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Table("files").AddUniqueIndex("uix_file_parent_name", "parent_id", "file_name", "owner", "deleted_id").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	err := e.AutoMigrate(&File{}).Error
+	if err == nil {
+		err = FillFileTreePath(e)
+	}
+	if err == nil {
+		err = AddFileNameUniqueIndex(e)
+	}
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var nulls int
+	assert.NoError(t, e.Table("files").Where("deleted_id IS NULL").Count(&nulls).Error)
+	assert.Equal(t, 0, nulls)
+
+	files := make([]*File, 0)
+	assert.NoError(t, e.Unscoped().Where("parent_id=?", root.ID).Order("id").Find(&files).Error)
+	if assert.Len(t, files, 3) {
+		assert.Equal(t, []string{"a.txt", "a (1).txt", "a.txt"}, []string{files[0].FileName, files[1].FileName, files[2].FileName})
+		assert.Equal(t, []uint{0, 0, files[2].ID}, []uint{files[0].DeletedID, files[1].DeletedID, files[2].DeletedID})
+	}
+
+	// the index rebuilt on the filled rows holds
+	err = e.Create(&File{FileID: "new", FileName: "a.txt", FileType: FileTypeFile, Owner: 1, ParentID: root.ID}).Error
+	assert.Error(t, err)
+}
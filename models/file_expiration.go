@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SetFileExpiration sets the time f is deleted, nil keeps it forever. The
+// owner is notified again before the new expiry.
+func SetFileExpiration(f *File, expiresAt *time.Time) error {
+	if f.IsRoot() {
+		return ErrModifyRootFile{ID: f.ID, Owner: f.Owner}
+	}
+
+	if err := engine.Model(f).UpdateColumns(map[string]interface{}{
+		"expires_at":      expiresAt,
+		"expiry_notified": false,
+	}).Error; err != nil {
+		return err
+	}
+
+	f.ExpiresAt = expiresAt
+	f.ExpiryNotified = false
+	return touchFile(engine, f)
+}
+
+// GetExpiredFiles returns the entries with an id greater than afterID which
+// expired before now, ordered by id.
+func GetExpiredFiles(now time.Time, afterID uint, limit int) ([]*File, error) {
+	files := make([]*File, 0, limit)
+	err := engine.Where("expires_at IS NOT NULL AND expires_at<=? AND id>?", now, afterID).Order("id ASC").Limit(limit).Find(&files).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return files, nil
+}
+
+// GetExpiringFiles returns the entries expiring between now and before whose
+// owner wasn't notified yet, ordered by owner.
+func GetExpiringFiles(now, before time.Time, limit int) ([]*File, error) {
+	files := make([]*File, 0, limit)
+	err := engine.Where("expires_at IS NOT NULL AND expires_at>? AND expires_at<=? AND expiry_notified=?", now, before, false).Order("owner ASC, expires_at ASC").Limit(limit).Find(&files).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return files, nil
+}
+
+func SetFilesExpiryNotified(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return engine.Model(&File{}).Where("id IN (?)", ids).UpdateColumn("expiry_notified", true).Error
+}
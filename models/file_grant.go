@@ -0,0 +1,258 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type FilePermission int
+
+const (
+	FilePermissionNone FilePermission = iota
+	FilePermissionRead
+	FilePermissionWrite
+	// FilePermissionAdmin allows to manage grants, it is never granted
+	FilePermissionAdmin
+)
+
+func (p FilePermission) String() string {
+	switch p {
+	case FilePermissionRead:
+		return "read"
+	case FilePermissionWrite:
+		return "write"
+	case FilePermissionAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+func ParseFilePermission(s string) FilePermission {
+	switch s {
+	case "read":
+		return FilePermissionRead
+	case "write":
+		return FilePermissionWrite
+	}
+	return FilePermissionNone
+}
+
+// FileGrant gives the user UserID access to a file of another user, grants
+// on a directory apply to everything below it.
+type FileGrant struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	FileID     uint `gorm:"unique_index:idx_file_grant_file_user"`
+	UserID     uint `gorm:"unique_index:idx_file_grant_file_user;index"`
+	Owner      uint `gorm:"index"`
+	Permission FilePermission
+
+	File *File `gorm:"-"`
+	User *User `gorm:"-"`
+}
+
+// GrantFile gives the user uid perm on f, an existing grant is replaced.
+func GrantFile(f *File, uid uint, perm FilePermission) (*FileGrant, error) {
+	if f.IsRoot() {
+		return nil, ErrModifyRootFile{ID: f.ID, Owner: f.Owner}
+	}
+
+	grant := &FileGrant{}
+	err := engine.Where(FileGrant{FileID: f.ID, UserID: uid}).
+		Assign(FileGrant{Owner: f.Owner, Permission: perm}).FirstOrCreate(grant).Error
+	if err != nil {
+		return nil, err
+	}
+	grant.File = f
+	return grant, nil
+}
+
+func RevokeFileGrant(f *File, uid uint) error {
+	result := engine.Where("file_id=? AND user_id=?", f.ID, uid).Delete(&FileGrant{})
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrFileGrantNotExist{FileID: f.ID, UserID: uid}
+	}
+	return nil
+}
+
+// GetFileGrants returns the grants given directly on f with their users.
+func GetFileGrants(f *File) ([]*FileGrant, error) {
+	grants := make([]*FileGrant, 0)
+	if err := engine.Where("file_id=?", f.ID).Order("id ASC").Find(&grants).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	for _, grant := range grants {
+		grant.File = f
+	}
+
+	if err := loadFileGrantUsers(grants); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// loadFileGrantUsers sets the users of grants, users which don't exist
+// anymore are left nil.
+func loadFileGrantUsers(grants []*FileGrant) error {
+	if len(grants) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(grants))
+	for i, grant := range grants {
+		ids[i] = grant.UserID
+	}
+
+	users := make([]*User, 0, len(ids))
+	if err := engine.Where("id IN (?)", ids).Find(&users).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	byID := make(map[uint]*User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+
+	for _, grant := range grants {
+		grant.User = byID[grant.UserID]
+	}
+	return nil
+}
+
+// loadFileGrantFiles sets the files of grants, files which don't exist
+// anymore are left nil.
+func loadFileGrantFiles(grants []*FileGrant) error {
+	if len(grants) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(grants))
+	for i, grant := range grants {
+		ids[i] = grant.FileID
+	}
+
+	files := make([]*File, 0, len(ids))
+	if err := engine.Where("id IN (?)", ids).Find(&files).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	byID := make(map[uint]*File, len(files))
+	for _, file := range files {
+		byID[file.ID] = file
+	}
+
+	for _, grant := range grants {
+		grant.File = byID[grant.FileID]
+	}
+	return nil
+}
+
+// GetSharedWithMe returns the grants given to the user uid together with
+// their files, the latest first.
+func GetSharedWithMe(uid uint, opts ListOptions) ([]*FileGrant, int64, error) {
+	join := "JOIN files ON files.id = file_grants.file_id AND files.deleted_at IS NULL"
+
+	var count int64
+	if err := engine.Model(&FileGrant{}).Joins(join).Where("file_grants.user_id=?", uid).Count(&count).Error; err != nil {
+		return nil, 0, fmt.Errorf("Count: %v", err)
+	}
+
+	db := engine.Joins(join).Where("file_grants.user_id=?", uid).
+		Order("file_grants.created_at DESC").Order("file_grants.id DESC")
+	if opts.Page != 0 {
+		db = opts.SetEnginePagination(db)
+	}
+
+	grants := make([]*FileGrant, 0, opts.PageSize)
+	if err := db.Select("file_grants.*").Find(&grants).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, 0, err
+	}
+
+	if err := loadFileGrantFiles(grants); err != nil {
+		return nil, 0, err
+	}
+	return grants, count, nil
+}
+
+// GetFilePermission returns the permission of the user uid on f, owners
+// may do everything, members of a team owning f get the permission of their
+// role and other users need a grant on f or one of its ancestors.
+func GetFilePermission(uid uint, f *File) (FilePermission, error) {
+	return getFilePermission(engine, uid, f)
+}
+
+func getFilePermission(e *gorm.DB, uid uint, f *File) (FilePermission, error) {
+	if f.Owner == uid {
+		return FilePermissionAdmin, nil
+	}
+
+	member, err := getTeamMember(e, f.Owner, uid)
+	if err != nil && !IsErrTeamMemberNotExist(err) {
+		return FilePermissionNone, err
+	}
+
+	perm := FilePermissionNone
+	if member != nil {
+		perm = member.Role.FilePermission()
+	}
+
+	ids := append(treePathIDs(f.TreePath), f.ID)
+
+	grant := &FileGrant{}
+	err = e.Where("user_id=? AND file_id IN (?)", uid, ids).Order("permission DESC").First(grant).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return perm, nil
+		}
+		return FilePermissionNone, err
+	}
+
+	if grant.Permission > perm {
+		perm = grant.Permission
+	}
+	return perm, nil
+}
+
+// GetAccessibleFile returns the file id if the user uid has at least perm on
+// it, an uid of 0 skips the check. Files the user can't see at all are
+// reported as not existing.
+func GetAccessibleFile(id, uid uint, perm FilePermission) (*File, error) {
+	return getAccessibleFile(engine, id, uid, perm)
+}
+
+func getAccessibleFile(e *gorm.DB, id, uid uint, perm FilePermission) (*File, error) {
+	if id == 0 || uid == 0 {
+		return getFileByID(e, id, uid)
+	}
+
+	file, err := getFileByID(e, id, 0)
+	if err != nil {
+		if IsErrFileNotExist(err) {
+			return nil, ErrFileNotExist{ID: id, Owner: uid}
+		}
+		return nil, err
+	}
+
+	granted, err := getFilePermission(e, uid, file)
+	if err != nil {
+		return nil, err
+	}
+
+	if granted == FilePermissionNone {
+		return nil, ErrFileNotExist{ID: id, Owner: uid}
+	}
+
+	if granted < perm {
+		return nil, ErrFilePermissionDenied{ID: id, UserID: uid}
+	}
+	return file, nil
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilePermissionInheritance(t *testing.T) {
+	owner, root := newTestUser(t)
+	a := createTestDir(t, owner, root, "a")
+	b := createTestDir(t, owner, a, "b")
+	f := uploadTestFile(t, owner, b, "f.txt", "f")
+	other := uploadTestFile(t, owner, root, "other.txt", "o")
+
+	reader, _ := newTestUser(t)
+	writer, _ := newTestUser(t)
+	stranger, _ := newTestUser(t)
+
+	// reader may read everything below a and write below b, writer may
+	// write below a but only read f
+	grants := []struct {
+		file *File
+		user *User
+		perm FilePermission
+	}{
+		{a, reader, FilePermissionRead},
+		{b, reader, FilePermissionWrite},
+		{a, writer, FilePermissionWrite},
+		{f, writer, FilePermissionRead},
+	}
+	for _, g := range grants {
+		if _, err := GrantFile(g.file, g.user.ID, g.perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		user *User
+		file *File
+		want FilePermission
+	}{
+		{owner, f, FilePermissionAdmin},
+		{reader, a, FilePermissionRead},
+		{reader, b, FilePermissionWrite},
+		{reader, f, FilePermissionWrite},
+		{reader, root, FilePermissionNone},
+		{reader, other, FilePermissionNone},
+		// the strongest grant on the path wins
+		{writer, f, FilePermissionWrite},
+		{writer, b, FilePermissionWrite},
+		{stranger, f, FilePermissionNone},
+	}
+
+	for _, c := range cases {
+		perm, err := GetFilePermission(c.user.ID, c.file)
+		assert.NoError(t, err)
+		assert.Equal(t, c.want, perm, "%s on %s", c.user.Username, c.file.FilePath())
+	}
+
+	t.Run("accessible", func(t *testing.T) {
+		_, err := GetAccessibleFile(f.ID, reader.ID, FilePermissionWrite)
+		assert.NoError(t, err)
+
+		_, err = GetAccessibleFile(a.ID, reader.ID, FilePermissionWrite)
+		assert.True(t, IsErrFilePermissionDenied(err))
+
+		// files without any permission don't exist for the user
+		_, err = GetAccessibleFile(other.ID, reader.ID, FilePermissionRead)
+		assert.True(t, IsErrFileNotExist(err))
+
+		_, err = GetAccessibleFile(f.ID, reader.ID, FilePermissionAdmin)
+		assert.True(t, IsErrFilePermissionDenied(err))
+	})
+
+	t.Run("moved out of the grant", func(t *testing.T) {
+		moved := uploadTestFile(t, owner, b, "moved.txt", "m")
+		if _, err := MoveFile(owner.ID, moved, root, "", ConflictReject, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		perm, err := GetFilePermission(reader.ID, moved)
+		assert.NoError(t, err)
+		assert.Equal(t, FilePermissionNone, perm)
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		assert.NoError(t, RevokeFileGrant(b, reader.ID))
+		perm, err := GetFilePermission(reader.ID, f)
+		assert.NoError(t, err)
+		assert.Equal(t, FilePermissionRead, perm)
+
+		assert.True(t, IsErrFileGrantNotExist(RevokeFileGrant(b, reader.ID)))
+	})
+
+	t.Run("root", func(t *testing.T) {
+		_, err := GrantFile(root, reader.ID, FilePermissionRead)
+		assert.True(t, IsErrModifyRootFile(err))
+	})
+}
+
+func TestTeamFilePermission(t *testing.T) {
+	team, root := newTestUser(t)
+	f := uploadTestFile(t, team, root, "f.txt", "f")
+
+	cases := []struct {
+		role  TeamRole
+		grant FilePermission
+		want  FilePermission
+	}{
+		{TeamRoleViewer, FilePermissionNone, FilePermissionRead},
+		{TeamRoleEditor, FilePermissionNone, FilePermissionWrite},
+		{TeamRoleOwner, FilePermissionNone, FilePermissionAdmin},
+		// a grant raises the permission of a role but never lowers it
+		{TeamRoleViewer, FilePermissionWrite, FilePermissionWrite},
+		{TeamRoleEditor, FilePermissionRead, FilePermissionWrite},
+	}
+
+	for _, c := range cases {
+		u, _ := newTestUser(t)
+		if err := engine.Create(&TeamMember{TeamID: team.ID, UserID: u.ID, Role: c.role}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if c.grant != FilePermissionNone {
+			if _, err := GrantFile(f, u.ID, c.grant); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		perm, err := GetFilePermission(u.ID, f)
+		assert.NoError(t, err)
+		assert.Equal(t, c.want, perm, "%v with %v", c.role, c.grant)
+	}
+}
+
+func TestGetSharedWithMe(t *testing.T) {
+	u, _ := newTestUser(t)
+	files := make([]*File, 0)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		owner, root := newTestUser(t)
+		f := uploadTestFile(t, owner, root, name, name)
+		if _, err := GrantFile(f, u.ID, FilePermissionRead); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+
+	// grants of deleted files are left out
+	if err := DeleteFile(files[1].Owner, files[1], ""); err != nil {
+		t.Fatal(err)
+	}
+
+	grants, count, err := GetSharedWithMe(u.ID, ListOptions{Page: 1, PageSize: 10})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int64(2), count)
+	names := make([]string, 0, len(grants))
+	for _, grant := range grants {
+		if assert.NotNil(t, grant.File) {
+			names = append(names, grant.File.FileName)
+		}
+	}
+	assert.Equal(t, []string{"c.txt", "a.txt"}, names)
+
+	grants, err = GetFileGrants(files[0])
+	if assert.NoError(t, err) && assert.Len(t, grants, 1) && assert.NotNil(t, grants[0].User) {
+		assert.Equal(t, u.Username, grants[0].User.Username)
+	}
+}
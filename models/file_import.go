@@ -0,0 +1,125 @@
+package models
+
+import (
+	"context"
+	"io"
+	"path"
+
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+// ImportEntry is a file or directory to be created by ImportFiles, Path is
+// relative to the target directory.
+type ImportEntry struct {
+	Path  string
+	IsDir bool
+	Size  int64
+}
+
+// ImportFiles creates the entries returned by next under dir until next
+// returns io.EOF, u is the uploader. size is the total size of the entries,
+// the import fails up front when it exceeds the free capacity of the owner
+// of dir. Directories are always merged, policy applies to files only.
+func ImportFiles(u *User, dir *File, size int64, policy ConflictPolicy, next func() (*ImportEntry, io.Reader, error)) (int, error) {
+	owner := dir.Owner
+	id, err := LockUserFile(context.Background(), owner)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := UnlockUserFile(context.Background(), owner, id); err != nil {
+			log.Error("Failed to unlock user file", zap.Uint("uid", owner), zap.Error(err))
+		}
+	}()
+
+	tx := engine.Begin()
+	if err := tx.Error; err != nil {
+		return 0, err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	created := make([]string, 0)
+	count, err := importFiles(tx, u, dir, size, policy, next, &created)
+	if err == nil {
+		err = tx.Commit().Error
+	}
+
+	if err != nil {
+		removeObjects(created)
+		return 0, err
+	}
+
+	afterFileChange(owner)
+	return count, nil
+}
+
+func importFiles(e *gorm.DB, u *User, dir *File, size int64, policy ConflictPolicy, next func() (*ImportEntry, io.Reader, error), created *[]string) (int, error) {
+	if !dir.IsDir() {
+		return 0, ErrFileNotDirectory{ID: dir.ID, Path: dir.FilePath()}
+	}
+
+	owner, err := getUserByID(e, dir.Owner)
+	if err != nil {
+		return 0, err
+	}
+
+	if owner.UsedFileCapacity+size > owner.MaxFileCapacity {
+		return 0, ErrUserMaxFileCapacityLimit{UserID: owner.ID}
+	}
+
+	dirs := map[string]*File{".": dir}
+	count := 0
+	for {
+		entry, r, err := next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if entry.IsDir {
+			if _, err := importDirectory(e, u.ID, dirs, entry.Path); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		parent, err := importDirectory(e, u.ID, dirs, path.Dir(entry.Path))
+		if err != nil {
+			return 0, err
+		}
+
+		id, _, err := uploadFile(e, u, parent, path.Base(entry.Path), entry.Size, r, policy, "", nil)
+		if len(id) != 0 {
+			*created = append(*created, id)
+		}
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+}
+
+// importDirectory returns the directory at p, missing directories on the way
+// are created.
+func importDirectory(e *gorm.DB, uid uint, dirs map[string]*File, p string) (*File, error) {
+	if dir, ok := dirs[p]; ok {
+		return dir, nil
+	}
+
+	parent, err := importDirectory(e, uid, dirs, path.Dir(p))
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := createDirectory(e, uid, parent, path.Base(p), ConflictMerge)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs[p] = dir
+	return dir, nil
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// FileContent is the extracted text of an indexed file. Binary files and
+// files too large to index are stored with Indexed false and no content.
+type FileContent struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	FileID    uint `gorm:"unique_index"`
+	Owner     uint `gorm:"index"`
+	Indexed   bool
+	Content   string `gorm:"type:text"`
+}
+
+// FileTerm is an entry of the inverted index of the files of a user.
+type FileTerm struct {
+	ID        uint   `gorm:"primary_key"`
+	Owner     uint   `gorm:"index:idx_file_term_owner_term"`
+	Term      string `gorm:"type:varchar(255);index:idx_file_term_owner_term"`
+	FileID    uint   `gorm:"index"`
+	Frequency int
+}
+
+type FileContentResult struct {
+	File    *File
+	Score   int
+	Content string
+}
+
+// fileTermInsertSize is the number of rows inserted by one statement.
+const fileTermInsertSize = 100
+
+// GetUnindexedFiles returns at most limit files of the user uid without a
+// FileContent, see getUnexaminedFiles.
+func GetUnindexedFiles(uid uint, ids []uint, limit int) ([]*File, error) {
+	return getUnexaminedFiles(engine, uid, "file_contents", ids, limit)
+}
+
+// RemoveStaleFileIndexes removes the index of files of the user uid which
+// no longer exist, of the files ids unless ids is nil.
+func RemoveStaleFileIndexes(uid uint, ids []uint) error {
+	tx := engine.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	for _, bean := range []interface{}{&FileTerm{}, &FileContent{}} {
+		if err := staleFileCondition(tx, uid, ids).Delete(bean).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// staleFileCondition matches the rows of the user uid referring to files
+// which no longer exist, to the files ids unless ids is nil.
+func staleFileCondition(e *gorm.DB, uid uint, ids []uint) *gorm.DB {
+	if ids != nil {
+		e = e.Where("file_id IN (?)", ids)
+	}
+	return e.Where("owner=? AND file_id NOT IN (SELECT id FROM files WHERE owner=? AND deleted_at IS NULL)", uid, uid)
+}
+
+// SaveFileIndex stores the text content of f and its terms. A nil terms
+// marks f as examined without indexing it.
+func SaveFileIndex(f *File, content string, terms map[string]int) error {
+	tx := engine.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	if err := tx.Create(&FileContent{
+		FileID:  f.ID,
+		Owner:   f.Owner,
+		Indexed: terms != nil,
+		Content: content,
+	}).Error; err != nil {
+		return err
+	}
+
+	values := make([]string, 0, fileTermInsertSize)
+	args := make([]interface{}, 0, fileTermInsertSize*4)
+	flush := func() error {
+		if len(values) == 0 {
+			return nil
+		}
+		err := tx.Exec("INSERT INTO file_terms (owner, term, file_id, frequency) VALUES "+strings.Join(values, ","), args...).Error
+		values = values[:0]
+		args = args[:0]
+		return err
+	}
+
+	for term, frequency := range terms {
+		values = append(values, "(?,?,?,?)")
+		args = append(args, f.Owner, term, f.ID, frequency)
+		if len(values) == fileTermInsertSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// SearchFileContent returns the files of the user uid containing all terms,
+// files with more occurrences come first.
+func SearchFileContent(uid uint, terms []string, opts ListOptions) ([]*FileContentResult, int64, error) {
+	if len(terms) == 0 {
+		return []*FileContentResult{}, 0, nil
+	}
+
+	// files quarantined after they were indexed are left out
+	matched := "SELECT file_id, SUM(frequency) AS score FROM file_terms WHERE owner=? AND term IN (?) AND file_id NOT IN (SELECT id FROM files WHERE owner=? AND scan_status IN (?)) GROUP BY file_id HAVING COUNT(DISTINCT term)=?"
+	args := []interface{}{uid, terms, uid, heldBackScanStatuses, len(terms)}
+
+	count := &struct {
+		Count int64
+	}{}
+	if err := engine.Raw("SELECT COUNT(*) AS count FROM ("+matched+") matched", args...).Scan(count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	scores := make([]*struct {
+		FileID uint
+		Score  int
+	}, 0)
+	query := engine.Raw(matched+" ORDER BY score DESC, file_id ASC", args...)
+	if opts.Page != 0 {
+		query = engine.Raw(matched+" ORDER BY score DESC, file_id ASC LIMIT ? OFFSET ?", append(args, opts.PageSize, (opts.Page-1)*opts.PageSize)...)
+	}
+	if err := query.Scan(&scores).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, 0, err
+	}
+
+	if len(scores) == 0 {
+		return []*FileContentResult{}, count.Count, nil
+	}
+
+	ids := make([]uint, len(scores))
+	for i, score := range scores {
+		ids[i] = score.FileID
+	}
+
+	files := make([]*File, 0, len(ids))
+	if err := engine.Where("owner=? AND id IN (?)", uid, ids).Find(&files).Error; err != nil {
+		return nil, 0, err
+	}
+
+	contents := make([]*FileContent, 0, len(ids))
+	if err := engine.Where("owner=? AND file_id IN (?)", uid, ids).Find(&contents).Error; err != nil {
+		return nil, 0, err
+	}
+
+	fileMap := make(map[uint]*File, len(files))
+	for _, file := range files {
+		fileMap[file.ID] = file
+	}
+
+	contentMap := make(map[uint]string, len(contents))
+	for _, content := range contents {
+		contentMap[content.FileID] = content.Content
+	}
+
+	results := make([]*FileContentResult, 0, len(scores))
+	for _, score := range scores {
+		file, ok := fileMap[score.FileID]
+		if !ok {
+			continue
+		}
+		results = append(results, &FileContentResult{
+			File:    file,
+			Score:   score.Score,
+			Content: contentMap[score.FileID],
+		})
+	}
+	return results, count.Count, nil
+}
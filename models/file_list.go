@@ -0,0 +1,433 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/modules/utils"
+	"github.com/jinzhu/gorm"
+)
+
+type DirSortField string
+
+const (
+	DirSortByName DirSortField = "name"
+	DirSortBySize DirSortField = "size"
+	DirSortByDate DirSortField = "date"
+	DirSortByType DirSortField = "type"
+)
+
+// dirEntryColumns are the columns needed to sort the entries of a directory
+// by name, the entries of a page are loaded completely afterwards.
+const dirEntryColumns = "id, file_name, file_type"
+
+type ListDirOptions struct {
+	ListOptions
+	MetadataFilter
+	// Keyword filters the entry names, see SearchFileOptions
+	Keyword string
+	Match   FileMatchMode
+	Type    FileType
+	// Extension limits the entries to files with the extension
+	Extension string
+	// ContentType is a prefix of the content type of files, e.g. "image/"
+	ContentType string
+
+	// SortBy is the name in natural order when empty, directories are
+	// listed before files unless MixDirs is set. Entries are sorted by
+	// the stored content type, files stored before types were sniffed
+	// have none.
+	SortBy  DirSortField
+	Desc    bool
+	MixDirs bool
+
+	// Cursor continues after the last entry of a previous page instead of
+	// using Page, it is stable while entries are added or removed
+	Cursor string
+}
+
+// dirCursor is the sort key of the last entry of a page.
+type dirCursor struct {
+	Sort        string   `json:"s"`
+	ID          uint     `json:"i"`
+	FileType    FileType `json:"t"`
+	FileName    string   `json:"n"`
+	Size        int64    `json:"z,omitempty"`
+	UpdatedAt   int64    `json:"u,omitempty"`
+	ContentType string   `json:"c,omitempty"`
+}
+
+func (opts *ListDirOptions) sortKey() string {
+	sortBy := opts.SortBy
+	if len(sortBy) == 0 {
+		sortBy = DirSortByName
+	}
+
+	key := string(sortBy)
+	if opts.Desc {
+		key += ",desc"
+	}
+	if opts.MixDirs {
+		key += ",mix"
+	}
+	return key
+}
+
+func (opts *ListDirOptions) encodeCursor(f *File) string {
+	data, _ := json.Marshal(&dirCursor{
+		Sort:        opts.sortKey(),
+		ID:          f.ID,
+		FileType:    f.FileType,
+		FileName:    f.FileName,
+		Size:        entrySize(f),
+		UpdatedAt:   f.UpdatedAt.UnixNano(),
+		ContentType: f.ContentType,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (opts *ListDirOptions) decodeCursor() (*File, error) {
+	data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return nil, ErrInvalidDirCursor{Cursor: opts.Cursor}
+	}
+
+	cursor := &dirCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil || cursor.Sort != opts.sortKey() {
+		return nil, ErrInvalidDirCursor{Cursor: opts.Cursor}
+	}
+
+	f := &File{
+		ID:          cursor.ID,
+		FileType:    cursor.FileType,
+		FileName:    cursor.FileName,
+		FileSize:    cursor.Size,
+		TotalSize:   cursor.Size,
+		ContentType: cursor.ContentType,
+		UpdatedAt:   time.Unix(0, cursor.UpdatedAt),
+	}
+	return f, nil
+}
+
+func entrySize(f *File) int64 {
+	if f.IsDir() {
+		return f.TotalSize
+	}
+	return f.FileSize
+}
+
+// entryLess returns a function ordering the entries of a directory by name
+// in natural order, entries which are equal that way are ordered bytewise
+// and finally by id, so the order is total and stable across pages.
+func (opts *ListDirOptions) entryLess() func(a, b *File) bool {
+	return func(a, b *File) bool {
+		if !opts.MixDirs && a.IsDir() != b.IsDir() {
+			return a.IsDir()
+		}
+
+		c := utils.NaturalCompare(a.FileName, b.FileName)
+		if c == 0 {
+			c = strings.Compare(a.FileName, b.FileName)
+		}
+
+		if c == 0 {
+			c = compareInt64(int64(a.ID), int64(b.ID))
+		}
+
+		if opts.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+}
+
+// entryDirColumn orders directories before files.
+var entryDirColumn = fmt.Sprintf("(CASE WHEN file_type=%d THEN 0 ELSE 1 END)", FileTypeDir)
+
+// sortColumn returns the column the entries are ordered by in SQL and its
+// value for f, it is empty for the natural order of names.
+func (opts *ListDirOptions) sortColumn(f *File) (string, interface{}) {
+	switch opts.SortBy {
+	case DirSortBySize:
+		return fmt.Sprintf("(CASE WHEN file_type=%d THEN total_size ELSE file_size END)", FileTypeDir), entrySize(f)
+	case DirSortByDate:
+		return "updated_at", f.UpdatedAt
+	case DirSortByType:
+		return "COALESCE(content_type, '')", f.ContentType
+	}
+	return "", nil
+}
+
+// orderBy orders query by column like entryLess orders by name, entries
+// equal by column are ordered by name and id.
+func (opts *ListDirOptions) orderBy(query *gorm.DB, column string) *gorm.DB {
+	order := " ASC"
+	if opts.Desc {
+		order = " DESC"
+	}
+
+	if !opts.MixDirs {
+		query = query.Order(entryDirColumn + " ASC")
+	}
+	return query.Order(column + order).Order("file_name" + order).Order("id" + order)
+}
+
+// whereAfter limits query to the entries following after in the order of
+// orderBy.
+func (opts *ListDirOptions) whereAfter(query *gorm.DB, column string, after *File) *gorm.DB {
+	op := ">"
+	if opts.Desc {
+		op = "<"
+	}
+
+	_, value := opts.sortColumn(after)
+	cond := fmt.Sprintf("%[1]s %[2]s ? OR (%[1]s = ? AND (file_name %[2]s ? OR (file_name = ? AND id %[2]s ?)))", column, op)
+	args := []interface{}{value, value, after.FileName, after.FileName, after.ID}
+
+	if !opts.MixDirs {
+		dir := 1
+		if after.IsDir() {
+			dir = 0
+		}
+		cond = fmt.Sprintf("%[1]s > ? OR (%[1]s = ? AND (%[2]s))", entryDirColumn, cond)
+		args = append([]interface{}{dir, dir}, args...)
+	}
+	return query.Where(cond, args...)
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// ListDirectory returns a page of the entries of dir matching opts with the
+// number of matching entries and a cursor to the next page, the cursor is
+// empty on the last page. Without Cursor the first page is returned unless
+// Page is given.
+func ListDirectory(dir *File, opts *ListDirOptions) ([]*File, int64, string, error) {
+	if !dir.IsDir() {
+		return nil, 0, "", ErrFileNotDirectory{ID: dir.ID, Path: dir.FilePath()}
+	}
+
+	var after *File
+	if len(opts.Cursor) != 0 {
+		var err error
+		if after, err = opts.decodeCursor(); err != nil {
+			return nil, 0, "", err
+		}
+	} else if opts.Page <= 0 {
+		opts.Page = 1
+	}
+
+	if opts.PageSize <= 0 {
+		opts.PageSize = setting.API.DefaultPagingSize
+	}
+
+	search := &SearchFileOptions{
+		MetadataFilter: opts.MetadataFilter,
+		Keyword:        opts.Keyword,
+		Match:          opts.Match,
+		Type:           opts.Type,
+		Extension:      opts.Extension,
+	}
+
+	query := search.Apply(engine.Model(&File{}).Where("parent_id=?", dir.ID))
+	if len(opts.ContentType) != 0 {
+		query = query.Where("file_type=? AND LOWER(content_type) LIKE ? ESCAPE '!'", FileTypeFile, likeEscaper.Replace(strings.ToLower(opts.ContentType))+"%")
+	}
+
+	var (
+		page []*File
+		next string
+	)
+
+	column, _ := opts.sortColumn(&File{})
+	if len(column) == 0 {
+		entries, err := opts.pageByName(query, after)
+		if err != nil {
+			return nil, 0, "", err
+		}
+
+		if len(entries) > opts.PageSize {
+			entries = entries[:opts.PageSize]
+			next = opts.encodeCursor(entries[len(entries)-1])
+		}
+
+		if page, err = getFilesByIDsInOrder(engine, entries); err != nil {
+			return nil, 0, "", err
+		}
+	} else {
+		var err error
+		if page, err = opts.pageByColumn(query, column, after); err != nil {
+			return nil, 0, "", err
+		}
+
+		if len(page) > opts.PageSize {
+			page = page[:opts.PageSize]
+			next = opts.encodeCursor(page[len(page)-1])
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, "", err
+	}
+	return page, total, next, nil
+}
+
+// pageByColumn reads the entries of the page from query ordered by column,
+// with one more entry telling whether there is a next page.
+func (opts *ListDirOptions) pageByColumn(query *gorm.DB, column string, after *File) ([]*File, error) {
+	query = opts.orderBy(query, column).Limit(opts.PageSize + 1)
+	if after != nil {
+		query = opts.whereAfter(query, column, after)
+	} else {
+		query = query.Offset((opts.Page - 1) * opts.PageSize)
+	}
+
+	files := make([]*File, 0, opts.PageSize+1)
+	if err := query.Find(&files).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return files, nil
+}
+
+// pageByName sorts the entries of query in natural order of their names,
+// which can't be expressed in SQL, so only the sort keys of every entry are
+// read. It returns the partially loaded entries from the start of the page
+// on, with one more entry telling whether there is a next page.
+func (opts *ListDirOptions) pageByName(query *gorm.DB, after *File) ([]*File, error) {
+	entries := make([]*File, 0)
+	if err := query.Select(dirEntryColumns).Find(&entries).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	less := opts.entryLess()
+	sort.Slice(entries, func(i, j int) bool {
+		return less(entries[i], entries[j])
+	})
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(entries), func(i int) bool {
+			return less(after, entries[i])
+		})
+	} else if start = (opts.Page - 1) * opts.PageSize; start > len(entries) {
+		start = len(entries)
+	}
+
+	entries = entries[start:]
+	if len(entries) > opts.PageSize+1 {
+		entries = entries[:opts.PageSize+1]
+	}
+	return entries, nil
+}
+
+// getFilesByIDsInOrder loads the complete entries of the partially loaded
+// entries, keeping their order.
+func getFilesByIDsInOrder(e *gorm.DB, entries []*File) ([]*File, error) {
+	if len(entries) == 0 {
+		return []*File{}, nil
+	}
+
+	ids := make([]uint, len(entries))
+	for i := range entries {
+		ids[i] = entries[i].ID
+	}
+
+	loaded := make([]*File, 0, len(ids))
+	if err := e.Where("id IN (?)", ids).Find(&loaded).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	byID := make(map[uint]*File, len(loaded))
+	for _, f := range loaded {
+		byID[f.ID] = f
+	}
+
+	// entries removed in the meantime are skipped
+	files := make([]*File, 0, len(ids))
+	for _, id := range ids {
+		if f, ok := byID[id]; ok {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// FileTree is a directory with its entries, Children is nil for entries
+// which weren't descended into.
+type FileTree struct {
+	*File
+	Children []*FileTree
+}
+
+// GetDirectoryTree returns the entries of dir down to depth levels below
+// it, directories first and in natural order. Levels are read as a whole,
+// the tree stops at the last level which fits into maxSize entries.
+func GetDirectoryTree(dir *File, depth int, onlyDir bool, maxSize int) (*FileTree, error) {
+	if !dir.IsDir() {
+		return nil, ErrFileNotDirectory{ID: dir.ID, Path: dir.FilePath()}
+	}
+
+	root := &FileTree{File: dir}
+	level := []*FileTree{root}
+	less := (&ListDirOptions{}).entryLess()
+	size := 0
+
+	for ; depth > 0 && len(level) != 0; depth-- {
+		byID := make(map[uint]*FileTree, len(level))
+		ids := make([]uint, 0, len(level))
+		for _, node := range level {
+			if node.IsDir() {
+				byID[node.ID] = node
+				ids = append(ids, node.ID)
+			}
+		}
+
+		if len(ids) == 0 {
+			break
+		}
+
+		// one more entry than fits tells that the level is too large
+		entries := make([]*File, 0)
+		query := engine.Where("parent_id IN (?)", ids).Limit(maxSize - size + 1)
+		if onlyDir {
+			query = query.Where("file_type=?", FileTypeDir)
+		}
+		if err := query.Find(&entries).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+			return nil, err
+		}
+
+		if size += len(entries); size > maxSize {
+			break
+		}
+
+		sort.Slice(entries, func(i, j int) bool {
+			return less(entries[i], entries[j])
+		})
+
+		for _, node := range byID {
+			node.Children = make([]*FileTree, 0)
+		}
+
+		next := make([]*FileTree, len(entries))
+		for i, entry := range entries {
+			next[i] = &FileTree{File: entry}
+			parent := byID[entry.ParentID]
+			parent.Children = append(parent.Children, next[i])
+		}
+		level = next
+	}
+	return root, nil
+}
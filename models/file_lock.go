@@ -0,0 +1,241 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/czhj/ahfs/modules/utils"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+// FileLock is an exclusive checkout of a file, while it is active only its
+// holder may overwrite, rename, move or delete the file. It is unrelated to
+// LockUserFile, which only serializes changes of the files of a user.
+type FileLock struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	LockID    string `gorm:"unique_index"`
+	FileID    uint   `gorm:"unique_index"`
+	Owner     uint   `gorm:"index"`
+	UserID    uint   `gorm:"index"`
+	Note      string
+	ExpiresAt time.Time
+
+	User *User `gorm:"-"`
+}
+
+func (l *FileLock) IsExpired() bool {
+	return !l.ExpiresAt.After(time.Now())
+}
+
+func (l *FileLock) LoadUser() (err error) {
+	if l.User == nil {
+		l.User, err = GetUserByID(l.UserID)
+	}
+	return err
+}
+
+// LockFile checks f out for the user uid until timeout elapsed. The holder
+// may lock the file again to extend the lock or to change its note, expired
+// locks of other users are taken over.
+func LockFile(f *File, uid uint, timeout time.Duration, note string) (*FileLock, error) {
+	if f.IsDir() {
+		return nil, ErrFileLockDirectory{ID: f.ID}
+	}
+
+	// concurrent first locks of f would both miss the row and the insert of
+	// the later one would fail, the locks are taken one after the other
+	// like the other changes of the files of the owner
+	owner := f.Owner
+	id, err := LockUserFile(context.Background(), owner)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := UnlockUserFile(context.Background(), owner, id); err != nil {
+			log.Error("Failed to unlock user file", zap.Uint("uid", owner), zap.Error(err))
+		}
+	}()
+
+	tx := engine.Begin()
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	lock, err := lockFile(tx, f, uid, timeout, note)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+func lockFile(e *gorm.DB, f *File, uid uint, timeout time.Duration, note string) (*FileLock, error) {
+	lock := &FileLock{}
+	err := e.Where("file_id=?", f.ID).First(lock).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	if lock.ID != 0 && !lock.IsExpired() && lock.UserID != uid {
+		return nil, ErrFileLocked{ID: f.ID, UserID: lock.UserID}
+	}
+
+	if lock.ID == 0 {
+		lock = &FileLock{
+			LockID:    utils.GenerateLockID(f.ID),
+			FileID:    f.ID,
+			Owner:     f.Owner,
+			UserID:    uid,
+			Note:      note,
+			ExpiresAt: time.Now().Add(timeout),
+		}
+		if err := e.Create(lock).Error; err != nil {
+			return nil, err
+		}
+		return lock, touchFile(e, f)
+	}
+
+	// the row is only updated if nobody else changed it in the meantime
+	lockID := lock.LockID
+	if lock.UserID != uid || lock.IsExpired() {
+		lock.LockID = utils.GenerateLockID(f.ID)
+		lock.CreatedAt = time.Now()
+	}
+	lock.UserID = uid
+	lock.Note = note
+	lock.ExpiresAt = time.Now().Add(timeout)
+
+	result := e.Model(&FileLock{}).Where("id=? AND lock_id=?", lock.ID, lockID).UpdateColumns(map[string]interface{}{
+		"lock_id":    lock.LockID,
+		"created_at": lock.CreatedAt,
+		"updated_at": time.Now(),
+		"user_id":    lock.UserID,
+		"note":       lock.Note,
+		"expires_at": lock.ExpiresAt,
+	})
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrFileLocked{ID: f.ID}
+	}
+	return lock, touchFile(e, f)
+}
+
+// UnlockFile releases the lock of f held by the user uid, force releases
+// the lock whoever holds it.
+func UnlockFile(f *File, uid uint, force bool) error {
+	lock, err := GetFileLock(f)
+	if err != nil {
+		return err
+	}
+
+	if lock == nil {
+		return ErrFileUnlockFailed{ID: f.ID}
+	}
+
+	if !force && lock.UserID != uid {
+		return ErrFileLocked{ID: f.ID, UserID: lock.UserID}
+	}
+
+	result := engine.Where("id=? AND lock_id=?", lock.ID, lock.LockID).Delete(&FileLock{})
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrFileUnlockFailed{ID: f.ID, LockID: lock.LockID}
+	}
+	return touchFile(engine, f)
+}
+
+// GetFileLock returns the active lock of f, or nil if it isn't locked.
+func GetFileLock(f *File) (*FileLock, error) {
+	lock := &FileLock{}
+	if err := engine.Where("file_id=?", f.ID).First(lock).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if lock.IsExpired() {
+		return nil, nil
+	}
+	return lock, nil
+}
+
+// LoadFileLocks sets the active lock, together with its holder, of every
+// file of files.
+func LoadFileLocks(files []*File) error {
+	ids := make([]uint, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() {
+			ids = append(ids, file.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	locks := make([]*FileLock, 0)
+	if err := engine.Where("file_id IN (?) AND expires_at > ?", ids, time.Now()).Find(&locks).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	byFile := make(map[uint]*FileLock, len(locks))
+	for _, lock := range locks {
+		if err := lock.LoadUser(); err != nil && !IsErrUserNotExist(err) {
+			return err
+		}
+		byFile[lock.FileID] = lock
+	}
+
+	for _, file := range files {
+		file.Lock = byFile[file.ID]
+	}
+	return nil
+}
+
+// GetUserFileLocks returns the active locks held by the user uid, the
+// latest first.
+func GetUserFileLocks(uid uint) ([]*FileLock, error) {
+	locks := make([]*FileLock, 0)
+	err := engine.Where("user_id=? AND expires_at > ?", uid, time.Now()).Order("created_at DESC").Find(&locks).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return locks, nil
+}
+
+// checkFileLocks fails with ErrFileLocked if f or, for directories, any file
+// below f is locked by someone else than the user uid.
+func checkFileLocks(e *gorm.DB, f *File, uid uint) error {
+	db := e.Model(&FileLock{}).Where("file_locks.user_id<>? AND file_locks.expires_at > ?", uid, time.Now())
+	if f.IsDir() {
+		db = db.Joins("JOIN files ON files.id = file_locks.file_id AND files.deleted_at IS NULL").
+			Where("files.tree_path LIKE ?", f.ChildTreePath()+"%")
+	} else {
+		db = db.Where("file_locks.file_id=?", f.ID)
+	}
+
+	lock := &FileLock{}
+	if err := db.Select("file_locks.*").First(lock).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+	return ErrFileLocked{ID: lock.FileID, UserID: lock.UserID}
+}
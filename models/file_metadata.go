@@ -0,0 +1,182 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// FileTag is a user defined label of a file.
+type FileTag struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	FileID    uint   `gorm:"unique_index:idx_file_tag_file_name"`
+	Name      string `gorm:"unique_index:idx_file_tag_file_name;index"`
+	Owner     uint   `gorm:"index"`
+}
+
+// FileProperty is a user defined key/value pair of a file.
+type FileProperty struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	FileID    uint   `gorm:"unique_index:idx_file_property_file_name"`
+	Name      string `gorm:"unique_index:idx_file_property_file_name"`
+	Value     string `gorm:"type:varchar(1024)"`
+	Owner     uint   `gorm:"index"`
+}
+
+type FileMetadata struct {
+	Tags       []string
+	Properties map[string]string
+}
+
+type TagCount struct {
+	Name  string
+	Count int64
+}
+
+// MetadataFilter keeps the files carrying all Tags and all Properties, an
+// empty property value only requires the property to be set.
+type MetadataFilter struct {
+	Tags       []string
+	Properties map[string]string
+}
+
+func (m MetadataFilter) apply(db *gorm.DB) *gorm.DB {
+	for _, tag := range m.Tags {
+		db = db.Where("id IN (SELECT file_id FROM file_tags WHERE name=?)", tag)
+	}
+
+	for name, value := range m.Properties {
+		if len(value) == 0 {
+			db = db.Where("id IN (SELECT file_id FROM file_properties WHERE name=?)", name)
+		} else {
+			db = db.Where("id IN (SELECT file_id FROM file_properties WHERE name=? AND value=?)", name, value)
+		}
+	}
+	return db
+}
+
+// GetFileMetadata returns the tags and properties of the file fileID.
+func GetFileMetadata(fileID uint) (*FileMetadata, error) {
+	return getFileMetadata(engine, fileID)
+}
+
+func getFileMetadata(e *gorm.DB, fileID uint) (*FileMetadata, error) {
+	tags := make([]*FileTag, 0)
+	if err := e.Where("file_id=?", fileID).Order("name ASC").Find(&tags).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	properties := make([]*FileProperty, 0)
+	if err := e.Where("file_id=?", fileID).Order("name ASC").Find(&properties).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	metadata := &FileMetadata{
+		Tags:       make([]string, len(tags)),
+		Properties: make(map[string]string, len(properties)),
+	}
+	for i, tag := range tags {
+		metadata.Tags[i] = tag.Name
+	}
+	for _, property := range properties {
+		metadata.Properties[property.Name] = property.Value
+	}
+	return metadata, nil
+}
+
+// AddFileTags adds tags to f, tags which are already set are kept.
+func AddFileTags(f *File, tags []string) (*FileMetadata, error) {
+	tx := engine.Begin()
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	for _, tag := range tags {
+		if err := tx.Where(FileTag{FileID: f.ID, Name: tag}).Attrs(FileTag{Owner: f.Owner}).FirstOrCreate(&FileTag{}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := touchFile(tx, f); err != nil {
+		return nil, err
+	}
+
+	metadata, err := getFileMetadata(tx, f.ID)
+	if err != nil {
+		return nil, err
+	}
+	return metadata, tx.Commit().Error
+}
+
+func RemoveFileTag(f *File, tag string) error {
+	return removeFileMetadata(f, engine.Where("file_id=? AND name=?", f.ID, tag).Delete(&FileTag{}))
+}
+
+// SetFileProperties sets properties of f, other properties are kept.
+func SetFileProperties(f *File, properties map[string]string) (*FileMetadata, error) {
+	tx := engine.Begin()
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	for name, value := range properties {
+		if err := tx.Where(FileProperty{FileID: f.ID, Name: name}).Assign(FileProperty{Value: value, Owner: f.Owner}).FirstOrCreate(&FileProperty{}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := touchFile(tx, f); err != nil {
+		return nil, err
+	}
+
+	metadata, err := getFileMetadata(tx, f.ID)
+	if err != nil {
+		return nil, err
+	}
+	return metadata, tx.Commit().Error
+}
+
+func RemoveFileProperty(f *File, name string) error {
+	return removeFileMetadata(f, engine.Where("file_id=? AND name=?", f.ID, name).Delete(&FileProperty{}))
+}
+
+// removeFileMetadata bumps the version of f if result removed a tag or a
+// property of it.
+func removeFileMetadata(f *File, result *gorm.DB) error {
+	if err := result.Error; err != nil || result.RowsAffected == 0 {
+		return err
+	}
+	return touchFile(engine, f)
+}
+
+// GetUserTags returns the tags used by the user uid with the number of files
+// carrying them.
+func GetUserTags(uid uint) ([]*TagCount, error) {
+	tags := make([]*TagCount, 0)
+	err := engine.Table("file_tags").Select("name, COUNT(*) AS count").
+		Where("owner=? AND file_id IN (SELECT id FROM files WHERE owner=? AND deleted_at IS NULL)", uid, uid).
+		Group("name").Order("name ASC").Scan(&tags).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func copyFileMetadata(e *gorm.DB, src, dst *File) error {
+	if err := e.Exec("INSERT INTO file_tags (created_at, file_id, name, owner) SELECT ?, ?, name, ? FROM file_tags WHERE file_id=?", time.Now(), dst.ID, dst.Owner, src.ID).Error; err != nil {
+		return err
+	}
+	return e.Exec("INSERT INTO file_properties (created_at, updated_at, file_id, name, value, owner) SELECT ?, ?, ?, name, value, ? FROM file_properties WHERE file_id=?", time.Now(), time.Now(), dst.ID, dst.Owner, src.ID).Error
+}
+
+func deleteFileMetadata(e *gorm.DB, fileID uint) error {
+	if err := e.Where("file_id=?", fileID).Delete(&FileTag{}).Error; err != nil {
+		return err
+	}
+	return e.Where("file_id=?", fileID).Delete(&FileProperty{}).Error
+}
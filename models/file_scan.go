@@ -0,0 +1,235 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/czhj/ahfs/modules/scan"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/modules/storage"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+type FileScanStatus string
+
+const (
+	// FileScanNone is the status of files stored while scanning was disabled
+	FileScanNone        FileScanStatus = ""
+	FileScanPending     FileScanStatus = "pending"
+	FileScanClean       FileScanStatus = "clean"
+	FileScanQuarantined FileScanStatus = "quarantined"
+	// FileScanReleased is the status of quarantined files released by an
+	// administrator
+	FileScanReleased FileScanStatus = "released"
+)
+
+// heldBackScanStatuses are the statuses of files whose content may not be
+// read, they wait for the scanner or are quarantined.
+var heldBackScanStatuses = []FileScanStatus{FileScanPending, FileScanQuarantined}
+
+// readableFileCondition matches the files whose content may be read, it
+// takes heldBackScanStatuses as argument. Files stored before scanning was
+// added have no status at all.
+const readableFileCondition = "(scan_status IS NULL OR scan_status NOT IN (?))"
+
+// getUnexaminedFiles returns at most limit readable files of the user uid
+// matched by e which have no row in table yet, table records the files a
+// background service is done with. A non nil ids limits the files to those
+// ids. Files held back by the scanner are left out until they become
+// readable.
+func getUnexaminedFiles(e *gorm.DB, uid uint, table string, ids []uint, limit int) ([]*File, error) {
+	if ids != nil {
+		e = e.Where("id IN (?)", ids)
+	}
+
+	files := make([]*File, 0)
+	err := e.Where("owner=? AND file_type=? AND id NOT IN (SELECT file_id FROM "+table+" WHERE owner=?)", uid, FileTypeFile, uid).
+		Where(readableFileCondition, heldBackScanStatuses).
+		Order("id ASC").Limit(limit).Find(&files).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return files, nil
+}
+
+// IsDownloadable reports whether the content of f may be read, see
+// heldBackScanStatuses.
+func (f *File) IsDownloadable() bool {
+	return f.ScanStatus != FileScanPending && f.ScanStatus != FileScanQuarantined
+}
+
+// initialScanStatus returns the scan status of a new object, it waits for
+// the scanner if scanning is enabled.
+func initialScanStatus() FileScanStatus {
+	if !scan.IsEnabled() {
+		return FileScanNone
+	}
+	return FileScanPending
+}
+
+// scanUploadedFile scans the pending file f right away unless scanning is
+// asynchronous. It runs after the upload was committed, so the scanner
+// doesn't hold up other changes of the owner. Failed scans are retried by
+// the scanner service.
+func scanUploadedFile(f *File) {
+	if f.ScanStatus != FileScanPending || setting.Scanner.Async {
+		return
+	}
+
+	status, result, err := ScanObject(storage.ID(f.FileID))
+	if err == nil {
+		err = SetFileScanResult(f, status, result)
+	}
+
+	if err != nil && !IsErrFileNotExist(err) {
+		log.Warn("Failed to scan uploaded file, leaving it to the scanner service", zap.Uint("id", f.ID), zap.Error(err))
+	}
+}
+
+// ScanObject runs the scanner on the stored object id.
+func ScanObject(id storage.ID) (FileScanStatus, string, error) {
+	obj, err := storage.LFS.Read(id)
+	if err != nil {
+		return FileScanNone, "", err
+	}
+	defer obj.Reader.Close()
+
+	result, err := scan.Default.Scan(context.Background(), obj.Reader)
+	if err != nil {
+		return FileScanNone, "", ErrFileScanFailed{Reason: err.Error()}
+	}
+
+	if result.Infected {
+		return FileScanQuarantined, result.Signature, nil
+	}
+	return FileScanClean, "", nil
+}
+
+// GetPendingScanFiles returns the files of the user uid with an id greater
+// than afterID which wait for the scanner, ordered by id.
+func GetPendingScanFiles(uid uint, afterID uint, limit int) ([]*File, error) {
+	files := make([]*File, 0, limit)
+	err := engine.Where("owner=? AND scan_status=? AND id>?", uid, FileScanPending, afterID).Order("id ASC").Limit(limit).Find(&files).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return files, nil
+}
+
+// GetPendingScanOwners returns the users who have files waiting for the
+// scanner.
+func GetPendingScanOwners() ([]uint, error) {
+	owners := make([]uint, 0)
+	err := engine.Model(&File{}).Where("scan_status=?", FileScanPending).Pluck("DISTINCT owner", &owners).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return owners, nil
+}
+
+var fileReadableHooks []func(f *File)
+
+// AddFileReadableHook registers fn to be called with a file held back by the
+// scanner after it became readable, services which read the content of files
+// skip them until then.
+func AddFileReadableHook(fn func(f *File)) {
+	fileReadableHooks = append(fileReadableHooks, fn)
+}
+
+func afterFileReadable(f *File) {
+	for _, fn := range fileReadableHooks {
+		fn(f)
+	}
+}
+
+// SetFileScanResult stores the verdict of the scanner on the pending file f,
+// files released in the meantime are left alone. It fails with
+// ErrFileNotExist if f was deleted.
+func SetFileScanResult(f *File, status FileScanStatus, result string) error {
+	res := engine.Model(&File{}).Where("id=? AND scan_status=?", f.ID, FileScanPending).UpdateColumns(map[string]interface{}{
+		"scan_status": status,
+		"scan_result": result,
+	})
+	if err := res.Error; err != nil {
+		return err
+	}
+
+	if res.RowsAffected == 0 {
+		current := &File{}
+		if err := engine.Select("id, scan_status").Where("id=?", f.ID).First(current).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrFileNotExist{ID: f.ID}
+			}
+			return err
+		}
+		f.ScanStatus = current.ScanStatus
+		return nil
+	}
+
+	f.ScanStatus, f.ScanResult = status, result
+	if err := touchFile(engine, f); err != nil {
+		return err
+	}
+
+	if f.IsDownloadable() {
+		afterFileReadable(f)
+	}
+	auditFileQuarantine(f)
+	return nil
+}
+
+// auditFileQuarantine records the quarantine of f by the scanner.
+func auditFileQuarantine(f *File) {
+	if f.ScanStatus != FileScanQuarantined {
+		return
+	}
+
+	after := FileAuditState(f)
+	after["signature"] = f.ScanResult
+	RecordAuditLog(NewFileAuditLog(AuditFileQuarantine, f), nil, after)
+}
+
+// GetQuarantinedFiles returns the files of every user with status, the
+// newest first.
+func GetQuarantinedFiles(status FileScanStatus, opts ListOptions) ([]*File, int64, error) {
+	var count int64
+	if err := engine.Model(&File{}).Where("scan_status=?", status).Count(&count).Error; err != nil {
+		return nil, 0, fmt.Errorf("Count: %v", err)
+	}
+
+	db := engine.Where("scan_status=?", status).Order("updated_at DESC, id DESC")
+	if opts.Page != 0 {
+		db = opts.SetEnginePagination(db)
+	}
+
+	files := make([]*File, 0, opts.PageSize)
+	if err := db.Find(&files).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, 0, err
+	}
+	return files, count, nil
+}
+
+// ReleaseQuarantinedFile makes a quarantined or pending file downloadable.
+func ReleaseQuarantinedFile(f *File) error {
+	if f.IsDownloadable() {
+		return ErrFileNotQuarantined{ID: f.ID}
+	}
+
+	result := engine.Model(&File{}).Where("id=? AND scan_status IN (?)", f.ID, heldBackScanStatuses).UpdateColumn("scan_status", FileScanReleased)
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrFileNotQuarantined{ID: f.ID}
+	}
+	f.ScanStatus = FileScanReleased
+	if err := touchFile(engine, f); err != nil {
+		return err
+	}
+
+	afterFileReadable(f)
+	return nil
+}
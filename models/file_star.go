@@ -0,0 +1,46 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// FileStar marks a file or directory as a favorite of a user.
+type FileStar struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UserID    uint `gorm:"unique_index:idx_file_star_user_file"`
+	FileID    uint `gorm:"unique_index:idx_file_star_user_file;index"`
+}
+
+func StarFile(uid uint, f *File) error {
+	return engine.Where(FileStar{UserID: uid, FileID: f.ID}).FirstOrCreate(&FileStar{}).Error
+}
+
+func UnstarFile(uid uint, f *File) error {
+	return engine.Where("user_id=? AND file_id=?", uid, f.ID).Delete(&FileStar{}).Error
+}
+
+// GetStarredFiles returns the files starred by the user uid, the latest
+// starred first.
+func GetStarredFiles(uid uint, opts ListOptions) ([]*File, int64, error) {
+	join := "JOIN file_stars ON file_stars.file_id = files.id AND file_stars.user_id = ?"
+
+	var count int64
+	if err := engine.Model(&File{}).Joins(join, uid).Count(&count).Error; err != nil {
+		return nil, 0, fmt.Errorf("Count: %v", err)
+	}
+
+	db := engine.Joins(join, uid).Order("file_stars.created_at DESC").Order("files.id ASC")
+	if opts.Page != 0 {
+		db = opts.SetEnginePagination(db)
+	}
+
+	files := make([]*File, 0, opts.PageSize)
+	if err := db.Find(&files).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, 0, err
+	}
+	return files, count, nil
+}
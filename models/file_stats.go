@@ -0,0 +1,273 @@
+package models
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/czhj/ahfs/modules/typesniffer"
+	"github.com/jinzhu/gorm"
+)
+
+// Every directory keeps the aggregated size and number of files and
+// directories below it in TotalSize, FileCount and DirCount. They are
+// updated in the same transaction as the files, on all ancestors listed in
+// the TreePath of the changed entry.
+
+// fileStats is the contribution of an entry to the statistics of its
+// ancestors.
+type fileStats struct {
+	Size  int64
+	Files int64
+	Dirs  int64
+}
+
+func (s fileStats) neg() fileStats {
+	return fileStats{Size: -s.Size, Files: -s.Files, Dirs: -s.Dirs}
+}
+
+// getFileStats returns the contribution of f, the statistics of directories
+// are read again since f may have been loaded before the user was locked.
+func getFileStats(e *gorm.DB, f *File) (fileStats, error) {
+	if !f.IsDir() {
+		return fileStats{Size: f.FileSize, Files: 1}, nil
+	}
+
+	dir := new(File)
+	if err := e.Select("total_size, file_count, dir_count").Where("id=?", f.ID).First(dir).Error; err != nil {
+		return fileStats{}, err
+	}
+	return fileStats{Size: dir.TotalSize, Files: dir.FileCount, Dirs: dir.DirCount + 1}, nil
+}
+
+func treePathIDs(treePath string) []uint {
+	ids := make([]uint, 0)
+	for _, s := range strings.Split(treePath, "/") {
+		if id, err := strconv.ParseUint(s, 10, 64); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// updateAncestorStats adds s to the statistics of the directories listed in
+// treePath and fails if they outgrow the upload policies.
+func updateAncestorStats(e *gorm.DB, treePath string, s fileStats) error {
+	ids := treePathIDs(treePath)
+	if len(ids) == 0 || s == (fileStats{}) {
+		return nil
+	}
+
+	if err := addAncestorStats(e, ids, s); err != nil {
+		return err
+	}
+	return checkAncestorLimits(e, ids, s)
+}
+
+// moveAncestorStats moves s from the directories listed in oldTreePath to
+// the ones listed in newTreePath. The common ancestors keep their statistics,
+// so they aren't checked against the upload policies either.
+func moveAncestorStats(e *gorm.DB, oldTreePath, newTreePath string, s fileStats) error {
+	oldIDs, newIDs := treePathIDs(oldTreePath), treePathIDs(newTreePath)
+	n := commonAncestorCount(oldIDs, newIDs)
+
+	if n > 0 {
+		if err := e.Exec("UPDATE files SET version=version+1 WHERE id IN (?)", oldIDs[:n]).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(oldIDs) == n && len(newIDs) == n || s == (fileStats{}) {
+		return nil
+	}
+
+	if err := addAncestorStats(e, oldIDs[n:], s.neg()); err != nil {
+		return err
+	}
+	if err := addAncestorStats(e, newIDs[n:], s); err != nil {
+		return err
+	}
+	return checkAncestorLimits(e, newIDs[n:], s)
+}
+
+// newAncestorIDs returns the directories listed in newTreePath which aren't
+// listed in oldTreePath.
+func newAncestorIDs(oldTreePath, newTreePath string) []uint {
+	oldIDs, newIDs := treePathIDs(oldTreePath), treePathIDs(newTreePath)
+	return newIDs[commonAncestorCount(oldIDs, newIDs):]
+}
+
+func commonAncestorCount(oldIDs, newIDs []uint) int {
+	n := 0
+	for n < len(oldIDs) && n < len(newIDs) && oldIDs[n] == newIDs[n] {
+		n++
+	}
+	return n
+}
+
+func addAncestorStats(e *gorm.DB, ids []uint, s fileStats) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return e.Exec("UPDATE files SET total_size=total_size+?, file_count=file_count+?, dir_count=dir_count+?, version=version+1 WHERE id IN (?)",
+		s.Size, s.Files, s.Dirs, ids).Error
+}
+
+// FillDirectoryStats recomputes the statistics of all directories of users
+// whose root doesn't add up, it runs once after the statistics were
+// introduced, see RunMigration.
+func FillDirectoryStats(e *gorm.DB) error {
+	// the increments of the statistics leave NULL as it is
+	err := fillNullColumns(e, "files", map[string]interface{}{
+		"total_size": 0,
+		"file_count": 0,
+		"dir_count":  0,
+		"quota":      0,
+	})
+	if err != nil {
+		return err
+	}
+
+	roots := make([]*File, 0)
+	err = e.Raw(`SELECT r.id, r.owner FROM files r WHERE r.parent_id=0 AND r.deleted_at IS NULL AND (
+		COALESCE(r.total_size, 0) <> (SELECT COALESCE(SUM(f.file_size), 0) FROM files f WHERE f.owner=r.owner AND f.deleted_at IS NULL) OR
+		COALESCE(r.file_count, 0) <> (SELECT COUNT(*) FROM files f WHERE f.owner=r.owner AND f.deleted_at IS NULL AND f.file_type=?) OR
+		COALESCE(r.dir_count, 0) <> (SELECT COUNT(*) FROM files f WHERE f.owner=r.owner AND f.deleted_at IS NULL AND f.file_type=? AND f.parent_id<>0))`,
+		FileTypeFile, FileTypeDir).Scan(&roots).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	for _, root := range roots {
+		if err := fillUserDirectoryStats(e, root.Owner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fillUserDirectoryStats(e *gorm.DB, uid uint) error {
+	files := make([]*File, 0)
+	if err := e.Select("id, tree_path, file_type, file_size").Where("owner=?", uid).Find(&files).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+
+	stats := make(map[uint]*fileStats)
+	for _, f := range files {
+		if f.IsDir() {
+			if _, ok := stats[f.ID]; !ok {
+				stats[f.ID] = &fileStats{}
+			}
+		}
+
+		var s fileStats
+		if f.IsDir() {
+			s.Dirs = 1
+		} else {
+			s = fileStats{Size: f.FileSize, Files: 1}
+		}
+
+		for _, id := range treePathIDs(f.TreePath) {
+			ancestor, ok := stats[id]
+			if !ok {
+				ancestor = &fileStats{}
+				stats[id] = ancestor
+			}
+			ancestor.Size += s.Size
+			ancestor.Files += s.Files
+			ancestor.Dirs += s.Dirs
+		}
+	}
+
+	for id, s := range stats {
+		err := e.Model(&File{}).Where("id=?", id).UpdateColumns(map[string]interface{}{
+			"total_size": s.Size,
+			"file_count": s.Files,
+			"dir_count":  s.Dirs,
+			"version":    gorm.Expr("version+1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileTypeUsage is the space taken by the files of one content type.
+type FileTypeUsage struct {
+	ContentType string
+	Count       int64
+	Size        int64
+}
+
+type DirectoryBreakdown struct {
+	Largest []*File
+	Types   []*FileTypeUsage
+}
+
+// GetDirectoryBreakdown returns the limit largest subdirectories of dir and
+// the usage of all files below it grouped by content type, largest first.
+func GetDirectoryBreakdown(dir *File, limit int) (*DirectoryBreakdown, error) {
+	if !dir.IsDir() {
+		return nil, ErrFileNotDirectory{ID: dir.ID, Path: dir.FilePath()}
+	}
+
+	largest := make([]*File, 0, limit)
+	err := engine.Where("parent_id=? AND file_type=?", dir.ID, FileTypeDir).
+		Order("total_size DESC").Order("id ASC").Limit(limit).Find(&largest).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	rows := make([]*FileTypeUsage, 0)
+	err = engine.Model(&File{}).Select("content_type, COUNT(*) AS count, SUM(file_size) AS size").
+		Where("tree_path LIKE ? AND file_type=? AND COALESCE(content_type, '')<>''", dir.ChildTreePath()+"%", FileTypeFile).
+		Group("content_type").Scan(&rows).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	// files stored before types were sniffed have no content type, they
+	// are grouped by their extension instead.
+	legacy := make([]*File, 0)
+	err = engine.Select("file_name, file_size").
+		Where("tree_path LIKE ? AND file_type=? AND COALESCE(content_type, '')=''", dir.ChildTreePath()+"%", FileTypeFile).
+		Find(&legacy).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	for _, f := range legacy {
+		rows = append(rows, &FileTypeUsage{ContentType: typesniffer.ByName(f.FileName), Count: 1, Size: f.FileSize})
+	}
+
+	usages := make(map[string]*FileTypeUsage)
+	types := make([]*FileTypeUsage, 0)
+	for _, row := range rows {
+		contentType := row.ContentType
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			contentType = mediaType
+		}
+
+		usage, ok := usages[contentType]
+		if !ok {
+			usage = &FileTypeUsage{ContentType: contentType}
+			usages[contentType] = usage
+			types = append(types, usage)
+		}
+		usage.Count += row.Count
+		usage.Size += row.Size
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].Size != types[j].Size {
+			return types[i].Size > types[j].Size
+		}
+		return types[i].ContentType < types[j].ContentType
+	})
+
+	return &DirectoryBreakdown{Largest: largest, Types: types}, nil
+}
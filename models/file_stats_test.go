@@ -0,0 +1,221 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertDirectoryStats checks the statistics of every directory of the user
+// u against the ones counted from the entries below it.
+func assertDirectoryStats(t *testing.T, u *User, msg string) {
+	files := make([]*File, 0)
+	if err := engine.Where("owner=?", u.ID).Find(&files).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range files {
+		if !dir.IsDir() {
+			continue
+		}
+
+		var want fileStats
+		for _, f := range files {
+			if !dir.IsAncestorOf(f) {
+				continue
+			}
+			if f.IsDir() {
+				want.Dirs++
+			} else {
+				want.Size += f.FileSize
+				want.Files++
+			}
+		}
+
+		got := fileStats{Size: dir.TotalSize, Files: dir.FileCount, Dirs: dir.DirCount}
+		assert.Equal(t, want, got, "%s: %s", msg, dir.FilePath())
+	}
+}
+
+func TestTreePathIDs(t *testing.T) {
+	cases := []struct {
+		treePath string
+		ids      []uint
+	}{
+		{"", []uint{}},
+		{"/", []uint{}},
+		{"/1/", []uint{1}},
+		{"/1/5/12/", []uint{1, 5, 12}},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.ids, treePathIDs(c.treePath), c.treePath)
+	}
+}
+
+func TestNewAncestorIDs(t *testing.T) {
+	cases := []struct {
+		oldTreePath string
+		newTreePath string
+		ids         []uint
+	}{
+		{"/1/", "/1/", []uint{}},
+		{"/1/2/", "/1/", []uint{}},
+		{"/1/", "/1/2/3/", []uint{2, 3}},
+		{"/1/2/3/", "/1/2/4/", []uint{4}},
+		{"/1/2/", "/1/3/2/", []uint{3, 2}},
+		{"/1/", "/7/", []uint{7}},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.ids, newAncestorIDs(c.oldTreePath, c.newTreePath), "%s -> %s", c.oldTreePath, c.newTreePath)
+	}
+}
+
+func TestDirectoryStats(t *testing.T) {
+	u, root := newTestUser(t)
+	a := createTestDir(t, u, root, "a")
+	b := createTestDir(t, u, a, "b")
+	x := createTestDir(t, u, root, "x")
+
+	steps := []struct {
+		desc string
+		run  func() error
+	}{
+		{"upload", func() error {
+			uploadTestFile(t, u, b, "f.txt", "12345")
+			uploadTestFile(t, u, a, "g.txt", "123")
+			return nil
+		}},
+		{"replace", func() error {
+			_, err := UploadFile(u, b, "f.txt", 2, strings.NewReader("12"), ConflictOverwrite, "", nil)
+			return err
+		}},
+		{"create directory", func() error {
+			_, err := CreateDirectory(u.ID, b, "c", ConflictReject)
+			return err
+		}},
+		{"copy directory", func() error {
+			_, err := CopyFile(u.ID, getTestFile(t, u, "/a"), x, "", ConflictReject)
+			return err
+		}},
+		{"move file", func() error {
+			_, err := MoveFile(u.ID, getTestFile(t, u, "/a/g.txt"), getTestFile(t, u, "/a/b/c"), "", ConflictReject, "")
+			return err
+		}},
+		{"move directory", func() error {
+			_, err := MoveFile(u.ID, getTestFile(t, u, "/x/a/b"), getTestFile(t, u, "/"), "", ConflictReject, "")
+			return err
+		}},
+		{"merge directory", func() error {
+			uploadTestFile(t, u, getTestFile(t, u, "/b/c"), "h.txt", "1234")
+			_, err := MoveFile(u.ID, getTestFile(t, u, "/b/c"), getTestFile(t, u, "/a/b"), "", ConflictMerge, "")
+			return err
+		}},
+		{"rename", func() error {
+			_, err := RenameFile(u.ID, getTestFile(t, u, "/x/a"), "y", ConflictReject, "")
+			return err
+		}},
+		{"delete file", func() error {
+			return DeleteFile(u.ID, getTestFile(t, u, "/a/b/f.txt"), "")
+		}},
+		{"delete directory", func() error {
+			return DeleteFile(u.ID, getTestFile(t, u, "/x"), "")
+		}},
+	}
+
+	for _, s := range steps {
+		if !assert.NoError(t, s.run(), s.desc) {
+			return
+		}
+		assertDirectoryStats(t, u, s.desc)
+	}
+}
+
+func TestFillDirectoryStats(t *testing.T) {
+	u, root := newTestUser(t)
+	a := createTestDir(t, u, root, "a")
+	uploadTestFile(t, u, createTestDir(t, u, a, "b"), "f.txt", "12345")
+	uploadTestFile(t, u, a, "g.txt", "123")
+
+	// directories created before the statistics existed
+	if err := engine.Exec("UPDATE files SET total_size=0, file_count=0, dir_count=0 WHERE owner=?", u.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, FillDirectoryStats(engine))
+	assertDirectoryStats(t, u, "fill")
+	assert.Equal(t, int64(8), getTestFile(t, u, "/").TotalSize)
+}
+
+func TestFillDirectoryStatsUpgrade(t *testing.T) {
+	e, close := openUpgradeTestDB(t)
+	defer close()
+
+	deleted := time.Now()
+	root := &baselineFile{FileID: "1-root", FileName: "/", FileType: FileTypeDir, Owner: 1}
+	createBaselineFiles(t, e, root)
+	a := &baselineFile{FileName: "a", FileType: FileTypeDir, Owner: 1, ParentID: root.ID}
+	createBaselineFiles(t, e, a)
+	createBaselineFiles(t, e,
+		&baselineFile{FileName: "f.txt", FileType: FileTypeFile, FileSize: 5, Owner: 1, ParentID: a.ID},
+		&baselineFile{FileName: "g.txt", FileType: FileTypeFile, FileSize: 3, Owner: 1, ParentID: root.ID},
+		&baselineFile{FileName: "gone.txt", FileType: FileTypeFile, FileSize: 7, Owner: 1, ParentID: root.ID, DeletedAt: &deleted},
+	)
+
+	err := e.AutoMigrate(&File{}, &Migration{}).Error
+	if err == nil {
+		err = FillFileTreePath(e)
+	}
+	if err == nil {
+		err = RunMigration(e, "fill_directory_stats", FillDirectoryStats)
+	}
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var nulls int
+	assert.NoError(t, e.Table("files").Where("total_size IS NULL OR file_count IS NULL OR dir_count IS NULL OR quota IS NULL").Count(&nulls).Error)
+	assert.Equal(t, 0, nulls)
+
+	stats := func(id uint) fileStats {
+		f := &File{}
+		if err := e.First(f, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		return fileStats{Size: f.TotalSize, Files: f.FileCount, Dirs: f.DirCount}
+	}
+	assert.Equal(t, fileStats{Size: 8, Files: 2, Dirs: 1}, stats(root.ID))
+	assert.Equal(t, fileStats{Size: 5, Files: 1}, stats(a.ID))
+
+	// later changes add to the filled statistics
+	assert.NoError(t, addAncestorStats(e, []uint{root.ID, a.ID}, fileStats{Size: 2, Files: 1}))
+	assert.Equal(t, fileStats{Size: 10, Files: 3, Dirs: 1}, stats(root.ID))
+	assert.Equal(t, fileStats{Size: 7, Files: 2}, stats(a.ID))
+}
+
+func TestDirectoryBreakdownLegacyContentType(t *testing.T) {
+	u, root := newTestUser(t)
+	uploadTestFile(t, u, root, "a.txt", "123")
+	legacy := uploadTestFile(t, u, root, "b.txt", "12")
+	uploadTestFile(t, u, root, "c.png", "\x89PNG\r\n\x1a\n")
+
+	// files stored before content types were sniffed
+	if err := engine.Exec("UPDATE files SET content_type=NULL WHERE id=?", legacy.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	breakdown, err := GetDirectoryBreakdown(root, 10)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	usages := make(map[string]FileTypeUsage)
+	for _, usage := range breakdown.Types {
+		usages[usage.ContentType] = *usage
+	}
+	assert.Equal(t, FileTypeUsage{ContentType: "text/plain", Count: 2, Size: 5}, usages["text/plain"])
+	assert.Equal(t, FileTypeUsage{ContentType: "image/png", Count: 1, Size: 8}, usages["image/png"])
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/czhj/ahfs/modules/storage"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+// Thumbnail is a rendered preview of an image file. Files which aren't
+// images or fail to decode get a single row with Size 0 and no object.
+type Thumbnail struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	FileID      uint `gorm:"unique_index:idx_thumbnail_file_size"`
+	Size        int  `gorm:"unique_index:idx_thumbnail_file_size"`
+	Owner       uint `gorm:"index"`
+	ObjectID    string
+	ObjectSize  int64
+	ContentType string
+}
+
+// GetThumbnail returns the smallest thumbnail of the file fileID which is
+// at least size pixels wide, or the largest one if all are smaller.
+func GetThumbnail(fileID uint, size int) (*Thumbnail, error) {
+	thumb := new(Thumbnail)
+	err := engine.Where("file_id=? AND size>=?", fileID, size).Where("size>0").Order("size ASC").First(thumb).Error
+	if gorm.IsRecordNotFoundError(err) {
+		err = engine.Where("file_id=? AND size>0", fileID).Order("size DESC").First(thumb).Error
+	}
+
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrThumbnailNotExist{FileID: fileID, Size: size}
+		}
+		return nil, err
+	}
+	return thumb, nil
+}
+
+// GetUnthumbnailedFiles returns at most limit files of the user uid with one
+// of contentTypes without a Thumbnail. Files stored before types were
+// sniffed are returned as well, their type is only known after decoding.
+func GetUnthumbnailedFiles(uid uint, contentTypes []string, ids []uint, limit int) ([]*File, error) {
+	e := engine.Where("content_type IN (?) OR content_type='' OR content_type IS NULL", contentTypes)
+	return getUnexaminedFiles(e, uid, "thumbnails", ids, limit)
+}
+
+// SaveThumbnails stores the thumbnails rendered for a file.
+func SaveThumbnails(thumbs []*Thumbnail) error {
+	tx := engine.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	for _, thumb := range thumbs {
+		if err := tx.Create(thumb).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// PurgeStaleThumbnails removes the thumbnails of files of the user uid which
+// no longer exist, of the files ids unless ids is nil.
+func PurgeStaleThumbnails(uid uint, ids []uint) error {
+	thumbs := make([]*Thumbnail, 0)
+	err := staleFileCondition(engine, uid, ids).Find(&thumbs).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, thumb := range thumbs {
+		if len(thumb.ObjectID) != 0 {
+			if err := storage.LFS.Delete(storage.ID(thumb.ObjectID)); err != nil && err != storage.ErrNotFound {
+				log.Error("Failed to remove thumbnail", zap.String("id", thumb.ObjectID), zap.Error(err))
+				continue
+			}
+		}
+
+		if err := engine.Delete(thumb).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
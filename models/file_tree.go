@@ -0,0 +1,92 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Every file stores the ids of its ancestors in TreePath, e.g. "/1/5/" for a
+// file whose parent is 5 and grand parent is the root 1, the root itself uses
+// "/". A subtree is therefore selected by a single prefix match and can be
+// relocated with a single UPDATE statement.
+
+// ChildTreePath returns the TreePath of the direct children of f.
+func (f *File) ChildTreePath() string {
+	return f.TreePath + strconv.FormatUint(uint64(f.ID), 10) + "/"
+}
+
+// IsAncestorOf reports whether c is located somewhere under f.
+func (f *File) IsAncestorOf(c *File) bool {
+	return strings.HasPrefix(c.TreePath, f.ChildTreePath())
+}
+
+func concatSQL(e *gorm.DB, a, b string) string {
+	if e.Dialect().GetName() == "mysql" {
+		return fmt.Sprintf("CONCAT(%s, %s)", a, b)
+	}
+	return fmt.Sprintf("(%s || %s)", a, b)
+}
+
+// relocateDescendants rewrites tree_path and file_dir of all descendants of f
+// after f has been moved or renamed.
+func relocateDescendants(e *gorm.DB, f *File, oldChildTreePath, oldPath string) error {
+	newChildTreePath := f.ChildTreePath()
+	newPath := f.FilePath()
+	if newChildTreePath == oldChildTreePath && newPath == oldPath {
+		return nil
+	}
+
+	sql := fmt.Sprintf("UPDATE files SET tree_path=%s, file_dir=%s, version=version+1 WHERE tree_path LIKE ?",
+		concatSQL(e, "?", "SUBSTR(tree_path, ?)"),
+		concatSQL(e, "?", "SUBSTR(file_dir, ?)"))
+
+	return e.Exec(sql,
+		newChildTreePath, len(oldChildTreePath)+1,
+		newPath, utf8.RuneCountInString(oldPath)+1,
+		oldChildTreePath+"%").Error
+}
+
+func getDescendants(e *gorm.DB, f *File) ([]*File, error) {
+	files := make([]*File, 0)
+	if err := e.Where("tree_path LIKE ?", f.ChildTreePath()+"%").Find(&files).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return files, nil
+		}
+		return nil, err
+	}
+	return files, nil
+}
+
+// FillFileTreePath computes the TreePath of files created before it existed,
+// one directory level per round.
+func FillFileTreePath(e *gorm.DB) error {
+	err := e.Exec("UPDATE files SET tree_path=? WHERE parent_id=0 AND (tree_path IS NULL OR tree_path='')", "/").Error
+	if err != nil {
+		return err
+	}
+
+	for {
+		parents := make([]*File, 0)
+		err := e.Raw(`SELECT DISTINCT p.id, p.tree_path FROM files p INNER JOIN files c ON c.parent_id=p.id
+			WHERE p.tree_path IS NOT NULL AND p.tree_path<>'' AND (c.tree_path IS NULL OR c.tree_path='')`).Scan(&parents).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+
+		if len(parents) == 0 {
+			return nil
+		}
+
+		for _, p := range parents {
+			err := e.Exec("UPDATE files SET tree_path=? WHERE parent_id=? AND (tree_path IS NULL OR tree_path='')",
+				p.ChildTreePath(), p.ID).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
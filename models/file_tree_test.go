@@ -0,0 +1,143 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertTreePaths checks the tree path and directory of every entry of the
+// user u against the ones derived from the parents.
+func assertTreePaths(t *testing.T, u *User, msg string) {
+	files := make([]*File, 0)
+	if err := engine.Where("owner=?", u.ID).Find(&files).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	byID := make(map[uint]*File, len(files))
+	for _, f := range files {
+		byID[f.ID] = f
+	}
+
+	for _, f := range files {
+		if f.ParentID == 0 {
+			assert.Equal(t, "/", f.TreePath, msg)
+			continue
+		}
+
+		parent := byID[f.ParentID]
+		if assert.NotNil(t, parent, msg) {
+			assert.Equal(t, parent.ChildTreePath(), f.TreePath, "%s: %s", msg, f.FileName)
+			assert.Equal(t, parent.FilePath(), f.FileDir, "%s: %s", msg, f.FileName)
+		}
+	}
+}
+
+func TestRelocateDescendants(t *testing.T) {
+	cases := []struct {
+		desc  string
+		src   string
+		dst   string
+		name  string
+		paths []string
+	}{
+		{"rename", "/a", "/", "renamed", []string{"/renamed/b/c/f.txt", "/renamed/b/g.txt", "/x/h.txt"}},
+		{"rename to a longer name", "/a/b", "/a", "a much longer name", []string{"/a/a much longer name/c/f.txt", "/a/a much longer name/g.txt", "/x/h.txt"}},
+		{"rename to a non ASCII name", "/a/b", "/a", "目录", []string{"/a/目录/c/f.txt", "/a/目录/g.txt", "/x/h.txt"}},
+		{"move down", "/a/b", "/x", "", []string{"/a", "/x/b/c/f.txt", "/x/b/g.txt", "/x/h.txt"}},
+		{"move up", "/a/b/c", "/", "", []string{"/a/b/g.txt", "/c/f.txt", "/x/h.txt"}},
+		{"move and rename", "/a", "/x", "y", []string{"/x/h.txt", "/x/y/b/c/f.txt", "/x/y/b/g.txt"}},
+	}
+
+	for _, c := range cases {
+		u, root := newTestUser(t)
+		a := createTestDir(t, u, root, "a")
+		b := createTestDir(t, u, a, "b")
+		uploadTestFile(t, u, createTestDir(t, u, b, "c"), "f.txt", "f")
+		uploadTestFile(t, u, b, "g.txt", "g")
+		uploadTestFile(t, u, createTestDir(t, u, root, "x"), "h.txt", "h")
+
+		src, dst := getTestFile(t, u, c.src), getTestFile(t, u, c.dst)
+		var err error
+		if src.ParentID == dst.ID {
+			_, err = RenameFile(u.ID, src, c.name, ConflictReject, "")
+		} else {
+			_, err = MoveFile(u.ID, src, dst, c.name, ConflictReject, "")
+		}
+		if !assert.NoError(t, err, c.desc) {
+			continue
+		}
+
+		assertTreePaths(t, u, c.desc)
+		for _, p := range c.paths {
+			_, err := GetFileByPath(u.ID, p)
+			assert.NoError(t, err, "%s: %s", c.desc, p)
+		}
+	}
+}
+
+func TestMoveIntoItself(t *testing.T) {
+	u, root := newTestUser(t)
+	a := createTestDir(t, u, root, "a")
+	b := createTestDir(t, u, a, "b")
+
+	cases := []struct {
+		desc string
+		dst  *File
+	}{
+		{"itself", a},
+		{"child", b},
+		{"grand child", createTestDir(t, u, b, "c")},
+	}
+
+	for _, c := range cases {
+		_, err := MoveFile(u.ID, a, c.dst, "", ConflictReject, "")
+		assert.True(t, IsErrFileMoveIntoItself(err), c.desc)
+	}
+	assertTreePaths(t, u, "move into itself")
+}
+
+func TestFillFileTreePath(t *testing.T) {
+	u, root := newTestUser(t)
+	a := createTestDir(t, u, root, "a")
+	uploadTestFile(t, u, createTestDir(t, u, a, "b"), "f.txt", "f")
+	uploadTestFile(t, u, a, "g.txt", "g")
+
+	// entries created before the tree paths existed
+	if err := engine.Exec("UPDATE files SET tree_path='' WHERE owner=?", u.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, FillFileTreePath(engine))
+	assertTreePaths(t, u, "fill")
+}
+
+func TestStaleDirectory(t *testing.T) {
+	u, root := newTestUser(t)
+	a := createTestDir(t, u, root, "a")
+	b := createTestDir(t, u, root, "b")
+
+	// the copies were loaded before b was moved below a
+	staleA, staleB := *a, *b
+	if _, err := MoveFile(u.ID, b, a, "", ConflictReject, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := MoveFile(u.ID, a, &staleB, "", ConflictReject, "")
+	assert.True(t, IsErrFileMoveIntoItself(err))
+
+	stale := staleB
+	_, err = CopyFile(u.ID, &staleA, &stale, "", ConflictReject)
+	assert.True(t, IsErrFileMoveIntoItself(err))
+
+	stale = staleB
+	uploadTestFile(t, u, &stale, "f.txt", "f")
+	stale = staleB
+	createTestDir(t, u, &stale, "c")
+	assert.Equal(t, []string{"c", "f.txt"}, listTestDir(t, getTestFile(t, u, "/a/b")))
+	assertTreePaths(t, u, "stale parent")
+
+	a = getTestFile(t, u, "/a")
+	assert.Equal(t, int64(1), a.TotalSize)
+	assert.Equal(t, int64(2), a.DirCount)
+}
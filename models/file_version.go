@@ -0,0 +1,65 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ETag identifies the current version of f, it changes with every change of
+// the entry and, for directories, of the entries below it.
+func (f *File) ETag() string {
+	return fmt.Sprintf(`"%d-%d"`, f.ID, f.Version)
+}
+
+// MatchETag reports whether f satisfies the If-Match header value match,
+// which is either "*" or a list of entity tags.
+func (f *File) MatchETag(match string) bool {
+	for _, tag := range strings.Split(match, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == f.ETag() {
+			return true
+		}
+	}
+	return false
+}
+
+// FillFileVersion starts the versions of the entries stored before versions
+// were introduced, they are NULL and wouldn't be increased by changes. It
+// runs once, see RunMigration.
+func FillFileVersion(e *gorm.DB) error {
+	return fillNullColumns(e, "files", map[string]interface{}{"version": 0})
+}
+
+// reloadFile replaces f with its current row and fails with ErrFileModified
+// if etag isn't empty and doesn't match it, see MatchETag. Changes of files
+// are serialized by LockUserFile, so the result holds until the lock of the
+// owner is released.
+func reloadFile(e *gorm.DB, f *File, etag string) error {
+	current := &File{}
+	if err := e.Where("id=?", f.ID).First(current).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return ErrFileNotExist{ID: f.ID, Owner: f.Owner}
+		}
+		return err
+	}
+
+	if len(etag) != 0 && !current.MatchETag(etag) {
+		return ErrFileModified{ID: f.ID, Version: current.Version}
+	}
+
+	*f = *current
+	return nil
+}
+
+// touchFile bumps the version of f and of the directories above it, for
+// changes which leave the statistics of the directories alone.
+func touchFile(e *gorm.DB, f *File) error {
+	ids := append(treePathIDs(f.TreePath), f.ID)
+	if err := e.Exec("UPDATE files SET version=version+1 WHERE id IN (?)", ids).Error; err != nil {
+		return err
+	}
+	f.Version++
+	return nil
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchETag(t *testing.T) {
+	f := &File{ID: 7, Version: 3}
+
+	cases := []struct {
+		match string
+		want  bool
+	}{
+		{`"7-3"`, true},
+		{`*`, true},
+		{`"7-2", "7-3"`, true},
+		{` "7-3" `, true},
+		{`"7-2"`, false},
+		{`7-3`, false},
+		{`W/"7-3"`, false},
+		{``, false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.want, f.MatchETag(c.match), c.match)
+	}
+}
+
+func TestFileVersions(t *testing.T) {
+	u, root := newTestUser(t)
+	dir := createTestDir(t, u, root, "dir")
+	f := uploadTestFile(t, u, dir, "f.txt", "f")
+	etag := f.ETag()
+
+	// every change bumps the entry and the directories above it
+	versions := func() []int64 {
+		return []int64{getTestFile(t, u, "/").Version, getTestFile(t, u, "/dir").Version}
+	}
+	before := versions()
+
+	f, err := RenameFile(u.ID, f, "g.txt", ConflictReject, etag)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotEqual(t, etag, f.ETag())
+	after := versions()
+	assert.True(t, after[0] > before[0] && after[1] > before[1], "%v %v", before, after)
+
+	_, err = RenameFile(u.ID, f, "h.txt", ConflictReject, etag)
+	assert.True(t, IsErrFileModified(err))
+	assert.True(t, IsErrFileModified(DeleteFile(u.ID, f, etag)))
+	_, err = MoveFile(u.ID, f, root, "", ConflictReject, etag)
+	assert.True(t, IsErrFileModified(err))
+
+	// an upload with an entity tag must replace that entry
+	_, err = UploadFile(u, dir, "new.txt", 1, nil, ConflictOverwrite, f.ETag(), nil)
+	assert.True(t, IsErrFileModified(err))
+
+	assert.NoError(t, DeleteFile(u.ID, f, f.ETag()))
+}
+
+func TestFillFileVersionUpgrade(t *testing.T) {
+	e, close := openUpgradeTestDB(t)
+	defer close()
+
+	root := &baselineFile{FileID: "1-root", FileName: "/", FileType: FileTypeDir, Owner: 1}
+	createBaselineFiles(t, e, root)
+	f := &baselineFile{FileName: "f.txt", FileType: FileTypeFile, Owner: 1, ParentID: root.ID}
+	createBaselineFiles(t, e, f)
+
+	err := e.AutoMigrate(&File{}, &Migration{}).Error
+	if err == nil {
+		err = FillFileTreePath(e)
+	}
+	if err == nil {
+		err = RunMigration(e, "fill_file_version", FillFileVersion)
+	}
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	file := &File{}
+	if err := e.First(file, f.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fmt.Sprintf(`"%d-0"`, f.ID), file.ETag())
+
+	// changes of the filled versions are visible in the entity tags
+	assert.NoError(t, touchFile(e, file))
+	assert.NoError(t, reloadFile(e, file, fmt.Sprintf(`"%d-1"`, f.ID)))
+
+	reloaded := &File{}
+	assert.NoError(t, e.First(reloaded, root.ID).Error)
+	assert.Equal(t, int64(1), reloaded.Version)
+}
@@ -47,4 +47,8 @@ const (
 	SearchOrderByMaxFileCapacityReverse  = "max_file_capacity DESC"
 	SearchOrderByUsedFileCapacity        = "used_file_capacity ASC"
 	SearchOrderByUsedFileCapacityReverse = "used_file_capacity DESC"
+	SearchOrderByFileName                = "file_name ASC"
+	SearchOrderByFileNameReverse         = "file_name DESC"
+	SearchOrderByFileSize                = "file_size ASC"
+	SearchOrderByFileSizeReverse         = "file_size DESC"
 )
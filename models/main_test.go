@@ -0,0 +1,163 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/modules/storage"
+	"github.com/czhj/ahfs/modules/storage/local"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "ahfs-models")
+	if err != nil {
+		panic(err)
+	}
+
+	setting.ServerMode = "release"
+	setting.Database.Driver = "sqlite3"
+	setting.Database.URL = filepath.Join(dir, "test.db")
+	setting.Upload = &setting.UploadService{}
+	storage.LFS = local.NewStorage(local.LocalStorageConfig{Directory: filepath.Join(dir, "lfs")})
+
+	err = NewEngine(context.Background(), func(e *gorm.DB) error {
+		return e.AutoMigrate(&User{}, &File{}, &FileTag{}, &FileProperty{}, &FileStar{}, &FileActivity{}, &ShareLink{},
+			&FileGrant{}, &TeamMember{}, &FileLock{}, &FileChange{}, &UploadPolicy{}, &AuditLog{}, &Migration{}).Error
+	})
+	if err == nil {
+		err = AddFileNameUniqueIndex(engine)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestUser creates a user with a unique name and returns its root
+// directory.
+func newTestUser(t *testing.T) (*User, *File) {
+	var count int64
+	engine.Model(&User{}).Count(&count)
+	name := fmt.Sprintf("user%d", count+1)
+
+	u := &User{Username: name, Email: name + "@example.com", Password: "password", MaxFileCapacity: 1 << 20}
+	if err := CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := GetUserRootFile(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, root
+}
+
+func createTestDir(t *testing.T, u *User, parent *File, name string) *File {
+	dir, err := CreateDirectory(u.ID, parent, name, ConflictReject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func uploadTestFile(t *testing.T, u *User, parent *File, name, content string) *File {
+	f, err := UploadFile(u, parent, name, int64(len(content)), strings.NewReader(content), ConflictReject, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// getTestFile reloads the entry at p of the user u.
+func getTestFile(t *testing.T, u *User, p string) *File {
+	f, err := GetFileByPath(u.ID, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// listTestDir returns the names of the entries of dir.
+func listTestDir(t *testing.T, dir *File) []string {
+	files, err := dir.ReadDir(ReadDirOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.FileName
+	}
+	return names
+}
+
+// baselineFile is the files table of the first release, the upgrade tests
+// migrate rows stored in it.
+type baselineFile struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time `sql:"index"`
+
+	FileID   string `gorm:"unique_index"`
+	FileDir  string
+	FileName string
+
+	FileType FileType
+	FileSize int64
+
+	Owner    uint
+	ParentID uint
+}
+
+func (baselineFile) TableName() string {
+	return "files"
+}
+
+// openUpgradeTestDB opens a new database holding the baseline files table,
+// close removes it.
+func openUpgradeTestDB(t *testing.T) (e *gorm.DB, close func()) {
+	dir, err := ioutil.TempDir("", "ahfs-upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err = gorm.Open("sqlite3", filepath.Join(dir, "upgrade.db"))
+	if err == nil {
+		err = e.CreateTable(&baselineFile{}).Error
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return e, func() {
+		e.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// createBaselineFiles stores files in the baseline table of e, every entry
+// gets a file id from its owner and its name.
+func createBaselineFiles(t *testing.T, e *gorm.DB, files ...*baselineFile) {
+	for _, f := range files {
+		if len(f.FileID) == 0 {
+			f.FileID = fmt.Sprintf("%d-%d-%s", f.Owner, f.ParentID, f.FileName)
+		}
+		if err := e.Create(f).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Migration records a data migration which ran already, migrations which
+// only have to run once, like filling a new column, are skipped afterwards.
+type Migration struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+
+	Name string `gorm:"unique_index"`
+}
+
+// RunMigration runs migrate unless the migration name ran already, the
+// migration and its record are committed together.
+func RunMigration(e *gorm.DB, name string, migrate func(*gorm.DB) error) error {
+	var count int
+	if err := e.Model(&Migration{}).Where("name=?", name).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count != 0 {
+		return nil
+	}
+
+	tx := e.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	if err := migrate(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Create(&Migration{Name: name}).Error; err != nil {
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// fillNullColumns sets the columns of table to the values of columns where
+// they are NULL, which is what the rows stored before a column was added
+// hold in it.
+func fillNullColumns(e *gorm.DB, table string, columns map[string]interface{}) error {
+	for column, value := range columns {
+		if err := e.Exec(fmt.Sprintf("UPDATE %s SET %s=? WHERE %s IS NULL", table, column, column), value).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/czhj/ahfs/modules/utils"
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ShareLink gives anyone knowing its token read access to a file or to a
+// directory and everything below it.
+type ShareLink struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Token    string `gorm:"unique_index"`
+	Owner    uint   `gorm:"index"`
+	FileID   uint   `gorm:"index"`
+	Password string
+	// ExpiresAt is nil for links which never expire
+	ExpiresAt *time.Time
+	// MaxDownloads is 0 for links which may be downloaded without limit
+	MaxDownloads  int64
+	DownloadCount int64
+
+	File *File `gorm:"-"`
+}
+
+func (l *ShareLink) HashPassword(pwd string) {
+	if len(pwd) == 0 {
+		l.Password = ""
+		return
+	}
+	hashedpwd, _ := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+	l.Password = string(hashedpwd)
+}
+
+func (l *ShareLink) ValidatePassword(pwd string) bool {
+	if !l.IsPasswordSet() {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(l.Password), []byte(pwd)) == nil
+}
+
+func (l *ShareLink) IsPasswordSet() bool {
+	return len(l.Password) != 0
+}
+
+func (l *ShareLink) IsExpired() bool {
+	return l.ExpiresAt != nil && !l.ExpiresAt.After(time.Now())
+}
+
+func (l *ShareLink) IsExhausted() bool {
+	return l.MaxDownloads > 0 && l.DownloadCount >= l.MaxDownloads
+}
+
+func (l *ShareLink) LoadFile() (err error) {
+	if l.File == nil {
+		l.File, err = GetFileByID(l.FileID, l.Owner)
+	}
+	return err
+}
+
+// CreateShareLink stores l with a new random token.
+func CreateShareLink(l *ShareLink) error {
+	token, err := utils.RandomToken(24)
+	if err != nil {
+		return err
+	}
+	l.Token = token
+	return engine.Create(l).Error
+}
+
+// GetShareLinkByToken returns the link of token together with the shared
+// file, links of deleted files don't exist anymore.
+func GetShareLinkByToken(token string) (*ShareLink, error) {
+	if len(token) == 0 {
+		return nil, ErrShareLinkNotExist{}
+	}
+
+	l := new(ShareLink)
+	if err := engine.Where("token=?", token).First(l).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrShareLinkNotExist{Token: token}
+		}
+		return nil, err
+	}
+
+	if err := l.LoadFile(); err != nil {
+		if IsErrFileNotExist(err) {
+			return nil, ErrShareLinkNotExist{Token: token}
+		}
+		return nil, err
+	}
+	return l, nil
+}
+
+// GetShareLinks returns the links created by owner, the newest first.
+func GetShareLinks(owner uint, opts ListOptions) ([]*ShareLink, int64, error) {
+	var count int64
+	if err := engine.Model(&ShareLink{}).Where("owner=?", owner).Count(&count).Error; err != nil {
+		return nil, 0, fmt.Errorf("Count: %v", err)
+	}
+
+	db := engine.Where("owner=?", owner).Order("created_at DESC").Order("id DESC")
+	if opts.Page != 0 {
+		db = opts.SetEnginePagination(db)
+	}
+
+	links := make([]*ShareLink, 0, opts.PageSize)
+	if err := db.Find(&links).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, 0, err
+	}
+
+	for _, l := range links {
+		if err := l.LoadFile(); err != nil && !IsErrFileNotExist(err) {
+			return nil, 0, err
+		}
+	}
+	return links, count, nil
+}
+
+func DeleteShareLink(id, owner uint) error {
+	result := engine.Where("id=? AND owner=?", id, owner).Delete(&ShareLink{})
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrShareLinkNotExist{ID: id, Owner: owner}
+	}
+	return nil
+}
+
+// IncreaseShareLinkDownloads counts a download of l, it fails once the
+// download limit is reached.
+func IncreaseShareLinkDownloads(l *ShareLink) error {
+	result := engine.Exec("UPDATE share_links SET download_count=download_count+1 WHERE id=? AND (max_downloads=0 OR download_count<max_downloads)", l.ID)
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrShareLinkExhausted{ID: l.ID, MaxDownloads: l.MaxDownloads}
+	}
+	l.DownloadCount++
+	return nil
+}
@@ -0,0 +1,274 @@
+package models
+
+import (
+	"time"
+
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/jinzhu/gorm"
+)
+
+// Teams are users of the type UserTypeTeam, so that they own a root
+// directory and a capacity like everyone else. Their files are accessed
+// by their members according to the role of the member.
+
+type TeamRole int
+
+const (
+	TeamRoleNone TeamRole = iota
+	TeamRoleViewer
+	TeamRoleEditor
+	TeamRoleOwner
+)
+
+func (r TeamRole) String() string {
+	switch r {
+	case TeamRoleViewer:
+		return "viewer"
+	case TeamRoleEditor:
+		return "editor"
+	case TeamRoleOwner:
+		return "owner"
+	}
+	return "none"
+}
+
+func ParseTeamRole(s string) TeamRole {
+	switch s {
+	case "viewer":
+		return TeamRoleViewer
+	case "editor":
+		return TeamRoleEditor
+	case "owner":
+		return TeamRoleOwner
+	}
+	return TeamRoleNone
+}
+
+// FilePermission returns the permission of the role on the team files.
+func (r TeamRole) FilePermission() FilePermission {
+	switch r {
+	case TeamRoleViewer:
+		return FilePermissionRead
+	case TeamRoleEditor:
+		return FilePermissionWrite
+	case TeamRoleOwner:
+		return FilePermissionAdmin
+	}
+	return FilePermissionNone
+}
+
+type TeamMember struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	TeamID uint `gorm:"unique_index:idx_team_member_team_user"`
+	UserID uint `gorm:"unique_index:idx_team_member_team_user;index"`
+	Role   TeamRole
+
+	Team *User `gorm:"-"`
+	User *User `gorm:"-"`
+}
+
+// CreateTeam creates the team t together with its root directory, creator
+// becomes its first owner.
+func CreateTeam(t *User, creator *User) error {
+	tx := engine.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	used, err := isUsernameUsed(tx, t.Username)
+	if err != nil {
+		return err
+	} else if used {
+		return ErrUsernameAlreadyUsed{Username: t.Username}
+	}
+
+	t.Type = UserTypeTeam
+	t.IsActive = true
+	t.Password = ""
+	if len(t.Nickname) == 0 {
+		t.Nickname = t.Username
+	}
+	if t.MaxFileCapacity == 0 {
+		t.MaxFileCapacity = setting.Service.TeamMaxFileCapacitySize
+	}
+
+	if err := tx.Create(t).Error; err != nil {
+		return err
+	}
+
+	if err := createFile(tx, CreateUserRootFile(t)); err != nil {
+		return err
+	}
+
+	member := &TeamMember{TeamID: t.ID, UserID: creator.ID, Role: TeamRoleOwner}
+	if err := tx.Create(member).Error; err != nil {
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func GetTeamByID(id uint) (*User, error) {
+	team := new(User)
+	if err := engine.Where("id=? AND type=?", id, UserTypeTeam).First(team).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrTeamNotExist{ID: id}
+		}
+		return nil, err
+	}
+	return team, nil
+}
+
+func UpdateTeam(t *User) error {
+	return engine.Model(t).UpdateColumns(map[string]interface{}{
+		"nickname": t.Nickname,
+	}).Error
+}
+
+// DeleteTeam removes t together with its files and memberships.
+func DeleteTeam(t *User) error {
+	if !t.IsTeam() {
+		return ErrTeamNotExist{ID: t.ID, Name: t.Username}
+	}
+	return DeleteUser(t)
+}
+
+func GetTeamMember(teamID, uid uint) (*TeamMember, error) {
+	return getTeamMember(engine, teamID, uid)
+}
+
+func getTeamMember(e *gorm.DB, teamID, uid uint) (*TeamMember, error) {
+	member := new(TeamMember)
+	if err := e.Where("team_id=? AND user_id=?", teamID, uid).First(member).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrTeamMemberNotExist{TeamID: teamID, UserID: uid}
+		}
+		return nil, err
+	}
+	return member, nil
+}
+
+// GetTeamMembers returns the members of the team with their users.
+func GetTeamMembers(teamID uint) ([]*TeamMember, error) {
+	members := make([]*TeamMember, 0)
+	if err := engine.Where("team_id=?", teamID).Order("id ASC").Find(&members).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	for _, member := range members {
+		user, err := GetUserByID(member.UserID)
+		if err != nil && !IsErrUserNotExist(err) {
+			return nil, err
+		}
+		member.User = user
+	}
+	return members, nil
+}
+
+// GetUserTeams returns the memberships of the user uid with their teams.
+func GetUserTeams(uid uint) ([]*TeamMember, error) {
+	members := make([]*TeamMember, 0)
+	if err := engine.Where("user_id=?", uid).Order("id ASC").Find(&members).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	for _, member := range members {
+		team, err := GetTeamByID(member.TeamID)
+		if err != nil && !IsErrTeamNotExist(err) {
+			return nil, err
+		}
+		member.Team = team
+	}
+	return members, nil
+}
+
+// SetTeamMember adds the user uid to the team or changes its role, the last
+// owner of a team can't be demoted.
+func SetTeamMember(teamID, uid uint, role TeamRole) (*TeamMember, error) {
+	tx := engine.Begin()
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	if role != TeamRoleOwner {
+		if err := checkTeamOwnerLeft(tx, teamID, uid); err != nil {
+			return nil, err
+		}
+	}
+
+	member := &TeamMember{}
+	err := tx.Where(TeamMember{TeamID: teamID, UserID: uid}).Assign(TeamMember{Role: role}).FirstOrCreate(member).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return member, tx.Commit().Error
+}
+
+func RemoveTeamMember(teamID, uid uint) error {
+	tx := engine.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	if err := checkTeamOwnerLeft(tx, teamID, uid); err != nil {
+		return err
+	}
+
+	result := tx.Where("team_id=? AND user_id=?", teamID, uid).Delete(&TeamMember{})
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrTeamMemberNotExist{TeamID: teamID, UserID: uid}
+	}
+	return tx.Commit().Error
+}
+
+// checkUserTeamsOwnerLeft fails if uid is the only owner of one of its teams.
+func checkUserTeamsOwnerLeft(e *gorm.DB, uid uint) error {
+	members := make([]*TeamMember, 0)
+	if err := e.Where("user_id=? AND role=?", uid, TeamRoleOwner).Find(&members).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	for _, member := range members {
+		if err := checkTeamOwnerLeft(e, member.TeamID, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTeamOwnerLeft fails if uid is the only owner of the team.
+func checkTeamOwnerLeft(e *gorm.DB, teamID, uid uint) error {
+	var count int64
+	err := e.Model(&TeamMember{}).Where("team_id=? AND user_id<>? AND role=?", teamID, uid, TeamRoleOwner).Count(&count).Error
+	if err != nil {
+		return err
+	}
+
+	if count != 0 {
+		return nil
+	}
+
+	member, err := getTeamMember(e, teamID, uid)
+	if err != nil {
+		if IsErrTeamMemberNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if member.Role == TeamRoleOwner {
+		return ErrTeamLastOwner{TeamID: teamID, UserID: uid}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeamLastOwner(t *testing.T) {
+	creator, _ := newTestUser(t)
+	other, _ := newTestUser(t)
+	team := &User{Username: "lastowner"}
+	if err := CreateTeam(team, creator); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name     string
+		do       func() error
+		rejected bool
+	}{
+		{"demote the only owner", func() error {
+			_, err := SetTeamMember(team.ID, creator.ID, TeamRoleEditor)
+			return err
+		}, true},
+		{"remove the only owner", func() error {
+			return RemoveTeamMember(team.ID, creator.ID)
+		}, true},
+		{"delete the only owner", func() error {
+			return DeleteUser(creator)
+		}, true},
+		{"add an editor", func() error {
+			_, err := SetTeamMember(team.ID, other.ID, TeamRoleEditor)
+			return err
+		}, false},
+		{"demote the only owner beside an editor", func() error {
+			_, err := SetTeamMember(team.ID, creator.ID, TeamRoleViewer)
+			return err
+		}, true},
+		{"promote the editor", func() error {
+			_, err := SetTeamMember(team.ID, other.ID, TeamRoleOwner)
+			return err
+		}, false},
+		{"demote one of two owners", func() error {
+			_, err := SetTeamMember(team.ID, creator.ID, TeamRoleViewer)
+			return err
+		}, false},
+		{"demote the other owner", func() error {
+			_, err := SetTeamMember(team.ID, other.ID, TeamRoleEditor)
+			return err
+		}, true},
+		{"remove a viewer", func() error {
+			return RemoveTeamMember(team.ID, creator.ID)
+		}, false},
+		{"delete the owner", func() error {
+			return DeleteUser(other)
+		}, true},
+		// keeping the role of the last owner is no demotion
+		{"set the owner again", func() error {
+			_, err := SetTeamMember(team.ID, other.ID, TeamRoleOwner)
+			return err
+		}, false},
+	}
+
+	for _, step := range steps {
+		err := step.do()
+		if step.rejected {
+			assert.True(t, IsErrTeamLastOwner(err), "%s: %v", step.name, err)
+		} else {
+			assert.NoError(t, err, step.name)
+		}
+	}
+
+	members, err := GetTeamMembers(team.ID)
+	if assert.NoError(t, err) && assert.Len(t, members, 1) {
+		assert.Equal(t, other.ID, members[0].UserID)
+		assert.Equal(t, TeamRoleOwner, members[0].Role)
+	}
+
+	// the rejected deletion kept the user, who has no access as a former
+	// member
+	_, err = GetUserByID(creator.ID)
+	assert.NoError(t, err)
+
+	root, err := GetUserRootFile(team.ID)
+	if assert.NoError(t, err) {
+		perm, err := GetFilePermission(creator.ID, root)
+		assert.NoError(t, err)
+		assert.Equal(t, FilePermissionNone, perm)
+	}
+}
@@ -0,0 +1,245 @@
+package models
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/jinzhu/gorm"
+)
+
+// The upload policies of setting.Upload and the UploadPolicy of every
+// directory above a file are checked for every file added to a tree, the
+// directory quotas and the file count of the user are checked by
+// updateAncestorStats whenever the statistics of a tree grow.
+
+// UploadPolicy restricts the files stored below a directory on top of the
+// policies of setting.Upload, 0 or an empty list disables a policy.
+type UploadPolicy struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	FileID      uint `gorm:"unique_index"`
+	Owner       uint `gorm:"index"`
+	MaxFileSize int64
+	// AllowedTypes and BlockedTypes are comma separated lists like the ones
+	// of setting.Upload
+	AllowedTypes string
+	BlockedTypes string
+}
+
+func (p *UploadPolicy) AllowedTypeList() []string {
+	return splitFileTypes(p.AllowedTypes)
+}
+
+func (p *UploadPolicy) BlockedTypeList() []string {
+	return splitFileTypes(p.BlockedTypes)
+}
+
+func (p *UploadPolicy) SetAllowedTypeList(types []string) {
+	p.AllowedTypes = strings.Join(setting.NormalizeFileTypes(types), ",")
+}
+
+func (p *UploadPolicy) SetBlockedTypeList(types []string) {
+	p.BlockedTypes = strings.Join(setting.NormalizeFileTypes(types), ",")
+}
+
+func splitFileTypes(types string) []string {
+	if len(types) == 0 {
+		return []string{}
+	}
+	return strings.Split(types, ",")
+}
+
+// check returns an error if a file called name of size and contentType
+// mustn't be stored below the directory of p.
+func (p *UploadPolicy) check(name string, size int64, contentType string) error {
+	if p.MaxFileSize > 0 && size > p.MaxFileSize {
+		return ErrFileTooLarge{Name: name, Size: size, MaxSize: p.MaxFileSize}
+	}
+	return checkFileTypeList(name, contentType, p.AllowedTypeList(), p.BlockedTypeList())
+}
+
+// GetUploadPolicy returns the upload policy of dir, a policy without any
+// restriction if it has none.
+func GetUploadPolicy(dir *File) (*UploadPolicy, error) {
+	if !dir.IsDir() {
+		return nil, ErrFileNotDirectory{ID: dir.ID, Path: dir.FilePath()}
+	}
+
+	policy := &UploadPolicy{}
+	if err := engine.Where("file_id=?", dir.ID).First(policy).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &UploadPolicy{FileID: dir.ID, Owner: dir.Owner}, nil
+		}
+		return nil, err
+	}
+	return policy, nil
+}
+
+// SetUploadPolicy restricts the files stored below dir to policy, files
+// which are already stored are kept.
+func SetUploadPolicy(dir *File, policy *UploadPolicy) error {
+	if !dir.IsDir() {
+		return ErrFileNotDirectory{ID: dir.ID, Path: dir.FilePath()}
+	}
+
+	policy.FileID, policy.Owner = dir.ID, dir.Owner
+	return engine.Where(UploadPolicy{FileID: dir.ID}).
+		Assign(map[string]interface{}{"owner": dir.Owner, "max_file_size": policy.MaxFileSize, "allowed_types": policy.AllowedTypes, "blocked_types": policy.BlockedTypes}).
+		FirstOrCreate(policy).Error
+}
+
+// RemoveUploadPolicy removes the upload policy of dir.
+func RemoveUploadPolicy(dir *File) error {
+	if !dir.IsDir() {
+		return ErrFileNotDirectory{ID: dir.ID, Path: dir.FilePath()}
+	}
+	return engine.Where("file_id=?", dir.ID).Delete(&UploadPolicy{}).Error
+}
+
+// getUploadPolicies returns the upload policies of the directories ids.
+func getUploadPolicies(e *gorm.DB, ids []uint) ([]*UploadPolicy, error) {
+	policies := make([]*UploadPolicy, 0)
+	if len(ids) == 0 {
+		return policies, nil
+	}
+
+	if err := e.Where("file_id IN (?)", ids).Find(&policies).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// checkUploadPolicy returns an error if a file called name of size and
+// contentType mustn't be stored in dir.
+func checkUploadPolicy(e *gorm.DB, dir *File, name string, size int64, contentType string) error {
+	if max := setting.Upload.MaxFileSize; max > 0 && size > max {
+		return ErrFileTooLarge{Name: name, Size: size, MaxSize: max}
+	}
+
+	if err := checkFileTypeList(name, contentType, setting.Upload.AllowedTypes, setting.Upload.BlockedTypes); err != nil {
+		return err
+	}
+	return checkDirectoryUploadPolicies(e, treePathIDs(dir.ChildTreePath()), name, size, contentType)
+}
+
+// checkFileType returns an error if the type of a file called name and of
+// contentType mustn't be stored in dir, the size was checked already.
+func checkFileType(e *gorm.DB, dir *File, name, contentType string) error {
+	return checkUploadPolicy(e, dir, name, 0, contentType)
+}
+
+// checkDirectoryUploadPolicies returns an error if a file mustn't be stored
+// below the directories ids.
+func checkDirectoryUploadPolicies(e *gorm.DB, ids []uint, name string, size int64, contentType string) error {
+	policies, err := getUploadPolicies(e, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range policies {
+		if err := p.check(name, size, contentType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMovedFiles returns an error if f or a file below it mustn't be moved
+// below the directories ids, which it wasn't below before.
+func checkMovedFiles(e *gorm.DB, f *File, ids []uint) error {
+	policies, err := getUploadPolicies(e, ids)
+	if err != nil || len(policies) == 0 {
+		return err
+	}
+
+	files := []*File{f}
+	if f.IsDir() {
+		files = files[:0]
+		if err := e.Where("owner=? AND tree_path LIKE ? AND file_type=?", f.Owner, f.ChildTreePath()+"%", FileTypeFile).Find(&files).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		for _, p := range policies {
+			if err := p.check(file.FileName, file.FileSize, file.MimeType()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkFileTypeList(name, contentType string, allowed, blocked []string) error {
+	ext := strings.ToLower(path.Ext(name))
+	mimeType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+
+	match := func(types []string) bool {
+		for _, t := range types {
+			switch {
+			case strings.HasPrefix(t, "."):
+				if ext == t {
+					return true
+				}
+			case strings.HasSuffix(t, "/*"):
+				if strings.HasPrefix(mimeType, t[:len(t)-1]) {
+					return true
+				}
+			case mimeType == t:
+				return true
+			}
+		}
+		return false
+	}
+
+	if match(blocked) || (len(allowed) != 0 && !match(allowed)) {
+		return ErrFileTypeNotAllowed{Name: name, ContentType: mimeType}
+	}
+	return nil
+}
+
+// checkAncestorLimits returns an error if the directories ids exceed their
+// quota or the root among them holds too many files, it runs after their
+// statistics grew by s.
+func checkAncestorLimits(e *gorm.DB, ids []uint, s fileStats) error {
+	if s.Size > 0 {
+		dir := new(File)
+		err := e.Where("id IN (?) AND quota>0 AND total_size>quota", ids).First(dir).Error
+		if err == nil {
+			return ErrDirectoryQuotaExceeded{ID: dir.ID, Path: dir.FilePath(), Quota: dir.Quota}
+		}
+		if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+	}
+
+	if max := setting.Upload.MaxFileCount; s.Files > 0 && max > 0 {
+		root := new(File)
+		err := e.Select("id, owner").Where("id IN (?) AND parent_id=0 AND file_count>?", ids, max).First(root).Error
+		if err == nil {
+			return ErrUserMaxFileCountLimit{UserID: root.Owner, MaxCount: max}
+		}
+		if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetDirectoryQuota limits the total size of the files below dir, 0 removes
+// the limit. A quota below the current size only prevents further growth.
+func SetDirectoryQuota(dir *File, quota int64) error {
+	if !dir.IsDir() {
+		return ErrFileNotDirectory{ID: dir.ID, Path: dir.FilePath()}
+	}
+
+	if err := engine.Model(dir).UpdateColumn("quota", quota).Error; err != nil {
+		return err
+	}
+	dir.Quota = quota
+	return touchFile(engine, dir)
+}
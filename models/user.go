@@ -24,6 +24,7 @@ type UserType int
 
 const (
 	UserTypeUser UserType = iota
+	UserTypeTeam
 )
 
 var (
@@ -68,6 +69,11 @@ func (u *User) IsOAuth2() bool {
 	return u.LoginType == LoginOAuth2
 }
 
+// IsTeam reports whether u is a team, teams own files but can't sign in.
+func (u *User) IsTeam() bool {
+	return u.Type == UserTypeTeam
+}
+
 func (u *User) IsPlain() bool {
 	return u.LoginType == LoginPlain
 }
@@ -225,10 +231,21 @@ func DeleteUser(u *User) error {
 		return err
 	}
 
-	return tx.Commit().Error
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	afterFileChange(u.ID)
+	return nil
 }
 
 func deleteUser(e *gorm.DB, u *User) error {
+	// teams must not be left without an owner, another member has to be
+	// made owner or the team deleted first
+	if err := checkUserTeamsOwnerLeft(e, u.ID); err != nil {
+		return err
+	}
+
 	db := e.Delete(u)
 	if err := db.Error; err != nil {
 		return err
@@ -259,6 +276,22 @@ func deleteUser(e *gorm.DB, u *User) error {
 		return err
 	}
 
+	if err := e.Where("user_id=?", u.ID).Delete(&FileGrant{}).Error; err != nil {
+		return err
+	}
+
+	if err := e.Where("team_id=? OR user_id=?", u.ID, u.ID).Delete(&TeamMember{}).Error; err != nil {
+		return err
+	}
+
+	if err := e.Where("owner=?", u.ID).Delete(&FileChange{}).Error; err != nil {
+		return err
+	}
+
+	if err := deleteUserWebhooks(e, u.ID); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -403,6 +436,10 @@ func UserSignIn(username string, password string) (*User, error) {
 		}
 	}
 
+	if user.IsTeam() {
+		return nil, ErrUserNotExist{Username: user.Username}
+	}
+
 	switch user.LoginType {
 	case LoginNoType, LoginPlain, LoginOAuth2:
 		if user.IsPasswordSet() && user.ValidatePassword(password) {
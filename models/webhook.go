@@ -0,0 +1,307 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+type WebhookEvent string
+
+const (
+	WebhookEventAll WebhookEvent = "*"
+
+	WebhookEventFileCreate WebhookEvent = "file.create"
+	WebhookEventFileUpdate WebhookEvent = "file.update"
+	WebhookEventFileMove   WebhookEvent = "file.move"
+	WebhookEventFileRename WebhookEvent = "file.rename"
+	WebhookEventFileDelete WebhookEvent = "file.delete"
+
+	WebhookEventAccountCreate WebhookEvent = "account.create"
+	WebhookEventAccountUpdate WebhookEvent = "account.update"
+	WebhookEventAccountDelete WebhookEvent = "account.delete"
+)
+
+var webhookEvents = []WebhookEvent{
+	WebhookEventFileCreate,
+	WebhookEventFileUpdate,
+	WebhookEventFileMove,
+	WebhookEventFileRename,
+	WebhookEventFileDelete,
+	WebhookEventAccountCreate,
+	WebhookEventAccountUpdate,
+	WebhookEventAccountDelete,
+}
+
+func IsValidWebhookEvent(event string) bool {
+	if WebhookEvent(event) == WebhookEventAll {
+		return true
+	}
+	for _, e := range webhookEvents {
+		if string(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// FileChangeWebhookEvent returns the event which announces a change of type t.
+func FileChangeWebhookEvent(t FileChangeType) WebhookEvent {
+	return WebhookEvent("file." + string(t))
+}
+
+func (e WebhookEvent) IsFileEvent() bool {
+	return strings.HasPrefix(string(e), "file.")
+}
+
+// Webhook posts the events of the files and of the account of its owner to
+// URL. System webhooks have no owner and receive the events of every user.
+type Webhook struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Owner  uint `gorm:"index"`
+	URL    string
+	Secret string
+	// Events is the comma separated list of subscribed events, * subscribes
+	// to all of them
+	Events string
+	// PathPrefix limits file events to the files at or below it
+	PathPrefix string
+	IsActive   bool
+}
+
+func (w *Webhook) EventList() []string {
+	if len(w.Events) == 0 {
+		return []string{}
+	}
+	return strings.Split(w.Events, ",")
+}
+
+func (w *Webhook) SetEventList(events []string) {
+	w.Events = strings.Join(events, ",")
+}
+
+func (w *Webhook) HasEvent(event WebhookEvent) bool {
+	for _, e := range w.EventList() {
+		if WebhookEvent(e) == WebhookEventAll || WebhookEvent(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPath reports whether one of paths is at or below the path prefix.
+func (w *Webhook) MatchPath(paths ...string) bool {
+	prefix := path.Clean("/" + w.PathPrefix)
+	if prefix == "/" {
+		return true
+	}
+
+	for _, p := range paths {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) IsSystem() bool {
+	return w.Owner == 0
+}
+
+func CreateWebhook(w *Webhook) error {
+	return engine.Create(w).Error
+}
+
+func GetWebhook(id, owner uint) (*Webhook, error) {
+	w := &Webhook{}
+	if err := engine.Where("id=? AND owner=?", id, owner).First(w).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrWebhookNotExist{ID: id, Owner: owner}
+		}
+		return nil, err
+	}
+	return w, nil
+}
+
+func GetWebhookByID(id uint) (*Webhook, error) {
+	w := &Webhook{}
+	if err := engine.Where("id=?", id).First(w).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrWebhookNotExist{ID: id}
+		}
+		return nil, err
+	}
+	return w, nil
+}
+
+// GetWebhooks returns the webhooks of owner, the newest first.
+func GetWebhooks(owner uint, opts ListOptions) ([]*Webhook, int64, error) {
+	var count int64
+	if err := engine.Model(&Webhook{}).Where("owner=?", owner).Count(&count).Error; err != nil {
+		return nil, 0, fmt.Errorf("Count: %v", err)
+	}
+
+	db := engine.Where("owner=?", owner).Order("id DESC")
+	if opts.Page != 0 {
+		db = opts.SetEnginePagination(db)
+	}
+
+	hooks := make([]*Webhook, 0, opts.PageSize)
+	if err := db.Find(&hooks).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, 0, err
+	}
+	return hooks, count, nil
+}
+
+// GetActiveWebhooks returns the active webhooks which receive the events of
+// the user uid, system webhooks included.
+func GetActiveWebhooks(uid uint) ([]*Webhook, error) {
+	hooks := make([]*Webhook, 0)
+	err := engine.Where("(owner=? OR owner=0) AND is_active=?", uid, true).Order("id ASC").Find(&hooks).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func UpdateWebhook(w *Webhook) error {
+	return engine.Save(w).Error
+}
+
+// DeleteWebhook removes the webhook together with its delivery history.
+func DeleteWebhook(id, owner uint) error {
+	tx := engine.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	result := tx.Where("id=? AND owner=?", id, owner).Delete(&Webhook{})
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrWebhookNotExist{ID: id, Owner: owner}
+	}
+
+	if err := tx.Where("webhook_id=?", id).Delete(&WebhookDelivery{}).Error; err != nil {
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func deleteUserWebhooks(e *gorm.DB, uid uint) error {
+	if err := e.Where("webhook_id IN (?)", e.Model(&Webhook{}).Select("id").Where("owner=?", uid).SubQuery()).Delete(&WebhookDelivery{}).Error; err != nil {
+		return err
+	}
+	return e.Where("owner=?", uid).Delete(&Webhook{}).Error
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is an event posted to a webhook, the response fields are
+// the ones of the latest attempt.
+type WebhookDelivery struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UUID      string `gorm:"unique_index"`
+	WebhookID uint   `gorm:"index"`
+	Event     WebhookEvent
+	Payload   string `gorm:"type:text"`
+	Status    WebhookDeliveryStatus
+	Attempts  int
+	// NextAttemptAt is nil once the delivery is finished
+	NextAttemptAt  *time.Time
+	ResponseStatus int
+	ResponseBody   string `gorm:"type:text"`
+	Error          string
+	// RedeliveryOf is the delivery repeated by this one
+	RedeliveryOf uint
+}
+
+func (d *WebhookDelivery) IsFinished() bool {
+	return d.Status != WebhookDeliveryPending
+}
+
+// CreateWebhookDelivery stores d as pending with a new UUID, finished
+// deliveries of the webhook which are older than the retention are removed.
+func CreateWebhookDelivery(d *WebhookDelivery) error {
+	now := time.Now()
+	d.UUID = uuid.New().String()
+	d.Status = WebhookDeliveryPending
+	d.NextAttemptAt = &now
+	if err := engine.Create(d).Error; err != nil {
+		return err
+	}
+
+	if setting.Webhook.DeliveryRetention > 0 {
+		before := now.Add(-setting.Webhook.DeliveryRetention)
+		if err := engine.Where("webhook_id=? AND status<>? AND updated_at<?", d.WebhookID, WebhookDeliveryPending, before).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GetWebhookDelivery(id, webhookID uint) (*WebhookDelivery, error) {
+	d := &WebhookDelivery{}
+	if err := engine.Where("id=? AND webhook_id=?", id, webhookID).First(d).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrWebhookDeliveryNotExist{ID: id, WebhookID: webhookID}
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+// GetWebhookDeliveries returns the delivery history of a webhook, the newest
+// first.
+func GetWebhookDeliveries(webhookID uint, opts ListOptions) ([]*WebhookDelivery, int64, error) {
+	var count int64
+	if err := engine.Model(&WebhookDelivery{}).Where("webhook_id=?", webhookID).Count(&count).Error; err != nil {
+		return nil, 0, fmt.Errorf("Count: %v", err)
+	}
+
+	db := engine.Where("webhook_id=?", webhookID).Order("id DESC")
+	if opts.Page != 0 {
+		db = opts.SetEnginePagination(db)
+	}
+
+	deliveries := make([]*WebhookDelivery, 0, opts.PageSize)
+	if err := db.Find(&deliveries).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, 0, err
+	}
+	return deliveries, count, nil
+}
+
+// GetPendingWebhookDeliveries returns the deliveries which still have to be
+// attempted, the oldest first.
+func GetPendingWebhookDeliveries() ([]*WebhookDelivery, error) {
+	deliveries := make([]*WebhookDelivery, 0)
+	err := engine.Where("status=?", WebhookDeliveryPending).Order("id ASC").Find(&deliveries).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func UpdateWebhookDelivery(d *WebhookDelivery) error {
+	return engine.Save(d).Error
+}
@@ -0,0 +1,118 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatZip   Format = "zip"
+	FormatTarGz Format = "tar.gz"
+)
+
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+func (f Format) ContentType() string {
+	if f == FormatZip {
+		return "application/zip"
+	}
+	return "application/gzip"
+}
+
+// Writer writes entries of an archive to the underlying writer as they come,
+// nothing is buffered besides the compressor state.
+type Writer interface {
+	WriteDir(name string, modTime time.Time) error
+	WriteFile(name string, size int64, modTime time.Time, r io.Reader) error
+	Close() error
+}
+
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatZip:
+		return &zipWriter{w: zip.NewWriter(w)}, nil
+	case FormatTarGz:
+		gw := gzip.NewWriter(w)
+		return &tarWriter{gw: gw, w: tar.NewWriter(gw)}, nil
+	}
+	return nil, fmt.Errorf("unsupported archive format: %s", format)
+}
+
+type zipWriter struct {
+	w *zip.Writer
+}
+
+func (z *zipWriter) WriteDir(name string, modTime time.Time) error {
+	_, err := z.w.CreateHeader(&zip.FileHeader{
+		Name:     strings.TrimSuffix(name, "/") + "/",
+		Modified: modTime,
+	})
+	return err
+}
+
+func (z *zipWriter) WriteFile(name string, size int64, modTime time.Time, r io.Reader) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	}
+	header.SetMode(0644)
+
+	fw, err := z.w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	return z.w.Close()
+}
+
+type tarWriter struct {
+	gw *gzip.Writer
+	w  *tar.Writer
+}
+
+func (t *tarWriter) WriteDir(name string, modTime time.Time) error {
+	return t.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     strings.TrimSuffix(name, "/") + "/",
+		Mode:     0755,
+		ModTime:  modTime,
+	})
+}
+
+func (t *tarWriter) WriteFile(name string, size int64, modTime time.Time, r io.Reader) error {
+	err := t.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(t.w, r, size)
+	return err
+}
+
+func (t *tarWriter) Close() error {
+	if err := t.w.Close(); err != nil {
+		return err
+	}
+	return t.gw.Close()
+}
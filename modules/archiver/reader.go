@@ -0,0 +1,175 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotReaderAt = errors.New("zip archive requires an io.ReaderAt")
+)
+
+type ErrIllegalPath struct {
+	Name string
+}
+
+func IsErrIllegalPath(err error) bool {
+	_, ok := err.(ErrIllegalPath)
+	return ok
+}
+
+func (e ErrIllegalPath) Error() string {
+	return fmt.Sprintf("illegal path in archive: %s", e.Name)
+}
+
+// Entry is a regular file or a directory of an archive, entries of other
+// types such as links are skipped by Reader.
+type Entry struct {
+	Name    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// Reader iterates over the entries of an archive. Next returns io.EOF after
+// the last entry, the returned reader is valid until the next call of Next.
+type Reader interface {
+	Next() (*Entry, io.Reader, error)
+	Close() error
+}
+
+// DetectFormat returns the archive format of a file by its name.
+func DetectFormat(name string) (Format, bool) {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return FormatZip, true
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return FormatTarGz, true
+	}
+	return "", false
+}
+
+// CleanName normalizes the name of an entry to a relative slash separated
+// path, names which would escape the extraction directory are rejected.
+func CleanName(name string) (string, error) {
+	if strings.Contains(name, "\\") || strings.HasPrefix(name, "/") {
+		return "", ErrIllegalPath{Name: name}
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrIllegalPath{Name: name}
+	}
+	return cleaned, nil
+}
+
+// NewReader opens an archive of size bytes. Zip archives need random access,
+// so r must implement io.ReaderAt for them.
+func NewReader(format Format, r io.Reader, size int64) (Reader, error) {
+	switch format {
+	case FormatZip:
+		ra, ok := r.(io.ReaderAt)
+		if !ok {
+			return nil, ErrNotReaderAt
+		}
+
+		zr, err := zip.NewReader(ra, size)
+		if err != nil {
+			return nil, err
+		}
+		return &zipReader{r: zr}, nil
+	case FormatTarGz:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return &tarReader{gr: gr, r: tar.NewReader(gr)}, nil
+	}
+	return nil, fmt.Errorf("unsupported archive format: %s", format)
+}
+
+type zipReader struct {
+	r       *zip.Reader
+	index   int
+	current io.ReadCloser
+}
+
+func (z *zipReader) Next() (*Entry, io.Reader, error) {
+	if err := z.closeCurrent(); err != nil {
+		return nil, nil, err
+	}
+
+	for z.index < len(z.r.File) {
+		f := z.r.File[z.index]
+		z.index++
+
+		mode := f.Mode()
+		if !mode.IsDir() && !mode.IsRegular() {
+			continue
+		}
+
+		entry := &Entry{
+			Name:    f.Name,
+			IsDir:   mode.IsDir(),
+			Size:    int64(f.UncompressedSize64),
+			ModTime: f.Modified,
+		}
+		if entry.IsDir {
+			return entry, nil, nil
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		z.current = rc
+		return entry, rc, nil
+	}
+	return nil, nil, io.EOF
+}
+
+func (z *zipReader) closeCurrent() error {
+	if z.current == nil {
+		return nil
+	}
+	err := z.current.Close()
+	z.current = nil
+	return err
+}
+
+func (z *zipReader) Close() error {
+	return z.closeCurrent()
+}
+
+type tarReader struct {
+	gr *gzip.Reader
+	r  *tar.Reader
+}
+
+func (t *tarReader) Next() (*Entry, io.Reader, error) {
+	for {
+		header, err := t.r.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return &Entry{Name: header.Name, IsDir: true, ModTime: header.ModTime}, nil, nil
+		case tar.TypeReg, tar.TypeRegA:
+			return &Entry{Name: header.Name, Size: header.Size, ModTime: header.ModTime}, t.r, nil
+		}
+	}
+}
+
+func (t *tarReader) Close() error {
+	return t.gr.Close()
+}
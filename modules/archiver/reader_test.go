@@ -0,0 +1,42 @@
+package archiver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanName(t *testing.T) {
+	cases := []struct {
+		name  string
+		clean string
+		ok    bool
+	}{
+		{"a.txt", "a.txt", true},
+		{"dir/a.txt", "dir/a.txt", true},
+		{"dir/", "dir", true},
+		{"./dir//a.txt", "dir/a.txt", true},
+		{"dir/../a.txt", "a.txt", true},
+		{"dir/sub/../../a.txt", "a.txt", true},
+		{"..a.txt", "..a.txt", true},
+		{"", "", false},
+		{".", "", false},
+		{"./", "", false},
+		{"..", "", false},
+		{"../a.txt", "", false},
+		{"dir/../../a.txt", "", false},
+		{"/etc/passwd", "", false},
+		{"dir\\..\\a.txt", "", false},
+		{"C:\\a.txt", "", false},
+	}
+
+	for _, c := range cases {
+		clean, err := CleanName(c.name)
+		if !c.ok {
+			assert.True(t, IsErrIllegalPath(err), c.name)
+			continue
+		}
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, c.clean, clean, c.name)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/czhj/ahfs/modules/log"
 	"github.com/czhj/ahfs/modules/storage"
+	"github.com/czhj/ahfs/modules/typesniffer"
 	"github.com/czhj/ahfs/routers/api/v1/errcode"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -33,6 +35,35 @@ type APIError struct {
 	Message string `json:"message"`
 }
 
+// ContentDisposition returns a Content-Disposition header value, non-ASCII
+// names are sent as RFC 5987 filename* with an ASCII fallback.
+func ContentDisposition(disposition, filename string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r >= 0x7f || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+
+	if fallback == filename {
+		return fmt.Sprintf("%s; filename=\"%s\"", disposition, filename)
+	}
+	return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s", disposition, fallback, encodeRFC5987(filename))
+}
+
+func encodeRFC5987(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
 func (ctx *APIContext) File(filename string, localPath string) {
 	file, err := os.Open(localPath)
 	if err != nil {
@@ -51,13 +82,23 @@ func (ctx *APIContext) File(filename string, localPath string) {
 		return
 	}
 
-	ctx.DataFromReader(http.StatusOK, fi.Size(), "application/octet-stream", file,
+	ctx.DataFromReader(http.StatusOK, fi.Size(), typesniffer.OctetStream, file,
 		map[string]string{
-			"Content-Disposition": fmt.Sprintf("attachment; filename=\"%s\"", filename),
+			"Content-Disposition":    ContentDisposition("attachment", filename),
+			"X-Content-Type-Options": "nosniff",
 		})
 }
 
-func (ctx *APIContext) Storage(filename string, id storage.ID, fileStorage storage.Storage) {
+// ServeOptions describes how Storage sends an object.
+type ServeOptions struct {
+	Filename    string
+	Size        int64
+	ContentType string
+	// Inline lets the browser display the object instead of saving it
+	Inline bool
+}
+
+func (ctx *APIContext) Storage(opts *ServeOptions, id storage.ID, fileStorage storage.Storage) {
 	fileObj, err := fileStorage.Read(id)
 	if err != nil {
 		ctx.InternalServerError(err)
@@ -71,10 +112,24 @@ func (ctx *APIContext) Storage(filename string, id storage.ID, fileStorage stora
 		}
 	}()
 
-	ctx.DataFromReader(http.StatusOK, fileObj.Size, "application/octet-stream", file,
-		map[string]string{
-			"Content-Disposition": fmt.Sprintf("attachment; filename=\"%s\"", filename),
-		})
+	headers := map[string]string{
+		"Content-Disposition":    ContentDisposition("attachment", opts.Filename),
+		"X-Content-Type-Options": "nosniff",
+	}
+
+	contentType := opts.ContentType
+	if len(contentType) == 0 {
+		contentType = typesniffer.OctetStream
+	}
+
+	if opts.Inline {
+		headers["Content-Disposition"] = ContentDisposition("inline", opts.Filename)
+		if typesniffer.IsActiveContent(contentType) {
+			headers["Content-Security-Policy"] = "sandbox; default-src 'none'; img-src data:; style-src 'unsafe-inline'"
+		}
+	}
+
+	ctx.DataFromReader(http.StatusOK, opts.Size, contentType, file, headers)
 }
 
 func (ctx *APIContext) JSON(status int, code errcode.ErrorCode, obj interface{}) {
@@ -0,0 +1,27 @@
+package context
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentDisposition(t *testing.T) {
+	cases := []struct {
+		disposition string
+		filename    string
+		header      string
+	}{
+		{"attachment", "report.pdf", `attachment; filename="report.pdf"`},
+		{"inline", "a b.txt", `inline; filename="a b.txt"`},
+		{"attachment", `say "hi".txt`, `attachment; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`},
+		{"attachment", `a\b.txt`, `attachment; filename="a_b.txt"; filename*=UTF-8''a%5Cb.txt`},
+		{"attachment", "a\r\nb.txt", `attachment; filename="a__b.txt"; filename*=UTF-8''a%0D%0Ab.txt`},
+		{"attachment", "报告.pdf", `attachment; filename="__.pdf"; filename*=UTF-8''%E6%8A%A5%E5%91%8A.pdf`},
+		{"inline", "café;x.txt", `inline; filename="caf_;x.txt"; filename*=UTF-8''caf%C3%A9%3Bx.txt`},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.header, ContentDisposition(c.disposition, c.filename), c.filename)
+	}
+}
@@ -1,6 +1,9 @@
 package convert
 
 import (
+	"encoding/json"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/czhj/ahfs/models"
@@ -38,15 +41,272 @@ func ToToken(t *models.AuthToken) *api.Token {
 }
 
 func ToFile(f *models.File) *api.File {
-	return &api.File{
-		ID:        f.ID,
-		CreatedAt: f.CreatedAt,
-		UpdatedAt: f.UpdatedAt,
-		FileName:  f.FileName,
-		IsDir:     f.IsDir(),
-		Owner:     f.Owner,
-		FileSize:  f.FileSize,
-		ParentID:  f.ParentID,
-		FileDir:   f.FilePath(),
+	file := &api.File{
+		ID:          f.ID,
+		CreatedAt:   f.CreatedAt,
+		UpdatedAt:   f.UpdatedAt,
+		FileName:    f.FileName,
+		IsDir:       f.IsDir(),
+		Owner:       f.Owner,
+		FileSize:    f.FileSize,
+		ContentType: f.MimeType(),
+		ParentID:    f.ParentID,
+		FileDir:     f.FilePath(),
+		Version:     f.Version,
+		ETag:        f.ETag(),
+		ExpiresAt:   f.ExpiresAt,
+		ScanStatus:  string(f.ScanStatus),
+		ScanResult:  f.ScanResult,
 	}
+
+	if f.IsDir() {
+		file.FileSize = f.TotalSize
+		file.FileCount = f.FileCount
+		file.DirCount = f.DirCount
+		file.Quota = f.Quota
+	}
+
+	if f.Lock != nil {
+		file.Lock = ToFileLock(f.Lock)
+	}
+	return file
+}
+
+func ToFileTree(t *models.FileTree, onlyDir bool) *api.FileTree {
+	tree := &api.FileTree{
+		File: ToFile(t.File),
+	}
+
+	if t.IsDir() {
+		tree.HasChildren = t.DirCount > 0 || (!onlyDir && t.FileCount > 0)
+	}
+
+	if t.Children != nil {
+		tree.Children = make([]*api.FileTree, len(t.Children))
+		for i := range t.Children {
+			tree.Children[i] = ToFileTree(t.Children[i], onlyDir)
+		}
+	}
+	return tree
+}
+
+func ToFileChange(c *models.FileChange) *api.FileChange {
+	return &api.FileChange{
+		Seq:         c.Seq,
+		Type:        string(c.Type),
+		FileID:      c.FileID,
+		OldFileID:   c.OldFileID,
+		IsDir:       c.IsDir,
+		ParentID:    c.ParentID,
+		OldParentID: c.OldParentID,
+		Name:        c.Name,
+		OldName:     c.OldName,
+		Path:        c.Path,
+		OldPath:     c.OldPath,
+		CreatedAt:   c.CreatedAt,
+	}
+}
+
+func ToFileLock(l *models.FileLock) *api.FileLock {
+	lock := &api.FileLock{
+		LockID:    l.LockID,
+		FileID:    l.FileID,
+		UserID:    l.UserID,
+		Note:      l.Note,
+		CreatedAt: l.CreatedAt,
+		ExpiresAt: l.ExpiresAt,
+	}
+
+	if l.User != nil {
+		lock.User = ToUser(l.User, false, false)
+	}
+	return lock
+}
+
+func ToDirectoryStats(dir *models.File, b *models.DirectoryBreakdown) *api.DirectoryStats {
+	stats := &api.DirectoryStats{
+		Directory: ToFile(dir),
+		Largest:   make([]*api.File, len(b.Largest)),
+		Types:     make([]*api.FileTypeUsage, len(b.Types)),
+	}
+
+	for i := range b.Largest {
+		stats.Largest[i] = ToFile(b.Largest[i])
+	}
+
+	for i, t := range b.Types {
+		stats.Types[i] = &api.FileTypeUsage{
+			ContentType: t.ContentType,
+			Count:       t.Count,
+			Size:        t.Size,
+		}
+	}
+	return stats
+}
+
+func ToExtractTask(t *models.ExtractTask) *api.ExtractTask {
+	return &api.ExtractTask{
+		ID:          t.ID,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+		ArchiveID:   t.ArchiveID,
+		DirectoryID: t.DirectoryID,
+		Status:      t.Status.String(),
+		FileCount:   t.FileCount,
+		Message:     t.Message,
+	}
+}
+
+func ToUploadPolicy(p *models.UploadPolicy) *api.UploadPolicy {
+	return &api.UploadPolicy{
+		DirectoryID:  p.FileID,
+		MaxFileSize:  p.MaxFileSize,
+		AllowedTypes: p.AllowedTypeList(),
+		BlockedTypes: p.BlockedTypeList(),
+	}
+}
+
+func ToFileMetadata(m *models.FileMetadata) *api.FileMetadata {
+	return &api.FileMetadata{
+		Tags:       m.Tags,
+		Properties: m.Properties,
+	}
+}
+
+func ToShareLink(l *models.ShareLink) *api.ShareLink {
+	link := &api.ShareLink{
+		ID:            l.ID,
+		CreatedAt:     l.CreatedAt,
+		Token:         l.Token,
+		HasPassword:   l.IsPasswordSet(),
+		ExpiresAt:     l.ExpiresAt,
+		MaxDownloads:  l.MaxDownloads,
+		DownloadCount: l.DownloadCount,
+	}
+
+	if l.File != nil {
+		link.File = ToFile(l.File)
+	}
+	return link
+}
+
+// ToSharedFile converts f, which is shared through root, relative to root
+// so that neither the location of root nor its owner are disclosed. root is
+// the entry 0 of the share, like the root directory of a user.
+func ToSharedFile(root, f *models.File) *api.File {
+	file := ToFile(f)
+	file.FileDir = path.Join("/", strings.TrimPrefix(f.FilePath(), root.FilePath()))
+	file.Owner = 0
+	if f.ID == root.ID {
+		file.ID, file.ParentID = 0, 0
+	} else if f.ParentID == root.ID {
+		file.ParentID = 0
+	}
+	return file
+}
+
+func ToFileGrant(g *models.FileGrant) *api.FileGrant {
+	grant := &api.FileGrant{
+		ID:         g.ID,
+		CreatedAt:  g.CreatedAt,
+		UpdatedAt:  g.UpdatedAt,
+		UserID:     g.UserID,
+		Permission: g.Permission.String(),
+	}
+
+	if g.File != nil {
+		grant.File = ToFile(g.File)
+	}
+
+	if g.User != nil {
+		grant.User = ToUser(g.User, true, false)
+	}
+	return grant
+}
+
+// ToTeam converts t, role is the role of the current user and may be
+// TeamRoleNone for administrators.
+func ToTeam(t *models.User, role models.TeamRole, rootFileID uint) *api.Team {
+	team := &api.Team{
+		ID:               t.ID,
+		Name:             t.Username,
+		NickName:         t.Nickname,
+		AvatarURL:        t.AvatarLink(),
+		CreatedAt:        t.CreatedAt,
+		UsedFileCapacity: t.UsedFileCapacity,
+		MaxFileCapacity:  t.MaxFileCapacity,
+		RootFileID:       rootFileID,
+	}
+
+	if role != models.TeamRoleNone {
+		team.Role = role.String()
+	}
+	return team
+}
+
+func ToTeamMember(m *models.TeamMember) *api.TeamMember {
+	member := &api.TeamMember{
+		UserID:    m.UserID,
+		Role:      m.Role.String(),
+		CreatedAt: m.CreatedAt,
+	}
+
+	if m.User != nil {
+		member.User = ToUser(m.User, true, false)
+	}
+	return member
+}
+
+func ToWebhook(w *models.Webhook) *api.Webhook {
+	return &api.Webhook{
+		ID:         w.ID,
+		URL:        w.URL,
+		HasSecret:  len(w.Secret) != 0,
+		Events:     w.EventList(),
+		PathPrefix: w.PathPrefix,
+		IsActive:   w.IsActive,
+		CreatedAt:  w.CreatedAt,
+		UpdatedAt:  w.UpdatedAt,
+	}
+}
+
+func ToWebhookDelivery(d *models.WebhookDelivery) *api.WebhookDelivery {
+	return &api.WebhookDelivery{
+		ID:             d.ID,
+		UUID:           d.UUID,
+		Event:          string(d.Event),
+		Status:         string(d.Status),
+		Attempts:       d.Attempts,
+		NextAttemptAt:  d.NextAttemptAt,
+		ResponseStatus: d.ResponseStatus,
+		ResponseBody:   d.ResponseBody,
+		Error:          d.Error,
+		RedeliveryOf:   d.RedeliveryOf,
+		Payload:        json.RawMessage(d.Payload),
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+	}
+}
+
+func ToAuditLog(l *models.AuditLog) *api.AuditLog {
+	log := &api.AuditLog{
+		ID:          l.ID,
+		ActorID:     l.ActorID,
+		ActorName:   l.ActorName,
+		IP:          l.IP,
+		Action:      string(l.Action),
+		TargetType:  l.TargetType,
+		TargetID:    l.TargetID,
+		TargetName:  l.TargetName,
+		TargetOwner: l.TargetOwner,
+		CreatedAt:   l.CreatedAt,
+	}
+
+	if len(l.Before) != 0 {
+		log.Before = json.RawMessage(l.Before)
+	}
+	if len(l.After) != 0 {
+		log.After = json.RawMessage(l.After)
+	}
+	return log
 }
@@ -0,0 +1,154 @@
+package indexer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jaytaylor/html2text"
+)
+
+var (
+	ErrBinaryContent = errors.New("content is not text")
+)
+
+// extractFunc returns the text of data, at most limit bytes are
+// decompressed from compressed formats.
+type extractFunc func(data []byte, limit int64) (string, error)
+
+var textExtensions = map[string]bool{
+	".txt": true, ".text": true, ".log": true, ".csv": true, ".tsv": true,
+	".md": true, ".markdown": true, ".rst": true, ".adoc": true, ".org": true, ".tex": true,
+	".json": true, ".xml": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".conf": true, ".cfg": true, ".properties": true,
+	".go": true, ".c": true, ".h": true, ".cc": true, ".cpp": true, ".hpp": true, ".cs": true, ".java": true, ".kt": true, ".scala": true,
+	".py": true, ".rb": true, ".php": true, ".pl": true, ".lua": true, ".rs": true, ".swift": true, ".m": true, ".r": true,
+	".js": true, ".jsx": true, ".ts": true, ".tsx": true, ".vue": true, ".css": true, ".scss": true, ".less": true,
+	".sh": true, ".bash": true, ".zsh": true, ".bat": true, ".ps1": true, ".sql": true, ".proto": true,
+}
+
+var documentExtractors = map[string]extractFunc{
+	".html": extractHTML,
+	".htm":  extractHTML,
+	".docx": extractOfficeXML("word/document.xml"),
+	".odt":  extractOfficeXML("content.xml"),
+}
+
+var plainNames = map[string]bool{
+	"readme": true, "license": true, "makefile": true, "dockerfile": true, "changelog": true,
+}
+
+func extractor(name string) (extractFunc, bool) {
+	name = strings.ToLower(name)
+	ext := path.Ext(name)
+	if fn, ok := documentExtractors[ext]; ok {
+		return fn, true
+	}
+
+	if textExtensions[ext] || (len(ext) == 0 && plainNames[name]) {
+		return extractPlain, true
+	}
+	return nil, false
+}
+
+// IsIndexable reports whether text can be extracted from a file by its name.
+func IsIndexable(name string) bool {
+	_, ok := extractor(name)
+	return ok
+}
+
+// ExtractText returns the text content of the file called name read from r,
+// at most limit bytes of r are read.
+func ExtractText(name string, r io.Reader, limit int64) (string, error) {
+	fn, ok := extractor(name)
+	if !ok {
+		return "", ErrBinaryContent
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit))
+	if err != nil {
+		return "", err
+	}
+	return fn(data, limit)
+}
+
+func extractPlain(data []byte, _ int64) (string, error) {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", ErrBinaryContent
+	}
+
+	// the content may be cut in the middle of a rune by the read limit
+	for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+		data = data[:len(data)-1]
+	}
+
+	if !utf8.Valid(data) {
+		return "", ErrBinaryContent
+	}
+	return string(data), nil
+}
+
+func extractHTML(data []byte, _ int64) (string, error) {
+	return html2text.FromReader(bytes.NewReader(data))
+}
+
+// extractOfficeXML returns an extractor for zip based document formats,
+// the text nodes of the document part are joined by whitespace.
+func extractOfficeXML(part string) extractFunc {
+	return func(data []byte, limit int64) (string, error) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return "", err
+		}
+
+		for _, f := range zr.File {
+			if f.Name != part {
+				continue
+			}
+
+			rc, err := f.Open()
+			if err != nil {
+				return "", err
+			}
+			defer rc.Close()
+
+			lr := &io.LimitedReader{R: rc, N: limit}
+			text, err := xmlText(lr)
+			if err != nil && lr.N <= 0 {
+				// the part was cut by the limit, the text before is kept
+				return text, nil
+			}
+			return text, err
+		}
+		return "", ErrBinaryContent
+	}
+}
+
+func xmlText(r io.Reader) (string, error) {
+	var b strings.Builder
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return b.String(), nil
+		}
+		if err != nil {
+			return b.String(), err
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			b.Write(t)
+		case xml.EndElement:
+			// paragraphs and tabs end words in both docx and odt
+			if t.Name.Local == "p" || t.Name.Local == "tab" || t.Name.Local == "br" {
+				b.WriteByte('\n')
+			}
+		}
+	}
+}
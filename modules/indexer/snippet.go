@@ -0,0 +1,67 @@
+package indexer
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	snippetEllipsis = "…"
+)
+
+// Snippet returns about length runes of text around the first match of
+// terms. Matches are wrapped in <mark>, the rest of the snippet is HTML
+// escaped.
+func Snippet(text string, terms []string, length int) string {
+	set := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		set[term] = true
+	}
+
+	first := -1
+	scanTerms(text, func(start, _ int, term string) {
+		if first < 0 && set[term] {
+			first = start
+		}
+	})
+	if first < 0 {
+		first = 0
+	}
+
+	// keep a quarter of the snippet before the first match
+	begin := first
+	for n := 0; n < length/4 && begin > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:begin])
+		begin -= size
+	}
+
+	end := begin
+	for n := 0; n < length && end < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+
+	var b strings.Builder
+	if begin > 0 {
+		b.WriteString(snippetEllipsis)
+	}
+
+	last := begin
+	scanTerms(text[begin:end], func(start, stop int, term string) {
+		if !set[term] {
+			return
+		}
+		b.WriteString(html.EscapeString(text[last : begin+start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[begin+start : begin+stop]))
+		b.WriteString("</mark>")
+		last = begin + stop
+	})
+	b.WriteString(html.EscapeString(text[last:end]))
+
+	if end < len(text) {
+		b.WriteString(snippetEllipsis)
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
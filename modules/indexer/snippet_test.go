@@ -0,0 +1,31 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnippet(t *testing.T) {
+	cases := []struct {
+		text    string
+		terms   []string
+		length  int
+		snippet string
+	}{
+		{"", []string{"a"}, 10, ""},
+		{"hello world", []string{"world"}, 40, "hello <mark>world</mark>"},
+		{"Hello World", []string{"hello"}, 40, "<mark>Hello</mark> World"},
+		{"no match here", []string{"absent"}, 40, "no match here"},
+		{"no match in a longer text", []string{"absent"}, 8, "no match…"},
+		{"one two three four five six seven", []string{"five"}, 12, "…ur <mark>five</mark> six …"},
+		{"a  b\n\tc <b>", []string{"c"}, 40, "a b <mark>c</mark> &lt;b&gt;"},
+		{"<x> tag <y>", []string{"tag"}, 40, "&lt;x&gt; <mark>tag</mark> &lt;y&gt;"},
+		{"cat dog cat", []string{"cat"}, 40, "<mark>cat</mark> dog <mark>cat</mark>"},
+		{"头发中文内容", []string{"中"}, 4, "…发<mark>中</mark>文内…"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.snippet, Snippet(c.text, c.terms, c.length), c.text)
+	}
+}
@@ -0,0 +1,69 @@
+package indexer
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxTermLength = 64
+)
+
+func isIdeograph(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// scanTerms calls fn with the byte range and the lower cased term of each
+// word of text. Words are runs of letters and digits, ideographs are
+// returned one by one since they are not separated by spaces.
+func scanTerms(text string, fn func(start, end int, term string)) {
+	start := -1
+
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		term := strings.ToLower(text[start:end])
+		if utf8.RuneCountInString(term) <= maxTermLength {
+			fn(start, end, term)
+		}
+		start = -1
+	}
+
+	for i, r := range text {
+		switch {
+		case isIdeograph(r):
+			flush(i)
+			fn(i, i+utf8.RuneLen(r), string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if start < 0 {
+				start = i
+			}
+		default:
+			flush(i)
+		}
+	}
+	flush(len(text))
+}
+
+// Tokenize splits text into terms and counts them.
+func Tokenize(text string) map[string]int {
+	terms := make(map[string]int)
+	scanTerms(text, func(_, _ int, term string) {
+		terms[term]++
+	})
+	return terms
+}
+
+// Terms returns the distinct terms of a query.
+func Terms(query string) []string {
+	counts := Tokenize(query)
+	terms := make([]string, 0, len(counts))
+	for term := range counts {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
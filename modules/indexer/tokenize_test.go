@@ -0,0 +1,33 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		text  string
+		terms map[string]int
+	}{
+		{"", map[string]int{}},
+		{"  ,.;  ", map[string]int{}},
+		{"Hello, hello WORLD", map[string]int{"hello": 2, "world": 1}},
+		{"file_v2.txt", map[string]int{"file": 1, "v2": 1, "txt": 1}},
+		{"Größe 10kB", map[string]int{"größe": 1, "10kb": 1}},
+		{"中文abc", map[string]int{"中": 1, "文": 1, "abc": 1}},
+		{"ひらがな", map[string]int{"ひ": 1, "ら": 1, "が": 1, "な": 1}},
+		{strings.Repeat("a", maxTermLength) + " " + strings.Repeat("b", maxTermLength+1), map[string]int{strings.Repeat("a", maxTermLength): 1}},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.terms, Tokenize(c.text), c.text)
+	}
+}
+
+func TestTerms(t *testing.T) {
+	assert.Equal(t, []string{}, Terms(""))
+	assert.Equal(t, []string{"apple", "banana"}, Terms("Banana apple BANANA"))
+}
@@ -0,0 +1,167 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClamd serves the INSTREAM command on a local port and answers with
+// the reply for the received stream.
+func fakeClamd(t *testing.T, reply func(data []byte) string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				cmd, err := r.ReadBytes(0)
+				if err != nil || string(cmd) != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+
+				data := &bytes.Buffer{}
+				size := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(r, size); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					if _, err := io.CopyN(data, r, int64(n)); err != nil {
+						return
+					}
+				}
+				conn.Write([]byte(reply(data.Bytes()) + "\x00"))
+			}(conn)
+		}
+	}()
+	return l
+}
+
+func TestClamdScan(t *testing.T) {
+	var received []byte
+	l := fakeClamd(t, func(data []byte) string {
+		received = data
+		switch {
+		case bytes.Contains(data, []byte("EICAR")):
+			return "stream: Eicar-Test-Signature FOUND"
+		case bytes.Contains(data, []byte("BOOM")):
+			return "INSTREAM size limit exceeded. ERROR"
+		}
+		return "stream: OK"
+	})
+	defer l.Close()
+
+	// a small chunk size splits the content into several chunks
+	clamd, err := NewClamd("tcp://"+l.Addr().String(), 5*time.Second, 3)
+	assert.NoError(t, err)
+
+	result, err := clamd.Scan(context.Background(), strings.NewReader("hello world"))
+	assert.NoError(t, err)
+	assert.False(t, result.Infected)
+	assert.Equal(t, "hello world", string(received))
+
+	result, err = clamd.Scan(context.Background(), strings.NewReader("xxEICARxx"))
+	assert.NoError(t, err)
+	assert.True(t, result.Infected)
+	assert.Equal(t, "Eicar-Test-Signature", result.Signature)
+
+	_, err = clamd.Scan(context.Background(), strings.NewReader("BOOM"))
+	assert.Error(t, err)
+
+	result, err = clamd.Scan(context.Background(), strings.NewReader(""))
+	assert.NoError(t, err)
+	assert.False(t, result.Infected)
+}
+
+func TestClamdUnavailable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	clamd, err := NewClamd(addr, time.Second, 0)
+	assert.NoError(t, err)
+
+	_, err = clamd.Scan(context.Background(), strings.NewReader("hello"))
+	assert.Error(t, err)
+}
+
+func TestNewClamd(t *testing.T) {
+	kases := []struct {
+		address string
+		network string
+		addr    string
+		err     bool
+	}{
+		{"unix:///var/run/clamav/clamd.ctl", "unix", "/var/run/clamav/clamd.ctl", false},
+		{"tcp://127.0.0.1:3310", "tcp", "127.0.0.1:3310", false},
+		{"127.0.0.1:3310", "tcp", "127.0.0.1:3310", false},
+		{"http://127.0.0.1:3310", "", "", true},
+	}
+
+	for _, kase := range kases {
+		clamd, err := NewClamd(kase.address, time.Second, 0)
+		if kase.err {
+			assert.Error(t, err, kase.address)
+			continue
+		}
+
+		assert.NoError(t, err, kase.address)
+		assert.Equal(t, kase.network, clamd.network, kase.address)
+		assert.Equal(t, kase.addr, clamd.address, kase.address)
+		assert.Equal(t, 1024*64, clamd.chunkSize, kase.address)
+	}
+}
+
+func TestParseClamdReply(t *testing.T) {
+	kases := []struct {
+		reply     string
+		infected  bool
+		signature string
+		err       bool
+	}{
+		{"stream: OK", false, "", false},
+		{"OK", false, "", false},
+		{"stream: Eicar-Test-Signature FOUND", true, "Eicar-Test-Signature", false},
+		{"1: stream: Win.Test.EICAR_HDB-1 FOUND", true, "Win.Test.EICAR_HDB-1", false},
+		{"INSTREAM size limit exceeded. ERROR", false, "", true},
+		{"stream: Can't allocate memory ERROR", false, "", true},
+		{"", false, "", true},
+	}
+
+	for _, kase := range kases {
+		result, err := parseClamdReply(kase.reply)
+		if kase.err {
+			assert.Error(t, err, kase.reply)
+			continue
+		}
+
+		assert.NoError(t, err, kase.reply)
+		assert.Equal(t, kase.infected, result.Infected, kase.reply)
+		assert.Equal(t, kase.signature, result.Signature, kase.reply)
+	}
+}
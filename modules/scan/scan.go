@@ -0,0 +1,50 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/czhj/ahfs/modules/setting"
+)
+
+// Result is the verdict of a scanner on a file.
+type Result struct {
+	Infected bool
+	// Signature names the malware found
+	Signature string
+}
+
+// Scanner examines the content of files for malware.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+}
+
+var (
+	// Default is the configured scanner, nil if scanning is disabled
+	Default Scanner
+)
+
+// Init creates the Default scanner from setting.Scanner.
+func Init() error {
+	Default = nil
+	if setting.Scanner == nil || !setting.Scanner.Enabled {
+		return nil
+	}
+
+	switch setting.Scanner.Type {
+	case "clamd":
+		clamd, err := NewClamd(setting.Scanner.Address, setting.Scanner.Timeout, setting.Scanner.ChunkSize)
+		if err != nil {
+			return err
+		}
+		Default = clamd
+	default:
+		return fmt.Errorf("Unsupported scanner type: %v", setting.Scanner.Type)
+	}
+	return nil
+}
+
+func IsEnabled() bool {
+	return Default != nil
+}
@@ -0,0 +1,30 @@
+package setting
+
+import "github.com/spf13/viper"
+
+type ArchiveService struct {
+	MaxSize           int64
+	ExtractMaxSize    int64
+	ExtractMaxEntries int
+	ExtractSyncSize   int64
+}
+
+var (
+	Archive *ArchiveService
+)
+
+func newArchiveService() {
+	viper.SetDefault("archive", map[string]interface{}{
+		"max_size":            1024 * 1024 * 1024, //1G
+		"extract_max_size":    1024 * 1024 * 1024, //1G
+		"extract_max_entries": 10000,
+		"extract_sync_size":   1024 * 1024 * 16, //16M
+	})
+
+	archiveCfg := viper.Sub("archive")
+	Archive = new(ArchiveService)
+	Archive.MaxSize = archiveCfg.GetInt64("max_size")
+	Archive.ExtractMaxSize = archiveCfg.GetInt64("extract_max_size")
+	Archive.ExtractMaxEntries = archiveCfg.GetInt("extract_max_entries")
+	Archive.ExtractSyncSize = archiveCfg.GetInt64("extract_sync_size")
+}
@@ -0,0 +1,27 @@
+package setting
+
+import "github.com/spf13/viper"
+
+type IndexerService struct {
+	Enabled       bool
+	MaxFileSize   int64
+	SnippetLength int
+}
+
+var (
+	Indexer *IndexerService
+)
+
+func newIndexerService() {
+	viper.SetDefault("indexer", map[string]interface{}{
+		"enabled":        true,
+		"max_file_size":  1024 * 1024 * 4, //4M
+		"snippet_length": 160,
+	})
+
+	indexerCfg := viper.Sub("indexer")
+	Indexer = new(IndexerService)
+	Indexer.Enabled = indexerCfg.GetBool("enabled")
+	Indexer.MaxFileSize = indexerCfg.GetInt64("max_file_size")
+	Indexer.SnippetLength = indexerCfg.GetInt("snippet_length")
+}
@@ -0,0 +1,50 @@
+package setting
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type ScannerService struct {
+	Enabled bool
+	// Type is the scanner implementation, only clamd is supported
+	Type string
+	// Address of clamd, unix:///path/to/clamd.sock or tcp://host:port
+	Address string
+	// Async scans uploads in the background. Otherwise uploads are scanned
+	// once they are stored, before the upload request returns. Either way
+	// files can't be downloaded until they are scanned.
+	Async     bool
+	Timeout   time.Duration
+	ChunkSize int
+	// RetryInterval is the interval between two retries of the files whose
+	// scan failed
+	RetryInterval time.Duration
+}
+
+var (
+	Scanner *ScannerService
+)
+
+func newScannerService() {
+	viper.SetDefault("scanner", map[string]interface{}{
+		"enabled":        false,
+		"type":           "clamd",
+		"address":        "unix:///var/run/clamav/clamd.ctl",
+		"async":          true,
+		"timeout":        time.Duration(60) * time.Second,
+		"chunk_size":     1024 * 64,
+		"retry_interval": time.Duration(10) * time.Minute,
+	})
+
+	scannerCfg := viper.Sub("scanner")
+	Scanner = new(ScannerService)
+	Scanner.Enabled = scannerCfg.GetBool("enabled")
+	Scanner.Type = scannerCfg.GetString("type")
+	Scanner.Address = scannerCfg.GetString("address")
+	Scanner.Async = scannerCfg.GetBool("async")
+	Scanner.Timeout = scannerCfg.GetDuration("timeout")
+	Scanner.ChunkSize = scannerCfg.GetInt("chunk_size")
+	Scanner.RetryInterval = scannerCfg.GetDuration("retry_interval")
+}
@@ -13,7 +13,19 @@ var Service struct {
 	ResetPasswordCodeInterval time.Duration
 	RegisterEmailConfirm      bool
 	MaxFileCapacitySize       int64
+	TeamMaxFileCapacitySize   int64
 	AvatarMaxSize             int64
+	FileLockTimeout           time.Duration
+	FileLockMaxTimeout        time.Duration
+	FileChangeRetention       time.Duration
+	AuditLogRetention         time.Duration
+	FileExpirySweepInterval   time.Duration
+	// FileExpiryNotifyBefore is how long before expiring the owner of a file
+	// is mailed, 0 disables the notification
+	FileExpiryNotifyBefore time.Duration
+	// DeletedFileRetention is how long deleted files are kept before the
+	// sweeper purges them
+	DeletedFileRetention time.Duration
 }
 
 func newService() {
@@ -23,16 +35,32 @@ func newService() {
 		"reset_password_code_live":     time.Duration(10) * time.Minute,
 		"reset_password_code_interval": time.Duration(60) * time.Second,
 		"register_email_confirm":       true,
-		"max_file_capacity_size":       1024 * 1024 * 512, //512M
+		"max_file_capacity_size":       1024 * 1024 * 512,      //512M
+		"team_max_file_capacity_size":  1024 * 1024 * 1024 * 2, //2G
 		"avatar_max_size":              1024 * 1024 * 3,
+		"file_lock_timeout":            time.Duration(1) * time.Hour,
+		"file_lock_max_timeout":        time.Duration(24) * time.Hour,
+		"file_change_retention":        time.Duration(30*24) * time.Hour,
+		"audit_log_retention":          time.Duration(365*24) * time.Hour,
+		"file_expiry_sweep_interval":   time.Duration(5) * time.Minute,
+		"file_expiry_notify_before":    time.Duration(24) * time.Hour,
+		"deleted_file_retention":       time.Duration(7*24) * time.Hour,
 	})
 
 	serviceCfg := viper.Sub("service")
 	Service.MaxFileCapacitySize = serviceCfg.GetInt64("max_file_capacity_size")
+	Service.TeamMaxFileCapacitySize = serviceCfg.GetInt64("team_max_file_capacity_size")
 	Service.ActiveCodeLive = serviceCfg.GetDuration("active_code_live")
 	Service.ActiveCodeInterval = serviceCfg.GetDuration("active_code_interval")
 	Service.ResetPasswordCodeLive = serviceCfg.GetDuration("reset_password_code_live")
 	Service.ResetPasswordCodeInterval = serviceCfg.GetDuration("reset_password_code_interval")
 	Service.RegisterEmailConfirm = serviceCfg.GetBool("register_email_confirm")
 	Service.AvatarMaxSize = serviceCfg.GetInt64("avatar_max_size")
+	Service.FileLockTimeout = serviceCfg.GetDuration("file_lock_timeout")
+	Service.FileLockMaxTimeout = serviceCfg.GetDuration("file_lock_max_timeout")
+	Service.FileChangeRetention = serviceCfg.GetDuration("file_change_retention")
+	Service.AuditLogRetention = serviceCfg.GetDuration("audit_log_retention")
+	Service.FileExpirySweepInterval = serviceCfg.GetDuration("file_expiry_sweep_interval")
+	Service.FileExpiryNotifyBefore = serviceCfg.GetDuration("file_expiry_notify_before")
+	Service.DeletedFileRetention = serviceCfg.GetDuration("deleted_file_retention")
 }
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/czhj/ahfs/modules/log"
 	"github.com/spf13/viper"
@@ -53,6 +54,11 @@ var (
 	API struct {
 		DefaultPagingSize int
 		MaxPagingSize     int
+		MaxBatchSize      int
+		MaxChangeSize     int
+		MaxChangeWait     time.Duration
+		MaxTreeDepth      int
+		MaxTreeSize       int
 	}
 
 	PasswordComplexity []string
@@ -246,12 +252,22 @@ func newAPIService() {
 	viper.SetDefault("api", map[string]interface{}{
 		"default_paging_size": 16,
 		"max_paging_size":     32,
+		"max_batch_size":      1000,
+		"max_change_size":     500,
+		"max_change_wait":     time.Duration(60) * time.Second,
+		"max_tree_depth":      8,
+		"max_tree_size":       2000,
 	})
 
 	apiCfg := viper.Sub("api")
 
 	API.DefaultPagingSize = apiCfg.GetInt("default_paging_size")
 	API.MaxPagingSize = apiCfg.GetInt("max_paging_size")
+	API.MaxBatchSize = apiCfg.GetInt("max_batch_size")
+	API.MaxChangeSize = apiCfg.GetInt("max_change_size")
+	API.MaxChangeWait = apiCfg.GetDuration("max_change_wait")
+	API.MaxTreeDepth = apiCfg.GetInt("max_tree_depth")
+	API.MaxTreeSize = apiCfg.GetInt("max_tree_size")
 }
 
 func SaveSetting() {
@@ -275,4 +291,10 @@ func NewServices() {
 	newPprofService()
 	newQueueService()
 	newLFSService()
+	newArchiveService()
+	newIndexerService()
+	newThumbnailService()
+	newWebhookService()
+	newUploadService()
+	newScannerService()
 }
@@ -0,0 +1,38 @@
+package setting
+
+import (
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+type ThumbnailService struct {
+	Enabled     bool
+	Sizes       []int
+	MaxFileSize int64
+	MaxWidth    int
+	MaxHeight   int
+}
+
+var (
+	Thumbnail *ThumbnailService
+)
+
+func newThumbnailService() {
+	viper.SetDefault("thumbnail", map[string]interface{}{
+		"enabled":       true,
+		"sizes":         []int{64, 256, 512},
+		"max_file_size": 1024 * 1024 * 32, //32M
+		"max_width":     10000,
+		"max_height":    10000,
+	})
+
+	thumbnailCfg := viper.Sub("thumbnail")
+	Thumbnail = new(ThumbnailService)
+	Thumbnail.Enabled = thumbnailCfg.GetBool("enabled")
+	Thumbnail.Sizes = thumbnailCfg.GetIntSlice("sizes")
+	Thumbnail.MaxFileSize = thumbnailCfg.GetInt64("max_file_size")
+	Thumbnail.MaxWidth = thumbnailCfg.GetInt("max_width")
+	Thumbnail.MaxHeight = thumbnailCfg.GetInt("max_height")
+	sort.Ints(Thumbnail.Sizes)
+}
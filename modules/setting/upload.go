@@ -0,0 +1,50 @@
+package setting
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// UploadService holds the policies every new file has to pass, 0 or an empty
+// list disables a policy.
+type UploadService struct {
+	MaxFileSize int64
+	// MaxFileCount is the number of files a user may keep
+	MaxFileCount int64
+	// AllowedTypes and BlockedTypes list extensions like ".exe" and MIME
+	// types like "image/*", blocked types win over allowed ones
+	AllowedTypes []string
+	BlockedTypes []string
+}
+
+var (
+	Upload *UploadService
+)
+
+func newUploadService() {
+	viper.SetDefault("upload", map[string]interface{}{
+		"max_file_size":  0,
+		"max_file_count": 0,
+		"allowed_types":  []string{},
+		"blocked_types":  []string{},
+	})
+
+	uploadCfg := viper.Sub("upload")
+	Upload = new(UploadService)
+	Upload.MaxFileSize = uploadCfg.GetInt64("max_file_size")
+	Upload.MaxFileCount = uploadCfg.GetInt64("max_file_count")
+	Upload.AllowedTypes = NormalizeFileTypes(uploadCfg.GetStringSlice("allowed_types"))
+	Upload.BlockedTypes = NormalizeFileTypes(uploadCfg.GetStringSlice("blocked_types"))
+}
+
+// NormalizeFileTypes lowers the file types and drops the empty ones.
+func NormalizeFileTypes(types []string) []string {
+	result := make([]string, 0, len(types))
+	for _, t := range types {
+		if t = strings.ToLower(strings.TrimSpace(t)); len(t) != 0 {
+			result = append(result, t)
+		}
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+package setting
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type WebhookService struct {
+	Enabled bool
+	// MaxAttempts is the number of times a delivery is tried before it fails
+	MaxAttempts int
+	// RetryInterval is the delay before the first retry, it doubles with
+	// every further attempt
+	RetryInterval     time.Duration
+	Timeout           time.Duration
+	DeliveryRetention time.Duration
+	// MaxResponseSize is the number of bytes of a response kept in the
+	// history, no response body is kept when it is 0
+	MaxResponseSize int64
+	// AllowLocalNetwork allows webhooks to loopback, private and link-local
+	// addresses, which are refused by default
+	AllowLocalNetwork bool
+}
+
+var (
+	Webhook *WebhookService
+)
+
+func newWebhookService() {
+	viper.SetDefault("webhook", map[string]interface{}{
+		"enabled":             true,
+		"max_attempts":        5,
+		"retry_interval":      time.Duration(10) * time.Second,
+		"timeout":             time.Duration(10) * time.Second,
+		"delivery_retention":  time.Duration(7*24) * time.Hour,
+		"max_response_size":   0,
+		"allow_local_network": false,
+	})
+
+	webhookCfg := viper.Sub("webhook")
+	Webhook = new(WebhookService)
+	Webhook.Enabled = webhookCfg.GetBool("enabled")
+	Webhook.MaxAttempts = webhookCfg.GetInt("max_attempts")
+	Webhook.RetryInterval = webhookCfg.GetDuration("retry_interval")
+	Webhook.Timeout = webhookCfg.GetDuration("timeout")
+	Webhook.DeliveryRetention = webhookCfg.GetDuration("delivery_retention")
+	Webhook.MaxResponseSize = webhookCfg.GetInt64("max_response_size")
+	Webhook.AllowLocalNetwork = webhookCfg.GetBool("allow_local_network")
+}
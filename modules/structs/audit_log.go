@@ -0,0 +1,21 @@
+package structs
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditLog struct {
+	ID          uint            `json:"id"`
+	ActorID     uint            `json:"actor_id"`
+	ActorName   string          `json:"actor_name"`
+	IP          string          `json:"ip"`
+	Action      string          `json:"action"`
+	TargetType  string          `json:"target_type"`
+	TargetID    uint            `json:"target_id"`
+	TargetName  string          `json:"target_name"`
+	TargetOwner uint            `json:"target_owner"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
@@ -3,13 +3,142 @@ package structs
 import "time"
 
 type File struct {
-	ID        uint      `json:"id"`
+	ID          uint       `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	FileName    string     `json:"filename"`
+	FileDir     string     `json:"path"`
+	IsDir       bool       `json:"is_dir"`
+	FileSize    int64      `json:"size"`
+	ContentType string     `json:"content_type,omitempty"`
+	FileCount   int64      `json:"file_count,omitempty"`
+	DirCount    int64      `json:"dir_count,omitempty"`
+	Quota       int64      `json:"quota,omitempty"`
+	Owner       uint       `json:"owner"`
+	ParentID    uint       `json:"parent_id"`
+	Version     int64      `json:"version"`
+	ETag        string     `json:"etag"`
+	Lock        *FileLock  `json:"lock,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	ScanStatus  string     `json:"scan_status,omitempty"`
+	ScanResult  string     `json:"scan_result,omitempty"`
+}
+
+// FileTree is a directory with its entries, Children is left out for
+// entries below the requested depth.
+type FileTree struct {
+	*File
+	HasChildren bool        `json:"has_children"`
+	Children    []*FileTree `json:"children,omitempty"`
+}
+
+type FileLock struct {
+	LockID    string    `json:"lock_id"`
+	FileID    uint      `json:"file_id"`
+	UserID    uint      `json:"user_id"`
+	User      *User     `json:"user,omitempty"`
+	Note      string    `json:"note,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	FileName  string    `json:"filename"`
-	FileDir   string    `json:"path"`
-	IsDir     bool      `json:"is_dir"`
-	FileSize  int64     `json:"size"`
-	Owner     uint      `json:"owner"`
-	ParentID  uint      `json:"parent_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type FileBatchResult struct {
+	Index  int    `json:"index"`
+	FileID uint   `json:"file_id"`
+	Code   int    `json:"code"`
+	Error  string `json:"error,omitempty"`
+	File   *File  `json:"file,omitempty"`
+}
+
+// UploadPolicy restricts the files stored below a directory, 0 or an empty
+// list disables a policy.
+type UploadPolicy struct {
+	DirectoryID  uint     `json:"directory_id"`
+	MaxFileSize  int64    `json:"max_file_size"`
+	AllowedTypes []string `json:"allowed_types"`
+	BlockedTypes []string `json:"blocked_types"`
+}
+
+type ExtractTask struct {
+	ID          uint      `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	ArchiveID   uint      `json:"archive_id"`
+	DirectoryID uint      `json:"directory_id"`
+	Status      string    `json:"status"`
+	FileCount   int       `json:"file_count"`
+	Message     string    `json:"message,omitempty"`
+}
+
+type FileContentSearchResult struct {
+	File    *File  `json:"file"`
+	Score   int    `json:"score"`
+	Snippet string `json:"snippet"`
+}
+
+type FileMetadata struct {
+	Tags       []string          `json:"tags"`
+	Properties map[string]string `json:"properties"`
+}
+
+type Tag struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+type FileTypeUsage struct {
+	ContentType string `json:"content_type"`
+	Count       int64  `json:"count"`
+	Size        int64  `json:"size"`
+}
+
+type DirectoryStats struct {
+	Directory *File            `json:"directory"`
+	Largest   []*File          `json:"largest"`
+	Types     []*FileTypeUsage `json:"types"`
+}
+
+type ShareLink struct {
+	ID            uint       `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Token         string     `json:"token"`
+	File          *File      `json:"file,omitempty"`
+	HasPassword   bool       `json:"has_password"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	MaxDownloads  int64      `json:"max_downloads"`
+	DownloadCount int64      `json:"download_count"`
+}
+
+type FileGrant struct {
+	ID         uint      `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	File       *File     `json:"file,omitempty"`
+	UserID     uint      `json:"user_id"`
+	User       *User     `json:"user,omitempty"`
+	Permission string    `json:"permission"`
+}
+
+type FileChange struct {
+	Seq         int64     `json:"seq"`
+	Type        string    `json:"type"`
+	FileID      uint      `json:"file_id"`
+	OldFileID   uint      `json:"old_file_id,omitempty"`
+	IsDir       bool      `json:"is_dir"`
+	ParentID    uint      `json:"parent_id"`
+	OldParentID uint      `json:"old_parent_id,omitempty"`
+	Name        string    `json:"name"`
+	OldName     string    `json:"old_name,omitempty"`
+	Path        string    `json:"path"`
+	OldPath     string    `json:"old_path,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// FileChanges is a batch of the change journal, Reset tells the client to
+// list its files again as changes after its cursor are not available anymore.
+type FileChanges struct {
+	Cursor  string        `json:"cursor"`
+	Reset   bool          `json:"reset"`
+	HasMore bool          `json:"has_more"`
+	Changes []*FileChange `json:"changes"`
 }
@@ -0,0 +1,36 @@
+package structs
+
+import "time"
+
+type Team struct {
+	ID               uint      `json:"id"`
+	Name             string    `json:"name"`
+	NickName         string    `json:"nickname"`
+	AvatarURL        string    `json:"avatar_url"`
+	CreatedAt        time.Time `json:"created_at"`
+	Role             string    `json:"role,omitempty"`
+	UsedFileCapacity int64     `json:"used_file_capacity"`
+	MaxFileCapacity  int64     `json:"max_file_capacity"`
+	RootFileID       uint      `json:"root_file_id"`
+}
+
+type TeamMember struct {
+	UserID    uint      `json:"user_id"`
+	User      *User     `json:"user,omitempty"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateTeamOption struct {
+	Name     string `json:"name" form:"name" binding:"required,username"`
+	Nickname string `json:"nickname" form:"nickname" binding:"omitempty,nickname"`
+}
+
+type EditTeamOption struct {
+	Nickname string `json:"nickname" form:"nickname" binding:"required,nickname"`
+}
+
+type SetTeamMemberOption struct {
+	Username string `json:"username" form:"username" binding:"required"`
+	Role     string `json:"role" form:"role" binding:"required,oneof=viewer editor owner"`
+}
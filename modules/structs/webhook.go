@@ -0,0 +1,58 @@
+package structs
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Webhook struct {
+	ID         uint      `json:"id"`
+	URL        string    `json:"url"`
+	HasSecret  bool      `json:"has_secret"`
+	Events     []string  `json:"events"`
+	PathPrefix string    `json:"path_prefix"`
+	IsActive   bool      `json:"is_active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	ID             uint            `json:"id"`
+	UUID           string          `json:"uuid"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	ResponseStatus int             `json:"response_status"`
+	ResponseBody   string          `json:"response_body"`
+	Error          string          `json:"error,omitempty"`
+	RedeliveryOf   uint            `json:"redelivery_of,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// WebhookPayload is the body posted to webhooks, User is the account of the
+// event or the owner of the changed file.
+type WebhookPayload struct {
+	Event     string      `json:"event"`
+	User      *User       `json:"user"`
+	Change    *FileChange `json:"change,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type CreateWebhookOption struct {
+	URL        string   `json:"url" form:"url" binding:"required,url,max=2048"`
+	Secret     string   `json:"secret" form:"secret" binding:"max=255"`
+	Events     []string `json:"events" form:"events" binding:"required,min=1"`
+	PathPrefix string   `json:"path_prefix" form:"path_prefix" binding:"max=1024"`
+	IsActive   *bool    `json:"is_active" form:"is_active"`
+}
+
+type EditWebhookOption struct {
+	URL        *string  `json:"url" form:"url" binding:"omitempty,url,max=2048"`
+	Secret     *string  `json:"secret" form:"secret" binding:"omitempty,max=255"`
+	Events     []string `json:"events" form:"events" binding:"omitempty,min=1"`
+	PathPrefix *string  `json:"path_prefix" form:"path_prefix" binding:"omitempty,max=1024"`
+	IsActive   *bool    `json:"is_active" form:"is_active"`
+}
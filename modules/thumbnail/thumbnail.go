@@ -0,0 +1,95 @@
+package thumbnail
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	// register the decoders of the supported formats
+	_ "image/gif"
+
+	"github.com/nfnt/resize"
+	"github.com/oliamb/cutter"
+)
+
+const (
+	jpegQuality = 85
+)
+
+// supportedTypes are the content types which can be decoded.
+var supportedTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+func IsSupported(contentType string) bool {
+	return supportedTypes[contentType]
+}
+
+// Decode decodes an image, images larger than maxWidth x maxHeight are
+// rejected before they are decoded.
+func Decode(r io.ReadSeeker, maxWidth, maxHeight int) (image.Image, string, error) {
+	imgCfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("Cannot decode image config: %v", err)
+	}
+
+	if imgCfg.Width > maxWidth {
+		return nil, "", fmt.Errorf("Image width too large: %d > %d", imgCfg.Width, maxWidth)
+	}
+
+	if imgCfg.Height > maxHeight {
+		return nil, "", fmt.Errorf("Image height too large: %d > %d", imgCfg.Height, maxHeight)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("Cannot decode image: %v", err)
+	}
+	return img, format, nil
+}
+
+// Square crops the center square of img and resizes it to size x size.
+func Square(img image.Image, size uint, interp resize.InterpolationFunction) (image.Image, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width != height {
+		var ax, ay, newSize int
+		if width > height {
+			newSize = height
+			ax = (width - height) / 2
+		} else {
+			newSize = width
+			ay = (height - width) / 2
+		}
+
+		var err error
+		img, err = cutter.Crop(img, cutter.Config{
+			Width:  newSize,
+			Height: newSize,
+			Anchor: image.Point{bounds.Min.X + ax, bounds.Min.Y + ay},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resize.Resize(size, size, img, interp), nil
+}
+
+// Encode writes img as jpeg, images decoded from formats supporting
+// transparency are written as png. It returns the content type written.
+func Encode(w io.Writer, img image.Image, format string) (string, error) {
+	if format == "png" || format == "gif" {
+		return "image/png", png.Encode(w, img)
+	}
+	return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+}
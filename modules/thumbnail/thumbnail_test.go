@@ -0,0 +1,107 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/nfnt/resize"
+	"github.com/stretchr/testify/assert"
+)
+
+// stripedImage returns a width x height image which is red in its center
+// square and blue elsewhere.
+func stripedImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	side := width
+	if height < side {
+		side = height
+	}
+	x0, y0 := (width-side)/2, (height-side)/2
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			c := color.RGBA{B: 255, A: 255}
+			if x >= x0 && x < x0+side && y >= y0 && y < y0+side {
+				c = color.RGBA{R: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestSquare(t *testing.T) {
+	cases := []struct {
+		width, height int
+		size          uint
+	}{
+		{100, 100, 10},
+		{200, 100, 50},
+		{100, 200, 50},
+		{30, 90, 60},
+	}
+
+	for _, c := range cases {
+		thumb, err := Square(stripedImage(c.width, c.height), c.size, resize.NearestNeighbor)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		bounds := thumb.Bounds()
+		assert.Equal(t, int(c.size), bounds.Dx(), "%dx%d", c.width, c.height)
+		assert.Equal(t, int(c.size), bounds.Dy(), "%dx%d", c.width, c.height)
+
+		// only the center square is kept
+		for _, p := range []image.Point{bounds.Min, bounds.Max.Sub(image.Pt(1, 1))} {
+			r, _, b, _ := thumb.At(p.X, p.Y).RGBA()
+			assert.True(t, r > 0 && b == 0, "%dx%d at %v", c.width, c.height, p)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, stripedImage(40, 20)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	img, format, err := Decode(bytes.NewReader(data), 40, 20)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "png", format)
+		assert.Equal(t, image.Rect(0, 0, 40, 20), img.Bounds())
+	}
+
+	_, _, err = Decode(bytes.NewReader(data), 39, 20)
+	assert.Error(t, err)
+	_, _, err = Decode(bytes.NewReader(data), 40, 19)
+	assert.Error(t, err)
+	_, _, err = Decode(bytes.NewReader([]byte("not an image")), 40, 20)
+	assert.Error(t, err)
+}
+
+func TestEncode(t *testing.T) {
+	img := stripedImage(4, 4)
+	cases := []struct {
+		format      string
+		contentType string
+	}{
+		{"png", "image/png"},
+		{"gif", "image/png"},
+		{"jpeg", "image/jpeg"},
+	}
+
+	for _, c := range cases {
+		buf := new(bytes.Buffer)
+		contentType, err := Encode(buf, img, c.format)
+		assert.NoError(t, err, c.format)
+		assert.Equal(t, c.contentType, contentType, c.format)
+
+		_, format, err := image.DecodeConfig(buf)
+		assert.NoError(t, err, c.format)
+		assert.Equal(t, contentType, "image/"+format, c.format)
+	}
+}
@@ -0,0 +1,98 @@
+package typesniffer
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	// SniffLength is the number of leading bytes used to detect a type.
+	SniffLength = 512
+
+	OctetStream = "application/octet-stream"
+)
+
+// extensionTypes takes precedence over the system mime table, which is
+// missing several common text formats on minimal hosts.
+var extensionTypes = map[string]string{
+	".md":       "text/markdown; charset=utf-8",
+	".markdown": "text/markdown; charset=utf-8",
+	".csv":      "text/csv; charset=utf-8",
+	".json":     "application/json",
+	".js":       "text/javascript; charset=utf-8",
+	".css":      "text/css; charset=utf-8",
+	".svg":      "image/svg+xml",
+	".yaml":     "text/yaml; charset=utf-8",
+	".yml":      "text/yaml; charset=utf-8",
+	".go":       "text/plain; charset=utf-8",
+	".pdf":      "application/pdf",
+	".docx":     "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx":     "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx":     "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":      "application/vnd.oasis.opendocument.text",
+	".mp4":      "video/mp4",
+	".mp3":      "audio/mpeg",
+}
+
+// activeTypes may run scripts when rendered by a browser.
+var activeTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+	"image/svg+xml":         true,
+	"text/xml":              true,
+	"application/xml":       true,
+}
+
+// ByName returns the content type of a file by its extension.
+func ByName(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if len(ext) == 0 {
+		return OctetStream
+	}
+
+	if typ, ok := extensionTypes[ext]; ok {
+		return typ
+	}
+
+	if typ := mime.TypeByExtension(ext); len(typ) != 0 {
+		return typ
+	}
+	return OctetStream
+}
+
+// Detect returns the content type of a file from its leading bytes. The
+// extension is only used when the content does not tell more than a
+// generic type, e.g. a docx file is sniffed as zip. Binary content never
+// gets an active type from its name.
+func Detect(name string, head []byte) string {
+	sniffed := http.DetectContentType(head)
+	typ := ByName(name)
+	if typ == OctetStream {
+		return sniffed
+	}
+
+	switch mediaType(sniffed) {
+	case "text/plain":
+		return typ
+	case OctetStream, "application/zip":
+		if !IsActiveContent(typ) {
+			return typ
+		}
+	}
+	return sniffed
+}
+
+// IsActiveContent reports whether a content type must not be rendered
+// inline without a sandbox.
+func IsActiveContent(contentType string) bool {
+	return activeTypes[mediaType(contentType)]
+}
+
+func mediaType(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
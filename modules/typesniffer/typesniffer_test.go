@@ -0,0 +1,80 @@
+package typesniffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	pngHead = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	zipHead = []byte("PK\x03\x04\x14\x00\x00\x00")
+	exeHead = []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff\x00\x00")
+)
+
+func TestByName(t *testing.T) {
+	cases := []struct {
+		name string
+		typ  string
+	}{
+		{"README", OctetStream},
+		{"notes.md", "text/markdown; charset=utf-8"},
+		{"NOTES.MD", "text/markdown; charset=utf-8"},
+		{"data.json", "application/json"},
+		{"report.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"unknown.ahfs-none", OctetStream},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.typ, ByName(c.name), c.name)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	cases := []struct {
+		name string
+		head []byte
+		typ  string
+	}{
+		// the name refines generic content types
+		{"notes.md", []byte("# title\n"), "text/markdown; charset=utf-8"},
+		{"data.csv", []byte("a,b\n1,2\n"), "text/csv; charset=utf-8"},
+		{"report.docx", zipHead, "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"song.mp3", []byte{0x00, 0x01, 0x02}, "audio/mpeg"},
+		{"icon.svg", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), "image/svg+xml"},
+		// the content wins over a misleading name
+		{"image.txt", pngHead, "image/png"},
+		{"photo.jpg", []byte("plain words\n"), "image/jpeg"},
+		{"page.md", []byte("<html><body>x</body></html>"), "text/html; charset=utf-8"},
+		// binary content never gets an active type from its name
+		{"evil.svg", exeHead, "application/octet-stream"},
+		{"evil.html", zipHead, "application/zip"},
+		// without a known extension the content decides
+		{"README", []byte("plain words\n"), "text/plain; charset=utf-8"},
+		{"blob", pngHead, "image/png"},
+		{"empty", []byte{}, "text/plain; charset=utf-8"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.typ, Detect(c.name, c.head), c.name)
+	}
+}
+
+func TestIsActiveContent(t *testing.T) {
+	cases := []struct {
+		typ    string
+		active bool
+	}{
+		{"text/html", true},
+		{"text/html; charset=utf-8", true},
+		{" Image/SVG+XML ", true},
+		{"application/xhtml+xml", true},
+		{"text/plain; charset=utf-8", false},
+		{"image/png", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.active, IsActiveContent(c.typ), c.typ)
+	}
+}
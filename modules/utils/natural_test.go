@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func TestNaturalCompare(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "a", -1},
+		{"a", "", 1},
+		{"a", "a", 0},
+		{"a", "B", -1},
+		{"File", "file", 0},
+		{"file2", "file10", -1},
+		{"file10", "file2", 1},
+		{"file02", "file2", 0},
+		{"file002", "file10", -1},
+		{"v1.9", "v1.10", -1},
+		{"img12b", "img12a", 1},
+		{"a1b2", "a1b10", -1},
+		{"2", "a", -1},
+		{"99999999999999999999", "100000000000000000000", -1},
+		{"ä", "Ä", 0},
+		{"é", "f", 1},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.want, sign(NaturalCompare(c.a, c.b)), "%q <=> %q", c.a, c.b)
+	}
+}
+
+func TestNaturalCompareSort(t *testing.T) {
+	names := []string{"file10.txt", "File1.txt", "file2.txt", "file1b.txt", "a", "file20.txt"}
+	sort.Slice(names, func(i, j int) bool {
+		return NaturalCompare(names[i], names[j]) < 0
+	})
+	assert.Equal(t, []string{"a", "File1.txt", "file1b.txt", "file2.txt", "file10.txt", "file20.txt"}, names)
+}
@@ -16,6 +16,7 @@ var (
 		"username": Username,
 		"nickname": Nickname,
 		"filename": Filename,
+		"conflict": Conflict,
 	}
 
 	usernameRegexp = regexp.MustCompile("^[a-zA-Z0-9_-]{6,16}$")
@@ -43,6 +44,18 @@ func Filename(fl validator.FieldLevel) bool {
 	return ValidFilename(filename)
 }
 
+func Conflict(fl validator.FieldLevel) bool {
+	return ValidConflict(fl.Field().String())
+}
+
+func ValidConflict(policy string) bool {
+	switch policy {
+	case "reject", "overwrite", "rename", "merge":
+		return true
+	}
+	return false
+}
+
 func ValidFilename(name string) bool {
 	return filenameRegexp.MatchString(name)
 }
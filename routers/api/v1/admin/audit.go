@@ -0,0 +1,214 @@
+package admin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	"github.com/czhj/ahfs/modules/log"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+	"go.uber.org/zap"
+)
+
+// auditExportBatchSize is the number of entries read at once while exporting.
+const auditExportBatchSize = 500
+
+type AuditLogSearchForm struct {
+	// User is the username of the actor
+	User string `form:"user"`
+	// Action is a comma separated list of actions
+	Action string     `form:"action"`
+	Since  *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until  *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Format string     `form:"format" binding:"omitempty,oneof=csv json"`
+}
+
+func getAuditLogOptions(c *context.APIContext) (*models.SearchAuditLogOptions, *AuditLogSearchForm, bool) {
+	form := &AuditLogSearchForm{}
+	if err := c.ShouldBindQuery(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return nil, nil, false
+	}
+
+	opts := &models.SearchAuditLogOptions{
+		ListOptions: utils.GetListOptions(c),
+		Since:       form.Since,
+		Until:       form.Until,
+	}
+
+	if len(form.User) != 0 {
+		user, err := models.GetUserByUsername(form.User)
+		if err != nil {
+			if models.IsErrUserNotExist(err) {
+				c.NotFound(ecode.UserNotFound, err)
+			} else {
+				c.InternalServerError(err)
+			}
+			return nil, nil, false
+		}
+		opts.ActorID = &user.ID
+	}
+
+	for _, action := range strings.Split(form.Action, ",") {
+		if action = strings.TrimSpace(action); len(action) != 0 {
+			opts.Actions = append(opts.Actions, models.AuditAction(action))
+		}
+	}
+	return opts, form, true
+}
+
+// ListsAuditLog lists the audit trail, the newest entries first.
+func ListsAuditLog(c *context.APIContext) {
+	opts, _, ok := getAuditLogOptions(c)
+	if !ok {
+		return
+	}
+
+	if opts.Page <= 0 {
+		opts.Page = 1
+	}
+
+	logs, maxResult, err := models.SearchAuditLogs(opts)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	result := make([]*api.AuditLog, len(logs))
+	for i := range logs {
+		result[i] = convert.ToAuditLog(logs[i])
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(maxResult, 10))
+	c.Header("Access-Control-Expose-Headers", "X-Total-Count")
+	c.OK(result)
+}
+
+var auditLogCSVHeader = []string{"id", "created_at", "actor_id", "actor_name", "ip", "action", "target_type", "target_id", "target_name", "target_owner", "before", "after"}
+
+// ExportAuditLogs streams every matching entry, the oldest first, as a CSV
+// file or as a JSON array.
+func ExportAuditLogs(c *context.APIContext) {
+	opts, form, ok := getAuditLogOptions(c)
+	if !ok {
+		return
+	}
+
+	format := form.Format
+	if len(format) == 0 {
+		format = "csv"
+	}
+
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+	}
+	c.Header("Content-Disposition", context.ContentDisposition("attachment", "audit_logs."+format))
+	c.Status(http.StatusOK)
+
+	var err error
+	if format == "csv" {
+		err = exportAuditLogsCSV(c, opts)
+	} else {
+		err = exportAuditLogsJSON(c, opts)
+	}
+
+	if err != nil {
+		// headers are already sent, the client sees a truncated export
+		log.Error("Failed to export audit logs", zap.Error(err))
+		c.Abort()
+	}
+}
+
+func exportAuditLogsCSV(c *context.APIContext, opts *models.SearchAuditLogOptions) error {
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write(auditLogCSVHeader); err != nil {
+		return err
+	}
+
+	err := models.IterateAuditLogs(opts, auditExportBatchSize, func(logs []*models.AuditLog) error {
+		for _, l := range logs {
+			record := []string{
+				strconv.FormatUint(uint64(l.ID), 10),
+				l.CreatedAt.Format(time.RFC3339),
+				strconv.FormatUint(uint64(l.ActorID), 10),
+				l.ActorName,
+				l.IP,
+				string(l.Action),
+				l.TargetType,
+				strconv.FormatUint(uint64(l.TargetID), 10),
+				l.TargetName,
+				strconv.FormatUint(uint64(l.TargetOwner), 10),
+				l.Before,
+				l.After,
+			}
+			for i := range record {
+				record[i] = csvCell(record[i])
+			}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// csvCell keeps spreadsheets from running a cell as a formula, names and
+// states come from users, so cells starting like a formula are prefixed with
+// a quote.
+func csvCell(s string) string {
+	if len(s) != 0 && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func exportAuditLogsJSON(c *context.APIContext, opts *models.SearchAuditLogOptions) error {
+	if _, err := c.Writer.WriteString("["); err != nil {
+		return err
+	}
+
+	first := true
+	err := models.IterateAuditLogs(opts, auditExportBatchSize, func(logs []*models.AuditLog) error {
+		for _, l := range logs {
+			data, err := json.Marshal(convert.ToAuditLog(l))
+			if err != nil {
+				return err
+			}
+
+			if !first {
+				if _, err := c.Writer.WriteString(","); err != nil {
+					return err
+				}
+			}
+			first = false
+
+			if _, err := c.Writer.Write(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Writer.WriteString("]")
+	return err
+}
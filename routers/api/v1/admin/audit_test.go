@@ -0,0 +1,30 @@
+package admin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVCell(t *testing.T) {
+	cases := []struct {
+		cell string
+		want string
+	}{
+		{"", ""},
+		{"alice", "alice"},
+		{"127.0.0.1", "127.0.0.1"},
+		{`{"path":"/a"}`, `{"path":"/a"}`},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+1+2", "'+1+2"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.want, csvCell(c.cell), c.cell)
+	}
+}
@@ -1,6 +1,7 @@
 package admin
 
 import (
+	"net/http"
 	"strconv"
 	"strings"
 
@@ -8,6 +9,7 @@ import (
 	"github.com/czhj/ahfs/modules/context"
 	"github.com/czhj/ahfs/modules/convert"
 	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
 	"github.com/czhj/ahfs/routers/api/v1/utils"
 )
 
@@ -42,3 +44,32 @@ func ListsFile(c *context.APIContext) {
 	c.OK(result)
 
 }
+
+// UnlockFile releases the lock of a file whoever holds it.
+func UnlockFile(c *context.APIContext) {
+	fileID, err := strconv.ParseUint(c.Param("file_id"), 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	file, err := models.GetFileByID(uint(fileID), 0)
+	if err != nil {
+		if models.IsErrFileNotExist(err) {
+			c.NotFound(ecode.FileNotExist, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	if err := models.UnlockFile(file, c.User.ID, true); err != nil {
+		if models.IsFileUnlockFailed(err) {
+			c.Error(http.StatusBadRequest, ecode.FileNotLocked, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+	c.OK(nil)
+}
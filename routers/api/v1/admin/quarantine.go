@@ -0,0 +1,129 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+)
+
+type QuarantineSearchForm struct {
+	Status string `form:"status" binding:"omitempty,oneof=quarantined pending"`
+}
+
+// ListsQuarantinedFile lists the files held back by the scanner, the
+// quarantined ones unless status is pending.
+func ListsQuarantinedFile(c *context.APIContext) {
+	form := &QuarantineSearchForm{}
+	if err := c.ShouldBindQuery(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	status := models.FileScanQuarantined
+	if len(form.Status) != 0 {
+		status = models.FileScanStatus(form.Status)
+	}
+
+	listOptions := utils.GetListOptions(c)
+	if listOptions.Page <= 0 {
+		listOptions.Page = 1
+	}
+
+	files, maxResult, err := models.GetQuarantinedFiles(status, listOptions)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	result := make([]*api.File, len(files))
+	for i := range files {
+		result[i] = convert.ToFile(files[i])
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(maxResult, 10))
+	c.Header("Access-Control-Expose-Headers", "X-Total-Count")
+	c.OK(result)
+}
+
+func getQuarantinedFile(c *context.APIContext) (*models.File, bool) {
+	fileID, err := strconv.ParseUint(c.Param("file_id"), 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return nil, false
+	}
+
+	file, err := models.GetFileByID(uint(fileID), 0)
+	if err != nil {
+		if models.IsErrFileNotExist(err) {
+			c.NotFound(ecode.FileNotExist, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return nil, false
+	}
+
+	if file.IsDownloadable() {
+		c.Error(http.StatusBadRequest, ecode.FileNotQuarantined, models.ErrFileNotQuarantined{ID: file.ID})
+		return nil, false
+	}
+	return file, true
+}
+
+func quarantineAuditState(f *models.File) map[string]interface{} {
+	return map[string]interface{}{
+		"path":        f.FilePath(),
+		"size":        f.FileSize,
+		"scan_status": f.ScanStatus,
+		"signature":   f.ScanResult,
+	}
+}
+
+// ReleaseQuarantinedFile makes a file held back by the scanner downloadable.
+func ReleaseQuarantinedFile(c *context.APIContext) {
+	file, ok := getQuarantinedFile(c)
+	if !ok {
+		return
+	}
+
+	before := quarantineAuditState(file)
+	if err := models.ReleaseQuarantinedFile(file); err != nil {
+		if models.IsErrFileNotQuarantined(err) {
+			c.Error(http.StatusBadRequest, ecode.FileNotQuarantined, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	utils.Audit(c, models.NewFileAuditLog(models.AuditFileRelease, file), before, quarantineAuditState(file))
+	c.OK(convert.ToFile(file))
+}
+
+// DeleteQuarantinedFile deletes a file held back by the scanner on behalf of
+// its owner.
+func DeleteQuarantinedFile(c *context.APIContext) {
+	file, ok := getQuarantinedFile(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteFile(file.Owner, file, ""); err != nil {
+		if models.IsErrFileModified(err) {
+			c.Error(http.StatusPreconditionFailed, ecode.FileModified, err)
+		} else if models.IsErrFileLocked(err) {
+			c.Error(http.StatusLocked, ecode.FileLocked, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	utils.Audit(c, models.NewFileAuditLog(models.AuditFileDelete, file), quarantineAuditState(file), nil)
+	c.OK(nil)
+}
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	api "github.com/czhj/ahfs/modules/structs"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+)
+
+// ListsTeam lists all teams, their capacity is changed like the one of
+// users through EditUser.
+func ListsTeam(c *context.APIContext) {
+	listOptions := utils.GetListOptions(c)
+
+	opts := &models.SearchUserOptions{
+		ListOptions: listOptions,
+		Keyword:     strings.Trim(c.Query("q"), " "),
+		Type:        models.UserTypeTeam,
+	}
+
+	teams, maxResult, err := models.SearchUser(opts)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	result := make([]*api.Team, len(teams))
+	for i := range teams {
+		root, err := models.GetUserRootFile(teams[i].ID)
+		if err != nil {
+			c.InternalServerError(err)
+			return
+		}
+		result[i] = convert.ToTeam(teams[i], models.TeamRoleNone, root.ID)
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(maxResult, 10))
+	c.Header("Access-Control-Expose-Headers", "X-Total-Count")
+	c.OK(result)
+}
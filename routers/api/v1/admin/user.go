@@ -11,6 +11,7 @@ import (
 	api "github.com/czhj/ahfs/modules/structs"
 	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
 	"github.com/czhj/ahfs/routers/api/v1/utils"
+	"github.com/czhj/ahfs/services/webhook"
 )
 
 func DeleteUser(c *context.APIContext) {
@@ -29,12 +30,16 @@ func DeleteUser(c *context.APIContext) {
 	if err := models.DeleteUser(user); err != nil {
 		if models.IsErrUserNotExist(err) {
 			c.NotFound(ecode.UsernameNotFound, err)
+		} else if models.IsErrTeamLastOwner(err) {
+			c.Error(http.StatusBadRequest, ecode.TeamLastOwner, err)
 		} else {
 			c.InternalServerError(err)
 		}
 		return
 	}
 
+	utils.Audit(c, models.NewUserAuditLog(models.AuditAdminDeleteUser, user), userAuditState(user), nil)
+	webhook.NotifyAccount(models.WebhookEventAccountDelete, user)
 	c.Done(http.StatusNotFound, nil)
 }
 
@@ -87,6 +92,7 @@ func EditUser(c *context.APIContext) {
 		return
 	}
 
+	before := userAuditState(user)
 	if opts.Active != nil {
 		user.IsActive = *opts.Active
 	}
@@ -112,5 +118,19 @@ func EditUser(c *context.APIContext) {
 		return
 	}
 
+	utils.Audit(c, models.NewUserAuditLog(models.AuditAdminEditUser, user), before, userAuditState(user))
+	webhook.NotifyAccount(models.WebhookEventAccountUpdate, user)
 	c.OK(convert.ToUser(user, c.IsSigned, c.IsAdmin()))
 }
+
+// userAuditState is the state of u kept in the audit log.
+func userAuditState(u *models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"nickname":             u.Nickname,
+		"is_active":            u.IsActive,
+		"is_admin":             u.IsAdmin,
+		"must_change_password": u.MustChangePassword,
+		"max_file_capacity":    u.MaxFileCapacity,
+		"used_file_capacity":   u.UsedFileCapacity,
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"github.com/czhj/ahfs/routers/api/v1/admin"
 	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
 	"github.com/czhj/ahfs/routers/api/v1/file"
+	"github.com/czhj/ahfs/routers/api/v1/team"
 	"github.com/czhj/ahfs/routers/api/v1/user"
+	"github.com/czhj/ahfs/routers/api/v1/webhook"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -29,7 +31,7 @@ func requestSignIn() context.APIHandlerFunc {
 
 func requestAdmin() context.APIHandlerFunc {
 	return func(c *context.APIContext) {
-		if c.IsAdmin() {
+		if !c.IsAdmin() {
 			c.Error(http.StatusUnauthorized, ecode.UnauthorizedError, "unauthorized error")
 			c.Abort()
 			return
@@ -63,8 +65,9 @@ func RegisterRoutes(e *gin.RouterGroup) {
 	{
 		v1.Use(cors.New(cors.Config{
 			AllowAllOrigins: true,
-			AllowMethods:    []string{"POST", "GET", "PUT", "DELETE"},
-			AllowHeaders:    []string{"Origin"},
+			AllowMethods:    []string{"POST", "GET", "PUT", "DELETE", "MKCOL", "MOVE", "COPY"},
+			AllowHeaders:    []string{"Origin", "Destination", "If-Match"},
+			ExposeHeaders:   []string{"ETag"},
 		}))
 		users := v1.Group("/users")
 		{
@@ -81,9 +84,22 @@ func RegisterRoutes(e *gin.RouterGroup) {
 			currentUser.Use(context.APIContextWrapper(requestSignIn()))
 			currentUser.GET("", context.APIContextWrapper(user.GetAuthenticatedUser))
 			currentUser.GET("/directory/root", context.APIContextWrapper(file.GetUserRootDirectory))
+			currentUser.GET("/starred", context.APIContextWrapper(file.ListStarredFiles))
+			currentUser.GET("/recent", context.APIContextWrapper(file.ListRecentFiles))
+			currentUser.GET("/shares", context.APIContextWrapper(file.ListShareLinks))
+			currentUser.POST("/shares", context.APIContextWrapper(file.CreateShareLink))
+			currentUser.GET("/shared", context.APIContextWrapper(file.ListSharedWithMe))
+			currentUser.DELETE("/shares/:share_id", context.APIContextWrapper(file.DeleteShareLink))
 			currentUser.PATCH("/", context.APIContextWrapper(user.EditUser))
 			currentUser.PUT("/password", context.APIContextWrapper(user.EditUserPassword))
 			currentUser.PUT("/avatar", context.APIContextWrapper(user.UpdateAvatar))
+			currentUser.GET("/webhooks", context.APIContextWrapper(webhook.ListHooks))
+			currentUser.POST("/webhooks", context.APIContextWrapper(webhook.CreateHook))
+			currentUser.GET("/webhooks/:webhook_id", context.APIContextWrapper(webhook.GetHook))
+			currentUser.PATCH("/webhooks/:webhook_id", context.APIContextWrapper(webhook.EditHook))
+			currentUser.DELETE("/webhooks/:webhook_id", context.APIContextWrapper(webhook.DeleteHook))
+			currentUser.GET("/webhooks/:webhook_id/deliveries", context.APIContextWrapper(webhook.ListDeliveries))
+			currentUser.POST("/webhooks/:webhook_id/deliveries/:delivery_id/redeliver", context.APIContextWrapper(webhook.Redeliver))
 		}
 
 		userGroup := v1.Group("/user")
@@ -96,9 +112,27 @@ func RegisterRoutes(e *gin.RouterGroup) {
 		files := v1.Group("/files")
 		{
 			files.Use(context.APIContextWrapper(requestSignIn()))
+			files.GET("", context.APIContextWrapper(file.SearchFiles))
 			files.POST("", context.APIContextWrapper(file.UploadFile))
+			files.POST("/batch", context.APIContextWrapper(file.BatchFiles))
+			files.POST("/archive", context.APIContextWrapper(file.ArchiveFiles))
 			files.GET("/:file_id", context.APIContextWrapper(file.DownloadFile))
 			files.GET("/:file_id/info", context.APIContextWrapper(file.GetFileInfo))
+			files.GET("/:file_id/thumbnail", context.APIContextWrapper(file.GetThumbnail))
+			files.GET("/:file_id/metadata", context.APIContextWrapper(file.GetFileMetadata))
+			files.PUT("/:file_id/star", context.APIContextWrapper(file.StarFile))
+			files.DELETE("/:file_id/star", context.APIContextWrapper(file.UnstarFile))
+			files.PUT("/:file_id/lock", context.APIContextWrapper(file.LockFile))
+			files.DELETE("/:file_id/lock", context.APIContextWrapper(file.UnlockFile))
+			files.PUT("/:file_id/expiration", context.APIContextWrapper(file.SetFileExpiration))
+			files.DELETE("/:file_id/expiration", context.APIContextWrapper(file.RemoveFileExpiration))
+			files.GET("/:file_id/grants", context.APIContextWrapper(file.ListFileGrants))
+			files.PUT("/:file_id/grants", context.APIContextWrapper(file.GrantFile))
+			files.DELETE("/:file_id/grants/:user_id", context.APIContextWrapper(file.RevokeFileGrant))
+			files.PUT("/:file_id/tags", context.APIContextWrapper(file.AddFileTags))
+			files.DELETE("/:file_id/tags/:tag", context.APIContextWrapper(file.RemoveFileTag))
+			files.PUT("/:file_id/properties", context.APIContextWrapper(file.SetFileProperties))
+			files.DELETE("/:file_id/properties/:name", context.APIContextWrapper(file.RemoveFileProperty))
 			files.PUT("/:file_id/name", context.APIContextWrapper(file.RenameFile))
 			files.PUT("/:file_id/directory", context.APIContextWrapper(file.MoveFile))
 			files.DELETE("/:file_id", context.APIContextWrapper(file.DeleteFile))
@@ -109,6 +143,75 @@ func RegisterRoutes(e *gin.RouterGroup) {
 			directory.Use(context.APIContextWrapper(requestSignIn()))
 			directory.POST("", context.APIContextWrapper(file.CreateDirectory))
 			directory.GET("/:file_id", context.APIContextWrapper(file.ReadDirectory))
+			directory.GET("/:file_id/archive", context.APIContextWrapper(file.ArchiveDirectory))
+			directory.GET("/:file_id/stats", context.APIContextWrapper(file.GetDirectoryStats))
+			directory.GET("/:file_id/tree", context.APIContextWrapper(file.GetDirectoryTree))
+			directory.PUT("/:file_id/quota", context.APIContextWrapper(file.SetDirectoryQuota))
+			directory.DELETE("/:file_id/quota", context.APIContextWrapper(file.RemoveDirectoryQuota))
+			directory.GET("/:file_id/upload_policy", context.APIContextWrapper(file.GetUploadPolicy))
+			directory.PUT("/:file_id/upload_policy", context.APIContextWrapper(file.SetUploadPolicy))
+			directory.DELETE("/:file_id/upload_policy", context.APIContextWrapper(file.RemoveUploadPolicy))
+			directory.POST("/:file_id/extract", context.APIContextWrapper(file.ExtractArchive))
+		}
+
+		changes := v1.Group("/changes")
+		{
+			changes.Use(context.APIContextWrapper(requestSignIn()))
+			changes.GET("", context.APIContextWrapper(file.ListChanges))
+		}
+
+		teams := v1.Group("/teams")
+		{
+			teams.Use(context.APIContextWrapper(requestSignIn()))
+			teams.POST("", context.APIContextWrapper(team.CreateTeam))
+			teams.GET("", context.APIContextWrapper(team.ListTeams))
+			teams.GET("/:team_id", context.APIContextWrapper(team.GetTeam))
+			teams.PATCH("/:team_id", context.APIContextWrapper(team.EditTeam))
+			teams.DELETE("/:team_id", context.APIContextWrapper(team.DeleteTeam))
+			teams.GET("/:team_id/members", context.APIContextWrapper(team.ListMembers))
+			teams.PUT("/:team_id/members", context.APIContextWrapper(team.SetMember))
+			teams.DELETE("/:team_id/members/:user_id", context.APIContextWrapper(team.RemoveMember))
+		}
+
+		shares := v1.Group("/shares")
+		{
+			shares.Use(context.APIContextWrapper(requestLimiter()))
+			shares.GET("/:token", context.APIContextWrapper(file.GetSharedFile))
+			shares.GET("/:token/files", context.APIContextWrapper(file.ListSharedDirectory))
+			shares.GET("/:token/download", context.APIContextWrapper(file.DownloadSharedFile))
+			// the password of a link may be posted instead of sent in a header
+			shares.POST("/:token", context.APIContextWrapper(file.GetSharedFile))
+			shares.POST("/:token/files", context.APIContextWrapper(file.ListSharedDirectory))
+			shares.POST("/:token/download", context.APIContextWrapper(file.DownloadSharedFile))
+		}
+
+		tags := v1.Group("/tags")
+		{
+			tags.Use(context.APIContextWrapper(requestSignIn()))
+			tags.GET("", context.APIContextWrapper(file.ListTags))
+		}
+
+		search := v1.Group("/search")
+		{
+			search.Use(context.APIContextWrapper(requestSignIn()))
+			search.GET("/content", context.APIContextWrapper(file.SearchFileContent))
+		}
+
+		extractTasks := v1.Group("/extract_tasks")
+		{
+			extractTasks.Use(context.APIContextWrapper(requestSignIn()))
+			extractTasks.GET("/:task_id", context.APIContextWrapper(file.GetExtractTask))
+		}
+
+		fs := v1.Group("/fs")
+		{
+			fs.Use(context.APIContextWrapper(requestSignIn()))
+			fs.GET("/*path", context.APIContextWrapper(file.GetPath))
+			fs.PUT("/*path", context.APIContextWrapper(file.PutPath))
+			fs.DELETE("/*path", context.APIContextWrapper(file.DeletePath))
+			fs.Handle("MKCOL", "/*path", context.APIContextWrapper(file.MakeDirPath))
+			fs.Handle("MOVE", "/*path", context.APIContextWrapper(file.MovePath))
+			fs.Handle("COPY", "/*path", context.APIContextWrapper(file.CopyPath))
 		}
 
 		adminGroup := v1.Group("/admin", context.APIContextWrapper(requestAdmin()))
@@ -118,13 +221,35 @@ func RegisterRoutes(e *gin.RouterGroup) {
 			usersAdmin.DELETE("/:username", context.APIContextWrapper(admin.DeleteUser))
 			usersAdmin.PATCH("/:username", context.APIContextWrapper(admin.EditUser))
 
+			teamsAdmin := adminGroup.Group("/teams")
+			teamsAdmin.GET("", context.APIContextWrapper(admin.ListsTeam))
+
+			auditLogsAdmin := adminGroup.Group("/audit_logs")
+			auditLogsAdmin.GET("", context.APIContextWrapper(admin.ListsAuditLog))
+			auditLogsAdmin.GET("/export", context.APIContextWrapper(admin.ExportAuditLogs))
+
+			webhooksAdmin := adminGroup.Group("/webhooks")
+			webhooksAdmin.GET("", context.APIContextWrapper(webhook.ListSystemHooks))
+			webhooksAdmin.POST("", context.APIContextWrapper(webhook.CreateSystemHook))
+			webhooksAdmin.GET("/:webhook_id", context.APIContextWrapper(webhook.GetSystemHook))
+			webhooksAdmin.PATCH("/:webhook_id", context.APIContextWrapper(webhook.EditSystemHook))
+			webhooksAdmin.DELETE("/:webhook_id", context.APIContextWrapper(webhook.DeleteSystemHook))
+			webhooksAdmin.GET("/:webhook_id/deliveries", context.APIContextWrapper(webhook.ListSystemDeliveries))
+			webhooksAdmin.POST("/:webhook_id/deliveries/:delivery_id/redeliver", context.APIContextWrapper(webhook.RedeliverSystem))
+
 			filesAdmin := adminGroup.Group("/files")
 			filesAdmin.GET("", context.APIContextWrapper(admin.ListsFile))
+			filesAdmin.DELETE("/:file_id/lock", context.APIContextWrapper(admin.UnlockFile))
 			filesAdmin.GET("/:file_id", context.APIContextWrapper(file.DownloadFile))
 			filesAdmin.GET("/:file_id/info", context.APIContextWrapper(file.GetFileInfo))
 			filesAdmin.PUT("/:file_id/name", context.APIContextWrapper(file.RenameFile))
 			filesAdmin.PUT("/:file_id/directory", context.APIContextWrapper(file.MoveFile))
 			filesAdmin.DELETE("/:file_id", context.APIContextWrapper(file.DeleteFile))
+
+			quarantineAdmin := adminGroup.Group("/quarantine")
+			quarantineAdmin.GET("", context.APIContextWrapper(admin.ListsQuarantinedFile))
+			quarantineAdmin.POST("/:file_id/release", context.APIContextWrapper(admin.ReleaseQuarantinedFile))
+			quarantineAdmin.DELETE("/:file_id", context.APIContextWrapper(admin.DeleteQuarantinedFile))
 		}
 	}
 }
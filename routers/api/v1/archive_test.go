@@ -0,0 +1,121 @@
+package v1
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/archiver"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/stretchr/testify/assert"
+)
+
+// readTestArchive returns the content of the entries of the archive sent in
+// w by name, directories end with a slash and have an empty content.
+func readTestArchive(t *testing.T, format archiver.Format, w *httptest.ResponseRecorder) (map[string]string, map[string]time.Time) {
+	data := w.Body.Bytes()
+	r, err := archiver.NewReader(format, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	contents, modTimes := make(map[string]string), make(map[string]time.Time)
+	for {
+		entry, content, err := r.Next()
+		if err == io.EOF {
+			return contents, modTimes
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		contents[entry.Name], modTimes[entry.Name] = "", entry.ModTime
+		if !entry.IsDir {
+			data, err := ioutil.ReadAll(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			contents[entry.Name] = string(data)
+		}
+	}
+}
+
+func TestArchiveDirectory(t *testing.T) {
+	u, root := newTestUser(t)
+	docs := createTestDir(t, u, root, "docs")
+	sub := createTestDir(t, u, docs, "sub")
+	a := uploadTestFile(t, u, docs, "a.txt", "a")
+	uploadTestFile(t, u, sub, "b.txt", "bb")
+
+	for _, format := range []archiver.Format{archiver.FormatZip, archiver.FormatTarGz} {
+		w := request(u, "GET", "/api/v1/directory/%d/archive?format=%s", docs.ID, format).do()
+		if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+			continue
+		}
+		assert.Equal(t, format.ContentType(), w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "docs"+format.Extension())
+
+		contents, modTimes := readTestArchive(t, format, w)
+		assert.Equal(t, map[string]string{"docs/": "", "docs/a.txt": "a", "docs/sub/": "", "docs/sub/b.txt": "bb"}, contents, format)
+		assert.WithinDuration(t, a.UpdatedAt, modTimes["docs/a.txt"], 2*time.Second, format)
+	}
+
+	w := request(u, "GET", "/api/v1/directory/%d/archive?format=rar", docs.ID).do()
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	w = request(u, "GET", "/api/v1/directory/%d/archive", a.ID).do()
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	other, _ := newTestUser(t)
+	w = request(other, "GET", "/api/v1/directory/%d/archive", docs.ID).do()
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	if _, err := models.GrantFile(docs, other.ID, models.FilePermissionRead); err != nil {
+		t.Fatal(err)
+	}
+	w = request(other, "GET", "/api/v1/directory/%d/archive", sub.ID).do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		contents, _ := readTestArchive(t, archiver.FormatZip, w)
+		assert.Equal(t, map[string]string{"sub/": "", "sub/b.txt": "bb"}, contents)
+	}
+}
+
+func TestArchiveFiles(t *testing.T) {
+	u, root := newTestUser(t)
+	one := createTestDir(t, u, root, "one")
+	two := createTestDir(t, u, root, "two")
+	a1 := uploadTestFile(t, u, one, "a.txt", "1")
+	a2 := uploadTestFile(t, u, two, "a.txt", "2")
+	b := uploadTestFile(t, u, two, "b.txt", "b")
+	a3 := uploadTestFile(t, u, createTestDir(t, u, root, "three"), "a.txt", "3")
+
+	// a2 and b are part of two already, the names of the selected files are
+	// made unique
+	w := request(u, "POST", "/api/v1/files/archive").json(map[string]interface{}{
+		"file_ids": []uint{a1.ID, two.ID, a2.ID, b.ID, a3.ID},
+		"format":   "tar.gz",
+	}).do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		contents, _ := readTestArchive(t, archiver.FormatTarGz, w)
+		assert.Equal(t, map[string]string{"a.txt": "1", "two/": "", "two/a.txt": "2", "two/b.txt": "b", "a (1).txt": "3"}, contents)
+	}
+
+	w = request(u, "POST", "/api/v1/files/archive").json(map[string]interface{}{"file_ids": []uint{}}).do()
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	w = request(u, "POST", "/api/v1/files/archive").json(map[string]interface{}{"file_ids": []uint{a1.ID, 1 << 20}}).do()
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	maxSize := setting.Archive.MaxSize
+	defer func() { setting.Archive.MaxSize = maxSize }()
+	setting.Archive.MaxSize = 2
+	w = request(u, "POST", "/api/v1/files/archive").json(map[string]interface{}{"file_ids": []uint{one.ID, two.ID}}).do()
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	w = request(u, "GET", "/api/v1/directory/%d/archive", one.ID).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
@@ -0,0 +1,139 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	api "github.com/czhj/ahfs/modules/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func listChanges(t *testing.T, u *models.User, query string) *api.FileChanges {
+	w := request(u, "GET", "/api/v1/changes?%s", query).do()
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		t.FailNow()
+	}
+
+	changes := &api.FileChanges{}
+	decodeData(t, w, changes)
+	return changes
+}
+
+func TestListChanges(t *testing.T) {
+	u, root := newTestUser(t)
+
+	// a new client starts from the latest cursor
+	changes := listChanges(t, u, "")
+	assert.True(t, changes.Reset)
+	assert.Equal(t, "0", changes.Cursor)
+
+	dir := createTestDir(t, u, root, "dir")
+	f := uploadTestFile(t, u, dir, "f.txt", "f")
+	if _, err := models.RenameFile(u.ID, f, "g.txt", models.ConflictReject, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	changes = listChanges(t, u, "cursor=0&limit=2")
+	assert.False(t, changes.Reset)
+	assert.True(t, changes.HasMore)
+	assert.Equal(t, "2", changes.Cursor)
+	if assert.Len(t, changes.Changes, 2) {
+		assert.Equal(t, "create", changes.Changes[0].Type)
+		assert.Equal(t, "/dir", changes.Changes[0].Path)
+		assert.Equal(t, "/dir/f.txt", changes.Changes[1].Path)
+	}
+
+	changes = listChanges(t, u, "cursor="+changes.Cursor)
+	assert.False(t, changes.HasMore)
+	assert.Equal(t, "3", changes.Cursor)
+	if assert.Len(t, changes.Changes, 1) {
+		c := changes.Changes[0]
+		assert.Equal(t, "rename", c.Type)
+		assert.Equal(t, "f.txt", c.OldName)
+		assert.Equal(t, "/dir/g.txt", c.Path)
+	}
+
+	// nothing happened since, the cursor stays
+	changes = listChanges(t, u, "cursor=3")
+	assert.Empty(t, changes.Changes)
+	assert.Equal(t, "3", changes.Cursor)
+
+	// cursors the journal doesn't know ask for a reset
+	changes = listChanges(t, u, "cursor=42")
+	assert.True(t, changes.Reset)
+	assert.Equal(t, "3", changes.Cursor)
+
+	w := request(u, "GET", "/api/v1/changes?cursor=abc").do()
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	w = request(nil, "GET", "/api/v1/changes?cursor=0").do()
+	assert.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+}
+
+func TestListChangesWait(t *testing.T) {
+	u, root := newTestUser(t)
+	other, otherRoot := newTestUser(t)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- request(u, "GET", "/api/v1/changes?cursor=0&wait=5").do()
+	}()
+
+	// changes of other users don't wake the request up
+	time.Sleep(100 * time.Millisecond)
+	uploadTestFile(t, other, otherRoot, "other.txt", "o")
+	select {
+	case w := <-done:
+		t.Fatalf("returned before a change: %s", w.Body.String())
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	start := time.Now()
+	uploadTestFile(t, u, root, "f.txt", "f")
+	select {
+	case w := <-done:
+		assert.True(t, time.Since(start) < time.Second)
+		changes := &api.FileChanges{}
+		decodeData(t, w, changes)
+		if assert.Len(t, changes.Changes, 1) {
+			assert.Equal(t, "f.txt", changes.Changes[0].Name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change received")
+	}
+
+	// without changes the request gives up after waiting
+	start = time.Now()
+	changes := listChanges(t, u, "cursor=1&wait=1")
+	assert.Empty(t, changes.Changes)
+	assert.True(t, time.Since(start) >= time.Second)
+}
+
+func TestListTeamChanges(t *testing.T) {
+	owner, _ := newTestUser(t)
+	outsider, _ := newTestUser(t)
+	team := &models.User{Username: "teamchanges", MaxFileCapacity: 1 << 20}
+	if err := models.CreateTeam(team, owner); err != nil {
+		t.Fatal(err)
+	}
+	root, err := models.GetUserRootFile(team.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadTestFile(t, owner, root, "f.txt", "f")
+
+	changes := listChanges(t, owner, fmt.Sprintf("cursor=0&team_id=%d", team.ID))
+	if assert.Len(t, changes.Changes, 1) {
+		assert.Equal(t, "/f.txt", changes.Changes[0].Path)
+	}
+
+	// the journal of the member is a different one
+	changes = listChanges(t, owner, "cursor=0")
+	assert.Empty(t, changes.Changes)
+
+	w := request(outsider, "GET", "/api/v1/changes?cursor=0&team_id=%d", team.ID).do()
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+}
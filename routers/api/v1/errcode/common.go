@@ -7,4 +7,5 @@ const (
 	ParameterFormatError ErrorCode = 400001
 	PermissionDenied     ErrorCode = 400002
 	VisitTooFrequently   ErrorCode = 400003
+	FeatureDisabled      ErrorCode = 400004 // 功能未开启
 )
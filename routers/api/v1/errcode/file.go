@@ -9,6 +9,26 @@ const (
 	FileDirNotExists      ErrorCode = 400205 // 文件夹不存在
 	FileParentNotDirError ErrorCode = 400206 // 父结点不是一个文件夹
 	FileAlreadyExists     ErrorCode = 400207 // 文件（夹）已经存在
-	FileTooLarge          ErrorCode = 400208
+	FileTooLarge          ErrorCode = 400208 // 文件大小超出限制
 	FilenameFormatError   ErrorCode = 400209 // 文件名格式错误
+	FileMoveIntoItself    ErrorCode = 400210 // 不能将文件夹移动到自身或其子文件夹中
+	FileBatchAborted      ErrorCode = 400211 // 批量操作中的其他操作失败，本操作已回滚
+	FileArchiveTooLarge   ErrorCode = 400212 // 打包文件总大小超出限制
+	FileArchiveInvalid    ErrorCode = 400213 // 压缩文件无效或超出解压限制
+	ExtractTaskNotExist   ErrorCode = 400214 // 解压任务不存在
+	FileThumbnailNotExist ErrorCode = 400215 // 缩略图不存在或尚未生成
+	ShareLinkNotExist     ErrorCode = 400216 // 分享链接不存在
+	ShareLinkExpired      ErrorCode = 400217 // 分享链接已过期
+	ShareLinkPassword     ErrorCode = 400218 // 分享链接密码错误
+	ShareLinkExhausted    ErrorCode = 400219 // 分享链接下载次数已用完
+	FileGrantNotExist     ErrorCode = 400220 // 文件授权不存在
+	FileLocked            ErrorCode = 400221 // 文件已被其他用户锁定
+	FileNotLocked         ErrorCode = 400222 // 文件未被锁定或锁已过期
+	FileLockDirError      ErrorCode = 400223 // 不能锁定文件夹
+	FileModified          ErrorCode = 400224 // 文件已被修改，请求的版本已过期
+	FileTypeNotAllowed    ErrorCode = 400225 // 不允许上传该类型的文件
+	FileCountLimit        ErrorCode = 400226 // 文件数量已达上限
+	DirQuotaExceeded      ErrorCode = 400227 // 超出文件夹配额
+	FileQuarantined       ErrorCode = 400228 // 文件正在扫描或已被隔离，暂不可下载
+	FileNotQuarantined    ErrorCode = 400229 // 文件未被隔离
 )
@@ -0,0 +1,7 @@
+package errcode
+
+const (
+	TeamNotExist       ErrorCode = 400300 // 团队不存在
+	TeamMemberNotExist ErrorCode = 400301 // 团队成员不存在
+	TeamLastOwner      ErrorCode = 400302 // 团队至少需要一个所有者
+)
@@ -0,0 +1,6 @@
+package errcode
+
+const (
+	WebhookNotExist         ErrorCode = 400400 // Webhook 不存在
+	WebhookDeliveryNotExist ErrorCode = 400401 // Webhook 投递记录不存在
+)
@@ -0,0 +1,165 @@
+package file
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/archiver"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/modules/storage"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+	"go.uber.org/zap"
+)
+
+type ArchiveFilesForm struct {
+	FileIDs []uint `json:"file_ids" form:"file_ids" binding:"required,min=1"`
+	Format  string `json:"format" form:"format" binding:"omitempty,oneof=zip tar.gz"`
+}
+
+func ArchiveDirectory(c *context.APIContext) {
+	fileIDParam := c.Param("file_id")
+	fileID, err := strconv.ParseUint(fileIDParam, 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	format := archiver.Format(c.DefaultQuery("format", string(archiver.FormatZip)))
+	if format != archiver.FormatZip && format != archiver.FormatTarGz {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, fmt.Errorf("unsupported archive format: %s", format))
+		return
+	}
+
+	userID := c.User.ID
+	if c.IsAdmin() {
+		userID = 0
+	}
+
+	directory, err := models.GetAccessibleFile(uint(fileID), userID, models.FilePermissionRead)
+	if err != nil {
+		if models.IsErrFileNotExist(err) {
+			c.Error(http.StatusNotFound, ecode.FileNotExist, err)
+		} else if models.IsErrFilePermissionDenied(err) {
+			c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	if !directory.IsDir() {
+		c.Error(http.StatusBadRequest, ecode.FileNotDirError, models.ErrFileNotDirectory{ID: directory.ID, Path: directory.FilePath()})
+		return
+	}
+
+	name := directory.FileName
+	if directory.IsRoot() {
+		name = "root"
+	}
+
+	writeArchive(c, name, format, []*models.File{directory})
+}
+
+func ArchiveFiles(c *context.APIContext) {
+	form := &ArchiveFilesForm{}
+	if err := c.ShouldBind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	format := archiver.FormatZip
+	if len(form.Format) != 0 {
+		format = archiver.Format(form.Format)
+	}
+
+	userID := c.User.ID
+	if c.IsAdmin() {
+		userID = 0
+	}
+
+	files := make([]*models.File, len(form.FileIDs))
+	for i, id := range form.FileIDs {
+		file, err := models.GetAccessibleFile(id, userID, models.FilePermissionRead)
+		if err != nil {
+			if models.IsErrFileNotExist(err) {
+				c.Error(http.StatusNotFound, ecode.FileNotExist, err)
+			} else if models.IsErrFilePermissionDenied(err) {
+				c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
+			} else {
+				c.InternalServerError(err)
+			}
+			return
+		}
+		files[i] = file
+	}
+
+	writeArchive(c, "archive", format, files)
+}
+
+// writeArchive streams files as an archive, objects are read from the
+// storage one by one while the response is written.
+func writeArchive(c *context.APIContext, name string, format archiver.Format, files []*models.File) {
+	entries, size, err := models.GetArchiveEntries(files)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	if size > setting.Archive.MaxSize {
+		c.Error(http.StatusBadRequest, ecode.FileArchiveTooLarge, fmt.Errorf("archive size %d exceeds the limit %d", size, setting.Archive.MaxSize))
+		return
+	}
+
+	for _, entry := range entries {
+		if !checkDownloadable(c, entry.File) {
+			return
+		}
+	}
+
+	for _, file := range files {
+		utils.Audit(c, models.NewFileAuditLog(models.AuditFileDownload, file), nil, map[string]interface{}{"archive": format})
+	}
+
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", context.ContentDisposition("attachment", name+format.Extension()))
+	c.Status(http.StatusOK)
+
+	w, err := archiver.NewWriter(format, c.Writer)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	for _, entry := range entries {
+		if err := writeArchiveEntry(w, entry); err != nil {
+			// headers are already sent, the client sees a truncated archive
+			log.Error("Failed to write archive entry", zap.String("path", entry.Path), zap.Uint("id", entry.File.ID), zap.Error(err))
+			c.Abort()
+			return
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		log.Error("Failed to close archive", zap.Error(err))
+	}
+}
+
+func writeArchiveEntry(w archiver.Writer, entry *models.ArchiveEntry) error {
+	file := entry.File
+	if file.IsDir() {
+		return w.WriteDir(entry.Path, file.UpdatedAt)
+	}
+
+	obj, err := storage.LFS.Read(storage.ID(file.FileID))
+	if err != nil {
+		return err
+	}
+	defer obj.Reader.Close()
+
+	return w.WriteFile(entry.Path, file.FileSize, file.UpdatedAt, obj.Reader)
+}
@@ -0,0 +1,163 @@
+package file
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/czhj/ahfs/modules/setting"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type BatchOperationForm struct {
+	Op          string `json:"op" form:"op" binding:"required,oneof=delete move copy rename"`
+	FileID      uint   `json:"file_id" form:"file_id" binding:"required"`
+	DirectoryID uint   `json:"directory_id" form:"directory_id" binding:"omitempty"`
+	FileName    string `json:"filename" form:"filename" binding:"omitempty,filename"`
+	Conflict    string `json:"conflict" form:"conflict" binding:"omitempty,conflict"`
+	// 与 If-Match 相同，文件的版本不匹配时操作失败
+	IfMatch string `json:"if_match" form:"if_match" binding:"omitempty"`
+}
+
+type BatchForm struct {
+	// atomic 或 best_effort，默认为 atomic
+	Mode       string                `json:"mode" form:"mode" binding:"omitempty,oneof=atomic best_effort"`
+	Operations []*BatchOperationForm `json:"operations" form:"operations" binding:"required,min=1,dive"`
+}
+
+func fileErrorCode(err error) ecode.ErrorCode {
+	switch {
+	case models.IsErrFileNotExist(err):
+		return ecode.FileNotExist
+	case models.IsErrModifyRootFile(err):
+		return ecode.FileRootOperateError
+	case models.IsErrFileParentNotDirectory(err):
+		return ecode.FileParentNotDirError
+	case models.IsErrFileNotDirectory(err):
+		return ecode.FileNotDirError
+	case models.IsErrFileMoveIntoItself(err):
+		return ecode.FileMoveIntoItself
+	case models.IsErrFileAlreadyExist(err):
+		return ecode.FileAlreadyExists
+	case models.IsErrFileMaxSizeLimit(err):
+		return ecode.FileStorageFulled
+	case models.IsErrFileTooLarge(err):
+		return ecode.FileTooLarge
+	case models.IsErrFileTypeNotAllowed(err):
+		return ecode.FileTypeNotAllowed
+	case models.IsErrUserMaxFileCountLimit(err):
+		return ecode.FileCountLimit
+	case models.IsErrDirectoryQuotaExceeded(err):
+		return ecode.DirQuotaExceeded
+	case models.IsErrFileQuarantined(err):
+		return ecode.FileQuarantined
+	case models.IsErrBatchOperationAborted(err):
+		return ecode.FileBatchAborted
+	case models.IsErrFilePermissionDenied(err):
+		return ecode.PermissionDenied
+	case models.IsErrFileLocked(err):
+		return ecode.FileLocked
+	case models.IsErrFileModified(err):
+		return ecode.FileModified
+	case models.IsErrArchiveInvalid(err):
+		return ecode.FileArchiveInvalid
+	case models.IsErrBatchOperationUnknown(err):
+		return ecode.ParameterFormatError
+	}
+	return ecode.InternalServerError
+}
+
+func BatchFiles(c *context.APIContext) {
+	form := &BatchForm{}
+	if err := c.ShouldBindJSON(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	if len(form.Operations) > setting.API.MaxBatchSize {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, fmt.Errorf("too many operations, max is %d", setting.API.MaxBatchSize))
+		return
+	}
+
+	ops := make([]*models.BatchOperation, len(form.Operations))
+	for i, op := range form.Operations {
+		if op.Op == string(models.BatchOperationRename) && len(op.FileName) == 0 {
+			c.Error(http.StatusBadRequest, ecode.ParameterFormatError, fmt.Errorf("operation %d: filename is required", i))
+			return
+		}
+
+		ops[i] = &models.BatchOperation{
+			Type:        models.BatchOperationType(op.Op),
+			FileID:      op.FileID,
+			DirectoryID: op.DirectoryID,
+			Name:        op.FileName,
+			Conflict:    models.ConflictPolicy(op.Conflict),
+			ETag:        op.IfMatch,
+		}
+	}
+
+	results, err := models.BatchFiles(c.User.ID, ops, form.Mode != "best_effort")
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	for i, result := range results {
+		if result.Err == nil {
+			auditBatchOperation(c, ops[i], result.Before, result.File)
+		}
+	}
+
+	apiResults := make([]*api.FileBatchResult, len(results))
+	for i, result := range results {
+		apiResult := &api.FileBatchResult{
+			Index:  i,
+			FileID: ops[i].FileID,
+			Code:   int(ecode.OK),
+		}
+
+		if result.Err != nil {
+			code := fileErrorCode(result.Err)
+			apiResult.Code = int(code)
+			apiResult.Error = result.Err.Error()
+			if code == ecode.InternalServerError {
+				log.Error("Batch file operation failed", zap.Int("index", i), zap.Error(result.Err))
+				if gin.Mode() == gin.ReleaseMode {
+					apiResult.Error = ""
+				}
+			}
+		} else if result.File != nil {
+			apiResult.File = convert.ToFile(result.File)
+		}
+		apiResults[i] = apiResult
+	}
+
+	c.OK(apiResults)
+}
+
+var batchAuditActions = map[models.BatchOperationType]models.AuditAction{
+	models.BatchOperationDelete: models.AuditFileDelete,
+	models.BatchOperationMove:   models.AuditFileMove,
+	models.BatchOperationCopy:   models.AuditFileCopy,
+	models.BatchOperationRename: models.AuditFileRename,
+}
+
+func auditBatchOperation(c *context.APIContext, op *models.BatchOperation, before, after *models.File) {
+	action, ok := batchAuditActions[op.Type]
+	if !ok {
+		return
+	}
+
+	target, afterState := before, interface{}(nil)
+	if after != nil {
+		target, afterState = after, models.FileAuditState(after)
+	}
+	utils.Audit(c, models.NewFileAuditLog(action, target), models.FileAuditState(before), afterState)
+}
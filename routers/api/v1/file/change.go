@@ -0,0 +1,119 @@
+package file
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	"github.com/czhj/ahfs/modules/setting"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+)
+
+type ListChangesForm struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1"`
+	// Wait is the number of seconds to wait for a change if there is none
+	Wait   int  `form:"wait" binding:"omitempty,min=0"`
+	TeamID uint `form:"team_id"`
+}
+
+// ListChanges returns the changes of the files of the current user or of a
+// team after the cursor. Without a cursor only the latest cursor is returned
+// together with the reset signal.
+func ListChanges(c *context.APIContext) {
+	form := &ListChangesForm{}
+	if err := c.ShouldBindQuery(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	owner := c.User.ID
+	if form.TeamID != 0 {
+		if _, err := models.GetTeamMember(form.TeamID, c.User.ID); err != nil {
+			if models.IsErrTeamMemberNotExist(err) {
+				c.NotFound(ecode.TeamNotExist, models.ErrTeamNotExist{ID: form.TeamID})
+			} else {
+				c.InternalServerError(err)
+			}
+			return
+		}
+		owner = form.TeamID
+	}
+
+	if len(form.Cursor) == 0 {
+		resetChanges(c, owner)
+		return
+	}
+
+	seq, err := strconv.ParseInt(form.Cursor, 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	limit := form.Limit
+	if limit <= 0 || limit > setting.API.MaxChangeSize {
+		limit = setting.API.MaxChangeSize
+	}
+
+	wait := time.Duration(form.Wait) * time.Second
+	if wait > setting.API.MaxChangeWait {
+		wait = setting.API.MaxChangeWait
+	}
+	timeout := time.After(wait)
+
+	for {
+		// watch before reading, a change in between must wake us up
+		changed := models.WatchFileChanges(owner)
+
+		changes, err := models.GetFileChanges(owner, seq, limit+1)
+		if err != nil {
+			if models.IsErrFileChangeCursorExpired(err) {
+				resetChanges(c, owner)
+			} else {
+				c.InternalServerError(err)
+			}
+			return
+		}
+
+		if len(changes) != 0 || wait <= 0 {
+			result := &api.FileChanges{
+				Cursor:  form.Cursor,
+				HasMore: len(changes) > limit,
+				Changes: make([]*api.FileChange, 0, limit),
+			}
+			for i := 0; i < len(changes) && i < limit; i++ {
+				result.Changes = append(result.Changes, convert.ToFileChange(changes[i]))
+				result.Cursor = strconv.FormatInt(changes[i].Seq, 10)
+			}
+			c.OK(result)
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-timeout:
+			wait = 0
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+func resetChanges(c *context.APIContext, owner uint) {
+	seq, err := models.GetLatestFileChangeSeq(owner)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	c.OK(&api.FileChanges{
+		Cursor:  strconv.FormatInt(seq, 10),
+		Reset:   true,
+		Changes: make([]*api.FileChange, 0),
+	})
+}
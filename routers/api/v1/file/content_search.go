@@ -0,0 +1,61 @@
+package file
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	"github.com/czhj/ahfs/modules/setting"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+	"github.com/czhj/ahfs/services/indexer"
+)
+
+func SearchFileContent(c *context.APIContext) {
+	if !setting.Indexer.Enabled {
+		c.Error(http.StatusNotFound, ecode.FeatureDisabled, fmt.Errorf("content search is disabled"))
+		return
+	}
+
+	keyword := strings.TrimSpace(c.Query("q"))
+	if len(keyword) == 0 {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, fmt.Errorf("q is required"))
+		return
+	}
+
+	owner, ok := getReadableTree(c)
+	if !ok {
+		return
+	}
+
+	listOptions := utils.GetListOptions(c)
+	if listOptions.Page <= 0 {
+		listOptions.Page = 1
+	}
+
+	// files uploaded before the indexer was enabled are picked up here
+	indexer.Notify(owner)
+
+	results, maxResult, err := indexer.Search(owner, keyword, listOptions)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	apiResults := make([]*api.FileContentSearchResult, len(results))
+	for i, result := range results {
+		apiResults[i] = &api.FileContentSearchResult{
+			File:    convert.ToFile(result.File),
+			Score:   result.Score,
+			Snippet: result.Snippet,
+		}
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(maxResult, 10))
+	c.Header("Access-Control-Expose-Headers", "X-Total-Count")
+	c.OK(apiResults)
+}
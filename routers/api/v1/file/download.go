@@ -3,17 +3,57 @@ package file
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/czhj/ahfs/models"
 	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/log"
 	"github.com/czhj/ahfs/modules/storage"
 	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+	"go.uber.org/zap"
 )
 
 type DownloadFileForm struct {
 	FileID uint `form:"file_id" uri:"file_id" json:"file_id" binding:"required"`
 }
 
+// checkDownloadable fails the request with 403 if the content of file is held
+// back by the scanner.
+func checkDownloadable(c *context.APIContext, file *models.File) bool {
+	if file.IsDownloadable() {
+		return true
+	}
+
+	c.Error(http.StatusForbidden, ecode.FileQuarantined, models.ErrFileQuarantined{ID: file.ID, Status: file.ScanStatus})
+	return false
+}
+
+func serveFile(c *context.APIContext, file *models.File) {
+	if !checkDownloadable(c, file) {
+		return
+	}
+
+	if err := models.RecordFileActivity(c.User.ID, file, models.FileActivityDownload); err != nil {
+		log.Error("Failed to record file download", zap.Uint("id", file.ID), zap.Uint("uid", c.User.ID), zap.Error(err))
+	}
+	utils.Audit(c, models.NewFileAuditLog(models.AuditFileDownload, file), nil, nil)
+
+	serveContent(c, file)
+}
+
+// serveContent writes the content of file without recording the download.
+func serveContent(c *context.APIContext, file *models.File) {
+	inline, _ := strconv.ParseBool(c.Query("inline"))
+	c.Header("ETag", file.ETag())
+	c.Storage(&context.ServeOptions{
+		Filename:    file.FileName,
+		Size:        file.FileSize,
+		ContentType: file.MimeType(),
+		Inline:      inline,
+	}, storage.ID(file.FileID), storage.LFS)
+}
+
 func DownloadFile(c *context.APIContext) {
 	form := &DownloadFileForm{}
 	if err := c.ShouldBindUri(form); err != nil {
@@ -26,12 +66,16 @@ func DownloadFile(c *context.APIContext) {
 		userID = 0
 	}
 
-	file, err := models.GetFileByID(form.FileID, userID)
+	file, err := models.GetAccessibleFile(form.FileID, userID, models.FilePermissionRead)
 	if err != nil {
 		if models.IsErrFileNotExist(err) {
 			c.Error(http.StatusBadRequest, ecode.FileNotExist, err)
 			return
 		}
+		if models.IsErrFilePermissionDenied(err) {
+			c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
+			return
+		}
 		c.InternalServerError(err)
 		return
 	}
@@ -41,5 +85,5 @@ func DownloadFile(c *context.APIContext) {
 		return
 	}
 
-	c.Storage(file.FileName, storage.ID(file.FileID), storage.LFS)
+	serveFile(c, file)
 }
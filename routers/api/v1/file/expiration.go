@@ -0,0 +1,96 @@
+package file
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+)
+
+type FileExpirationForm struct {
+	ExpiresAt *time.Time `form:"expires_at" json:"expires_at" time_format:"2006-01-02T15:04:05Z07:00"`
+	// TTL is the lifetime of the file in seconds
+	TTL int64 `form:"ttl" json:"ttl" binding:"omitempty,min=1"`
+}
+
+// expiration returns the expiry given by the form, nil if it has none.
+func (form *FileExpirationForm) expiration() (*time.Time, error) {
+	if form.ExpiresAt != nil && form.TTL > 0 {
+		return nil, fmt.Errorf("expires_at and ttl are exclusive")
+	}
+
+	if form.TTL > 0 {
+		expiresAt := time.Now().Add(time.Duration(form.TTL) * time.Second)
+		return &expiresAt, nil
+	}
+
+	if form.ExpiresAt != nil && !form.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+	return form.ExpiresAt, nil
+}
+
+// getExpiration reads the optional expiry of an upload, bind is either the
+// form or the query binding of c.
+func getExpiration(c *context.APIContext, bind func(interface{}) error) (*time.Time, bool) {
+	form := &FileExpirationForm{}
+	if err := bind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return nil, false
+	}
+
+	expiresAt, err := form.expiration()
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return nil, false
+	}
+	return expiresAt, true
+}
+
+func SetFileExpiration(c *context.APIContext) {
+	expiresAt, ok := getExpiration(c, c.ShouldBind)
+	if !ok {
+		return
+	}
+
+	if expiresAt == nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, fmt.Errorf("expires_at or ttl is required"))
+		return
+	}
+
+	file, ok := getFile(c, models.FilePermissionWrite)
+	if !ok {
+		return
+	}
+
+	setFileExpiration(c, file, expiresAt)
+}
+
+func RemoveFileExpiration(c *context.APIContext) {
+	file, ok := getFile(c, models.FilePermissionWrite)
+	if !ok {
+		return
+	}
+
+	setFileExpiration(c, file, nil)
+}
+
+func setFileExpiration(c *context.APIContext, file *models.File, expiresAt *time.Time) {
+	if !checkIfMatch(c, file) {
+		return
+	}
+
+	if err := models.SetFileExpiration(file, expiresAt); err != nil {
+		if models.IsErrModifyRootFile(err) {
+			c.Error(http.StatusBadRequest, ecode.FileRootOperateError, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+	c.OK(convert.ToFile(file))
+}
@@ -0,0 +1,89 @@
+package file
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/services/extractor"
+)
+
+type ExtractArchiveForm struct {
+	ArchiveID     uint   `json:"archive_id" form:"archive_id" binding:"required"`
+	Conflict      string `json:"conflict" form:"conflict" binding:"omitempty,conflict"`
+	RemoveArchive bool   `json:"remove_archive" form:"remove_archive"`
+}
+
+func ExtractArchive(c *context.APIContext) {
+	directory, ok := getFile(c, models.FilePermissionWrite)
+	if !ok {
+		return
+	}
+
+	form := &ExtractArchiveForm{}
+	if err := c.ShouldBind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	// removing the archive needs the permission to delete it
+	perm := models.FilePermissionRead
+	if form.RemoveArchive {
+		perm = models.FilePermissionWrite
+	}
+
+	archive, ok := getAccessibleFile(c, form.ArchiveID, perm)
+	if !ok {
+		return
+	}
+
+	if !checkDownloadable(c, archive) {
+		return
+	}
+
+	extractArchive(c, archive, directory, models.ConflictPolicy(form.Conflict), form.RemoveArchive)
+}
+
+// extractArchive extracts archive into directory and responds with the task,
+// it returns false if the extraction failed and the error was responded.
+func extractArchive(c *context.APIContext, archive, directory *models.File, policy models.ConflictPolicy, removeArchive bool) bool {
+	task, err := extractor.Extract(c.User, archive, directory, policy, removeArchive)
+	if err != nil {
+		code := fileErrorCode(err)
+		if code == ecode.InternalServerError {
+			c.InternalServerError(err)
+		} else if code == ecode.FileQuarantined {
+			c.Error(http.StatusForbidden, code, err)
+		} else {
+			c.Error(http.StatusBadRequest, code, err)
+		}
+		return false
+	}
+
+	c.OK(convert.ToExtractTask(task))
+	return true
+}
+
+func GetExtractTask(c *context.APIContext) {
+	taskIDParam := c.Param("task_id")
+	taskID, err := strconv.ParseUint(taskIDParam, 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	task, err := models.GetExtractTask(uint(taskID), c.User.ID)
+	if err != nil {
+		if models.IsErrExtractTaskNotExist(err) {
+			c.Error(http.StatusNotFound, ecode.ExtractTaskNotExist, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	c.OK(convert.ToExtractTask(task))
+}
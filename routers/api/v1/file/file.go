@@ -3,11 +3,13 @@ package file
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/czhj/ahfs/models"
 	"github.com/czhj/ahfs/modules/convert"
 	api "github.com/czhj/ahfs/modules/structs"
 	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
 
 	"github.com/czhj/ahfs/modules/context"
 )
@@ -21,6 +23,76 @@ type ReadDirectoryForm struct {
 	OnlyDir bool `form:"only_dir" query:"only_dir" binding:"omitempty"`
 }
 
+type ListDirectoryForm struct {
+	Keyword     string `form:"q"`
+	Match       string `form:"match" binding:"omitempty,oneof=exact substring prefix glob"`
+	Type        string `form:"type" binding:"omitempty,oneof=file dir"`
+	Extension   string `form:"ext"`
+	ContentType string `form:"content_type"`
+	Sort        string `form:"sort" binding:"omitempty,oneof=name size date type"`
+	Order       string `form:"order" binding:"omitempty,oneof=asc desc"`
+	// MixDirs sorts directories among the files instead of first
+	MixDirs bool   `form:"mix_dirs"`
+	Cursor  string `form:"cursor"`
+}
+
+// listDirectory reads a page of the entries of directory as requested by the
+// query, the first page unless page or cursor is given.
+func listDirectory(c *context.APIContext, directory *models.File, onlyDir bool) ([]*models.File, bool) {
+	return listDirectoryBy(c, directory, onlyDir, metadataFilter(c))
+}
+
+// listDirectoryBy is listDirectory with the metadata filter given by the
+// caller, e.g. none for visitors who don't see the metadata.
+func listDirectoryBy(c *context.APIContext, directory *models.File, onlyDir bool, filter models.MetadataFilter) ([]*models.File, bool) {
+	form := &ListDirectoryForm{}
+	if err := c.ShouldBindQuery(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return nil, false
+	}
+
+	opts := &models.ListDirOptions{
+		ListOptions:    utils.GetListOptions(c),
+		MetadataFilter: filter,
+		Keyword:        strings.TrimSpace(form.Keyword),
+		Match:          models.FileMatchMode(form.Match),
+		Extension:      form.Extension,
+		ContentType:    form.ContentType,
+		SortBy:         models.DirSortField(form.Sort),
+		Desc:           form.Order == "desc",
+		MixDirs:        form.MixDirs,
+		Cursor:         form.Cursor,
+	}
+
+	if len(opts.Cursor) != 0 {
+		opts.Page = 0
+	}
+
+	switch {
+	case onlyDir || form.Type == "dir":
+		opts.Type = models.FileTypeDir
+	case form.Type == "file":
+		opts.Type = models.FileTypeFile
+	}
+
+	files, maxResult, next, err := models.ListDirectory(directory, opts)
+	if err != nil {
+		if models.IsErrFileNotDirectory(err) {
+			c.Error(http.StatusBadRequest, ecode.FileNotDirError, err)
+		} else if models.IsErrInvalidDirCursor(err) {
+			c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return nil, false
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(maxResult, 10))
+	c.Header("X-Next-Cursor", next)
+	c.Header("Access-Control-Expose-Headers", "X-Total-Count, X-Next-Cursor")
+	return files, true
+}
+
 func ReadDirectory(c *context.APIContext) {
 
 	// uriForm := &ReadDirectoryUriForm{}
@@ -47,25 +119,25 @@ func ReadDirectory(c *context.APIContext) {
 		userID = form.UserID
 	}
 
-	directory, err := models.GetFileByID(uint(fileID), userID)
+	directory, err := models.GetAccessibleFile(uint(fileID), userID, models.FilePermissionRead)
 	if err != nil {
 		if models.IsErrFileNotExist(err) {
 			c.Error(http.StatusNotFound, ecode.FileNotExist, err)
+		} else if models.IsErrFilePermissionDenied(err) {
+			c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
 		} else {
 			c.InternalServerError(err)
 		}
 		return
 	}
 
-	files, err := directory.ReadDir(models.ReadDirOption{
-		OnlyDir: form.OnlyDir,
-	})
-	if err != nil {
-		if models.IsErrFileNotDirectory(err) {
-			c.Error(http.StatusBadRequest, ecode.FileNotDirError, err)
-		} else {
-			c.InternalServerError(err)
-		}
+	files, ok := listDirectory(c, directory, form.OnlyDir)
+	if !ok {
+		return
+	}
+
+	if err := models.LoadFileLocks(files); err != nil {
+		c.InternalServerError(err)
 		return
 	}
 
@@ -106,13 +178,8 @@ func GetUserRootDirectory(c *context.APIContext) {
 		return
 	}
 
-	files, err := root.ReadDir(models.ReadDirOption{})
-	if err != nil {
-		if models.IsErrFileNotDirectory(err) {
-			c.Error(http.StatusNotFound, ecode.FileNotDirError, err)
-		} else {
-			c.InternalServerError(err)
-		}
+	files, ok := listDirectory(c, root, false)
+	if !ok {
 		return
 	}
 
@@ -129,6 +196,7 @@ func GetUserRootDirectory(c *context.APIContext) {
 
 type RenameFileForm struct {
 	FileName string `form:"filename" json:"filename" binding:"required,filename"`
+	Conflict string `form:"conflict" json:"conflict" binding:"omitempty,conflict"`
 }
 
 func RenameFile(c *context.APIContext) {
@@ -158,26 +226,42 @@ func RenameFile(c *context.APIContext) {
 		userID = 0
 	}
 
-	file, err := models.GetFileByID(uint(fileID), userID)
+	file, err := models.GetAccessibleFile(uint(fileID), userID, models.FilePermissionWrite)
 	if err != nil {
 		if models.IsErrFileNotExist(err) {
 			c.Error(http.StatusNotFound, ecode.FileNotExist, err)
+		} else if models.IsErrFilePermissionDenied(err) {
+			c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
 		} else {
 			c.InternalServerError(err)
 		}
 		return
 	}
 
-	file.FileName = form.FileName
-	if err := models.RenameFile(file); err != nil {
+	if !checkIfMatch(c, file) {
+		return
+	}
+
+	before := models.FileAuditState(file)
+	file, err = models.RenameFile(c.User.ID, file, form.FileName, models.ConflictPolicy(form.Conflict), c.GetHeader("If-Match"))
+	if err != nil {
 		if models.IsErrModifyRootFile(err) {
 			c.Error(http.StatusBadRequest, ecode.FileRootOperateError, err)
+		} else if models.IsErrFileAlreadyExist(err) {
+			c.Error(http.StatusBadRequest, ecode.FileAlreadyExists, err)
+		} else if models.IsErrUploadPolicy(err) {
+			c.Error(http.StatusBadRequest, fileErrorCode(err), err)
+		} else if models.IsErrFileModified(err) {
+			c.Error(http.StatusPreconditionFailed, ecode.FileModified, err)
+		} else if models.IsErrFileLocked(err) {
+			c.Error(http.StatusLocked, ecode.FileLocked, err)
 		} else {
 			c.InternalServerError(err)
 		}
 		return
 	}
 
+	utils.Audit(c, models.NewFileAuditLog(models.AuditFileRename, file), before, models.FileAuditState(file))
 	c.OK(convert.ToFile(file))
 }
 
@@ -204,25 +288,36 @@ func DeleteFile(c *context.APIContext) {
 		userID = 0
 	}
 
-	file, err := models.GetFileByID(uint(fileID), userID)
+	file, err := models.GetAccessibleFile(uint(fileID), userID, models.FilePermissionWrite)
 	if err != nil {
 		if models.IsErrFileNotExist(err) {
 			c.Error(http.StatusNotFound, ecode.FileNotExist, err)
+		} else if models.IsErrFilePermissionDenied(err) {
+			c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
 		} else {
 			c.InternalServerError(err)
 		}
 		return
 	}
 
-	if err := models.DeleteFile(file); err != nil {
+	if !checkIfMatch(c, file) {
+		return
+	}
+
+	if err := models.DeleteFile(c.User.ID, file, c.GetHeader("If-Match")); err != nil {
 		if models.IsErrModifyRootFile(err) {
 			c.Error(http.StatusBadRequest, ecode.FileRootOperateError, err)
+		} else if models.IsErrFileModified(err) {
+			c.Error(http.StatusPreconditionFailed, ecode.FileModified, err)
+		} else if models.IsErrFileLocked(err) {
+			c.Error(http.StatusLocked, ecode.FileLocked, err)
 		} else {
 			c.InternalServerError(err)
 		}
 		return
 	}
 
+	utils.Audit(c, models.NewFileAuditLog(models.AuditFileDelete, file), models.FileAuditState(file), nil)
 	c.OK(nil)
 }
 
@@ -231,7 +326,8 @@ func DeleteFile(c *context.APIContext) {
 // }
 
 type MoveFileForm struct {
-	DirectoryID uint `form:"directory_id" json:"directory_id" binding:"required"`
+	DirectoryID uint   `form:"directory_id" json:"directory_id" binding:"required"`
+	Conflict    string `form:"conflict" json:"conflict" binding:"omitempty,conflict"`
 }
 
 func MoveFile(c *context.APIContext) {
@@ -260,43 +356,67 @@ func MoveFile(c *context.APIContext) {
 		userID = 0
 	}
 
-	file, err := models.GetFileByID(uint(fileID), userID)
+	file, err := models.GetAccessibleFile(uint(fileID), userID, models.FilePermissionWrite)
 	if err != nil {
 		if models.IsErrFileNotExist(err) {
 			c.Error(http.StatusNotFound, ecode.FileNotExist, err)
+		} else if models.IsErrFilePermissionDenied(err) {
+			c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
 		} else {
 			c.InternalServerError(err)
 		}
 		return
 	}
 
-	diretcory, err := models.GetFileByID(form.DirectoryID, userID)
+	if !checkIfMatch(c, file) {
+		return
+	}
+
+	diretcory, err := models.GetAccessibleFile(form.DirectoryID, userID, models.FilePermissionWrite)
 	if err != nil {
 		if models.IsErrFileNotExist(err) {
 			c.Error(http.StatusNotFound, ecode.FileDirNotExists, err)
+		} else if models.IsErrFilePermissionDenied(err) {
+			c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
 		} else {
 			c.InternalServerError(err)
 		}
 		return
 	}
 
-	if err := models.MoveFile(file, diretcory); err != nil {
+	before := models.FileAuditState(file)
+	file, err = models.MoveFile(c.User.ID, file, diretcory, "", models.ConflictPolicy(form.Conflict), c.GetHeader("If-Match"))
+	if err != nil {
 		if models.IsErrModifyRootFile(err) {
 			c.Error(http.StatusBadRequest, ecode.FileRootOperateError, err)
 		} else if models.IsErrFileParentNotDirectory(err) {
 			c.Error(http.StatusBadRequest, ecode.FileParentNotDirError, err)
+		} else if models.IsErrFileMoveIntoItself(err) {
+			c.Error(http.StatusBadRequest, ecode.FileMoveIntoItself, err)
+		} else if models.IsErrFilePermissionDenied(err) {
+			c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
+		} else if models.IsErrFileAlreadyExist(err) {
+			c.Error(http.StatusBadRequest, ecode.FileAlreadyExists, err)
+		} else if models.IsErrUploadPolicy(err) {
+			c.Error(http.StatusBadRequest, fileErrorCode(err), err)
+		} else if models.IsErrFileModified(err) {
+			c.Error(http.StatusPreconditionFailed, ecode.FileModified, err)
+		} else if models.IsErrFileLocked(err) {
+			c.Error(http.StatusLocked, ecode.FileLocked, err)
 		} else {
 			c.InternalServerError(err)
 		}
 		return
 	}
 
-	c.OK(nil)
+	utils.Audit(c, models.NewFileAuditLog(models.AuditFileMove, file), before, models.FileAuditState(file))
+	c.OK(convert.ToFile(file))
 }
 
 type CreateDirForm struct {
 	ParentID      uint   `json:"parent_id" form:"parent_id" binding:"omitempty"`
 	DirectoryName string `json:"directory_name" form:"directory_name" binding:"required,filename"`
+	Conflict      string `json:"conflict" form:"conflict" binding:"omitempty,conflict"`
 }
 
 func CreateDirectory(c *context.APIContext) {
@@ -312,12 +432,14 @@ func CreateDirectory(c *context.APIContext) {
 	if form.ParentID == 0 {
 		dir, err = models.GetUserRootFile(c.User.ID)
 	} else {
-		dir, err = models.GetFileByID(form.ParentID, c.User.ID)
+		dir, err = models.GetAccessibleFile(form.ParentID, c.User.ID, models.FilePermissionWrite)
 	}
 
 	if err != nil {
 		if models.IsErrFileNotExist(err) {
 			c.Error(http.StatusBadRequest, ecode.FileParentNotDirError, err)
+		} else if models.IsErrFilePermissionDenied(err) {
+			c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
 		} else {
 			c.InternalServerError(err)
 		}
@@ -329,12 +451,14 @@ func CreateDirectory(c *context.APIContext) {
 		return
 	}
 
-	ndir, err := models.CreateDirectory(dir, form.DirectoryName)
+	ndir, err := models.CreateDirectory(c.User.ID, dir, form.DirectoryName, models.ConflictPolicy(form.Conflict))
 	if err != nil {
 		if models.IsErrFileAlreadyExist(err) {
 			c.Error(http.StatusBadRequest, ecode.FileAlreadyExists, err)
 		} else if models.IsErrFileParentNotDirectory(err) {
 			c.Error(http.StatusBadRequest, ecode.FileParentNotDirError, err)
+		} else if models.IsErrFileLocked(err) {
+			c.Error(http.StatusLocked, ecode.FileLocked, err)
 		} else {
 			c.InternalServerError(err)
 		}
@@ -357,15 +481,28 @@ func GetFileInfo(c *context.APIContext) {
 		return
 	}
 
-	file, err := models.GetFileByID(uint(fileID), 0)
+	userID := c.User.ID
+	if c.IsAdmin() {
+		userID = 0
+	}
+
+	file, err := models.GetAccessibleFile(uint(fileID), userID, models.FilePermissionRead)
 	if err != nil {
 		if models.IsErrFileNotExist(err) {
 			c.Error(http.StatusNotFound, ecode.FileNotExist, err)
+		} else if models.IsErrFilePermissionDenied(err) {
+			c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
 		} else {
 			c.InternalServerError(err)
 		}
 		return
 	}
 
+	if err := models.LoadFileLocks([]*models.File{file}); err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	c.Header("ETag", file.ETag())
 	c.OK(convert.ToFile(file))
 }
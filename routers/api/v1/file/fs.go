@@ -0,0 +1,354 @@
+package file
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	api "github.com/czhj/ahfs/modules/structs"
+	"github.com/czhj/ahfs/modules/validator"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+)
+
+const fsRoutePrefix = "/api/v1/fs"
+
+func requestPath(c *context.APIContext) string {
+	return path.Clean("/" + c.Param("path"))
+}
+
+// destinationPath returns the target of MOVE and COPY, which is given by the
+// destination query or the WebDAV style Destination header.
+func destinationPath(c *context.APIContext) (string, error) {
+	dest := c.Query("destination")
+	if len(dest) == 0 {
+		dest = c.GetHeader("Destination")
+	}
+
+	if len(dest) == 0 {
+		return "", fmt.Errorf("destination is required")
+	}
+
+	u, err := url.Parse(dest)
+	if err != nil {
+		return "", err
+	}
+
+	p := u.Path
+	if i := strings.Index(p, fsRoutePrefix); len(u.Host) != 0 && i >= 0 {
+		p = p[i+len(fsRoutePrefix):]
+	}
+	return path.Clean("/" + p), nil
+}
+
+func conflictPolicy(c *context.APIContext, def models.ConflictPolicy) (models.ConflictPolicy, bool) {
+	conflict := c.DefaultQuery("conflict", string(def))
+	if !validator.ValidConflict(conflict) {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, fmt.Errorf("unknown conflict policy: %s", conflict))
+		return "", false
+	}
+	return models.ConflictPolicy(conflict), true
+}
+
+// getTree returns the owner of the tree the paths of the request are
+// resolved in together with the permission of the current user on it. It
+// is the tree of the team given by the team_id query or the user's own.
+func getTree(c *context.APIContext) (uint, models.FilePermission, bool) {
+	teamIDParam := c.Query("team_id")
+	if len(teamIDParam) == 0 {
+		return c.User.ID, models.FilePermissionAdmin, true
+	}
+
+	teamID, err := strconv.ParseUint(teamIDParam, 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return 0, models.FilePermissionNone, false
+	}
+
+	member, err := models.GetTeamMember(uint(teamID), c.User.ID)
+	if err != nil {
+		if models.IsErrTeamMemberNotExist(err) {
+			c.NotFound(ecode.TeamNotExist, models.ErrTeamNotExist{ID: uint(teamID)})
+		} else {
+			c.InternalServerError(err)
+		}
+		return 0, models.FilePermissionNone, false
+	}
+	return member.TeamID, member.Role.FilePermission(), true
+}
+
+// getReadableTree returns the owner of the tree of the request if the current
+// user may read it.
+func getReadableTree(c *context.APIContext) (uint, bool) {
+	owner, granted, ok := getTree(c)
+	if !ok {
+		return 0, false
+	}
+
+	if granted < models.FilePermissionRead {
+		c.Error(http.StatusForbidden, ecode.PermissionDenied, fmt.Errorf("no permission to read the files of team %d", owner))
+		return 0, false
+	}
+	return owner, true
+}
+
+// getPathInTree resolves p in the tree of the request if the current user
+// has at least perm on it, a missing entry fails with notExist.
+func getPathInTree(c *context.APIContext, p string, perm models.FilePermission, notExist ecode.ErrorCode) (*models.File, bool) {
+	owner, granted, ok := getTree(c)
+	if !ok {
+		return nil, false
+	}
+
+	file, err := models.GetFileByPath(owner, p)
+	if err != nil {
+		if models.IsErrFileNotExist(err) {
+			c.Error(http.StatusNotFound, notExist, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return nil, false
+	}
+
+	if granted < perm {
+		c.Error(http.StatusForbidden, ecode.PermissionDenied, models.ErrFilePermissionDenied{ID: file.ID, UserID: c.User.ID})
+		return nil, false
+	}
+	return file, true
+}
+
+func getFileByPath(c *context.APIContext, p string, perm models.FilePermission) (*models.File, bool) {
+	return getPathInTree(c, p, perm, ecode.FileNotExist)
+}
+
+// getParentByPath resolves the directory containing p, which the current
+// user must be allowed to write to, and returns it with the last element of
+// p.
+func getParentByPath(c *context.APIContext, p string) (*models.File, string, bool) {
+	if p == "/" {
+		c.Error(http.StatusBadRequest, ecode.FileRootOperateError, fmt.Errorf("cannot operate on the root directory"))
+		return nil, "", false
+	}
+
+	dir, name := path.Split(p)
+	if !validator.ValidFilename(name) {
+		c.Error(http.StatusBadRequest, ecode.FilenameFormatError, fmt.Errorf(`filename couldn't containt \/:*?"<>|`))
+		return nil, "", false
+	}
+
+	parent, ok := getPathInTree(c, dir, models.FilePermissionWrite, ecode.FileDirNotExists)
+	if !ok {
+		return nil, "", false
+	}
+
+	if !parent.IsDir() {
+		c.Error(http.StatusBadRequest, ecode.FileParentNotDirError, models.ErrFileParentNotDirectory{ID: parent.ID, Path: parent.FilePath()})
+		return nil, "", false
+	}
+
+	return parent, name, true
+}
+
+func GetPath(c *context.APIContext) {
+	file, ok := getFileByPath(c, requestPath(c), models.FilePermissionRead)
+	if !ok {
+		return
+	}
+
+	if !file.IsDir() {
+		serveFile(c, file)
+		return
+	}
+
+	onlyDir, _ := strconv.ParseBool(c.Query("only_dir"))
+	files, ok := listDirectory(c, file, onlyDir)
+	if !ok {
+		return
+	}
+
+	if err := models.LoadFileLocks(files); err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	apiFiles := make([]*api.File, len(files))
+	for i, file := range files {
+		apiFiles[i] = convert.ToFile(file)
+	}
+	c.OK(apiFiles)
+}
+
+func PutPath(c *context.APIContext) {
+	policy, ok := conflictPolicy(c, models.ConflictOverwrite)
+	if !ok {
+		return
+	}
+
+	if c.Request.ContentLength < 0 {
+		c.Error(http.StatusLengthRequired, ecode.ParameterFormatError, fmt.Errorf("Content-Length is required"))
+		return
+	}
+
+	expiresAt, ok := getExpiration(c, c.ShouldBindQuery)
+	if !ok {
+		return
+	}
+
+	parent, name, ok := getParentByPath(c, requestPath(c))
+	if !ok {
+		return
+	}
+
+	file, err := models.UploadFile(c.User, parent, name, c.Request.ContentLength, c.Request.Body, policy, c.GetHeader("If-Match"), expiresAt)
+	if err != nil {
+		if models.IsErrFileAlreadyExist(err) {
+			c.Error(http.StatusBadRequest, ecode.FileAlreadyExists, err)
+		} else if models.IsErrFileMaxSizeLimit(err) {
+			c.Error(http.StatusBadRequest, ecode.FileStorageFulled, err)
+		} else if models.IsErrUploadPolicy(err) {
+			c.Error(http.StatusBadRequest, fileErrorCode(err), err)
+		} else if models.IsErrFileModified(err) {
+			c.Error(http.StatusPreconditionFailed, ecode.FileModified, err)
+		} else if models.IsErrFileLocked(err) {
+			c.Error(http.StatusLocked, ecode.FileLocked, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	utils.Audit(c, models.NewFileAuditLog(models.AuditFileUpload, file), nil, models.FileAuditState(file))
+	c.OK(convert.ToFile(file))
+}
+
+func MakeDirPath(c *context.APIContext) {
+	policy, ok := conflictPolicy(c, models.ConflictReject)
+	if !ok {
+		return
+	}
+
+	parent, name, ok := getParentByPath(c, requestPath(c))
+	if !ok {
+		return
+	}
+
+	dir, err := models.CreateDirectory(c.User.ID, parent, name, policy)
+	if err != nil {
+		if models.IsErrFileAlreadyExist(err) {
+			c.Error(http.StatusBadRequest, ecode.FileAlreadyExists, err)
+		} else if models.IsErrFileLocked(err) {
+			c.Error(http.StatusLocked, ecode.FileLocked, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	c.OK(convert.ToFile(dir))
+}
+
+func DeletePath(c *context.APIContext) {
+	file, ok := getFileByPath(c, requestPath(c), models.FilePermissionWrite)
+	if !ok {
+		return
+	}
+
+	if !checkIfMatch(c, file) {
+		return
+	}
+
+	if err := models.DeleteFile(c.User.ID, file, c.GetHeader("If-Match")); err != nil {
+		if models.IsErrModifyRootFile(err) {
+			c.Error(http.StatusBadRequest, ecode.FileRootOperateError, err)
+		} else if models.IsErrFileModified(err) {
+			c.Error(http.StatusPreconditionFailed, ecode.FileModified, err)
+		} else if models.IsErrFileLocked(err) {
+			c.Error(http.StatusLocked, ecode.FileLocked, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	utils.Audit(c, models.NewFileAuditLog(models.AuditFileDelete, file), models.FileAuditState(file), nil)
+	c.OK(nil)
+}
+
+func MovePath(c *context.APIContext) {
+	transferPath(c, false)
+}
+
+func CopyPath(c *context.APIContext) {
+	transferPath(c, true)
+}
+
+func transferPath(c *context.APIContext, isCopy bool) {
+	policy, ok := conflictPolicy(c, models.ConflictReject)
+	if !ok {
+		return
+	}
+
+	dest, err := destinationPath(c)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	// copies only read their source
+	perm := models.FilePermissionWrite
+	if isCopy {
+		perm = models.FilePermissionRead
+	}
+
+	file, ok := getFileByPath(c, requestPath(c), perm)
+	if !ok {
+		return
+	}
+
+	if !checkIfMatch(c, file) {
+		return
+	}
+
+	dir, name, ok := getParentByPath(c, dest)
+	if !ok {
+		return
+	}
+
+	before, action := models.FileAuditState(file), models.AuditFileMove
+	if isCopy {
+		file, err = models.CopyFile(c.User.ID, file, dir, name, policy)
+		action = models.AuditFileCopy
+	} else {
+		file, err = models.MoveFile(c.User.ID, file, dir, name, policy, c.GetHeader("If-Match"))
+	}
+
+	if err != nil {
+		if models.IsErrModifyRootFile(err) {
+			c.Error(http.StatusBadRequest, ecode.FileRootOperateError, err)
+		} else if models.IsErrFileMoveIntoItself(err) {
+			c.Error(http.StatusBadRequest, ecode.FileMoveIntoItself, err)
+		} else if models.IsErrFileAlreadyExist(err) {
+			c.Error(http.StatusBadRequest, ecode.FileAlreadyExists, err)
+		} else if models.IsErrFileMaxSizeLimit(err) {
+			c.Error(http.StatusBadRequest, ecode.FileStorageFulled, err)
+		} else if models.IsErrUploadPolicy(err) {
+			c.Error(http.StatusBadRequest, fileErrorCode(err), err)
+		} else if models.IsErrFileModified(err) {
+			c.Error(http.StatusPreconditionFailed, ecode.FileModified, err)
+		} else if models.IsErrFileLocked(err) {
+			c.Error(http.StatusLocked, ecode.FileLocked, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	utils.Audit(c, models.NewFileAuditLog(action, file), before, models.FileAuditState(file))
+	c.OK(convert.ToFile(file))
+}
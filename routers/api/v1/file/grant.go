@@ -0,0 +1,133 @@
+package file
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+)
+
+type GrantFileForm struct {
+	Username   string `json:"username" form:"username" binding:"required"`
+	Permission string `json:"permission" form:"permission" binding:"required,oneof=read write"`
+}
+
+func ListFileGrants(c *context.APIContext) {
+	file, ok := getFile(c, models.FilePermissionAdmin)
+	if !ok {
+		return
+	}
+
+	grants, err := models.GetFileGrants(file)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	result := make([]*api.FileGrant, len(grants))
+	for i := range grants {
+		result[i] = convert.ToFileGrant(grants[i])
+	}
+	c.OK(result)
+}
+
+func GrantFile(c *context.APIContext) {
+	file, ok := getFile(c, models.FilePermissionAdmin)
+	if !ok {
+		return
+	}
+
+	form := &GrantFileForm{}
+	if err := c.ShouldBind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	user, err := models.GetUserByUsername(form.Username)
+	if err == nil && user.IsTeam() {
+		err = models.ErrUserNotExist{Username: form.Username}
+	}
+	if err != nil {
+		if models.IsErrUserNotExist(err) {
+			c.NotFound(ecode.UsernameNotFound, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	if user.ID == file.Owner {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, fmt.Errorf("cannot grant a file to its owner"))
+		return
+	}
+
+	grant, err := models.GrantFile(file, user.ID, models.ParseFilePermission(form.Permission))
+	if err != nil {
+		if models.IsErrModifyRootFile(err) {
+			c.Error(http.StatusBadRequest, ecode.FileRootOperateError, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+	grant.User = user
+
+	utils.Audit(c, models.NewFileAuditLog(models.AuditFileGrant, file), nil, map[string]interface{}{
+		"user":       user.Username,
+		"permission": form.Permission,
+	})
+	c.OK(convert.ToFileGrant(grant))
+}
+
+func RevokeFileGrant(c *context.APIContext) {
+	file, ok := getFile(c, models.FilePermissionAdmin)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	if err := models.RevokeFileGrant(file, uint(userID)); err != nil {
+		if models.IsErrFileGrantNotExist(err) {
+			c.Error(http.StatusNotFound, ecode.FileGrantNotExist, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	utils.Audit(c, models.NewFileAuditLog(models.AuditFileRevoke, file), map[string]interface{}{"user_id": userID}, nil)
+	c.OK(nil)
+}
+
+func ListSharedWithMe(c *context.APIContext) {
+	listOptions := utils.GetListOptions(c)
+	if listOptions.Page <= 0 {
+		listOptions.Page = 1
+	}
+
+	grants, maxResult, err := models.GetSharedWithMe(c.User.ID, listOptions)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	result := make([]*api.FileGrant, len(grants))
+	for i := range grants {
+		result[i] = convert.ToFileGrant(grants[i])
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(maxResult, 10))
+	c.Header("Access-Control-Expose-Headers", "X-Total-Count")
+	c.OK(result)
+}
@@ -0,0 +1,76 @@
+package file
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	"github.com/czhj/ahfs/modules/setting"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+)
+
+type LockFileForm struct {
+	// Timeout is the lifetime of the lock in seconds
+	Timeout int64  `form:"timeout" json:"timeout" binding:"omitempty,min=1"`
+	Note    string `form:"note" json:"note" binding:"omitempty,max=255"`
+}
+
+func LockFile(c *context.APIContext) {
+	form := &LockFileForm{}
+	if err := c.ShouldBind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	timeout := setting.Service.FileLockTimeout
+	if form.Timeout > 0 {
+		timeout = time.Duration(form.Timeout) * time.Second
+	}
+
+	if timeout > setting.Service.FileLockMaxTimeout {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, fmt.Errorf("timeout is too long, max is %d seconds", int64(setting.Service.FileLockMaxTimeout/time.Second)))
+		return
+	}
+
+	file, ok := getFile(c, models.FilePermissionWrite)
+	if !ok {
+		return
+	}
+
+	lock, err := models.LockFile(file, c.User.ID, timeout, form.Note)
+	if err != nil {
+		if models.IsErrFileLockDirectory(err) {
+			c.Error(http.StatusBadRequest, ecode.FileLockDirError, err)
+		} else if models.IsErrFileLocked(err) {
+			c.Error(http.StatusLocked, ecode.FileLocked, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	lock.User = c.User
+	c.OK(convert.ToFileLock(lock))
+}
+
+func UnlockFile(c *context.APIContext) {
+	file, ok := getFile(c, models.FilePermissionRead)
+	if !ok {
+		return
+	}
+
+	if err := models.UnlockFile(file, c.User.ID, false); err != nil {
+		if models.IsErrFileLocked(err) {
+			c.Error(http.StatusLocked, ecode.FileLocked, err)
+		} else if models.IsFileUnlockFailed(err) {
+			c.Error(http.StatusBadRequest, ecode.FileNotLocked, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+	c.OK(nil)
+}
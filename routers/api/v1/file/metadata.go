@@ -0,0 +1,194 @@
+package file
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+)
+
+type FileTagsForm struct {
+	Tags []string `json:"tags" form:"tags" binding:"required,min=1,max=64,dive,required,max=64"`
+}
+
+type FilePropertiesForm struct {
+	Properties map[string]string `json:"properties" form:"properties" binding:"required,min=1,max=64,dive,keys,required,max=64,endkeys,max=1024"`
+}
+
+// metadataFilter reads the repeated tag and property query parameters of
+// listings, properties are given as name=value or as name to only require
+// the property to be set.
+func metadataFilter(c *context.APIContext) models.MetadataFilter {
+	filter := models.MetadataFilter{}
+	for _, tag := range c.QueryArray("tag") {
+		if tag = strings.TrimSpace(tag); len(tag) != 0 {
+			filter.Tags = append(filter.Tags, tag)
+		}
+	}
+
+	for _, property := range c.QueryArray("property") {
+		name, value := property, ""
+		if i := strings.IndexByte(property, '='); i >= 0 {
+			name, value = property[:i], property[i+1:]
+		}
+
+		if name = strings.TrimSpace(name); len(name) != 0 {
+			if filter.Properties == nil {
+				filter.Properties = make(map[string]string)
+			}
+			filter.Properties[name] = value
+		}
+	}
+	return filter
+}
+
+// getFile returns the file given by the file_id parameter if the current
+// user has at least perm on it.
+func getFile(c *context.APIContext, perm models.FilePermission) (*models.File, bool) {
+	fileIDParam := c.Param("file_id")
+	fileID, err := strconv.ParseUint(fileIDParam, 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return nil, false
+	}
+	return getAccessibleFile(c, uint(fileID), perm)
+}
+
+// getAccessibleFile returns the file id if the current user has at least
+// perm on it.
+func getAccessibleFile(c *context.APIContext, id uint, perm models.FilePermission) (*models.File, bool) {
+	file, err := models.GetAccessibleFile(id, c.User.ID, perm)
+	if err != nil {
+		if models.IsErrFileNotExist(err) {
+			c.Error(http.StatusNotFound, ecode.FileNotExist, err)
+		} else if models.IsErrFilePermissionDenied(err) {
+			c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return nil, false
+	}
+	return file, true
+}
+
+// checkIfMatch fails the request with 412 if it has an If-Match header which
+// doesn't match the current version of file.
+func checkIfMatch(c *context.APIContext, file *models.File) bool {
+	match := c.GetHeader("If-Match")
+	if len(match) == 0 || file.MatchETag(match) {
+		return true
+	}
+
+	c.Error(http.StatusPreconditionFailed, ecode.FileModified, models.ErrFileModified{ID: file.ID, Version: file.Version})
+	return false
+}
+
+func GetFileMetadata(c *context.APIContext) {
+	file, ok := getFile(c, models.FilePermissionRead)
+	if !ok {
+		return
+	}
+
+	metadata, err := models.GetFileMetadata(file.ID)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+	c.OK(convert.ToFileMetadata(metadata))
+}
+
+func AddFileTags(c *context.APIContext) {
+	form := &FileTagsForm{}
+	if err := c.ShouldBind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	tags := make([]string, 0, len(form.Tags))
+	for _, tag := range form.Tags {
+		tag = strings.TrimSpace(tag)
+		if len(tag) == 0 {
+			c.Error(http.StatusBadRequest, ecode.ParameterFormatError, fmt.Errorf("tag cannot be blank"))
+			return
+		}
+		tags = append(tags, tag)
+	}
+
+	file, ok := getFile(c, models.FilePermissionWrite)
+	if !ok {
+		return
+	}
+
+	metadata, err := models.AddFileTags(file, tags)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+	c.OK(convert.ToFileMetadata(metadata))
+}
+
+func RemoveFileTag(c *context.APIContext) {
+	file, ok := getFile(c, models.FilePermissionWrite)
+	if !ok {
+		return
+	}
+
+	if err := models.RemoveFileTag(file, c.Param("tag")); err != nil {
+		c.InternalServerError(err)
+		return
+	}
+	c.OK(nil)
+}
+
+func SetFileProperties(c *context.APIContext) {
+	form := &FilePropertiesForm{}
+	if err := c.ShouldBindJSON(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	file, ok := getFile(c, models.FilePermissionWrite)
+	if !ok {
+		return
+	}
+
+	metadata, err := models.SetFileProperties(file, form.Properties)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+	c.OK(convert.ToFileMetadata(metadata))
+}
+
+func RemoveFileProperty(c *context.APIContext) {
+	file, ok := getFile(c, models.FilePermissionWrite)
+	if !ok {
+		return
+	}
+
+	if err := models.RemoveFileProperty(file, c.Param("name")); err != nil {
+		c.InternalServerError(err)
+		return
+	}
+	c.OK(nil)
+}
+
+func ListTags(c *context.APIContext) {
+	tags, err := models.GetUserTags(c.User.ID)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	result := make([]*api.Tag, len(tags))
+	for i, tag := range tags {
+		result[i] = &api.Tag{Name: tag.Name, Count: tag.Count}
+	}
+	c.OK(result)
+}
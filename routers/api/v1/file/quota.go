@@ -0,0 +1,143 @@
+package file
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+)
+
+type DirectoryQuotaForm struct {
+	// Quota is the maximum total size of the files in bytes
+	Quota int64 `form:"quota" json:"quota" binding:"required,min=1"`
+}
+
+type UploadPolicyForm struct {
+	// MaxFileSize is the maximum size of a file in bytes, 0 disables it
+	MaxFileSize int64 `form:"max_file_size" json:"max_file_size" binding:"min=0"`
+	// AllowedTypes and BlockedTypes list extensions like ".exe" and MIME
+	// types like "image/*"
+	AllowedTypes []string `form:"allowed_types" json:"allowed_types"`
+	BlockedTypes []string `form:"blocked_types" json:"blocked_types"`
+}
+
+// getOwnDirectory returns the directory of the request, quotas and upload
+// policies are managed by the owner only.
+func getOwnDirectory(c *context.APIContext) (*models.File, bool) {
+	fileID, err := strconv.ParseUint(c.Param("file_id"), 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return nil, false
+	}
+
+	directory, err := models.GetFileByID(uint(fileID), c.User.ID)
+	if err != nil {
+		if models.IsErrFileNotExist(err) {
+			c.Error(http.StatusNotFound, ecode.FileDirNotExists, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return nil, false
+	}
+	return directory, true
+}
+
+func SetDirectoryQuota(c *context.APIContext) {
+	form := &DirectoryQuotaForm{}
+	if err := c.ShouldBind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	directory, ok := getOwnDirectory(c)
+	if !ok {
+		return
+	}
+
+	setDirectoryQuota(c, directory, form.Quota)
+}
+
+func RemoveDirectoryQuota(c *context.APIContext) {
+	directory, ok := getOwnDirectory(c)
+	if !ok {
+		return
+	}
+
+	setDirectoryQuota(c, directory, 0)
+}
+
+func setDirectoryQuota(c *context.APIContext, directory *models.File, quota int64) {
+	if err := models.SetDirectoryQuota(directory, quota); err != nil {
+		if models.IsErrFileNotDirectory(err) {
+			c.Error(http.StatusBadRequest, ecode.FileNotDirError, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+	c.OK(convert.ToFile(directory))
+}
+
+func GetUploadPolicy(c *context.APIContext) {
+	directory, ok := getOwnDirectory(c)
+	if !ok {
+		return
+	}
+
+	policy, err := models.GetUploadPolicy(directory)
+	if err != nil {
+		if models.IsErrFileNotDirectory(err) {
+			c.Error(http.StatusBadRequest, ecode.FileNotDirError, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+	c.OK(convert.ToUploadPolicy(policy))
+}
+
+func SetUploadPolicy(c *context.APIContext) {
+	form := &UploadPolicyForm{}
+	if err := c.ShouldBind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	directory, ok := getOwnDirectory(c)
+	if !ok {
+		return
+	}
+
+	policy := &models.UploadPolicy{MaxFileSize: form.MaxFileSize}
+	policy.SetAllowedTypeList(form.AllowedTypes)
+	policy.SetBlockedTypeList(form.BlockedTypes)
+	if err := models.SetUploadPolicy(directory, policy); err != nil {
+		if models.IsErrFileNotDirectory(err) {
+			c.Error(http.StatusBadRequest, ecode.FileNotDirError, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+	c.OK(convert.ToUploadPolicy(policy))
+}
+
+func RemoveUploadPolicy(c *context.APIContext) {
+	directory, ok := getOwnDirectory(c)
+	if !ok {
+		return
+	}
+
+	if err := models.RemoveUploadPolicy(directory); err != nil {
+		if models.IsErrFileNotDirectory(err) {
+			c.Error(http.StatusBadRequest, ecode.FileNotDirError, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+	c.OK(nil)
+}
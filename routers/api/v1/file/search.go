@@ -0,0 +1,125 @@
+package file
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+)
+
+type SearchFileForm struct {
+	Keyword       string     `form:"q"`
+	Match         string     `form:"match" binding:"omitempty,oneof=exact substring prefix glob"`
+	Type          string     `form:"type" binding:"omitempty,oneof=file dir"`
+	MinSize       *int64     `form:"min_size" binding:"omitempty,min=0"`
+	MaxSize       *int64     `form:"max_size" binding:"omitempty,min=0"`
+	UpdatedAfter  *time.Time `form:"updated_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	UpdatedBefore *time.Time `form:"updated_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	Path          string     `form:"path"`
+	Extension     string     `form:"ext"`
+	Sort          string     `form:"sort" binding:"omitempty,oneof=name size date"`
+	Order         string     `form:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+var searchFileOrders = map[string][2]models.SearchOrderBy{
+	"name": {models.SearchOrderByFileName, models.SearchOrderByFileNameReverse},
+	"size": {models.SearchOrderByFileSize, models.SearchOrderByFileSizeReverse},
+	"date": {models.SearchOrderByLeastUpdated, models.SearchOrderByRecentUpdated},
+}
+
+func SearchFiles(c *context.APIContext) {
+	form := &SearchFileForm{}
+	if err := c.ShouldBindQuery(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	owner, ok := getReadableTree(c)
+	if !ok {
+		return
+	}
+
+	listOptions := utils.GetListOptions(c)
+	if listOptions.Page <= 0 {
+		listOptions.Page = 1
+	}
+
+	opts := &models.SearchFileOptions{
+		ListOptions:    listOptions,
+		MetadataFilter: metadataFilter(c),
+		Keyword:        strings.TrimSpace(form.Keyword),
+		Match:          models.FileMatchMode(form.Match),
+		Owner:          owner,
+		Extension:      form.Extension,
+		ExcludeRoot:    true,
+	}
+
+	switch form.Type {
+	case "file":
+		opts.Type = models.FileTypeFile
+	case "dir":
+		opts.Type = models.FileTypeDir
+	}
+
+	if form.MinSize != nil {
+		opts.MinSize = sql.NullInt64{Int64: *form.MinSize, Valid: true}
+	}
+
+	if form.MaxSize != nil {
+		opts.MaxSize = sql.NullInt64{Int64: *form.MaxSize, Valid: true}
+	}
+
+	if form.UpdatedAfter != nil {
+		opts.UpdatedAfter = *form.UpdatedAfter
+	}
+
+	if form.UpdatedBefore != nil {
+		opts.UpdatedBefore = *form.UpdatedBefore
+	}
+
+	if len(form.Sort) != 0 {
+		orders := searchFileOrders[form.Sort]
+		opts.OrderBy = orders[0]
+		if form.Order == "desc" {
+			opts.OrderBy = orders[1]
+		}
+	} else if form.Order == "desc" {
+		opts.OrderBy = models.SearchOrderByFileNameReverse
+	}
+
+	if len(form.Path) != 0 {
+		directory, ok := getFileByPath(c, form.Path, models.FilePermissionRead)
+		if !ok {
+			return
+		}
+
+		if !directory.IsDir() {
+			c.Error(http.StatusBadRequest, ecode.FileNotDirError, models.ErrFileNotDirectory{ID: directory.ID, Path: directory.FilePath()})
+			return
+		}
+		opts.Directory = directory
+	}
+
+	files, maxResult, err := models.SearchFile(opts)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	result := make([]*api.File, len(files))
+	for i := range files {
+		result[i] = convert.ToFile(files[i])
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(maxResult, 10))
+	c.Header("Access-Control-Expose-Headers", "X-Total-Count")
+	c.OK(result)
+}
@@ -0,0 +1,250 @@
+package file
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type CreateShareLinkForm struct {
+	FileID       uint       `form:"file_id" json:"file_id" binding:"required"`
+	Password     string     `form:"password" json:"password"`
+	ExpiresAt    *time.Time `form:"expires_at" json:"expires_at" time_format:"2006-01-02T15:04:05Z07:00"`
+	MaxDownloads int64      `form:"max_downloads" json:"max_downloads" binding:"omitempty,min=0"`
+}
+
+type SharePasswordForm struct {
+	Password string `form:"password" json:"password"`
+}
+
+func CreateShareLink(c *context.APIContext) {
+	form := &CreateShareLinkForm{}
+	if err := c.ShouldBind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	file, err := models.GetFileByID(form.FileID, c.User.ID)
+	if err != nil {
+		if models.IsErrFileNotExist(err) {
+			c.Error(http.StatusNotFound, ecode.FileNotExist, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	if form.ExpiresAt != nil && !form.ExpiresAt.After(time.Now()) {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, fmt.Errorf("expires_at must be in the future"))
+		return
+	}
+
+	link := &models.ShareLink{
+		Owner:        c.User.ID,
+		FileID:       file.ID,
+		ExpiresAt:    form.ExpiresAt,
+		MaxDownloads: form.MaxDownloads,
+		File:         file,
+	}
+	link.HashPassword(form.Password)
+
+	if err := models.CreateShareLink(link); err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	utils.Audit(c, models.NewFileAuditLog(models.AuditFileShare, file), nil, map[string]interface{}{
+		"share_id":      link.ID,
+		"has_password":  link.IsPasswordSet(),
+		"expires_at":    link.ExpiresAt,
+		"max_downloads": link.MaxDownloads,
+	})
+	c.OK(convert.ToShareLink(link))
+}
+
+func ListShareLinks(c *context.APIContext) {
+	listOptions := utils.GetListOptions(c)
+	if listOptions.Page <= 0 {
+		listOptions.Page = 1
+	}
+
+	links, maxResult, err := models.GetShareLinks(c.User.ID, listOptions)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	result := make([]*api.ShareLink, len(links))
+	for i := range links {
+		result[i] = convert.ToShareLink(links[i])
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(maxResult, 10))
+	c.Header("Access-Control-Expose-Headers", "X-Total-Count")
+	c.OK(result)
+}
+
+func DeleteShareLink(c *context.APIContext) {
+	shareID, err := strconv.ParseUint(c.Param("share_id"), 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	if err := models.DeleteShareLink(uint(shareID), c.User.ID); err != nil {
+		if models.IsErrShareLinkNotExist(err) {
+			c.Error(http.StatusNotFound, ecode.ShareLinkNotExist, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	utils.Audit(c, &models.AuditLog{
+		Action:      models.AuditFileUnshare,
+		TargetType:  models.AuditTargetShare,
+		TargetID:    uint(shareID),
+		TargetOwner: c.User.ID,
+	}, nil, nil)
+	c.OK(nil)
+}
+
+// sharePassword returns the password of a share link from the
+// X-Share-Password header or the body of a POST request. It isn't read from
+// the query, which ends up in access logs and the browser history.
+func sharePassword(c *context.APIContext) string {
+	if password := c.GetHeader("X-Share-Password"); len(password) != 0 {
+		return password
+	}
+
+	if c.Request.Method != http.MethodPost {
+		return ""
+	}
+
+	form := &SharePasswordForm{}
+	var b binding.Binding = binding.FormPost
+	if c.ContentType() == binding.MIMEJSON {
+		b = binding.JSON
+	}
+	if err := c.ShouldBindWith(form, b); err != nil {
+		return ""
+	}
+	return form.Password
+}
+
+// getShareLink resolves the token param to a usable link, see sharePassword
+// for the password.
+func getShareLink(c *context.APIContext) (*models.ShareLink, bool) {
+	link, err := models.GetShareLinkByToken(c.Param("token"))
+	if err != nil {
+		if models.IsErrShareLinkNotExist(err) {
+			c.Error(http.StatusNotFound, ecode.ShareLinkNotExist, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return nil, false
+	}
+
+	if link.IsExpired() {
+		c.Error(http.StatusGone, ecode.ShareLinkExpired, fmt.Errorf("share link has expired"))
+		return nil, false
+	}
+
+	if !link.ValidatePassword(sharePassword(c)) {
+		c.Error(http.StatusForbidden, ecode.ShareLinkPassword, fmt.Errorf("share link password is wrong"))
+		return nil, false
+	}
+	return link, true
+}
+
+// getSharedFile resolves the path query below the shared file of link.
+func getSharedFile(c *context.APIContext, link *models.ShareLink) (*models.File, bool) {
+	file, err := models.GetFileByRelativePath(link.File, c.Query("path"))
+	if err != nil {
+		if models.IsErrFileNotExist(err) {
+			c.Error(http.StatusNotFound, ecode.FileNotExist, fmt.Errorf("file does not exist"))
+		} else {
+			c.InternalServerError(err)
+		}
+		return nil, false
+	}
+	return file, true
+}
+
+func GetSharedFile(c *context.APIContext) {
+	link, ok := getShareLink(c)
+	if !ok {
+		return
+	}
+
+	result := convert.ToShareLink(link)
+	result.File = convert.ToSharedFile(link.File, link.File)
+	result.ID = 0
+	c.OK(result)
+}
+
+func ListSharedDirectory(c *context.APIContext) {
+	link, ok := getShareLink(c)
+	if !ok {
+		return
+	}
+
+	directory, ok := getSharedFile(c, link)
+	if !ok {
+		return
+	}
+
+	// visitors don't see the metadata, so they can't filter by it either
+	files, ok := listDirectoryBy(c, directory, false, models.MetadataFilter{})
+	if !ok {
+		return
+	}
+
+	result := make([]*api.File, len(files))
+	for i := range files {
+		result[i] = convert.ToSharedFile(link.File, files[i])
+	}
+	c.OK(result)
+}
+
+func DownloadSharedFile(c *context.APIContext) {
+	link, ok := getShareLink(c)
+	if !ok {
+		return
+	}
+
+	file, ok := getSharedFile(c, link)
+	if !ok {
+		return
+	}
+
+	if file.IsDir() {
+		c.Error(http.StatusBadRequest, ecode.FileDownloadDirError, fmt.Errorf("Cannot download a directory"))
+		return
+	}
+
+	if !checkDownloadable(c, file) {
+		return
+	}
+
+	if err := models.IncreaseShareLinkDownloads(link); err != nil {
+		if models.IsErrShareLinkExhausted(err) {
+			c.Error(http.StatusForbidden, ecode.ShareLinkExhausted, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	utils.Audit(c, models.NewFileAuditLog(models.AuditFileDownload, file), nil, map[string]interface{}{"share_id": link.ID})
+	serveContent(c, file)
+}
@@ -0,0 +1,88 @@
+package file
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+)
+
+type RecentFilesForm struct {
+	Type string `form:"type" binding:"omitempty,oneof=upload download modify"`
+}
+
+func StarFile(c *context.APIContext) {
+	file, ok := getFile(c, models.FilePermissionRead)
+	if !ok {
+		return
+	}
+
+	if err := models.StarFile(c.User.ID, file); err != nil {
+		c.InternalServerError(err)
+		return
+	}
+	c.OK(nil)
+}
+
+func UnstarFile(c *context.APIContext) {
+	file, ok := getFile(c, models.FilePermissionRead)
+	if !ok {
+		return
+	}
+
+	if err := models.UnstarFile(c.User.ID, file); err != nil {
+		c.InternalServerError(err)
+		return
+	}
+	c.OK(nil)
+}
+
+func ListStarredFiles(c *context.APIContext) {
+	listOptions := utils.GetListOptions(c)
+	if listOptions.Page <= 0 {
+		listOptions.Page = 1
+	}
+
+	files, maxResult, err := models.GetStarredFiles(c.User.ID, listOptions)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+	listFiles(c, files, maxResult)
+}
+
+func ListRecentFiles(c *context.APIContext) {
+	form := &RecentFilesForm{}
+	if err := c.ShouldBindQuery(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	listOptions := utils.GetListOptions(c)
+	if listOptions.Page <= 0 {
+		listOptions.Page = 1
+	}
+
+	files, maxResult, err := models.GetRecentFiles(c.User.ID, models.FileActivityType(form.Type), listOptions)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+	listFiles(c, files, maxResult)
+}
+
+func listFiles(c *context.APIContext, files []*models.File, maxResult int64) {
+	result := make([]*api.File, len(files))
+	for i := range files {
+		result[i] = convert.ToFile(files[i])
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(maxResult, 10))
+	c.Header("Access-Control-Expose-Headers", "X-Total-Count")
+	c.OK(result)
+}
@@ -0,0 +1,43 @@
+package file
+
+import (
+	"net/http"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+)
+
+type DirectoryStatsForm struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+func GetDirectoryStats(c *context.APIContext) {
+	form := &DirectoryStatsForm{}
+	if err := c.ShouldBindQuery(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	if form.Limit == 0 {
+		form.Limit = 10
+	}
+
+	directory, ok := getFile(c, models.FilePermissionRead)
+	if !ok {
+		return
+	}
+
+	breakdown, err := models.GetDirectoryBreakdown(directory, form.Limit)
+	if err != nil {
+		if models.IsErrFileNotDirectory(err) {
+			c.Error(http.StatusBadRequest, ecode.FileNotDirError, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	c.OK(convert.ToDirectoryStats(directory, breakdown))
+}
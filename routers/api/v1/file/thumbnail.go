@@ -0,0 +1,86 @@
+package file
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/modules/storage"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/services/thumbnailer"
+)
+
+type ThumbnailForm struct {
+	Size int `form:"size" binding:"omitempty,min=1"`
+}
+
+func GetThumbnail(c *context.APIContext) {
+	if !setting.Thumbnail.Enabled {
+		c.Error(http.StatusNotFound, ecode.FeatureDisabled, fmt.Errorf("thumbnails are disabled"))
+		return
+	}
+
+	fileIDParam := c.Param("file_id")
+	fileID, err := strconv.ParseUint(fileIDParam, 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	form := &ThumbnailForm{}
+	if err := c.ShouldBindQuery(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	userID := c.User.ID
+	if c.IsAdmin() {
+		userID = 0
+	}
+
+	file, err := models.GetAccessibleFile(uint(fileID), userID, models.FilePermissionRead)
+	if err != nil {
+		if models.IsErrFileNotExist(err) {
+			c.Error(http.StatusNotFound, ecode.FileNotExist, err)
+		} else if models.IsErrFilePermissionDenied(err) {
+			c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	if !checkDownloadable(c, file) {
+		return
+	}
+
+	thumb, err := models.GetThumbnail(file.ID, form.Size)
+	if err != nil {
+		if models.IsErrThumbnailNotExist(err) {
+			// the thumbnail may not be rendered yet, or the file predates the service
+			thumbnailer.Notify(file.Owner)
+			c.Error(http.StatusNotFound, ecode.FileThumbnailNotExist, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Storage(&context.ServeOptions{
+		Filename:    fmt.Sprintf("%d-%d%s", file.ID, thumb.Size, thumbnailExtension(thumb.ContentType)),
+		Size:        thumb.ObjectSize,
+		ContentType: thumb.ContentType,
+		Inline:      true,
+	}, storage.ID(thumb.ObjectID), storage.LFS)
+}
+
+func thumbnailExtension(contentType string) string {
+	if contentType == "image/png" {
+		return ".png"
+	}
+	return ".jpg"
+}
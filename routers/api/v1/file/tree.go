@@ -0,0 +1,54 @@
+package file
+
+import (
+	"net/http"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	"github.com/czhj/ahfs/modules/setting"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+)
+
+type DirectoryTreeForm struct {
+	// Depth is the number of levels below the directory, 1 by default
+	Depth   int  `form:"depth" binding:"omitempty,min=1"`
+	OnlyDir bool `form:"only_dir"`
+}
+
+// GetDirectoryTree returns the directory with its nested entries, e.g. for
+// sidebar trees. Entries which have children that weren't loaded because of
+// the depth or size limit can be expanded with another request.
+func GetDirectoryTree(c *context.APIContext) {
+	form := &DirectoryTreeForm{}
+	if err := c.ShouldBindQuery(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	depth := form.Depth
+	if depth == 0 {
+		depth = 1
+	}
+
+	if depth > setting.API.MaxTreeDepth {
+		depth = setting.API.MaxTreeDepth
+	}
+
+	directory, ok := getFile(c, models.FilePermissionRead)
+	if !ok {
+		return
+	}
+
+	tree, err := models.GetDirectoryTree(directory, depth, form.OnlyDir, setting.API.MaxTreeSize)
+	if err != nil {
+		if models.IsErrFileNotDirectory(err) {
+			c.Error(http.StatusBadRequest, ecode.FileNotDirError, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	c.OK(convert.ToFileTree(tree, form.OnlyDir))
+}
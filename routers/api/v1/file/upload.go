@@ -9,14 +9,29 @@ import (
 	"github.com/czhj/ahfs/models"
 	"github.com/czhj/ahfs/modules/context"
 	"github.com/czhj/ahfs/modules/convert"
+	"github.com/czhj/ahfs/modules/log"
 	"github.com/czhj/ahfs/modules/validator"
 	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+	"go.uber.org/zap"
 )
 
 func UploadFile(c *context.APIContext) {
 
 	filename := c.PostForm("filename")
 	parentID, _ := strconv.ParseUint(c.PostForm("parent_id"), 10, 64)
+	extract, _ := strconv.ParseBool(c.PostForm("extract"))
+	conflict := c.DefaultPostForm("conflict", string(models.ConflictReject))
+	if !validator.ValidConflict(conflict) {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, fmt.Errorf("unknown conflict policy: %s", conflict))
+		return
+	}
+
+	expiresAt, ok := getExpiration(c, c.ShouldBind)
+	if !ok {
+		return
+	}
+
 	fileHeader, err := c.FormFile("upload_file")
 	if err != nil {
 		c.InternalServerError(err)
@@ -37,7 +52,7 @@ func UploadFile(c *context.APIContext) {
 	if parentID == 0 {
 		parentFile, err = models.GetUserRootFile(c.User.ID)
 	} else {
-		parentFile, err = models.GetFileByID(uint(parentID), c.User.ID)
+		parentFile, err = models.GetAccessibleFile(uint(parentID), c.User.ID, models.FilePermissionWrite)
 	}
 
 	if err != nil {
@@ -45,21 +60,51 @@ func UploadFile(c *context.APIContext) {
 			c.Error(http.StatusBadRequest, ecode.FileNotExist, err)
 			return
 		}
+		if models.IsErrFilePermissionDenied(err) {
+			c.Error(http.StatusForbidden, ecode.PermissionDenied, err)
+			return
+		}
 		c.InternalServerError(err)
 		return
 	}
 
-	file, err := models.TryUploadFile(c.User, parentFile, fileHeader)
+	file, err := models.TryUploadFile(c.User, parentFile, fileHeader, models.ConflictPolicy(conflict), c.GetHeader("If-Match"), expiresAt)
 	if err != nil {
 		if models.IsErrFileNotDirectory(err) {
 			c.Error(http.StatusBadRequest, ecode.FileNotDirError, err)
+		} else if models.IsErrFileAlreadyExist(err) {
+			c.Error(http.StatusBadRequest, ecode.FileAlreadyExists, err)
 		} else if models.IsErrFileMaxSizeLimit(err) {
 			c.Error(http.StatusBadRequest, ecode.FileStorageFulled, err)
+		} else if models.IsErrUploadPolicy(err) {
+			c.Error(http.StatusBadRequest, fileErrorCode(err), err)
+		} else if models.IsErrFileModified(err) {
+			c.Error(http.StatusPreconditionFailed, ecode.FileModified, err)
+		} else if models.IsErrFileLocked(err) {
+			c.Error(http.StatusLocked, ecode.FileLocked, err)
 		} else {
 			c.InternalServerError(err)
 		}
 		return
 	}
 
+	utils.Audit(c, models.NewFileAuditLog(models.AuditFileUpload, file), nil, models.FileAuditState(file))
+
+	if extract {
+		if extractArchive(c, file, parentFile, models.ConflictPolicy(conflict), true) {
+			return
+		}
+
+		// the archive was only uploaded to be extracted, it isn't kept when
+		// the extraction failed, queued extractions report their failure
+		// through the task and keep the archive
+		if err := models.DeleteFile(c.User.ID, file, ""); err != nil {
+			log.Error("Failed to delete archive", zap.Uint("id", file.ID), zap.Error(err))
+			return
+		}
+		utils.Audit(c, models.NewFileAuditLog(models.AuditFileDelete, file), models.FileAuditState(file), nil)
+		return
+	}
+
 	c.OK(convert.ToFile(file))
 }
@@ -0,0 +1,103 @@
+package v1
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/czhj/ahfs/models"
+	api "github.com/czhj/ahfs/modules/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathAPI(t *testing.T) {
+	u, root := newTestUser(t)
+
+	steps := []struct {
+		req  *testRequest
+		code int
+	}{
+		{request(u, "MKCOL", "/api/v1/fs/docs"), http.StatusOK},
+		{request(u, "MKCOL", "/api/v1/fs/docs"), http.StatusBadRequest},
+		{request(u, "MKCOL", "/api/v1/fs/missing/docs"), http.StatusNotFound},
+		{request(u, "PUT", "/api/v1/fs/docs/a.txt"), http.StatusOK},
+		// PUT overwrites unless told otherwise
+		{request(u, "PUT", "/api/v1/fs/docs/a.txt"), http.StatusOK},
+		{request(u, "PUT", "/api/v1/fs/docs/a.txt?conflict=reject"), http.StatusBadRequest},
+		{request(u, "PUT", "/api/v1/fs/docs/a.txt/b.txt"), http.StatusBadRequest},
+		{request(u, "COPY", "/api/v1/fs/docs/a.txt?destination=/b.txt"), http.StatusOK},
+		{request(u, "COPY", "/api/v1/fs/docs?destination=/docs/sub"), http.StatusBadRequest},
+		{request(u, "MOVE", "/api/v1/fs/b.txt").with("Destination", "http://example.com/api/v1/fs/docs/c.txt"), http.StatusOK},
+		{request(u, "MOVE", "/api/v1/fs/docs/c.txt"), http.StatusBadRequest},
+		{request(u, "MOVE", "/api/v1/fs/?destination=/root"), http.StatusBadRequest},
+		{request(u, "DELETE", "/api/v1/fs/docs/missing.txt"), http.StatusNotFound},
+		{request(u, "DELETE", "/api/v1/fs/"), http.StatusBadRequest},
+	}
+	for _, step := range steps {
+		req := step.req
+		if req.method == "PUT" {
+			req.body = bytes.NewReader([]byte(req.url))
+		}
+		w := req.do()
+		assert.Equal(t, step.code, w.Code, "%s %s: %s", req.method, req.url, w.Body.String())
+	}
+
+	w := request(u, "GET", "/api/v1/fs/docs/c.txt").do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		assert.Equal(t, "/api/v1/fs/docs/a.txt", w.Body.String())
+	}
+
+	w = request(u, "GET", "/api/v1/fs/docs").do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		var files []*api.File
+		decodeData(t, w, &files)
+		names := make([]string, len(files))
+		for i, f := range files {
+			names[i] = f.FileName
+		}
+		assert.ElementsMatch(t, []string{"a.txt", "c.txt"}, names)
+	}
+	assert.Equal(t, []string{"docs"}, listNames(t, root))
+
+	w = request(u, "DELETE", "/api/v1/fs/docs").do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, listNames(t, root))
+}
+
+func TestPathAPITeam(t *testing.T) {
+	owner, _ := newTestUser(t)
+	team := &models.User{Username: "fsteam"}
+	if err := models.CreateTeam(team, owner); err != nil {
+		t.Fatal(err)
+	}
+	viewer, _ := newTestUser(t)
+	if _, err := models.SetTeamMember(team.ID, viewer.ID, models.TeamRoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	outsider, _ := newTestUser(t)
+
+	w := request(owner, "PUT", "/api/v1/fs/f.txt?team_id=%d", team.ID).do()
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+	var f api.File
+	decodeData(t, w, &f)
+	assert.Equal(t, team.ID, f.Owner)
+
+	// the paths of a user are resolved in their own tree without team_id
+	w = request(owner, "GET", "/api/v1/fs/f.txt").do()
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	w = request(viewer, "GET", "/api/v1/fs/f.txt?team_id=%d", team.ID).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = request(viewer, "DELETE", "/api/v1/fs/f.txt?team_id=%d", team.ID).do()
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = request(viewer, "PUT", "/api/v1/fs/g.txt?team_id=%d", team.ID).do()
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	w = request(outsider, "GET", "/api/v1/fs/f.txt?team_id=%d", team.ID).do()
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	w = request(nil, "GET", "/api/v1/fs/f.txt?team_id=%d", team.ID).do()
+	assert.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+}
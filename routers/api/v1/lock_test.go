@@ -0,0 +1,112 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileLockEnforcement(t *testing.T) {
+	owner, root := newTestUser(t)
+	dir := createTestDir(t, owner, root, "dir")
+	dst := createTestDir(t, owner, root, "dst")
+	f := uploadTestFile(t, owner, dir, "f.txt", "f")
+
+	holder, _ := newTestUser(t)
+	if _, err := models.GrantFile(dir, holder.ID, models.FilePermissionWrite); err != nil {
+		t.Fatal(err)
+	}
+
+	w := request(holder, "PUT", "/api/v1/files/%d/lock", f.ID).json(map[string]interface{}{"note": "editing"}).do()
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+
+	// nobody but the holder changes the file, not even its owner
+	locked := []*testRequest{
+		request(owner, "PUT", "/api/v1/files/%d/lock", f.ID),
+		request(owner, "PUT", "/api/v1/files/%d/name", f.ID).json(map[string]string{"filename": "g.txt"}),
+		request(owner, "PUT", "/api/v1/files/%d/directory", f.ID).json(map[string]interface{}{"directory_id": dst.ID}),
+		request(owner, "DELETE", "/api/v1/files/%d", f.ID),
+		request(owner, "POST", "/api/v1/files").upload("f.txt", []byte("new"), map[string]string{"parent_id": fmt.Sprint(dir.ID), "conflict": "overwrite"}),
+		request(owner, "PUT", "/api/v1/fs/dir/f.txt").with("Content-Type", "text/plain"),
+		// directories holding the file neither
+		request(owner, "DELETE", "/api/v1/files/%d", dir.ID),
+		request(owner, "PUT", "/api/v1/files/%d/directory", dir.ID).json(map[string]interface{}{"directory_id": dst.ID}),
+		request(owner, "DELETE", "/api/v1/files/%d/lock", f.ID),
+	}
+	for _, req := range locked {
+		w := req.do()
+		assert.Equal(t, http.StatusLocked, w.Code, "%s %s: %s", req.method, req.url, w.Body.String())
+	}
+	assert.Equal(t, []string{"f.txt"}, listNames(t, dir))
+
+	w = request(holder, "PUT", "/api/v1/files/%d/name", f.ID).json(map[string]string{"filename": "g.txt"}).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = request(holder, "DELETE", "/api/v1/files/%d/lock", f.ID).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = request(owner, "DELETE", "/api/v1/files/%d", f.ID).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestAdminUnlockFile(t *testing.T) {
+	owner, root := newTestUser(t)
+	f := uploadTestFile(t, owner, root, "f.txt", "f")
+	if _, err := models.LockFile(f, owner.ID, setting.Service.FileLockTimeout, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := newTestUser(t)
+	w := request(u, "DELETE", "/api/v1/admin/files/%d/lock", f.ID).do()
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	admin, _ := newTestUser(t)
+	admin.IsAdmin = true
+	if err := models.SaveUser(admin); err != nil {
+		t.Fatal(err)
+	}
+
+	w = request(admin, "DELETE", "/api/v1/admin/files/%d/lock", f.ID).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	lock, err := models.GetFileLock(f)
+	assert.NoError(t, err)
+	assert.Nil(t, lock)
+}
+
+func TestConcurrentFileLocks(t *testing.T) {
+	owner, root := newTestUser(t)
+	f := uploadTestFile(t, owner, root, "f.txt", "f")
+
+	users := make([]*models.User, 8)
+	for i := range users {
+		users[i], _ = newTestUser(t)
+		if _, err := models.GrantFile(f, users[i].ID, models.FilePermissionWrite); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	codes := make([]int, len(users))
+	var wg sync.WaitGroup
+	for i := range users {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = request(users[i], "PUT", "/api/v1/files/%d/lock", f.ID).do().Code
+		}(i)
+	}
+	wg.Wait()
+
+	counts := make(map[int]int)
+	for _, code := range codes {
+		counts[code]++
+	}
+	assert.Equal(t, map[int]int{http.StatusOK: 1, http.StatusLocked: len(users) - 1}, counts)
+}
@@ -0,0 +1,238 @@
+package v1
+
+import (
+	"bytes"
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/limiter"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/modules/storage"
+	"github.com/czhj/ahfs/modules/storage/local"
+	api "github.com/czhj/ahfs/modules/structs"
+	"github.com/czhj/ahfs/modules/validator"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// testRouter serves the API, the user of a request is the one whose id is
+// sent in the X-Test-User header instead of a session or a token.
+var testRouter *gin.Engine
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "ahfs-api")
+	if err != nil {
+		panic(err)
+	}
+
+	setting.ServerMode = "release"
+	setting.Database.Driver = "sqlite3"
+	setting.Database.URL = filepath.Join(dir, "test.db")
+	setting.Upload = &setting.UploadService{}
+	setting.Archive = &setting.ArchiveService{MaxSize: 1 << 20, ExtractSyncSize: 1 << 20, ExtractMaxSize: 1 << 20, ExtractMaxEntries: 100}
+	setting.Scanner = &setting.ScannerService{}
+	setting.API.DefaultPagingSize, setting.API.MaxPagingSize = 10, 50
+	setting.API.MaxBatchSize = 10
+	setting.API.MaxChangeSize, setting.API.MaxChangeWait = 100, 10*time.Second
+	setting.Service.FileLockTimeout, setting.Service.FileLockMaxTimeout = time.Hour, 24*time.Hour
+	storage.LFS = local.NewStorage(local.LocalStorageConfig{Directory: filepath.Join(dir, "lfs")})
+
+	err = models.NewEngine(gocontext.Background(), func(e *gorm.DB) error {
+		err := e.AutoMigrate(&models.User{}, &models.File{}, &models.ExtractTask{}, &models.FileTag{}, &models.FileProperty{},
+			&models.FileStar{}, &models.FileActivity{}, &models.ShareLink{}, &models.FileGrant{}, &models.TeamMember{},
+			&models.FileLock{}, &models.FileChange{}, &models.FileChangeCursor{}, &models.UploadPolicy{}, &models.AuditLog{},
+			&models.Webhook{}, &models.WebhookDelivery{}).Error
+		if err != nil {
+			return err
+		}
+		return models.AddFileNameUniqueIndex(e)
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	setting.CacheService.Enabled = true
+	limiter.NewContext()
+	validator.Register()
+	gin.SetMode(gin.ReleaseMode)
+	testRouter = gin.New()
+	testRouter.Use(func(c *gin.Context) {
+		ctx := &context.Context{Context: c}
+		if id := c.GetHeader("X-Test-User"); len(id) != 0 {
+			var uid uint
+			fmt.Sscan(id, &uid)
+			ctx.User, _ = models.GetUserByID(uid)
+			ctx.IsSigned = ctx.User != nil
+		}
+		c.Set(context.ContextKey, ctx)
+	})
+	RegisterRoutes(testRouter.Group("/api", context.APIContexter()))
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+var testUserCount int
+
+// newTestUser creates a user with a unique name and returns its root
+// directory.
+func newTestUser(t *testing.T) (*models.User, *models.File) {
+	testUserCount++
+	name := fmt.Sprintf("user%d", testUserCount)
+
+	u := &models.User{Username: name, Email: name + "@example.com", Password: "password", MaxFileCapacity: 1 << 20}
+	if err := models.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := models.GetUserRootFile(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, root
+}
+
+func createTestDir(t *testing.T, u *models.User, parent *models.File, name string) *models.File {
+	dir, err := models.CreateDirectory(u.ID, parent, name, models.ConflictReject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func uploadTestFile(t *testing.T, u *models.User, parent *models.File, name, content string) *models.File {
+	f, err := models.UploadFile(u, parent, name, int64(len(content)), strings.NewReader(content), models.ConflictReject, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// listNames returns the names of the entries of dir.
+func listNames(t *testing.T, dir *models.File) []string {
+	files, err := dir.ReadDir(models.ReadDirOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.FileName
+	}
+	return names
+}
+
+// testRequest is a request sent to testRouter, an empty user sends it
+// signed out.
+type testRequest struct {
+	user   *models.User
+	method string
+	url    string
+	header http.Header
+	body   io.Reader
+}
+
+func (r *testRequest) with(key, value string) *testRequest {
+	if r.header == nil {
+		r.header = make(http.Header)
+	}
+	r.header.Set(key, value)
+	return r
+}
+
+// json sends v as the JSON body of the request.
+func (r *testRequest) json(v interface{}) *testRequest {
+	data, _ := json.Marshal(v)
+	r.body = bytes.NewReader(data)
+	return r.with("Content-Type", "application/json")
+}
+
+// form sends values as an url encoded body.
+func (r *testRequest) form(values url.Values) *testRequest {
+	r.body = strings.NewReader(values.Encode())
+	return r.with("Content-Type", "application/x-www-form-urlencoded")
+}
+
+// upload sends a multipart body with the file name and the fields.
+func (r *testRequest) upload(name string, content []byte, fields map[string]string) *testRequest {
+	buf := new(bytes.Buffer)
+	w := multipart.NewWriter(buf)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	part, _ := w.CreateFormFile("upload_file", name)
+	part.Write(content)
+	w.Close()
+
+	r.body = buf
+	return r.with("Content-Type", w.FormDataContentType())
+}
+
+func (r *testRequest) do() *httptest.ResponseRecorder {
+	req := httptest.NewRequest(r.method, r.url, r.body)
+	for k := range r.header {
+		req.Header.Set(k, r.header.Get(k))
+	}
+	if r.user != nil {
+		req.Header.Set("X-Test-User", fmt.Sprint(r.user.ID))
+	}
+
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	return w
+}
+
+func request(u *models.User, method, format string, args ...interface{}) *testRequest {
+	return &testRequest{user: u, method: method, url: fmt.Sprintf(format, args...)}
+}
+
+// decodeData decodes the data of an API result into v.
+func decodeData(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	result := struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	if err := json.Unmarshal(result.Data, v); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+}
+
+// listedNames returns the names of the files listed in the data of an API
+// result in their order.
+func listedNames(t *testing.T, w *httptest.ResponseRecorder) []string {
+	files := make([]*api.File, 0)
+	decodeData(t, w, &files)
+
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.FileName
+	}
+	return names
+}
+
+// decodeNames returns the sorted names of the files listed in the data of
+// an API result.
+func decodeNames(t *testing.T, w *httptest.ResponseRecorder) []string {
+	names := listedNames(t, w)
+	sort.Strings(names)
+	return names
+}
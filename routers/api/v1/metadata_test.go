@@ -0,0 +1,137 @@
+package v1
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/czhj/ahfs/models"
+	api "github.com/czhj/ahfs/modules/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileMetadata(t *testing.T) {
+	u, root := newTestUser(t)
+	projects := createTestDir(t, u, root, "projects")
+	a := uploadTestFile(t, u, projects, "a.txt", "a")
+	b := uploadTestFile(t, u, projects, "b.txt", "b")
+	c := uploadTestFile(t, u, projects, "c.txt", "c")
+
+	setTags := func(f *models.File, tags ...string) {
+		w := request(u, "PUT", "/api/v1/files/%d/tags", f.ID).json(map[string]interface{}{"tags": tags}).do()
+		if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+			t.FailNow()
+		}
+	}
+	setProperties := func(f *models.File, properties map[string]string) {
+		w := request(u, "PUT", "/api/v1/files/%d/properties", f.ID).json(map[string]interface{}{"properties": properties}).do()
+		if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+			t.FailNow()
+		}
+	}
+
+	setTags(a, "acme", "draft")
+	setTags(a, "draft")
+	setTags(b, "acme", "final")
+	setTags(c, "globex")
+	setProperties(a, map[string]string{"client": "acme", "status": "open"})
+	setProperties(b, map[string]string{"client": "acme"})
+	setProperties(b, map[string]string{"status": "done"})
+
+	t.Run("Get", func(t *testing.T) {
+		w := request(u, "GET", "/api/v1/files/%d/metadata", b.ID).do()
+		if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+			return
+		}
+
+		var metadata api.FileMetadata
+		decodeData(t, w, &metadata)
+		assert.Equal(t, []string{"acme", "final"}, metadata.Tags)
+		assert.Equal(t, map[string]string{"client": "acme", "status": "done"}, metadata.Properties)
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		cases := []struct {
+			query string
+			names []string
+		}{
+			{"tag=acme", []string{"a.txt", "b.txt"}},
+			{"tag=acme&tag=draft", []string{"a.txt"}},
+			{"tag=missing", []string{}},
+			{"property=client=acme", []string{"a.txt", "b.txt"}},
+			{"property=status", []string{"a.txt", "b.txt"}},
+			{"property=status=done", []string{"b.txt"}},
+			{"tag=acme&property=status=open", []string{"a.txt"}},
+		}
+
+		for _, c := range cases {
+			w := request(u, "GET", "/api/v1/directory/%d?%s", projects.ID, c.query).do()
+			if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+				assert.Equal(t, c.names, decodeNames(t, w), "listing %s", c.query)
+			}
+
+			w = request(u, "GET", "/api/v1/files?%s", c.query).do()
+			if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+				assert.Equal(t, c.names, decodeNames(t, w), "search %s", c.query)
+			}
+		}
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		w := request(u, "GET", "/api/v1/tags").do()
+		if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+			return
+		}
+
+		var tags []*api.Tag
+		decodeData(t, w, &tags)
+		assert.Equal(t, []*api.Tag{{Name: "acme", Count: 2}, {Name: "draft", Count: 1}, {Name: "final", Count: 1}, {Name: "globex", Count: 1}}, tags)
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		w := request(u, "DELETE", "/api/v1/files/%d/tags/draft", a.ID).do()
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		w = request(u, "DELETE", "/api/v1/files/%d/properties/status", a.ID).do()
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		metadata, err := models.GetFileMetadata(a.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"acme"}, metadata.Tags)
+			assert.Equal(t, map[string]string{"client": "acme"}, metadata.Properties)
+		}
+
+		// tags of deleted files aren't counted
+		if err := models.DeleteFile(u.ID, c, ""); err != nil {
+			t.Fatal(err)
+		}
+		w = request(u, "GET", "/api/v1/tags").do()
+		var tags []*api.Tag
+		decodeData(t, w, &tags)
+		assert.Equal(t, []*api.Tag{{Name: "acme", Count: 2}, {Name: "final", Count: 1}}, tags)
+	})
+
+	t.Run("Permission", func(t *testing.T) {
+		other, _ := newTestUser(t)
+		if _, err := models.GrantFile(projects, other.ID, models.FilePermissionRead); err != nil {
+			t.Fatal(err)
+		}
+
+		w := request(other, "GET", "/api/v1/files/%d/metadata", a.ID).do()
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		w = request(other, "PUT", "/api/v1/files/%d/tags", a.ID).json(map[string]interface{}{"tags": []string{"x"}}).do()
+		assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+		w = request(other, "DELETE", "/api/v1/files/%d/tags/acme", a.ID).do()
+		assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		invalid := []*testRequest{
+			request(u, "PUT", "/api/v1/files/%d/tags", a.ID).json(map[string]interface{}{"tags": []string{}}),
+			request(u, "PUT", "/api/v1/files/%d/tags", a.ID).json(map[string]interface{}{"tags": []string{"  "}}),
+			request(u, "PUT", "/api/v1/files/%d/properties", a.ID).json(map[string]interface{}{"properties": map[string]string{}}),
+		}
+		for _, req := range invalid {
+			w := req.do()
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		}
+	})
+}
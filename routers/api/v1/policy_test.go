@@ -0,0 +1,200 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/setting"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/stretchr/testify/assert"
+)
+
+// resultCode returns the error code of an API result.
+func resultCode(t *testing.T, w *httptest.ResponseRecorder) ecode.ErrorCode {
+	result := struct {
+		Code ecode.ErrorCode `json:"code"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	return result.Code
+}
+
+// batchCodes returns the codes of the results of a batch request.
+func batchCodes(t *testing.T, w *httptest.ResponseRecorder) []ecode.ErrorCode {
+	results := make([]*api.FileBatchResult, 0)
+	decodeData(t, w, &results)
+
+	codes := make([]ecode.ErrorCode, len(results))
+	for i, r := range results {
+		codes[i] = ecode.ErrorCode(r.Code)
+	}
+	return codes
+}
+
+func uploadTo(u *models.User, dir *models.File, name, content string) *testRequest {
+	return request(u, "POST", "/api/v1/files").upload(name, []byte(content), map[string]string{"parent_id": fmt.Sprint(dir.ID)})
+}
+
+func TestUploadPolicy(t *testing.T) {
+	u, root := newTestUser(t)
+	other, _ := newTestUser(t)
+	dir := createTestDir(t, u, root, "docs")
+	sub := createTestDir(t, u, dir, "sub")
+	script := uploadTestFile(t, u, root, "run.sh", "echo")
+
+	policy := map[string]interface{}{"max_file_size": 5, "allowed_types": []string{".TXT", "image/*"}}
+	w := request(u, "PUT", "/api/v1/directory/%d/upload_policy", dir.ID).json(policy).do()
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+	w = request(u, "GET", "/api/v1/directory/%d/upload_policy", dir.ID).do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		var p api.UploadPolicy
+		decodeData(t, w, &p)
+		assert.Equal(t, int64(5), p.MaxFileSize)
+		assert.Equal(t, []string{".txt", "image/*"}, p.AllowedTypes)
+	}
+
+	cases := []struct {
+		name string
+		req  *testRequest
+		code ecode.ErrorCode
+	}{
+		{"allowed file", uploadTo(u, dir, "a.txt", "abc"), ecode.OK},
+		{"too large", uploadTo(u, dir, "big.txt", "abcdef"), ecode.FileTooLarge},
+		{"not allowed", uploadTo(u, dir, "b.sh", "echo"), ecode.FileTypeNotAllowed},
+		{"not allowed below", uploadTo(u, sub, "b.sh", "echo"), ecode.FileTypeNotAllowed},
+		{"outside", uploadTo(u, root, "b.sh", "echo"), ecode.OK},
+		{"move in", request(u, "PUT", "/api/v1/files/%d/directory", script.ID).json(map[string]uint{"directory_id": sub.ID}), ecode.FileTypeNotAllowed},
+		{"other user", request(other, "GET", "/api/v1/directory/%d/upload_policy", dir.ID), ecode.FileDirNotExists},
+		{"policy of a file", request(u, "GET", "/api/v1/directory/%d/upload_policy", script.ID), ecode.FileNotDirError},
+		{"negative size", request(u, "PUT", "/api/v1/directory/%d/upload_policy", dir.ID).json(map[string]int{"max_file_size": -1}), ecode.ParameterFormatError},
+	}
+	for _, c := range cases {
+		w := c.req.do()
+		assert.Equal(t, c.code, resultCode(t, w), "%s: %s", c.name, w.Body.String())
+	}
+	assert.Equal(t, []string{"a.txt", "sub"}, listNames(t, dir))
+
+	// copies are checked like uploads, moves within the directory are not
+	w = request(u, "POST", "/api/v1/files/batch").json(map[string]interface{}{
+		"mode": "best_effort",
+		"operations": []map[string]interface{}{
+			{"op": "copy", "file_id": script.ID, "directory_id": dir.ID},
+			{"op": "move", "file_id": sub.ID, "directory_id": root.ID},
+		},
+	}).do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		assert.Equal(t, []ecode.ErrorCode{ecode.FileTypeNotAllowed, ecode.OK}, batchCodes(t, w))
+	}
+
+	w = request(u, "DELETE", "/api/v1/directory/%d/upload_policy", dir.ID).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = request(u, "PUT", "/api/v1/files/%d/directory", script.ID).json(map[string]uint{"directory_id": dir.ID}).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// the policies of the server apply everywhere
+	blocked := setting.Upload.BlockedTypes
+	defer func() { setting.Upload.BlockedTypes = blocked }()
+	setting.Upload.BlockedTypes = []string{".exe"}
+	w = uploadTo(u, root, "setup.exe", "MZ").do()
+	assert.Equal(t, ecode.FileTypeNotAllowed, resultCode(t, w), w.Body.String())
+}
+
+func TestDirectoryQuota(t *testing.T) {
+	u, root := newTestUser(t)
+	dir := createTestDir(t, u, root, "quota")
+	sub := createTestDir(t, u, dir, "sub")
+	outside := uploadTestFile(t, u, root, "c.txt", "ccc")
+
+	w := request(u, "PUT", "/api/v1/directory/%d/quota", dir.ID).json(map[string]int{"quota": 5}).do()
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+	var f api.File
+	decodeData(t, w, &f)
+	assert.Equal(t, int64(5), f.Quota)
+
+	w = uploadTo(u, sub, "a.txt", "abc").do()
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+	var a api.File
+	decodeData(t, w, &a)
+
+	cases := []struct {
+		name string
+		req  *testRequest
+		code ecode.ErrorCode
+	}{
+		{"upload", uploadTo(u, dir, "b.txt", "abc"), ecode.DirQuotaExceeded},
+		{"upload below", uploadTo(u, sub, "b.txt", "abc"), ecode.DirQuotaExceeded},
+		{"move in", request(u, "PUT", "/api/v1/files/%d/directory", outside.ID).json(map[string]uint{"directory_id": dir.ID}), ecode.DirQuotaExceeded},
+		{"fits", uploadTo(u, dir, "b.txt", "ab"), ecode.OK},
+		{"zero quota", request(u, "PUT", "/api/v1/directory/%d/quota", dir.ID).json(map[string]int{"quota": 0}), ecode.ParameterFormatError},
+	}
+	for _, c := range cases {
+		w := c.req.do()
+		assert.Equal(t, c.code, resultCode(t, w), "%s: %s", c.name, w.Body.String())
+	}
+
+	w = request(u, "POST", "/api/v1/files/batch").json(map[string]interface{}{
+		"operations": []map[string]interface{}{{"op": "copy", "file_id": a.ID, "directory_id": dir.ID}},
+	}).do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		assert.Equal(t, []ecode.ErrorCode{ecode.DirQuotaExceeded}, batchCodes(t, w))
+	}
+	assert.Equal(t, []string{"b.txt", "sub"}, listNames(t, dir))
+
+	// moving files out frees the quota
+	w = request(u, "PUT", "/api/v1/files/%d/directory", a.ID).json(map[string]uint{"directory_id": root.ID}).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = uploadTo(u, sub, "d.txt", "ddd").do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = request(u, "DELETE", "/api/v1/directory/%d/quota", dir.ID).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = uploadTo(u, dir, "e.txt", "eeeeee").do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestFileCountLimit(t *testing.T) {
+	count := setting.Upload.MaxFileCount
+	defer func() { setting.Upload.MaxFileCount = count }()
+	setting.Upload.MaxFileCount = 2
+
+	u, root := newTestUser(t)
+	other, otherRoot := newTestUser(t)
+	dir := createTestDir(t, u, root, "dir")
+	a := uploadTestFile(t, u, dir, "a.txt", "a")
+	uploadTestFile(t, u, root, "b.txt", "b")
+
+	w := uploadTo(u, root, "c.txt", "c").do()
+	assert.Equal(t, ecode.FileCountLimit, resultCode(t, w), w.Body.String())
+	w = request(u, "POST", "/api/v1/files/batch").json(map[string]interface{}{
+		"operations": []map[string]interface{}{{"op": "copy", "file_id": a.ID, "directory_id": root.ID}},
+	}).do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		assert.Equal(t, []ecode.ErrorCode{ecode.FileCountLimit}, batchCodes(t, w))
+	}
+
+	// directories and moves don't count, and each user has an own limit
+	w = request(u, "POST", "/api/v1/directory").json(map[string]interface{}{"parent_id": root.ID, "directory_name": "more"}).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = request(u, "PUT", "/api/v1/files/%d/directory", a.ID).json(map[string]uint{"directory_id": root.ID}).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = uploadTo(other, otherRoot, "c.txt", "c").do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	if err := models.DeleteFile(u.ID, a, ""); err != nil {
+		t.Fatal(err)
+	}
+	w = uploadTo(u, root, "c.txt", "c").do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
@@ -0,0 +1,134 @@
+package v1
+
+import (
+	"bytes"
+	gocontext "context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/scan"
+	"github.com/czhj/ahfs/modules/setting"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/stretchr/testify/assert"
+)
+
+// testScanner finds malware in every file containing EICAR.
+type testScanner struct{}
+
+func (testScanner) Scan(ctx gocontext.Context, r io.Reader) (*scan.Result, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(content, []byte("EICAR")) {
+		return &scan.Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return &scan.Result{}, nil
+}
+
+func TestScanStatus(t *testing.T) {
+	scanner, async := scan.Default, setting.Scanner.Async
+	defer func() { scan.Default, setting.Scanner.Async = scanner, async }()
+	scan.Default = testScanner{}
+
+	// created before u, the first user of a server becomes an administrator
+	admin, _ := newTestUser(t)
+	u, root := newTestUser(t)
+	admin.IsAdmin = true
+	if err := models.SaveUser(admin); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := createTestDir(t, u, root, "scanned")
+	clean := uploadTestFile(t, u, dir, "clean.txt", "hello")
+	infected := uploadTestFile(t, u, dir, "infected.txt", "EICAR")
+	assert.Equal(t, models.FileScanClean, clean.ScanStatus)
+	assert.Equal(t, models.FileScanQuarantined, infected.ScanStatus)
+
+	// asynchronous scans leave new files to the scanner service
+	setting.Scanner.Async = true
+	pending := uploadTestFile(t, u, root, "pending.txt", "later")
+	assert.Equal(t, models.FileScanPending, pending.ScanStatus)
+
+	link := &models.ShareLink{Owner: u.ID, FileID: infected.ID}
+	if err := models.CreateShareLink(link); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		req  *testRequest
+		code int
+	}{
+		{"clean", request(u, "GET", "/api/v1/files/%d", clean.ID), http.StatusOK},
+		{"infected", request(u, "GET", "/api/v1/files/%d", infected.ID), http.StatusForbidden},
+		{"pending", request(u, "GET", "/api/v1/files/%d", pending.ID), http.StatusForbidden},
+		{"archive", request(u, "GET", "/api/v1/directory/%d/archive", dir.ID), http.StatusForbidden},
+		{"share", request(nil, "GET", "/api/v1/shares/%s/download", link.Token), http.StatusForbidden},
+		{"admin download", request(admin, "GET", "/api/v1/admin/files/%d", infected.ID), http.StatusForbidden},
+		// the information about a file stays available
+		{"info", request(u, "GET", "/api/v1/files/%d/info", infected.ID), http.StatusOK},
+	}
+	for _, c := range cases {
+		w := c.req.do()
+		if assert.Equal(t, c.code, w.Code, "%s: %s", c.name, w.Body.String()) && c.code == http.StatusForbidden {
+			assert.Equal(t, ecode.FileQuarantined, resultCode(t, w), c.name)
+		}
+	}
+
+	w := request(u, "GET", "/api/v1/admin/quarantine").do()
+	assert.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+	w = request(admin, "GET", "/api/v1/admin/quarantine").do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		files := make([]*api.File, 0)
+		decodeData(t, w, &files)
+		if assert.Len(t, files, 1) {
+			assert.Equal(t, infected.ID, files[0].ID)
+			assert.Equal(t, "Eicar-Test-Signature", files[0].ScanResult)
+		}
+	}
+	w = request(admin, "GET", "/api/v1/admin/quarantine?status=pending").do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		assert.Equal(t, []string{"pending.txt"}, listedNames(t, w))
+	}
+
+	w = request(admin, "POST", "/api/v1/admin/quarantine/%d/release", clean.ID).do()
+	assert.Equal(t, ecode.FileNotQuarantined, resultCode(t, w), w.Body.String())
+
+	w = request(admin, "POST", "/api/v1/admin/quarantine/%d/release", infected.ID).do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		var f api.File
+		decodeData(t, w, &f)
+		assert.Equal(t, string(models.FileScanReleased), f.ScanStatus)
+	}
+	w = request(u, "GET", "/api/v1/files/%d", infected.ID).do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		assert.Equal(t, "EICAR", w.Body.String())
+	}
+	w = request(u, "GET", "/api/v1/directory/%d/archive", dir.ID).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// releasing twice is no release
+	w = request(admin, "POST", "/api/v1/admin/quarantine/%d/release", infected.ID).do()
+	assert.Equal(t, ecode.FileNotQuarantined, resultCode(t, w), w.Body.String())
+
+	w = request(admin, "DELETE", "/api/v1/admin/quarantine/%d", pending.ID).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	_, err := models.GetFileByID(pending.ID, u.ID)
+	assert.True(t, models.IsErrFileNotExist(err), "%v", err)
+
+	logs, _, err := models.SearchAuditLogs(&models.SearchAuditLogOptions{Actions: []models.AuditAction{models.AuditFileQuarantine, models.AuditFileRelease}})
+	if assert.NoError(t, err) {
+		actions := make([]models.AuditAction, 0, len(logs))
+		for _, l := range logs {
+			if l.TargetID == infected.ID {
+				actions = append(actions, l.Action)
+			}
+		}
+		assert.ElementsMatch(t, []models.AuditAction{models.AuditFileQuarantine, models.AuditFileRelease}, actions)
+	}
+}
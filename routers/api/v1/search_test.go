@@ -0,0 +1,60 @@
+package v1
+
+import (
+	"net/http"
+	"sort"
+	"testing"
+
+	api "github.com/czhj/ahfs/modules/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchFiles(t *testing.T) {
+	u, root := newTestUser(t)
+	reports := createTestDir(t, u, root, "reports")
+	uploadTestFile(t, u, reports, "report-2020.txt", "2020")
+	uploadTestFile(t, u, reports, "report-2021.csv", "2021-data")
+	uploadTestFile(t, u, root, "notes.txt", "notes")
+
+	other, otherRoot := newTestUser(t)
+	uploadTestFile(t, other, otherRoot, "report-other.txt", "other")
+
+	cases := []struct {
+		query string
+		names []string
+	}{
+		{"q=report&match=substring", []string{"report-2020.txt", "report-2021.csv", "reports"}},
+		{"q=report&match=prefix&type=file", []string{"report-2020.txt", "report-2021.csv"}},
+		{"q=report*.txt&match=glob", []string{"report-2020.txt"}},
+		{"ext=txt", []string{"notes.txt", "report-2020.txt"}},
+		{"min_size=5", []string{"notes.txt", "report-2021.csv"}},
+		{"type=dir", []string{"reports"}},
+		{"path=/reports&q=2021&match=substring", []string{"report-2021.csv"}},
+	}
+
+	for _, c := range cases {
+		w := request(u, "GET", "/api/v1/files?%s", c.query).do()
+		if !assert.Equal(t, http.StatusOK, w.Code, c.query) {
+			continue
+		}
+
+		files := make([]*api.File, 0)
+		decodeData(t, w, &files)
+		names := make([]string, len(files))
+		for i, f := range files {
+			names[i] = f.FileName
+		}
+		sort.Strings(names)
+		assert.Equal(t, c.names, names, c.query)
+	}
+
+	w := request(u, "GET", "/api/v1/files?match=regexp").do()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request(nil, "GET", "/api/v1/files?q=report").do()
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// "search" is no file id
+	w = request(u, "GET", "/api/v1/files/search?q=report").do()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
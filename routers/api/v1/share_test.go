@@ -0,0 +1,146 @@
+package v1
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	api "github.com/czhj/ahfs/modules/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestShareLink shares f with the given password through the API
+// and returns the token of the link.
+func createTestShareLink(t *testing.T, u *models.User, f *models.File, password string, maxDownloads int64) string {
+	w := request(u, "POST", "/api/v1/current_user/shares").json(map[string]interface{}{
+		"file_id":       f.ID,
+		"password":      password,
+		"max_downloads": maxDownloads,
+	}).do()
+	if w.Code != http.StatusOK {
+		t.Fatalf("create share link: %d %s", w.Code, w.Body.String())
+	}
+
+	link := &api.ShareLink{}
+	decodeData(t, w, link)
+	return link.Token
+}
+
+func TestSharePassword(t *testing.T) {
+	u, root := newTestUser(t)
+	f := uploadTestFile(t, u, root, "secret.txt", "secret")
+	token := createTestShareLink(t, u, f, "pa ss", 0)
+
+	cases := []struct {
+		desc string
+		req  *testRequest
+		code int
+	}{
+		{"no password", request(nil, "GET", "/api/v1/shares/%s", token), http.StatusForbidden},
+		{"header", request(nil, "GET", "/api/v1/shares/%s", token).with("X-Share-Password", "pa ss"), http.StatusOK},
+		{"wrong header", request(nil, "GET", "/api/v1/shares/%s", token).with("X-Share-Password", "pass"), http.StatusForbidden},
+		{"query", request(nil, "GET", "/api/v1/shares/%s?password=pa+ss", token), http.StatusForbidden},
+		{"form", request(nil, "POST", "/api/v1/shares/%s", token).form(url.Values{"password": {"pa ss"}}), http.StatusOK},
+		{"json", request(nil, "POST", "/api/v1/shares/%s/download", token).json(map[string]string{"password": "pa ss"}), http.StatusOK},
+		{"wrong json", request(nil, "POST", "/api/v1/shares/%s/download", token).json(map[string]string{"password": "x"}), http.StatusForbidden},
+		{"unknown token", request(nil, "GET", "/api/v1/shares/%s", "nope"), http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		w := c.req.do()
+		assert.Equal(t, c.code, w.Code, "%s: %s", c.desc, w.Body.String())
+	}
+}
+
+func TestShareLimits(t *testing.T) {
+	u, root := newTestUser(t)
+	f := uploadTestFile(t, u, root, "f.txt", "content")
+	token := createTestShareLink(t, u, f, "", 2)
+
+	for i := 0; i < 2; i++ {
+		w := request(nil, "GET", "/api/v1/shares/%s/download", token).do()
+		if assert.Equal(t, http.StatusOK, w.Code) {
+			assert.Equal(t, "content", w.Body.String())
+		}
+	}
+
+	w := request(nil, "GET", "/api/v1/shares/%s/download", token).do()
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// the link itself is still readable
+	w = request(nil, "GET", "/api/v1/shares/%s", token).do()
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	past := time.Now().Add(-time.Minute)
+	w = request(u, "POST", "/api/v1/current_user/shares").json(map[string]interface{}{"file_id": f.ID, "expires_at": past}).do()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	link := &models.ShareLink{Owner: u.ID, FileID: f.ID, ExpiresAt: &past}
+	if err := models.CreateShareLink(link); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"", "/files", "/download"} {
+		w = request(nil, "GET", "/api/v1/shares/%s%s", link.Token, p).do()
+		assert.Equal(t, http.StatusGone, w.Code, p)
+	}
+
+	// links end with their file
+	if err := models.DeleteFile(u.ID, f, ""); err != nil {
+		t.Fatal(err)
+	}
+	w = request(nil, "GET", "/api/v1/shares/%s", token).do()
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSharedDirectory(t *testing.T) {
+	u, root := newTestUser(t)
+	parent := createTestDir(t, u, root, "private")
+	dir := createTestDir(t, u, parent, "shared")
+	sub := createTestDir(t, u, dir, "sub")
+	uploadTestFile(t, u, dir, "a.txt", "a")
+	uploadTestFile(t, u, sub, "b.txt", "b")
+	token := createTestShareLink(t, u, dir, "", 0)
+
+	link := &api.ShareLink{}
+	decodeData(t, request(nil, "GET", "/api/v1/shares/%s", token).do(), link)
+	if assert.NotNil(t, link.File) {
+		assert.Equal(t, api.File{FileName: "shared", FileDir: "/", IsDir: true}, api.File{FileName: link.File.FileName, FileDir: link.File.FileDir, IsDir: link.File.IsDir})
+		assert.Equal(t, []uint{0, 0, 0}, []uint{link.File.ID, link.File.ParentID, link.File.Owner})
+	}
+
+	cases := []struct {
+		path    string
+		names   []string
+		parents []uint
+	}{
+		{"", []string{"sub", "a.txt"}, []uint{0, 0}},
+		{"/sub", []string{"b.txt"}, []uint{sub.ID}},
+	}
+
+	for _, c := range cases {
+		w := request(nil, "GET", "/api/v1/shares/%s/files?path=%s", token, c.path).do()
+		if !assert.Equal(t, http.StatusOK, w.Code, c.path) {
+			continue
+		}
+
+		files := make([]*api.File, 0)
+		decodeData(t, w, &files)
+		names, parents := make([]string, len(files)), make([]uint, len(files))
+		for i, f := range files {
+			names[i], parents[i] = f.FileName, f.ParentID
+			assert.Zero(t, f.Owner, f.FileName)
+		}
+		assert.Equal(t, c.names, names, c.path)
+		assert.Equal(t, c.parents, parents, c.path)
+	}
+
+	// paths can't leave the shared directory
+	w := request(nil, "GET", "/api/v1/shares/%s/files?path=../", token).do()
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		files := make([]*api.File, 0)
+		decodeData(t, w, &files)
+		assert.Len(t, files, 2)
+	}
+}
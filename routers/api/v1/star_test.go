@@ -0,0 +1,106 @@
+package v1
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStarredFiles(t *testing.T) {
+	u, root := newTestUser(t)
+	dir := createTestDir(t, u, root, "dir")
+	a := uploadTestFile(t, u, dir, "a.txt", "a")
+	b := uploadTestFile(t, u, root, "b.txt", "b")
+
+	other, otherRoot := newTestUser(t)
+	shared := uploadTestFile(t, other, otherRoot, "shared.txt", "s")
+	private := uploadTestFile(t, other, otherRoot, "private.txt", "p")
+	if _, err := models.GrantFile(shared, u.ID, models.FilePermissionRead); err != nil {
+		t.Fatal(err)
+	}
+
+	// starring twice keeps the file once
+	for _, id := range []uint{a.ID, dir.ID, shared.ID, b.ID, a.ID} {
+		w := request(u, "PUT", "/api/v1/files/%d/star", id).do()
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	w := request(u, "PUT", "/api/v1/files/%d/star", private.ID).do()
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	w = request(u, "GET", "/api/v1/current_user/starred").do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		assert.Equal(t, []string{"b.txt", "shared.txt", "dir", "a.txt"}, listedNames(t, w))
+		assert.Equal(t, "4", w.Header().Get("X-Total-Count"))
+	}
+
+	w = request(u, "GET", "/api/v1/current_user/starred?page=2&limit=3").do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		assert.Equal(t, []string{"a.txt"}, listedNames(t, w))
+		assert.Equal(t, "4", w.Header().Get("X-Total-Count"))
+	}
+
+	// stars are per user
+	w = request(other, "GET", "/api/v1/current_user/starred").do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		assert.Empty(t, listedNames(t, w))
+	}
+
+	w = request(u, "DELETE", "/api/v1/files/%d/star", shared.ID).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	if err := models.DeleteFile(u.ID, dir, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// deleted files drop out of the listing together with their content
+	w = request(u, "GET", "/api/v1/current_user/starred").do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		assert.Equal(t, []string{"b.txt"}, listedNames(t, w))
+		assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+	}
+}
+
+func TestRecentFiles(t *testing.T) {
+	u, root := newTestUser(t)
+	a := uploadTestFile(t, u, root, "a.txt", "a")
+	uploadTestFile(t, u, root, "b.txt", "b")
+	c := uploadTestFile(t, u, root, "c.txt", "c")
+
+	w := request(u, "GET", "/api/v1/files/%d", a.ID).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = request(u, "PUT", "/api/v1/files/%d/name", c.ID).json(map[string]string{"filename": "d.txt"}).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	cases := []struct {
+		query string
+		names []string
+	}{
+		{"", []string{"d.txt", "a.txt", "b.txt"}},
+		{"?limit=2", []string{"d.txt", "a.txt"}},
+		{"?type=upload", []string{"b.txt"}},
+		{"?type=download", []string{"a.txt"}},
+		{"?type=modify", []string{"d.txt"}},
+	}
+	for _, c := range cases {
+		w := request(u, "GET", "/api/v1/current_user/recent%s", c.query).do()
+		if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+			assert.Equal(t, c.names, listedNames(t, w), c.query)
+		}
+	}
+
+	w = request(u, "GET", "/api/v1/current_user/recent?type=view").do()
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	// downloads of files shared with the user count as theirs
+	other, _ := newTestUser(t)
+	if _, err := models.GrantFile(a, other.ID, models.FilePermissionRead); err != nil {
+		t.Fatal(err)
+	}
+	w = request(other, "GET", "/api/v1/files/%d", a.ID).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = request(other, "GET", "/api/v1/current_user/recent").do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		assert.Equal(t, []string{"a.txt"}, listedNames(t, w))
+	}
+}
@@ -0,0 +1,249 @@
+package team
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+)
+
+// getTeam returns the team given by the team_id parameter if the current
+// user is a member with at least role, teams of others don't exist.
+func getTeam(c *context.APIContext, role models.TeamRole) (*models.User, *models.TeamMember, bool) {
+	teamID, err := strconv.ParseUint(c.Param("team_id"), 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return nil, nil, false
+	}
+
+	team, err := models.GetTeamByID(uint(teamID))
+	if err != nil {
+		if models.IsErrTeamNotExist(err) {
+			c.NotFound(ecode.TeamNotExist, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return nil, nil, false
+	}
+
+	member, err := models.GetTeamMember(team.ID, c.User.ID)
+	if err != nil {
+		if models.IsErrTeamMemberNotExist(err) {
+			c.NotFound(ecode.TeamNotExist, models.ErrTeamNotExist{ID: team.ID})
+		} else {
+			c.InternalServerError(err)
+		}
+		return nil, nil, false
+	}
+
+	if member.Role < role {
+		c.Error(http.StatusForbidden, ecode.PermissionDenied, fmt.Errorf("team role %s is required", role))
+		return nil, nil, false
+	}
+	return team, member, true
+}
+
+func toTeam(c *context.APIContext, team *models.User, role models.TeamRole) (*api.Team, bool) {
+	root, err := models.GetUserRootFile(team.ID)
+	if err != nil {
+		c.InternalServerError(err)
+		return nil, false
+	}
+	return convert.ToTeam(team, role, root.ID), true
+}
+
+func CreateTeam(c *context.APIContext) {
+	form := &api.CreateTeamOption{}
+	if err := c.ShouldBind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	team := &models.User{
+		Username: form.Name,
+		Nickname: form.Nickname,
+	}
+
+	if err := models.CreateTeam(team, c.User); err != nil {
+		if models.IsErrUsernameAlreadyUsed(err) {
+			c.Error(http.StatusBadRequest, ecode.UsernameAlreadyExists, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	result, ok := toTeam(c, team, models.TeamRoleOwner)
+	if !ok {
+		return
+	}
+	c.OK(result)
+}
+
+func ListTeams(c *context.APIContext) {
+	members, err := models.GetUserTeams(c.User.ID)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	result := make([]*api.Team, 0, len(members))
+	for _, member := range members {
+		if member.Team == nil {
+			continue
+		}
+
+		team, ok := toTeam(c, member.Team, member.Role)
+		if !ok {
+			return
+		}
+		result = append(result, team)
+	}
+	c.OK(result)
+}
+
+func GetTeam(c *context.APIContext) {
+	team, member, ok := getTeam(c, models.TeamRoleViewer)
+	if !ok {
+		return
+	}
+
+	result, ok := toTeam(c, team, member.Role)
+	if !ok {
+		return
+	}
+	c.OK(result)
+}
+
+func EditTeam(c *context.APIContext) {
+	team, member, ok := getTeam(c, models.TeamRoleOwner)
+	if !ok {
+		return
+	}
+
+	form := &api.EditTeamOption{}
+	if err := c.ShouldBind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	team.Nickname = form.Nickname
+	if err := models.UpdateTeam(team); err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	result, ok := toTeam(c, team, member.Role)
+	if !ok {
+		return
+	}
+	c.OK(result)
+}
+
+func DeleteTeam(c *context.APIContext) {
+	team, _, ok := getTeam(c, models.TeamRoleOwner)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteTeam(team); err != nil {
+		c.InternalServerError(err)
+		return
+	}
+	c.OK(nil)
+}
+
+func ListMembers(c *context.APIContext) {
+	team, _, ok := getTeam(c, models.TeamRoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := models.GetTeamMembers(team.ID)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	result := make([]*api.TeamMember, len(members))
+	for i := range members {
+		result[i] = convert.ToTeamMember(members[i])
+	}
+	c.OK(result)
+}
+
+func SetMember(c *context.APIContext) {
+	team, _, ok := getTeam(c, models.TeamRoleOwner)
+	if !ok {
+		return
+	}
+
+	form := &api.SetTeamMemberOption{}
+	if err := c.ShouldBind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	user, err := models.GetUserByUsername(form.Username)
+	if err == nil && user.IsTeam() {
+		err = models.ErrUserNotExist{Username: form.Username}
+	}
+	if err != nil {
+		if models.IsErrUserNotExist(err) {
+			c.NotFound(ecode.UsernameNotFound, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	member, err := models.SetTeamMember(team.ID, user.ID, models.ParseTeamRole(form.Role))
+	if err != nil {
+		if models.IsErrTeamLastOwner(err) {
+			c.Error(http.StatusBadRequest, ecode.TeamLastOwner, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+	member.User = user
+
+	c.OK(convert.ToTeamMember(member))
+}
+
+// RemoveMember removes a member from the team, owners may remove anyone and
+// every member may leave the team.
+func RemoveMember(c *context.APIContext) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	role := models.TeamRoleOwner
+	if uint(userID) == c.User.ID {
+		role = models.TeamRoleViewer
+	}
+
+	team, _, ok := getTeam(c, role)
+	if !ok {
+		return
+	}
+
+	if err := models.RemoveTeamMember(team.ID, uint(userID)); err != nil {
+		if models.IsErrTeamMemberNotExist(err) {
+			c.NotFound(ecode.TeamMemberNotExist, err)
+		} else if models.IsErrTeamLastOwner(err) {
+			c.Error(http.StatusBadRequest, ecode.TeamLastOwner, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+	c.OK(nil)
+}
@@ -0,0 +1,105 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/setting"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeamDrive(t *testing.T) {
+	capacity := setting.Service.TeamMaxFileCapacitySize
+	defer func() { setting.Service.TeamMaxFileCapacitySize = capacity }()
+	setting.Service.TeamMaxFileCapacitySize = 10
+
+	owner, _ := newTestUser(t)
+	editor, _ := newTestUser(t)
+	viewer, _ := newTestUser(t)
+	outsider, _ := newTestUser(t)
+
+	w := request(owner, "POST", "/api/v1/teams").json(map[string]string{"name": "teamdrive"}).do()
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+	var team api.Team
+	decodeData(t, w, &team)
+	assert.Equal(t, "owner", team.Role)
+	assert.Equal(t, int64(10), team.MaxFileCapacity)
+
+	for _, m := range []struct {
+		user *models.User
+		role string
+	}{{editor, "editor"}, {viewer, "viewer"}} {
+		w := request(owner, "PUT", "/api/v1/teams/%d/members", team.ID).json(map[string]string{"username": m.user.Username, "role": m.role}).do()
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	upload := func(u *models.User, name, content string) *testRequest {
+		return request(u, "POST", "/api/v1/files").upload(name, []byte(content), map[string]string{"parent_id": fmt.Sprint(team.RootFileID)})
+	}
+
+	w = upload(editor, "plan.txt", "plan").do()
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+	var plan api.File
+	decodeData(t, w, &plan)
+	assert.Equal(t, team.ID, plan.Owner)
+
+	// the team pays for its files, not the uploader
+	u, err := models.GetUserByID(editor.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(0), u.UsedFileCapacity)
+	}
+	w = upload(editor, "big.txt", strings.Repeat("x", 7)).do()
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	cases := []struct {
+		name string
+		req  *testRequest
+		code int
+	}{
+		{"viewer reads", request(viewer, "GET", "/api/v1/files/%d", plan.ID), http.StatusOK},
+		{"viewer lists", request(viewer, "GET", "/api/v1/directory/%d", team.RootFileID), http.StatusOK},
+		{"viewer uploads", upload(viewer, "notes.txt", "n"), http.StatusForbidden},
+		{"viewer renames", request(viewer, "PUT", "/api/v1/files/%d/name", plan.ID).json(map[string]string{"filename": "x.txt"}), http.StatusForbidden},
+		{"viewer adds members", request(viewer, "PUT", "/api/v1/teams/%d/members", team.ID).json(map[string]string{"username": outsider.Username, "role": "viewer"}), http.StatusForbidden},
+		{"editor renames", request(editor, "PUT", "/api/v1/files/%d/name", plan.ID).json(map[string]string{"filename": "roadmap.txt"}), http.StatusOK},
+		{"editor edits the team", request(editor, "PATCH", "/api/v1/teams/%d", team.ID).json(map[string]string{"nickname": "Drive"}), http.StatusForbidden},
+		{"outsider reads", request(outsider, "GET", "/api/v1/files/%d/info", plan.ID), http.StatusNotFound},
+		{"outsider gets the team", request(outsider, "GET", "/api/v1/teams/%d", team.ID), http.StatusNotFound},
+		{"outsider leaves", request(outsider, "DELETE", "/api/v1/teams/%d/members/%d", team.ID, outsider.ID), http.StatusNotFound},
+		{"viewer leaves", request(viewer, "DELETE", "/api/v1/teams/%d/members/%d", team.ID, viewer.ID), http.StatusOK},
+		{"former viewer reads", request(viewer, "GET", "/api/v1/files/%d/info", plan.ID), http.StatusNotFound},
+	}
+	for _, c := range cases {
+		w := c.req.do()
+		assert.Equal(t, c.code, w.Code, "%s: %s", c.name, w.Body.String())
+	}
+
+	lastOwner := []*testRequest{
+		request(owner, "DELETE", "/api/v1/teams/%d/members/%d", team.ID, owner.ID),
+		request(owner, "PUT", "/api/v1/teams/%d/members", team.ID).json(map[string]string{"username": owner.Username, "role": "editor"}),
+	}
+	for _, req := range lastOwner {
+		w := req.do()
+		if assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String()) {
+			assert.Contains(t, w.Body.String(), fmt.Sprint(ecode.TeamLastOwner))
+		}
+	}
+
+	// a team is no member of teams
+	w = request(owner, "PUT", "/api/v1/teams/%d/members", team.ID).json(map[string]string{"username": "teamdrive", "role": "viewer"}).do()
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	w = request(owner, "DELETE", "/api/v1/teams/%d", team.ID).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = request(editor, "GET", "/api/v1/teams/%d", team.ID).do()
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+}
@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadExtractSharedDirectory(t *testing.T) {
+	owner, root := newTestUser(t)
+	dir := createTestDir(t, owner, root, "shared")
+
+	writer, _ := newTestUser(t)
+	reader, _ := newTestUser(t)
+	if _, err := models.GrantFile(dir, writer.ID, models.FilePermissionWrite); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.GrantFile(dir, reader.ID, models.FilePermissionRead); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := zipArchive(t, map[string]string{"docs/a.txt": "a", "b.txt": "bb"})
+	fields := map[string]string{"parent_id": fmt.Sprint(dir.ID), "extract": "true"}
+
+	w := request(reader, "POST", "/api/v1/files").upload("a.zip", archive, fields).do()
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	w = request(writer, "POST", "/api/v1/files").upload("a.zip", archive, fields).do()
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+
+	// the entries belong to the owner of the directory, the archive is gone
+	files, err := dir.ReadDir(models.ReadDirOption{})
+	assert.NoError(t, err)
+	for _, f := range files {
+		assert.Equal(t, owner.ID, f.Owner, f.FileName)
+	}
+	assert.Equal(t, []string{"b.txt", "docs"}, listNames(t, dir))
+}
@@ -6,9 +6,11 @@ import (
 	"mime/multipart"
 	"net/http"
 
+	"github.com/czhj/ahfs/models"
 	"github.com/czhj/ahfs/modules/context"
 	"github.com/czhj/ahfs/modules/setting"
 	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/services/webhook"
 )
 
 type updateAvatarForm struct {
@@ -47,5 +49,7 @@ func UpdateAvatar(c *context.APIContext) {
 		return
 	}
 
+	webhook.NotifyAccount(models.WebhookEventAccountUpdate, user)
+
 	c.OK(nil)
 }
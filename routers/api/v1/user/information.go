@@ -6,6 +6,7 @@ import (
 	"github.com/czhj/ahfs/models"
 	"github.com/czhj/ahfs/modules/context"
 	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/services/webhook"
 )
 
 type EditUserOption struct {
@@ -30,5 +31,6 @@ func EditUser(c *context.APIContext) {
 		return
 	}
 
+	webhook.NotifyAccount(models.WebhookEventAccountUpdate, user)
 	c.OK(nil)
 }
@@ -10,7 +10,9 @@ import (
 	"github.com/czhj/ahfs/modules/context"
 	"github.com/czhj/ahfs/modules/convert"
 	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
 	"github.com/czhj/ahfs/services/mailer"
+	"github.com/czhj/ahfs/services/webhook"
 )
 
 type RequestResetPwdCodeForm struct {
@@ -89,6 +91,10 @@ func ResetPasswordPost(c *context.APIContext) {
 		return
 	}
 
+	audit := models.NewUserAuditLog(models.AuditPasswordReset, user)
+	audit.ActorID, audit.ActorName = user.ID, user.Username
+	utils.Audit(c, audit, nil, nil)
+	webhook.NotifyAccount(models.WebhookEventAccountUpdate, user)
 	code.RemoveEmailResetPwdCode(form.Email, form.Code)
 
 	if err := models.DeleteAuthTokenByUserID(user.ID); err != nil {
@@ -131,5 +137,7 @@ func EditUserPassword(c *context.APIContext) {
 		return
 	}
 
+	utils.Audit(c, models.NewUserAuditLog(models.AuditPasswordChange, user), nil, nil)
+	webhook.NotifyAccount(models.WebhookEventAccountUpdate, user)
 	c.OK(nil)
 }
@@ -17,6 +17,7 @@ import (
 	"github.com/czhj/ahfs/modules/setting"
 	api "github.com/czhj/ahfs/modules/structs"
 	"github.com/czhj/ahfs/services/mailer"
+	"github.com/czhj/ahfs/services/webhook"
 
 	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
 	"github.com/czhj/ahfs/routers/api/v1/utils"
@@ -33,6 +34,11 @@ func SignInPost(c *context.APIContext) {
 	user, err := models.UserSignIn(form.Username, form.Password)
 	if err != nil {
 		if models.IsErrUserNotExist(err) {
+			utils.Audit(c, &models.AuditLog{
+				Action:     models.AuditSignInFailed,
+				TargetType: models.AuditTargetUser,
+				TargetName: form.Username,
+			}, nil, nil)
 			c.Error(http.StatusNotFound, ecode.IncorrectUserNameOrPwd, err)
 		} else {
 			c.InternalServerError(err)
@@ -46,6 +52,10 @@ func SignInPost(c *context.APIContext) {
 		return
 	}
 
+	audit := models.NewUserAuditLog(models.AuditSignIn, user)
+	audit.ActorID, audit.ActorName = user.ID, user.Username
+	utils.Audit(c, audit, nil, nil)
+
 	result := convert.ToToken(authToken)
 	c.OK(result)
 
@@ -120,6 +130,10 @@ func SignUpPost(c *context.APIContext) {
 		return
 	}
 
+	audit := models.NewUserAuditLog(models.AuditSignUp, user)
+	audit.ActorID, audit.ActorName = user.ID, user.Username
+	utils.Audit(c, audit, nil, nil)
+	webhook.NotifyAccount(models.WebhookEventAccountCreate, user)
 	code.RemoveEmailActiveCode(form.Email, form.EmailVerifyCode)
 	authToken := &models.AuthToken{UserID: user.ID}
 	if err := models.CreateAuthToken(authToken); err != nil {
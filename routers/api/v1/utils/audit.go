@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+)
+
+// Audit appends l to the audit trail with the client address and, unless
+// l names its actor already, the current user as actor, see
+// models.RecordAuditLog.
+func Audit(c *context.APIContext, l *models.AuditLog, before, after interface{}) {
+	if l.ActorID == 0 && c.User != nil {
+		l.ActorID, l.ActorName = c.User.ID, c.User.Username
+	}
+	l.IP = c.ClientIP()
+	models.RecordAuditLog(l, before, after)
+}
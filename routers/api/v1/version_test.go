@@ -0,0 +1,77 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIfMatch(t *testing.T) {
+	u, root := newTestUser(t)
+	dir := createTestDir(t, u, root, "dir")
+	dst := createTestDir(t, u, root, "dst")
+	f := uploadTestFile(t, u, dir, "f.txt", "f")
+
+	w := request(u, "GET", "/api/v1/files/%d/info", f.ID).do()
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+	stale := w.Header().Get("ETag")
+	assert.Equal(t, f.ETag(), stale)
+
+	// the file changes under the client
+	uploadTestFile(t, u, dir, "g.txt", "g")
+	w = request(u, "PUT", "/api/v1/files/%d/name", f.ID).json(map[string]string{"filename": "h.txt"}).do()
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+
+	w = request(u, "GET", "/api/v1/files/%d/info", f.ID).do()
+	current := w.Header().Get("ETag")
+	assert.NotEqual(t, stale, current)
+
+	preconditions := []*testRequest{
+		request(u, "PUT", "/api/v1/files/%d/name", f.ID).json(map[string]string{"filename": "i.txt"}),
+		request(u, "PUT", "/api/v1/files/%d/directory", f.ID).json(map[string]interface{}{"directory_id": dst.ID}),
+		request(u, "DELETE", "/api/v1/files/%d", f.ID),
+		request(u, "POST", "/api/v1/files").upload("h.txt", []byte("new"), map[string]string{"parent_id": fmt.Sprint(dir.ID), "conflict": "overwrite"}),
+		request(u, "PUT", "/api/v1/fs/dir/h.txt").with("Content-Type", "text/plain"),
+		request(u, "DELETE", "/api/v1/fs/dir/h.txt"),
+		request(u, "MOVE", "/api/v1/fs/dir/h.txt").with("Destination", "/dst/h.txt"),
+	}
+	for _, req := range preconditions {
+		w := req.with("If-Match", stale).do()
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, "%s %s: %s", req.method, req.url, w.Body.String())
+	}
+	assert.Equal(t, []string{"g.txt", "h.txt"}, listNames(t, dir))
+
+	w = request(u, "POST", "/api/v1/files/batch").json(map[string]interface{}{
+		"operations": []map[string]interface{}{{"op": "delete", "file_id": f.ID, "if_match": stale}},
+	}).do()
+	if assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		var results []*api.FileBatchResult
+		decodeData(t, w, &results)
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, int(ecode.FileModified), results[0].Code)
+		}
+	}
+
+	w = request(u, "PUT", "/api/v1/files/%d/name", f.ID).with("If-Match", current).json(map[string]string{"filename": "i.txt"}).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// renaming changed the version again
+	w = request(u, "PUT", "/api/v1/files/%d/directory", f.ID).with("If-Match", current).json(map[string]interface{}{"directory_id": dst.ID}).do()
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code, w.Body.String())
+
+	// a list of tags matches any of them, * matches every version
+	w = request(u, "GET", "/api/v1/files/%d/info", f.ID).do()
+	renamed := w.Header().Get("ETag")
+	w = request(u, "PUT", "/api/v1/files/%d/directory", f.ID).with("If-Match", stale+", "+renamed).json(map[string]interface{}{"directory_id": dst.ID}).do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = request(u, "DELETE", "/api/v1/files/%d", f.ID).with("If-Match", "*").do()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
@@ -0,0 +1,311 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/context"
+	"github.com/czhj/ahfs/modules/convert"
+	api "github.com/czhj/ahfs/modules/structs"
+	ecode "github.com/czhj/ahfs/routers/api/v1/errcode"
+	"github.com/czhj/ahfs/routers/api/v1/utils"
+	webhook_service "github.com/czhj/ahfs/services/webhook"
+)
+
+// The handlers come in pairs, the first one manages the webhooks of the
+// current user and the System one the system webhooks, which receive the
+// events of every user.
+
+func CreateHook(c *context.APIContext) {
+	createHook(c, c.User.ID)
+}
+
+func CreateSystemHook(c *context.APIContext) {
+	createHook(c, 0)
+}
+
+func ListHooks(c *context.APIContext) {
+	listHooks(c, c.User.ID)
+}
+
+func ListSystemHooks(c *context.APIContext) {
+	listHooks(c, 0)
+}
+
+func GetHook(c *context.APIContext) {
+	getHookInfo(c, c.User.ID)
+}
+
+func GetSystemHook(c *context.APIContext) {
+	getHookInfo(c, 0)
+}
+
+func EditHook(c *context.APIContext) {
+	editHook(c, c.User.ID)
+}
+
+func EditSystemHook(c *context.APIContext) {
+	editHook(c, 0)
+}
+
+func DeleteHook(c *context.APIContext) {
+	deleteHook(c, c.User.ID)
+}
+
+func DeleteSystemHook(c *context.APIContext) {
+	deleteHook(c, 0)
+}
+
+func ListDeliveries(c *context.APIContext) {
+	listDeliveries(c, c.User.ID)
+}
+
+func ListSystemDeliveries(c *context.APIContext) {
+	listDeliveries(c, 0)
+}
+
+func Redeliver(c *context.APIContext) {
+	redeliver(c, c.User.ID)
+}
+
+func RedeliverSystem(c *context.APIContext) {
+	redeliver(c, 0)
+}
+
+func getHook(c *context.APIContext, owner uint) (*models.Webhook, bool) {
+	hookID, err := strconv.ParseUint(c.Param("webhook_id"), 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return nil, false
+	}
+
+	hook, err := models.GetWebhook(uint(hookID), owner)
+	if err != nil {
+		if models.IsErrWebhookNotExist(err) {
+			c.NotFound(ecode.WebhookNotExist, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return nil, false
+	}
+	return hook, true
+}
+
+func checkEnabled(c *context.APIContext) bool {
+	if !webhook_service.IsEnabled() {
+		c.Error(http.StatusNotFound, ecode.FeatureDisabled, fmt.Errorf("webhooks are disabled"))
+		return false
+	}
+	return true
+}
+
+func validEvents(events []string) error {
+	for _, event := range events {
+		if !models.IsValidWebhookEvent(event) {
+			return fmt.Errorf("unknown webhook event %q", event)
+		}
+	}
+	return nil
+}
+
+func cleanPathPrefix(prefix string) string {
+	if len(prefix) == 0 {
+		return ""
+	}
+	return path.Clean("/" + prefix)
+}
+
+func createHook(c *context.APIContext, owner uint) {
+	if !checkEnabled(c) {
+		return
+	}
+
+	form := &api.CreateWebhookOption{}
+	if err := c.ShouldBind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	if err := webhook_service.CheckURL(form.URL); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	if err := validEvents(form.Events); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	hook := &models.Webhook{
+		Owner:      owner,
+		URL:        form.URL,
+		Secret:     form.Secret,
+		PathPrefix: cleanPathPrefix(form.PathPrefix),
+		IsActive:   form.IsActive == nil || *form.IsActive,
+	}
+	hook.SetEventList(form.Events)
+
+	if err := models.CreateWebhook(hook); err != nil {
+		c.InternalServerError(err)
+		return
+	}
+	c.OK(convert.ToWebhook(hook))
+}
+
+func listHooks(c *context.APIContext, owner uint) {
+	listOptions := utils.GetListOptions(c)
+	if listOptions.Page <= 0 {
+		listOptions.Page = 1
+	}
+
+	hooks, maxResult, err := models.GetWebhooks(owner, listOptions)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	result := make([]*api.Webhook, len(hooks))
+	for i := range hooks {
+		result[i] = convert.ToWebhook(hooks[i])
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(maxResult, 10))
+	c.Header("Access-Control-Expose-Headers", "X-Total-Count")
+	c.OK(result)
+}
+
+func getHookInfo(c *context.APIContext, owner uint) {
+	hook, ok := getHook(c, owner)
+	if !ok {
+		return
+	}
+	c.OK(convert.ToWebhook(hook))
+}
+
+func editHook(c *context.APIContext, owner uint) {
+	hook, ok := getHook(c, owner)
+	if !ok {
+		return
+	}
+
+	form := &api.EditWebhookOption{}
+	if err := c.ShouldBind(form); err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	if form.URL != nil {
+		if err := webhook_service.CheckURL(*form.URL); err != nil {
+			c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+			return
+		}
+		hook.URL = *form.URL
+	}
+
+	if form.Events != nil {
+		if err := validEvents(form.Events); err != nil {
+			c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+			return
+		}
+		hook.SetEventList(form.Events)
+	}
+
+	if form.Secret != nil {
+		hook.Secret = *form.Secret
+	}
+
+	if form.PathPrefix != nil {
+		hook.PathPrefix = cleanPathPrefix(*form.PathPrefix)
+	}
+
+	if form.IsActive != nil {
+		hook.IsActive = *form.IsActive
+	}
+
+	if err := models.UpdateWebhook(hook); err != nil {
+		c.InternalServerError(err)
+		return
+	}
+	c.OK(convert.ToWebhook(hook))
+}
+
+func deleteHook(c *context.APIContext, owner uint) {
+	hook, ok := getHook(c, owner)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteWebhook(hook.ID, owner); err != nil {
+		if models.IsErrWebhookNotExist(err) {
+			c.NotFound(ecode.WebhookNotExist, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+	c.OK(nil)
+}
+
+func listDeliveries(c *context.APIContext, owner uint) {
+	hook, ok := getHook(c, owner)
+	if !ok {
+		return
+	}
+
+	listOptions := utils.GetListOptions(c)
+	if listOptions.Page <= 0 {
+		listOptions.Page = 1
+	}
+
+	deliveries, maxResult, err := models.GetWebhookDeliveries(hook.ID, listOptions)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+
+	result := make([]*api.WebhookDelivery, len(deliveries))
+	for i := range deliveries {
+		result[i] = convert.ToWebhookDelivery(deliveries[i])
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(maxResult, 10))
+	c.Header("Access-Control-Expose-Headers", "X-Total-Count")
+	c.OK(result)
+}
+
+func redeliver(c *context.APIContext, owner uint) {
+	if !checkEnabled(c) {
+		return
+	}
+
+	hook, ok := getHook(c, owner)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := strconv.ParseUint(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		c.Error(http.StatusBadRequest, ecode.ParameterFormatError, err)
+		return
+	}
+
+	delivery, err := models.GetWebhookDelivery(uint(deliveryID), hook.ID)
+	if err != nil {
+		if models.IsErrWebhookDeliveryNotExist(err) {
+			c.NotFound(ecode.WebhookDeliveryNotExist, err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return
+	}
+
+	redelivery, err := webhook_service.Redeliver(delivery)
+	if err != nil {
+		c.InternalServerError(err)
+		return
+	}
+	c.OK(convert.ToWebhookDelivery(redelivery))
+}
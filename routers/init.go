@@ -10,7 +10,13 @@ import (
 	"github.com/czhj/ahfs/modules/setting"
 	"github.com/czhj/ahfs/modules/storage"
 
+	"github.com/czhj/ahfs/services/expirer"
+	"github.com/czhj/ahfs/services/extractor"
+	"github.com/czhj/ahfs/services/indexer"
 	"github.com/czhj/ahfs/services/mailer"
+	"github.com/czhj/ahfs/services/scanner"
+	"github.com/czhj/ahfs/services/thumbnailer"
+	"github.com/czhj/ahfs/services/webhook"
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 	"go.uber.org/zap"
@@ -21,12 +27,29 @@ func NewServices() {
 	cache.NewContext()
 	limiter.NewContext()
 	mailer.NewContext()
+	extractor.NewContext()
+	indexer.NewContext()
+	thumbnailer.NewContext()
+	webhook.NewContext()
+	scanner.NewContext()
 }
 
 func initDBEngine(ctx context.Context) (err error) {
 
 	if err := models.NewEngine(ctx, func(e *gorm.DB) error {
-		return e.AutoMigrate(&models.User{}, &models.File{}, &models.AuthToken{}).Error
+		if err := e.AutoMigrate(&models.User{}, &models.File{}, &models.AuthToken{}, &models.ExtractTask{}, &models.FileContent{}, &models.FileTerm{}, &models.Thumbnail{}, &models.FileTag{}, &models.FileProperty{}, &models.FileStar{}, &models.FileActivity{}, &models.ShareLink{}, &models.FileGrant{}, &models.TeamMember{}, &models.FileLock{}, &models.FileChange{}, &models.FileChangeCursor{}, &models.UploadPolicy{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.AuditLog{}, &models.Migration{}).Error; err != nil {
+			return err
+		}
+		if err := models.FillFileTreePath(e); err != nil {
+			return err
+		}
+		if err := models.AddFileNameUniqueIndex(e); err != nil {
+			return err
+		}
+		if err := models.RunMigration(e, "fill_file_version", models.FillFileVersion); err != nil {
+			return err
+		}
+		return models.RunMigration(e, "fill_directory_stats", models.FillDirectoryStats)
 	}); err != nil {
 		return err
 	}
@@ -53,10 +76,17 @@ func GlobalInit(ctx context.Context) {
 		log.Info("GORM engine initialization success")
 	}
 
+	if err := webhook.Resume(); err != nil {
+		log.Error("Failed to resume webhook deliveries", zap.Error(err))
+	}
+
 	if err := storage.Init(); err != nil {
 		log.Fatal("Storage initalization failed", zap.Error(err))
 	} else {
 		log.Info("Storage initialization success")
 	}
 
+	scanner.Run(ctx)
+	expirer.Run(ctx)
+
 }
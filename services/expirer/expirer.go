@@ -0,0 +1,176 @@
+package expirer
+
+import (
+	"context"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/services/mailer"
+	"go.uber.org/zap"
+)
+
+// sweepBatchSize is the number of files read at once while sweeping.
+const sweepBatchSize = 100
+
+// Run sweeps the expired and deleted files and the old audit logs every
+// FileExpirySweepInterval until ctx is done, it must be called once the
+// database is ready.
+func Run(ctx context.Context) {
+	interval := setting.Service.FileExpirySweepInterval
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			Sweep()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Debug("File expirer is running", zap.Duration("interval", interval))
+}
+
+// Sweep notifies the owners of the files which expire soon, deletes the
+// expired files, purges the files deleted before the retention and prunes
+// the audit logs older than their retention.
+func Sweep() {
+	now := time.Now()
+
+	if setting.Service.FileExpiryNotifyBefore > 0 && mailer.IsEnabled() {
+		if err := notify(now); err != nil {
+			log.Error("Failed to notify owners of expiring files", zap.Error(err))
+		}
+	}
+
+	if err := expire(now); err != nil {
+		log.Error("Failed to delete expired files", zap.Error(err))
+	}
+
+	if err := purge(now.Add(-setting.Service.DeletedFileRetention)); err != nil {
+		log.Error("Failed to purge deleted files", zap.Error(err))
+	}
+
+	if setting.Service.AuditLogRetention > 0 {
+		if err := models.PruneAuditLogs(now.Add(-setting.Service.AuditLogRetention)); err != nil {
+			log.Error("Failed to prune audit logs", zap.Error(err))
+		}
+	}
+}
+
+func notify(now time.Time) error {
+	before := now.Add(setting.Service.FileExpiryNotifyBefore)
+	for {
+		files, err := models.GetExpiringFiles(now, before, sweepBatchSize)
+		if err != nil {
+			return err
+		}
+
+		// the files are ordered by owner, every owner gets a single mail
+		for start := 0; start < len(files); {
+			end := start + 1
+			for end < len(files) && files[end].Owner == files[start].Owner {
+				end++
+			}
+			if err := notifyOwner(files[start:end]); err != nil {
+				return err
+			}
+			start = end
+		}
+
+		if len(files) < sweepBatchSize {
+			return nil
+		}
+	}
+}
+
+func notifyOwner(files []*models.File) error {
+	owner := files[0].Owner
+	u, err := models.GetUserByID(owner)
+	if err != nil && !models.IsErrUserNotExist(err) {
+		return err
+	}
+
+	if u != nil && len(u.Email) != 0 {
+		mailer.SendFileExpiringMail(u, files)
+	}
+
+	ids := make([]uint, len(files))
+	for i := range files {
+		ids[i] = files[i].ID
+	}
+	return models.SetFilesExpiryNotified(ids)
+}
+
+func expire(now time.Time) error {
+	var last uint
+	for {
+		files, err := models.GetExpiredFiles(now, last, sweepBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			expireFile(f)
+		}
+
+		if len(files) < sweepBatchSize {
+			return nil
+		}
+		last = files[len(files)-1].ID
+	}
+}
+
+func purge(before time.Time) error {
+	var last uint
+	for {
+		files, err := models.GetDeletedFiles(before, last, sweepBatchSize)
+		if err != nil {
+			return err
+		}
+
+		// a file which can't be purged is retried on the next sweep
+		for _, f := range files {
+			if err := models.PurgeDeletedFile(f); err != nil {
+				log.Error("Failed to purge deleted file", zap.Uint("id", f.ID), zap.Error(err))
+			}
+		}
+
+		if len(files) < sweepBatchSize {
+			return nil
+		}
+		last = files[len(files)-1].ID
+	}
+}
+
+// expireFile deletes f on behalf of its owner, so the capacity is released
+// like on any other deletion. Files locked by another user are kept until
+// a later sweep.
+func expireFile(f *models.File) {
+	if err := models.DeleteFile(f.Owner, f, ""); err != nil {
+		// the file was deleted together with an expired directory
+		if models.IsErrFileNotExist(err) {
+			return
+		}
+
+		if models.IsErrFileLocked(err) || models.IsErrFileModified(err) {
+			log.Warn("Failed to delete expired file, retrying on the next sweep", zap.Uint("id", f.ID), zap.Error(err))
+		} else {
+			log.Error("Failed to delete expired file", zap.Uint("id", f.ID), zap.Error(err))
+		}
+		return
+	}
+
+	before := models.FileAuditState(f)
+	before["expires_at"] = f.ExpiresAt
+	models.RecordAuditLog(models.NewFileAuditLog(models.AuditFileExpire, f), before, nil)
+}
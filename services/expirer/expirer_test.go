@@ -0,0 +1,175 @@
+package expirer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/modules/storage"
+	"github.com/czhj/ahfs/modules/storage/local"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "ahfs-expirer")
+	if err != nil {
+		panic(err)
+	}
+
+	setting.ServerMode = "release"
+	setting.Database.Driver = "sqlite3"
+	setting.Database.URL = filepath.Join(dir, "test.db")
+	setting.Upload = &setting.UploadService{}
+	storage.LFS = local.NewStorage(local.LocalStorageConfig{Directory: filepath.Join(dir, "lfs")})
+
+	err = models.NewEngine(context.Background(), func(e *gorm.DB) error {
+		err := e.AutoMigrate(&models.User{}, &models.File{}, &models.FileTag{}, &models.FileProperty{}, &models.FileStar{},
+			&models.FileActivity{}, &models.ShareLink{}, &models.FileGrant{}, &models.TeamMember{}, &models.FileLock{},
+			&models.FileChange{}, &models.UploadPolicy{}, &models.AuditLog{}).Error
+		if err != nil {
+			return err
+		}
+		return models.AddFileNameUniqueIndex(e)
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestSweepExpiredFiles(t *testing.T) {
+	u := &models.User{Username: "expirer", Email: "expirer@example.com", Password: "password", MaxFileCapacity: 1 << 20}
+	if err := models.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	root, err := models.GetUserRootFile(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	upload := func(parent *models.File, name string, expiresAt *time.Time) *models.File {
+		f, err := models.UploadFile(u, parent, name, 4, strings.NewReader(name[:4]), models.ConflictReject, "", expiresAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	expired := upload(root, "expired.txt", &past)
+	kept := upload(root, "kept.txt", &future)
+	locked := upload(root, "locked.txt", &past)
+	dir, err := models.CreateDirectory(u.ID, root, "temp", models.ConflictReject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := upload(dir, "child.txt", nil)
+	if err := models.SetFileExpiration(dir, &past); err != nil {
+		t.Fatal(err)
+	}
+
+	// locks of other users keep an expired file until a later sweep
+	if _, err := models.LockFile(locked, u.ID+1000, time.Hour, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	retention := setting.Service.DeletedFileRetention
+	defer func() { setting.Service.DeletedFileRetention = retention }()
+	setting.Service.DeletedFileRetention = time.Hour
+	Sweep()
+
+	files, err := root.ReadDir(models.ReadDirOption{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	names := make([]string, len(files))
+	for i := range files {
+		names[i] = files[i].FileName
+	}
+	assert.ElementsMatch(t, []string{"kept.txt", "locked.txt"}, names)
+
+	// the capacity is released like on any other deletion
+	u, err = models.GetUserByID(u.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, kept.FileSize+locked.FileSize, u.UsedFileCapacity)
+	}
+
+	logs, _, err := models.SearchAuditLogs(&models.SearchAuditLogOptions{Actions: []models.AuditAction{models.AuditFileExpire}})
+	if assert.NoError(t, err) {
+		targets := make([]string, len(logs))
+		for i := range logs {
+			targets[i] = logs[i].TargetName
+		}
+		assert.ElementsMatch(t, []string{"/expired.txt", "/temp"}, targets)
+	}
+
+	// deleted files are kept for the retention, their objects as well
+	deleted, err := models.GetDeletedFiles(now.Add(time.Minute), 0, 100)
+	if assert.NoError(t, err) {
+		assert.Len(t, deleted, 3)
+	}
+	_, err = storage.LFS.Read(storage.ID(child.FileID))
+	assert.NoError(t, err)
+
+	setting.Service.DeletedFileRetention = 0
+	Sweep()
+
+	deleted, err = models.GetDeletedFiles(time.Now(), 0, 100)
+	if assert.NoError(t, err) {
+		assert.Empty(t, deleted)
+	}
+	for _, f := range []*models.File{expired, child} {
+		_, err = storage.LFS.Read(storage.ID(f.FileID))
+		assert.Equal(t, storage.ErrNotFound, err, f.FileName)
+	}
+	_, err = storage.LFS.Read(storage.ID(kept.FileID))
+	assert.NoError(t, err)
+}
+
+func TestSweepAuditLogs(t *testing.T) {
+	now := time.Now()
+	for _, age := range []time.Duration{48 * time.Hour, 2 * time.Hour, time.Minute} {
+		l := &models.AuditLog{CreatedAt: now.Add(-age), Action: models.AuditFileDelete, TargetName: age.String()}
+		if err := models.CreateAuditLog(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	targets := func() []string {
+		logs, _, err := models.SearchAuditLogs(&models.SearchAuditLogOptions{Actions: []models.AuditAction{models.AuditFileDelete}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, 0, len(logs))
+		for _, l := range logs {
+			names = append(names, l.TargetName)
+		}
+		return names
+	}
+
+	// entries are kept forever without a retention
+	setting.Service.AuditLogRetention = 0
+	Sweep()
+	assert.Equal(t, []string{"1m0s", "2h0m0s", "48h0m0s"}, targets())
+
+	setting.Service.AuditLogRetention = 24 * time.Hour
+	defer func() { setting.Service.AuditLogRetention = 0 }()
+	Sweep()
+	assert.Equal(t, []string{"1m0s", "2h0m0s"}, targets())
+
+	setting.Service.AuditLogRetention = time.Hour
+	Sweep()
+	assert.Equal(t, []string{"1m0s"}, targets())
+}
@@ -0,0 +1,273 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/archiver"
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/czhj/ahfs/modules/queue"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/modules/storage"
+	"github.com/czhj/ahfs/modules/validator"
+	"go.uber.org/zap"
+)
+
+var (
+	extractQueue queue.Queue
+)
+
+func NewContext() {
+	if extractQueue != nil {
+		return
+	}
+
+	extractQueue = queue.CreateQueue("extract", func(data ...queue.Data) {
+		for _, dat := range data {
+			task := dat.(*models.ExtractTask)
+			if err := run(task); err != nil {
+				log.Warn("Failed to extract archive", zap.Uint("task", task.ID), zap.Uint("archive", task.ArchiveID), zap.Error(err))
+			}
+		}
+	}, &models.ExtractTask{})
+
+	if extractQueue == nil {
+		return
+	}
+
+	extractQueue.Run(func(c context.Context, f func()) {
+		f()
+	}, func(c context.Context, f func()) {
+		f()
+	})
+	log.Debug("Extractor service is running")
+}
+
+// Extract extracts archive into dir. Archives larger than
+// setting.Archive.ExtractSyncSize are extracted in the background and the
+// pending task is returned, smaller ones are extracted before returning.
+func Extract(u *models.User, archive, dir *models.File, policy models.ConflictPolicy, removeArchive bool) (*models.ExtractTask, error) {
+	if archive.IsDir() {
+		return nil, models.ErrArchiveInvalid{Reason: "archive is a directory"}
+	}
+
+	if _, ok := archiver.DetectFormat(archive.FileName); !ok {
+		return nil, models.ErrArchiveInvalid{Reason: "unsupported archive format"}
+	}
+
+	if !archive.IsDownloadable() {
+		return nil, models.ErrFileQuarantined{ID: archive.ID, Status: archive.ScanStatus}
+	}
+
+	if !dir.IsDir() {
+		return nil, models.ErrFileNotDirectory{ID: dir.ID, Path: dir.FilePath()}
+	}
+
+	task := &models.ExtractTask{
+		Owner:         u.ID,
+		ArchiveID:     archive.ID,
+		DirectoryID:   dir.ID,
+		Conflict:      policy,
+		RemoveArchive: removeArchive,
+		Status:        models.ExtractTaskPending,
+	}
+
+	if err := models.CreateExtractTask(task); err != nil {
+		return nil, err
+	}
+
+	if archive.FileSize > setting.Archive.ExtractSyncSize && extractQueue != nil {
+		err := extractQueue.Push(task)
+		if err == nil {
+			return task, nil
+		}
+		log.Warn("Failed to queue extract task, extract it now", zap.Uint("task", task.ID), zap.Error(err))
+	}
+
+	return task, run(task)
+}
+
+func run(task *models.ExtractTask) error {
+	task.Status = models.ExtractTaskRunning
+	if err := models.SaveExtractTask(task); err != nil {
+		return err
+	}
+
+	count, err := extract(task)
+	if err != nil {
+		task.Status = models.ExtractTaskFailed
+		task.Message = err.Error()
+	} else {
+		task.Status = models.ExtractTaskDone
+		task.FileCount = count
+	}
+
+	if err := models.SaveExtractTask(task); err != nil {
+		log.Error("Failed to save extract task", zap.Uint("task", task.ID), zap.Error(err))
+	}
+	return err
+}
+
+func extract(task *models.ExtractTask) (int, error) {
+	u, err := models.GetUserByID(task.Owner)
+	if err != nil {
+		return 0, err
+	}
+
+	// the permissions are checked again, they may have been revoked while
+	// the task was queued
+	perm := models.FilePermissionRead
+	if task.RemoveArchive {
+		perm = models.FilePermissionWrite
+	}
+
+	archive, err := models.GetAccessibleFile(task.ArchiveID, task.Owner, perm)
+	if err != nil {
+		return 0, err
+	}
+
+	dir, err := models.GetAccessibleFile(task.DirectoryID, task.Owner, models.FilePermissionWrite)
+	if err != nil {
+		return 0, err
+	}
+
+	format, ok := archiver.DetectFormat(archive.FileName)
+	if !ok {
+		return 0, models.ErrArchiveInvalid{Reason: "unsupported archive format"}
+	}
+
+	// the archive may have been quarantined while the task was queued
+	if !archive.IsDownloadable() {
+		return 0, models.ErrFileQuarantined{ID: archive.ID, Status: archive.ScanStatus}
+	}
+
+	// the archive is scanned before anything is written, so that a bad
+	// entry or a limit violation leaves the directory untouched.
+	size, err := scan(format, archive)
+	if err != nil {
+		return 0, err
+	}
+
+	r, closeArchive, err := openArchive(format, archive)
+	if err != nil {
+		return 0, err
+	}
+	defer closeArchive()
+
+	count, err := models.ImportFiles(u, dir, size, task.Conflict, func() (*models.ImportEntry, io.Reader, error) {
+		entry, reader, err := r.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		name, err := archiver.CleanName(entry.Name)
+		if err != nil {
+			return nil, nil, models.ErrArchiveInvalid{Reason: err.Error()}
+		}
+		return &models.ImportEntry{Path: name, IsDir: entry.IsDir, Size: entry.Size}, reader, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if task.RemoveArchive {
+		if err := models.DeleteFile(u.ID, archive, ""); err != nil && !models.IsErrFileNotExist(err) {
+			log.Error("Failed to remove extracted archive", zap.Uint("id", archive.ID), zap.Error(err))
+		}
+	}
+	return count, nil
+}
+
+// scan validates the entries of the archive against the extraction limits
+// and returns their total size.
+func scan(format archiver.Format, archive *models.File) (int64, error) {
+	r, closeArchive, err := openArchive(format, archive)
+	if err != nil {
+		return 0, err
+	}
+	defer closeArchive()
+
+	var size int64
+	entries := 0
+	for {
+		entry, _, err := r.Next()
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return 0, models.ErrArchiveInvalid{Reason: err.Error()}
+		}
+
+		name, err := archiver.CleanName(entry.Name)
+		if err != nil {
+			return 0, models.ErrArchiveInvalid{Reason: err.Error()}
+		}
+
+		for _, seg := range strings.Split(name, "/") {
+			if !validator.ValidFilename(seg) {
+				return 0, models.ErrArchiveInvalid{Reason: fmt.Sprintf("illegal filename in archive: %s", entry.Name)}
+			}
+		}
+
+		entries++
+		if entries > setting.Archive.ExtractMaxEntries {
+			return 0, models.ErrArchiveInvalid{Reason: fmt.Sprintf("archive contains more than %d entries", setting.Archive.ExtractMaxEntries)}
+		}
+
+		size += entry.Size
+		if size > setting.Archive.ExtractMaxSize {
+			return 0, models.ErrArchiveInvalid{Reason: fmt.Sprintf("extracted size exceeds the limit %d", setting.Archive.ExtractMaxSize)}
+		}
+	}
+}
+
+// openArchive opens the archive object for reading. Zip archives need random
+// access, they are spooled to a temporary file when the storage object does
+// not support it.
+func openArchive(format archiver.Format, archive *models.File) (archiver.Reader, func(), error) {
+	obj, err := storage.LFS.Read(storage.ID(archive.FileID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var reader io.Reader = obj.Reader
+	cleanup := func() {
+		obj.Reader.Close()
+	}
+
+	if _, ok := obj.Reader.(io.ReaderAt); format == archiver.FormatZip && !ok {
+		tmp, err := ioutil.TempFile("", "ahfs-extract-")
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+
+		cleanup = func() {
+			obj.Reader.Close()
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+
+		if _, err := io.Copy(tmp, obj.Reader); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		reader = tmp
+	}
+
+	r, err := archiver.NewReader(format, reader, archive.FileSize)
+	if err != nil {
+		cleanup()
+		return nil, nil, models.ErrArchiveInvalid{Reason: err.Error()}
+	}
+
+	return r, func() {
+		r.Close()
+		cleanup()
+	}, nil
+}
@@ -0,0 +1,90 @@
+package indexer
+
+import (
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/indexer"
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/modules/storage"
+	"github.com/czhj/ahfs/services/worker"
+	"go.uber.org/zap"
+)
+
+// indexBatchSize is the number of files fetched at once while indexing.
+const indexBatchSize = 50
+
+var (
+	indexWorker *worker.Worker
+)
+
+func NewContext() {
+	if setting.Indexer == nil || !setting.Indexer.Enabled || indexWorker != nil {
+		return
+	}
+
+	indexWorker = worker.NewFileWorker("indexer", &worker.FileJob{
+		Remove:    models.RemoveStaleFileIndexes,
+		Pending:   models.GetUnindexedFiles,
+		Examine:   indexFile,
+		BatchSize: indexBatchSize,
+	})
+	if indexWorker == nil {
+		return
+	}
+	log.Debug("Indexer service is running")
+}
+
+// Notify queues the index of the user uid to be brought up to date.
+func Notify(uid uint) {
+	indexWorker.Notify(uid)
+}
+
+func indexFile(file *models.File) error {
+	if !indexer.IsIndexable(file.FileName) || file.FileSize > setting.Indexer.MaxFileSize {
+		return models.SaveFileIndex(file, "", nil)
+	}
+
+	obj, err := storage.LFS.Read(storage.ID(file.FileID))
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return models.SaveFileIndex(file, "", nil)
+		}
+		return err
+	}
+	defer obj.Reader.Close()
+
+	content, err := indexer.ExtractText(file.FileName, obj.Reader, setting.Indexer.MaxFileSize)
+	if err != nil {
+		// files without text are skipped for good, they are not retried
+		log.Debug("Failed to extract file content", zap.Uint("id", file.ID), zap.Error(err))
+		return models.SaveFileIndex(file, "", nil)
+	}
+
+	return models.SaveFileIndex(file, content, indexer.Tokenize(content))
+}
+
+type SearchResult struct {
+	File    *models.File
+	Score   int
+	Snippet string
+}
+
+// Search returns the files of the user uid whose content contains all words
+// of query, with a highlighted snippet of the first match.
+func Search(uid uint, query string, opts models.ListOptions) ([]*SearchResult, int64, error) {
+	terms := indexer.Terms(query)
+	files, count, err := models.SearchFileContent(uid, terms, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	results := make([]*SearchResult, len(files))
+	for i, file := range files {
+		results[i] = &SearchResult{
+			File:    file.File,
+			Score:   file.Score,
+			Snippet: indexer.Snippet(file.Content, terms, setting.Indexer.SnippetLength),
+		}
+	}
+	return results, count, nil
+}
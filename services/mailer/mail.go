@@ -15,6 +15,7 @@ import (
 const (
 	mailAuthActivateEmail = "auth/activate_email"
 	mailAuthResetPassword = "auth/reset_password"
+	mailFileExpiring      = "file/expiring"
 )
 
 var (
@@ -55,3 +56,21 @@ func SendResetPwdCodeMail(email string, code string) {
 		Email: email,
 	}, mailAuthResetPassword, code, "修改密码验证码(reset password  verification code)")
 }
+
+// SendFileExpiringMail tells u that files are deleted soon.
+func SendFileExpiringMail(u *models.User, files []*models.File) {
+	data := map[string]interface{}{
+		"DisplayName": u.Nickname,
+		"Files":       files,
+	}
+
+	var content bytes.Buffer
+
+	if err := bodyTemplates.ExecuteTemplate(&content, mailFileExpiring, data); err != nil {
+		log.Error("Failed to render mail template", zap.String("name", mailFileExpiring), zap.Error(err))
+		return
+	}
+
+	msg := NewMessage([]string{u.Email}, "文件即将过期(files are about to expire)", content.String())
+	SendAsync(msg)
+}
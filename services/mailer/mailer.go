@@ -153,6 +153,10 @@ func smtpSender() *gomail.Dialer {
 	return dialer
 }
 
+func IsEnabled() bool {
+	return mailerQueue != nil
+}
+
 func SendAsync(msg *Message) {
 	go func() {
 		_ = mailerQueue.Push(msg)
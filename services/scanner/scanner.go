@@ -0,0 +1,133 @@
+package scanner
+
+import (
+	"context"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/czhj/ahfs/modules/scan"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/modules/storage"
+	"github.com/czhj/ahfs/services/worker"
+	"go.uber.org/zap"
+)
+
+// scanBatchSize is the number of files fetched at once.
+const scanBatchSize = 20
+
+var (
+	scanWorker *worker.Worker
+)
+
+func NewContext() {
+	if err := scan.Init(); err != nil {
+		log.Fatal("Scanner initialization failed", zap.Error(err))
+	}
+
+	if !scan.IsEnabled() || scanWorker != nil {
+		return
+	}
+
+	scanWorker = worker.New("scan", sync)
+	if scanWorker == nil {
+		return
+	}
+
+	models.AddFileChangedHook(Notify)
+	log.Debug("Scanner service is running")
+}
+
+// Run queues the users with files waiting for the scanner right away and
+// every RetryInterval until ctx is done, so files whose scan failed are
+// tried again. It must be called once the database and the storage are
+// ready.
+func Run(ctx context.Context) {
+	if scanWorker == nil {
+		return
+	}
+
+	if setting.Scanner.RetryInterval <= 0 {
+		if err := resume(); err != nil {
+			log.Error("Failed to resume file scans", zap.Error(err))
+		}
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(setting.Scanner.RetryInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := resume(); err != nil {
+				log.Error("Failed to resume file scans", zap.Error(err))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func resume() error {
+	owners, err := models.GetPendingScanOwners()
+	if err != nil {
+		return err
+	}
+
+	for _, uid := range owners {
+		Notify(uid)
+	}
+	return nil
+}
+
+// Notify queues the pending files of the user uid to be scanned.
+func Notify(uid uint) {
+	scanWorker.Notify(uid)
+}
+
+// sync scans the pending files of the user uid. Files which couldn't be
+// scanned stay pending until the next retry.
+func sync(uid uint) error {
+	var last uint
+	for {
+		files, err := models.GetPendingScanFiles(uid, last, scanBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			if err := scanFile(file); err != nil {
+				log.Error("Failed to scan file", zap.Uint("id", file.ID), zap.Error(err))
+			}
+		}
+
+		if len(files) < scanBatchSize {
+			return nil
+		}
+		last = files[len(files)-1].ID
+	}
+}
+
+func scanFile(file *models.File) error {
+	status, result, err := models.ScanObject(storage.ID(file.FileID))
+	if err != nil {
+		return err
+	}
+
+	if err := models.SetFileScanResult(file, status, result); err != nil {
+		// the file was deleted while it was scanned
+		if models.IsErrFileNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if status == models.FileScanQuarantined {
+		log.Warn("Quarantined infected file", zap.Uint("id", file.ID), zap.Uint("owner", file.Owner), zap.String("signature", result))
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package thumbnailer
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"io/ioutil"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/modules/storage"
+	"github.com/czhj/ahfs/modules/thumbnail"
+	"github.com/czhj/ahfs/services/worker"
+	"github.com/nfnt/resize"
+	"go.uber.org/zap"
+)
+
+// thumbnailBatchSize is the number of files fetched at once.
+const thumbnailBatchSize = 20
+
+var thumbnailTypes = []string{"image/png", "image/jpeg", "image/gif"}
+
+var (
+	thumbnailWorker *worker.Worker
+)
+
+func NewContext() {
+	if setting.Thumbnail == nil || !setting.Thumbnail.Enabled || len(setting.Thumbnail.Sizes) == 0 || thumbnailWorker != nil {
+		return
+	}
+
+	thumbnailWorker = worker.NewFileWorker("thumbnail", &worker.FileJob{
+		Remove:    models.PurgeStaleThumbnails,
+		Pending:   pendingFiles,
+		Examine:   renderFile,
+		BatchSize: thumbnailBatchSize,
+	})
+	if thumbnailWorker == nil {
+		return
+	}
+	log.Debug("Thumbnail service is running")
+}
+
+// Notify queues the thumbnails of the user uid to be brought up to date.
+func Notify(uid uint) {
+	thumbnailWorker.Notify(uid)
+}
+
+func pendingFiles(uid uint, ids []uint, limit int) ([]*models.File, error) {
+	return models.GetUnthumbnailedFiles(uid, thumbnailTypes, ids, limit)
+}
+
+// skipFile marks file as examined without thumbnails.
+func skipFile(file *models.File) error {
+	return models.SaveThumbnails([]*models.Thumbnail{{FileID: file.ID, Owner: file.Owner}})
+}
+
+func renderFile(file *models.File) error {
+	if !thumbnail.IsSupported(file.MimeType()) || file.FileSize > setting.Thumbnail.MaxFileSize {
+		return skipFile(file)
+	}
+
+	obj, err := storage.LFS.Read(storage.ID(file.FileID))
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return skipFile(file)
+		}
+		return err
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(obj.Reader, setting.Thumbnail.MaxFileSize))
+	obj.Reader.Close()
+	if err != nil {
+		return err
+	}
+
+	img, format, err := thumbnail.Decode(bytes.NewReader(data), setting.Thumbnail.MaxWidth, setting.Thumbnail.MaxHeight)
+	if err != nil {
+		log.Debug("Failed to decode image", zap.Uint("id", file.ID), zap.Error(err))
+		return skipFile(file)
+	}
+
+	thumbs := make([]*models.Thumbnail, 0, len(setting.Thumbnail.Sizes))
+	for _, size := range setting.Thumbnail.Sizes {
+		thumb, err := render(file, img, format, size)
+		if err == nil {
+			thumbs = append(thumbs, thumb)
+			continue
+		}
+
+		removeThumbnails(thumbs)
+		log.Debug("Failed to render thumbnail", zap.Uint("id", file.ID), zap.Int("size", size), zap.Error(err))
+		return skipFile(file)
+	}
+
+	if err := models.SaveThumbnails(thumbs); err != nil {
+		removeThumbnails(thumbs)
+		return err
+	}
+	return nil
+}
+
+func render(file *models.File, img image.Image, format string, size int) (*models.Thumbnail, error) {
+	thumb, err := thumbnail.Square(img, uint(size), resize.Bilinear)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	contentType, err := thumbnail.Encode(buf, thumb, format)
+	if err != nil {
+		return nil, err
+	}
+
+	objectSize := int64(buf.Len())
+	id, err := storage.LFS.Write(&storage.Object{
+		Size:   objectSize,
+		Reader: ioutil.NopCloser(buf),
+	}, storage.WithID(file.Owner))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Thumbnail{
+		FileID:      file.ID,
+		Size:        size,
+		Owner:       file.Owner,
+		ObjectID:    string(id),
+		ObjectSize:  objectSize,
+		ContentType: contentType,
+	}, nil
+}
+
+func removeThumbnails(thumbs []*models.Thumbnail) {
+	for _, thumb := range thumbs {
+		if err := storage.LFS.Delete(storage.ID(thumb.ObjectID)); err != nil && err != storage.ErrNotFound {
+			log.Error("Failed to remove thumbnail", zap.String("id", thumb.ObjectID), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package thumbnailer
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/modules/storage"
+	"github.com/czhj/ahfs/modules/storage/local"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "ahfs-thumbnailer")
+	if err != nil {
+		panic(err)
+	}
+
+	setting.ServerMode = "release"
+	setting.Database.Driver = "sqlite3"
+	setting.Database.URL = filepath.Join(dir, "test.db")
+	setting.Upload = &setting.UploadService{}
+	setting.Thumbnail = &setting.ThumbnailService{
+		Enabled:     true,
+		Sizes:       []int{16, 64},
+		MaxFileSize: 1 << 20,
+		MaxWidth:    1000,
+		MaxHeight:   1000,
+	}
+	storage.LFS = local.NewStorage(local.LocalStorageConfig{Directory: filepath.Join(dir, "lfs")})
+
+	err = models.NewEngine(context.Background(), func(e *gorm.DB) error {
+		return e.AutoMigrate(&models.User{}, &models.File{}, &models.FileChange{}, &models.FileActivity{},
+			&models.FileLock{}, &models.UploadPolicy{}, &models.Thumbnail{}).Error
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestRenderFiles(t *testing.T) {
+	u := &models.User{Username: "thumbnailer", Email: "thumbnailer@example.com", Password: "password", MaxFileCapacity: 1 << 20}
+	if err := models.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	root, err := models.GetUserRootFile(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 100, 50))); err != nil {
+		t.Fatal(err)
+	}
+	upload := func(name string, content []byte) *models.File {
+		f, err := models.UploadFile(u, root, name, int64(len(content)), bytes.NewReader(content), models.ConflictReject, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	img := upload("image.png", buf.Bytes())
+	broken := upload("broken.png", []byte(strings.Repeat("not an image", 10)))
+	text := upload("notes.txt", []byte("notes"))
+
+	pending, err := pendingFiles(u.ID, nil, thumbnailBatchSize)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// only images are rendered
+	assert.Len(t, pending, 2)
+
+	for _, f := range pending {
+		assert.NoError(t, renderFile(f), f.FileName)
+	}
+
+	// every image is examined once, including those without thumbnails
+	pending, err = pendingFiles(u.ID, nil, thumbnailBatchSize)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+
+	for _, f := range []*models.File{broken, text} {
+		_, err := models.GetThumbnail(f.ID, 0)
+		assert.True(t, models.IsErrThumbnailNotExist(err), f.FileName)
+	}
+
+	sizes := []struct {
+		want, got int
+	}{
+		{0, 16},
+		{16, 16},
+		{17, 64},
+		{64, 64},
+		{512, 64},
+	}
+	for _, s := range sizes {
+		thumb, err := models.GetThumbnail(img.ID, s.want)
+		if !assert.NoError(t, err, s.want) {
+			continue
+		}
+		assert.Equal(t, s.got, thumb.Size, s.want)
+		assert.Equal(t, "image/png", thumb.ContentType, s.want)
+
+		obj, err := storage.LFS.Read(storage.ID(thumb.ObjectID))
+		if !assert.NoError(t, err, s.want) {
+			continue
+		}
+		cfg, _, err := image.DecodeConfig(obj.Reader)
+		obj.Reader.Close()
+		assert.NoError(t, err, s.want)
+		assert.Equal(t, image.Config{ColorModel: cfg.ColorModel, Width: s.got, Height: s.got}, cfg, s.want)
+	}
+
+	thumb, err := models.GetThumbnail(img.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// thumbnails go away together with their file
+	if err := models.DeleteFile(u.ID, img, ""); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, models.PurgeStaleThumbnails(u.ID, nil))
+
+	_, err = models.GetThumbnail(img.ID, 0)
+	assert.True(t, models.IsErrThumbnailNotExist(err))
+	_, err = storage.LFS.Read(storage.ID(thumb.ObjectID))
+	assert.Equal(t, storage.ErrNotFound, err)
+}
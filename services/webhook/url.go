@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+
+	"github.com/czhj/ahfs/modules/setting"
+)
+
+// blockedNetworks are the networks webhooks aren't delivered to unless the
+// local network is allowed, they reach the server itself or services which
+// aren't meant to be reachable from outside.
+var blockedNetworks = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+func isBlockedIP(ip net.IP) bool {
+	if ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckURL returns an error if rawurl can't be the URL of a webhook, it has
+// to be an http or https URL whose host doesn't resolve to a local address.
+func CheckURL(rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url scheme must be http or https")
+	}
+
+	host := u.Hostname()
+	if len(host) == 0 {
+		return fmt.Errorf("url has no host")
+	}
+
+	if setting.Webhook.AllowLocalNetwork {
+		return nil
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fmt.Errorf("unable to resolve %s: %v", host, err)
+	}
+
+	for _, ip := range ips {
+		if isBlockedIP(ip) {
+			return fmt.Errorf("host %s resolves to the local address %s", host, ip)
+		}
+	}
+	return nil
+}
+
+// checkDialAddress refuses connections to local addresses, it runs after the
+// host is resolved so a DNS answer changed since CheckURL is caught as well.
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	if setting.Webhook.AllowLocalNetwork {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || isBlockedIP(ip) {
+		return fmt.Errorf("webhook delivery to the local address %s is not allowed", host)
+	}
+	return nil
+}
+
+// newClient returns the client posting deliveries, it doesn't use a proxy so
+// every connection is checked and doesn't follow redirects, a redirect
+// counts as a failed attempt.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: setting.Webhook.Timeout,
+		Control: checkDialAddress,
+	}
+
+	return &http.Client{
+		Timeout: setting.Webhook.Timeout,
+		Transport: &http.Transport{
+			DialContext:       dialer.DialContext,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,341 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/convert"
+	"github.com/czhj/ahfs/modules/locker"
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/czhj/ahfs/modules/queue"
+	"github.com/czhj/ahfs/modules/setting"
+	api "github.com/czhj/ahfs/modules/structs"
+	"go.uber.org/zap"
+)
+
+// dispatchBatchSize is the number of file changes dispatched at once.
+const dispatchBatchSize = 50
+
+type deliveryTask struct {
+	ID        uint
+	WebhookID uint
+}
+
+var (
+	webhookQueue queue.Queue
+)
+
+func NewContext() {
+	if setting.Webhook == nil || !setting.Webhook.Enabled || webhookQueue != nil {
+		return
+	}
+
+	webhookQueue = queue.CreateQueue("webhook", func(data ...queue.Data) {
+		for _, dat := range data {
+			task := dat.(*deliveryTask)
+			if err := deliver(task); err != nil {
+				log.Error("Failed to deliver webhook", zap.Uint("webhook", task.WebhookID), zap.Uint("delivery", task.ID), zap.Error(err))
+			}
+		}
+	}, &deliveryTask{})
+
+	if webhookQueue == nil {
+		return
+	}
+
+	webhookQueue.Run(func(c context.Context, f func()) {
+		f()
+	}, func(c context.Context, f func()) {
+		f()
+	})
+
+	models.AddFileChangedHook(Notify)
+	log.Debug("Webhook service is running")
+}
+
+func IsEnabled() bool {
+	return webhookQueue != nil
+}
+
+// Resume schedules the deliveries which were pending when the service was
+// stopped, it must be called once the database is ready.
+func Resume() error {
+	if webhookQueue == nil {
+		return nil
+	}
+
+	deliveries, err := models.GetPendingWebhookDeliveries()
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deliveries {
+		schedule(d)
+	}
+	return nil
+}
+
+// Notify dispatches the file changes of the user uid to the webhooks.
+func Notify(uid uint) {
+	if webhookQueue == nil {
+		return
+	}
+
+	go func() {
+		if err := Dispatch(uid); err != nil {
+			log.Error("Failed to dispatch file changes to webhooks", zap.Uint("uid", uid), zap.Error(err))
+		}
+	}()
+}
+
+// Dispatch creates the deliveries of the file changes of the user uid which
+// weren't dispatched yet.
+func Dispatch(uid uint) error {
+	key := fmt.Sprintf("user-%d-webhook", uid)
+	id, err := locker.Lock(context.Background(), key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := locker.Unlock(context.Background(), key, id); err != nil {
+			log.Error("Failed to unlock user webhook", zap.Uint("uid", uid), zap.Error(err))
+		}
+	}()
+
+	var (
+		hooks []*models.Webhook
+		user  *api.User
+	)
+
+	for {
+		changes, err := models.GetUndispatchedFileChanges(uid, dispatchBatchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(changes) == 0 {
+			return nil
+		}
+
+		if hooks == nil {
+			if hooks, err = models.GetActiveWebhooks(uid); err != nil {
+				return err
+			}
+
+			u, err := models.GetUserByID(uid)
+			if err != nil && !models.IsErrUserNotExist(err) {
+				return err
+			}
+			if u != nil {
+				user = convert.ToUser(u, false, true)
+			}
+		}
+
+		for _, change := range changes {
+			event := models.FileChangeWebhookEvent(change.Type)
+			payload := &api.WebhookPayload{
+				Event:     string(event),
+				User:      user,
+				Change:    convert.ToFileChange(change),
+				CreatedAt: change.CreatedAt,
+			}
+
+			for _, hook := range hooks {
+				if !hook.HasEvent(event) || !hook.MatchPath(change.Path, change.OldPath) {
+					continue
+				}
+				if err := createDelivery(hook, event, payload); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := models.SetFileChangesDispatched(uid, changes[len(changes)-1].Seq); err != nil {
+			return err
+		}
+
+		if len(changes) < dispatchBatchSize {
+			return nil
+		}
+	}
+}
+
+// NotifyAccount delivers an account event of u to the webhooks.
+func NotifyAccount(event models.WebhookEvent, u *models.User) {
+	if webhookQueue == nil {
+		return
+	}
+
+	payload := &api.WebhookPayload{
+		Event:     string(event),
+		User:      convert.ToUser(u, false, true),
+		CreatedAt: time.Now(),
+	}
+
+	go func() {
+		hooks, err := models.GetActiveWebhooks(u.ID)
+		if err != nil {
+			log.Error("Failed to get webhooks", zap.Uint("uid", u.ID), zap.Error(err))
+			return
+		}
+
+		for _, hook := range hooks {
+			if !hook.HasEvent(event) {
+				continue
+			}
+			if err := createDelivery(hook, event, payload); err != nil {
+				log.Error("Failed to create webhook delivery", zap.Uint("webhook", hook.ID), zap.Error(err))
+			}
+		}
+	}()
+}
+
+// Redeliver posts the payload of d to its webhook again as a new delivery.
+func Redeliver(d *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	redelivery := &models.WebhookDelivery{
+		WebhookID:    d.WebhookID,
+		Event:        d.Event,
+		Payload:      d.Payload,
+		RedeliveryOf: d.ID,
+	}
+
+	if err := models.CreateWebhookDelivery(redelivery); err != nil {
+		return nil, err
+	}
+	schedule(redelivery)
+	return redelivery, nil
+}
+
+func createDelivery(hook *models.Webhook, event models.WebhookEvent, payload *api.WebhookPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	d := &models.WebhookDelivery{
+		WebhookID: hook.ID,
+		Event:     event,
+		Payload:   string(data),
+	}
+
+	if err := models.CreateWebhookDelivery(d); err != nil {
+		return err
+	}
+	schedule(d)
+	return nil
+}
+
+// schedule queues d once its next attempt is due.
+func schedule(d *models.WebhookDelivery) {
+	if webhookQueue == nil || d.NextAttemptAt == nil {
+		return
+	}
+
+	task := &deliveryTask{ID: d.ID, WebhookID: d.WebhookID}
+	push := func() {
+		if err := webhookQueue.Push(task); err != nil {
+			log.Error("Failed to queue webhook delivery", zap.Uint("delivery", task.ID), zap.Error(err))
+		}
+	}
+
+	if delay := time.Until(*d.NextAttemptAt); delay > 0 {
+		time.AfterFunc(delay, push)
+	} else {
+		go push()
+	}
+}
+
+// Sign returns the signature of body sent in the X-Ahfs-Signature-256
+// header, the HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func deliver(task *deliveryTask) error {
+	d, err := models.GetWebhookDelivery(task.ID, task.WebhookID)
+	if err != nil {
+		if models.IsErrWebhookDeliveryNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if d.IsFinished() {
+		return nil
+	}
+
+	hook, err := models.GetWebhookByID(d.WebhookID)
+	if err != nil {
+		if models.IsErrWebhookNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	d.Attempts++
+	d.ResponseStatus, d.ResponseBody, d.Error = 0, "", ""
+
+	if err := post(hook, d); err != nil {
+		d.Error = err.Error()
+	}
+
+	if d.Error == "" && d.ResponseStatus >= 200 && d.ResponseStatus < 300 {
+		d.Status = models.WebhookDeliverySucceeded
+		d.NextAttemptAt = nil
+	} else if d.Attempts >= setting.Webhook.MaxAttempts {
+		d.Status = models.WebhookDeliveryFailed
+		d.NextAttemptAt = nil
+	} else {
+		next := time.Now().Add(setting.Webhook.RetryInterval << uint(d.Attempts-1))
+		d.NextAttemptAt = &next
+	}
+
+	if err := models.UpdateWebhookDelivery(d); err != nil {
+		return err
+	}
+	schedule(d)
+	return nil
+}
+
+func post(hook *models.Webhook, d *models.WebhookDelivery) error {
+	body := []byte(d.Payload)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ahfs-webhook")
+	req.Header.Set("X-Ahfs-Event", string(d.Event))
+	req.Header.Set("X-Ahfs-Delivery", d.UUID)
+	if len(hook.Secret) != 0 {
+		req.Header.Set("X-Ahfs-Signature-256", Sign(hook.Secret, body))
+	}
+
+	resp, err := newClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	d.ResponseStatus = resp.StatusCode
+	if setting.Webhook.MaxResponseSize <= 0 {
+		return nil
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, setting.Webhook.MaxResponseSize))
+	d.ResponseBody = string(data)
+	return err
+}
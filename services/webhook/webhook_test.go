@@ -0,0 +1,412 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/czhj/ahfs/models"
+	"github.com/czhj/ahfs/modules/setting"
+	"github.com/czhj/ahfs/modules/storage"
+	"github.com/czhj/ahfs/modules/storage/local"
+	api "github.com/czhj/ahfs/modules/structs"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "ahfs-webhook")
+	if err != nil {
+		panic(err)
+	}
+
+	setting.ServerMode = "release"
+	setting.Database.Driver = "sqlite3"
+	setting.Database.URL = filepath.Join(dir, "test.db")
+	setting.Webhook = &setting.WebhookService{
+		Enabled:       true,
+		MaxAttempts:   3,
+		RetryInterval: time.Second,
+		Timeout:       5 * time.Second,
+	}
+
+	setting.Upload = &setting.UploadService{}
+	storage.LFS = local.NewStorage(local.LocalStorageConfig{Directory: filepath.Join(dir, "lfs")})
+
+	err = models.NewEngine(context.Background(), func(e *gorm.DB) error {
+		return e.AutoMigrate(&models.Webhook{}, &models.WebhookDelivery{}, &models.User{}, &models.File{}, &models.FileChange{},
+			&models.FileActivity{}, &models.FileLock{}, &models.UploadPolicy{}).Error
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestSign(t *testing.T) {
+	cases := []struct {
+		secret string
+		body   string
+		sig    string
+	}{
+		{"", "", "sha256=b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad"},
+		{"key", "The quick brown fox jumps over the lazy dog", "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.sig, Sign(c.secret, []byte(c.body)), c.body)
+	}
+	assert.NotEqual(t, Sign("a", []byte("body")), Sign("b", []byte("body")))
+}
+
+func TestIsBlockedIP(t *testing.T) {
+	cases := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"127.1.2.3", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"224.0.0.1", true},
+		{"::1", true},
+		{"::", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"8.8.8.8", false},
+		{"172.32.0.1", false},
+		{"93.184.216.34", false},
+		{"2606:4700::1111", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.blocked, isBlockedIP(net.ParseIP(c.ip)), c.ip)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	cases := []struct {
+		url   string
+		valid bool
+	}{
+		{"http://8.8.8.8/hook", true},
+		{"https://[2606:4700::1111]:8443/hook", true},
+		{"ftp://8.8.8.8/hook", false},
+		{"file:///etc/passwd", false},
+		{"http:///hook", false},
+		{"http://127.0.0.1:3000/hook", false},
+		{"http://localhost/hook", false},
+		{"http://10.0.0.1/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://[::1]/hook", false},
+		{"http://0.0.0.0/hook", false},
+	}
+
+	for _, c := range cases {
+		err := CheckURL(c.url)
+		if c.valid {
+			assert.NoError(t, err, c.url)
+		} else {
+			assert.Error(t, err, c.url)
+		}
+	}
+
+	setting.Webhook.AllowLocalNetwork = true
+	defer func() { setting.Webhook.AllowLocalNetwork = false }()
+	assert.NoError(t, CheckURL("http://127.0.0.1:3000/hook"))
+	assert.Error(t, CheckURL("ftp://127.0.0.1/hook"))
+}
+
+// newDelivery stores a webhook to url with a pending delivery of payload.
+func newDelivery(t *testing.T, url, secret, payload string) *models.WebhookDelivery {
+	hook := &models.Webhook{Owner: 1, URL: url, Secret: secret, Events: "*", IsActive: true}
+	if !assert.NoError(t, models.CreateWebhook(hook)) {
+		t.FailNow()
+	}
+
+	d := &models.WebhookDelivery{WebhookID: hook.ID, Event: models.WebhookEvent("file.create"), Payload: payload}
+	if !assert.NoError(t, models.CreateWebhookDelivery(d)) {
+		t.FailNow()
+	}
+	return d
+}
+
+func deliverAgain(t *testing.T, d *models.WebhookDelivery) *models.WebhookDelivery {
+	if !assert.NoError(t, deliver(&deliveryTask{ID: d.ID, WebhookID: d.WebhookID})) {
+		t.FailNow()
+	}
+
+	d, err := models.GetWebhookDelivery(d.ID, d.WebhookID)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return d
+}
+
+func allowLocalNetwork() func() {
+	setting.Webhook.AllowLocalNetwork = true
+	return func() { setting.Webhook.AllowLocalNetwork = false }
+}
+
+func TestDeliverSigned(t *testing.T) {
+	defer allowLocalNetwork()()
+
+	payload := `{"event":"file.create"}`
+	var req *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.Write([]byte("received"))
+	}))
+	defer srv.Close()
+
+	d := deliverAgain(t, newDelivery(t, srv.URL, "s3cret", payload))
+
+	assert.Equal(t, models.WebhookDeliverySucceeded, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, http.StatusOK, d.ResponseStatus)
+	assert.Nil(t, d.NextAttemptAt)
+	assert.Empty(t, d.ResponseBody)
+
+	if assert.NotNil(t, req) {
+		assert.Equal(t, http.MethodPost, req.Method)
+		assert.Equal(t, payload, string(body))
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		assert.Equal(t, "file.create", req.Header.Get("X-Ahfs-Event"))
+		assert.Equal(t, d.UUID, req.Header.Get("X-Ahfs-Delivery"))
+		assert.Equal(t, Sign("s3cret", []byte(payload)), req.Header.Get("X-Ahfs-Signature-256"))
+	}
+
+	req = nil
+	deliverAgain(t, newDelivery(t, srv.URL, "", payload))
+	if assert.NotNil(t, req) {
+		assert.Empty(t, req.Header.Get("X-Ahfs-Signature-256"))
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	defer allowLocalNetwork()()
+
+	var failures, requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		failures int32
+		statuses []models.WebhookDeliveryStatus
+	}{
+		{0, []models.WebhookDeliveryStatus{models.WebhookDeliverySucceeded}},
+		{2, []models.WebhookDeliveryStatus{models.WebhookDeliveryPending, models.WebhookDeliveryPending, models.WebhookDeliverySucceeded}},
+		{5, []models.WebhookDeliveryStatus{models.WebhookDeliveryPending, models.WebhookDeliveryPending, models.WebhookDeliveryFailed}},
+	}
+
+	for _, c := range cases {
+		atomic.StoreInt32(&failures, c.failures)
+		atomic.StoreInt32(&requests, 0)
+
+		d := newDelivery(t, srv.URL, "", "{}")
+		var previous time.Duration
+		for i, status := range c.statuses {
+			start := time.Now()
+			d = deliverAgain(t, d)
+			assert.Equal(t, status, d.Status, "failures %d attempt %d", c.failures, i+1)
+			assert.Equal(t, i+1, d.Attempts)
+
+			if status != models.WebhookDeliveryPending {
+				assert.Nil(t, d.NextAttemptAt)
+				assert.Empty(t, d.Error)
+				continue
+			}
+
+			// the delay before the next attempt doubles with every attempt
+			assert.Equal(t, http.StatusInternalServerError, d.ResponseStatus)
+			if assert.NotNil(t, d.NextAttemptAt) {
+				delay := d.NextAttemptAt.Sub(start)
+				assert.True(t, delay > previous, "delay %v after %v", delay, previous)
+				previous = delay
+			}
+		}
+
+		assert.Equal(t, int32(len(c.statuses)), atomic.LoadInt32(&requests))
+
+		// finished deliveries aren't attempted again
+		d = deliverAgain(t, d)
+		assert.Equal(t, len(c.statuses), d.Attempts)
+	}
+}
+
+func TestDeliverLocalNetwork(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer srv.Close()
+
+	d := deliverAgain(t, newDelivery(t, srv.URL, "", "{}"))
+	assert.Equal(t, models.WebhookDeliveryPending, d.Status)
+	assert.Equal(t, 0, d.ResponseStatus)
+	assert.Contains(t, d.Error, "not allowed")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+}
+
+func TestDeliverRedirect(t *testing.T) {
+	defer allowLocalNetwork()()
+
+	var redirected int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&redirected, 1)
+	}))
+	defer target.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	d := deliverAgain(t, newDelivery(t, srv.URL, "", "{}"))
+	assert.Equal(t, models.WebhookDeliveryPending, d.Status)
+	assert.Equal(t, http.StatusTemporaryRedirect, d.ResponseStatus)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&redirected))
+}
+
+func TestDeliverResponseBody(t *testing.T) {
+	defer allowLocalNetwork()()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789"))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		maxSize int64
+		body    string
+	}{
+		{0, ""},
+		{4, "0123"},
+		{100, "0123456789"},
+	}
+
+	defer func(size int64) { setting.Webhook.MaxResponseSize = size }(setting.Webhook.MaxResponseSize)
+	for _, c := range cases {
+		setting.Webhook.MaxResponseSize = c.maxSize
+		d := deliverAgain(t, newDelivery(t, srv.URL, "", "{}"))
+		assert.Equal(t, c.body, d.ResponseBody, "max size %d", c.maxSize)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	u := &models.User{Username: "dispatch", Email: "dispatch@example.com", Password: "password", MaxFileCapacity: 1 << 20}
+	if err := models.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	root, err := models.GetUserRootFile(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newHook := func(owner uint, events, prefix string, active bool) *models.Webhook {
+		hook := &models.Webhook{Owner: owner, URL: "http://8.8.8.8/hook", Events: events, PathPrefix: prefix, IsActive: active}
+		if err := models.CreateWebhook(hook); err != nil {
+			t.Fatal(err)
+		}
+		return hook
+	}
+	all := newHook(u.ID, "*", "", true)
+	deletes := newHook(u.ID, "file.delete,account.delete", "", true)
+	reports := newHook(u.ID, "*", "/reports", true)
+	inactive := newHook(u.ID, "*", "", false)
+	others := newHook(u.ID+1000, "*", "", true)
+	system := newHook(0, "file.create", "", true)
+
+	upload := func(parent *models.File, name string) *models.File {
+		f, err := models.UploadFile(u, parent, name, 1, strings.NewReader("x"), models.ConflictReject, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	dir, err := models.CreateDirectory(u.ID, root, "reports", models.ConflictReject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := upload(dir, "a.txt")
+	b := upload(root, "b.txt")
+	upload(root, "c.txt")
+	if _, err := models.MoveFile(u.ID, b, dir, "", models.ConflictReject, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.RenameFile(u.ID, a, "d.txt", models.ConflictReject, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.DeleteFile(u.ID, dir, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.NoError(t, Dispatch(u.ID)) {
+		return
+	}
+	// changes are dispatched once
+	assert.NoError(t, Dispatch(u.ID))
+
+	deliveries := func(hook *models.Webhook) []string {
+		ds, _, err := models.GetWebhookDeliveries(hook.ID, models.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		paths := make([]string, len(ds))
+		for i, d := range ds {
+			payload := &api.WebhookPayload{}
+			if assert.NoError(t, json.Unmarshal([]byte(d.Payload), payload)) && assert.NotNil(t, payload.Change) {
+				assert.Equal(t, string(d.Event), payload.Event)
+				assert.Equal(t, u.ID, payload.User.ID)
+				paths[i] = payload.Event + " " + payload.Change.Path
+			}
+		}
+		sort.Strings(paths)
+		return paths
+	}
+
+	assert.Equal(t, []string{
+		"file.create /b.txt", "file.create /c.txt", "file.create /reports", "file.create /reports/a.txt",
+		"file.delete /reports", "file.move /reports/b.txt", "file.rename /reports/d.txt",
+	}, deliveries(all))
+	assert.Equal(t, []string{"file.delete /reports"}, deliveries(deletes))
+	// moves into the prefix match by their new path
+	assert.Equal(t, []string{
+		"file.create /reports", "file.create /reports/a.txt", "file.delete /reports",
+		"file.move /reports/b.txt", "file.rename /reports/d.txt",
+	}, deliveries(reports))
+	assert.Empty(t, deliveries(inactive))
+	assert.Empty(t, deliveries(others))
+	assert.Equal(t, []string{
+		"file.create /b.txt", "file.create /c.txt", "file.create /reports", "file.create /reports/a.txt",
+	}, deliveries(system))
+}
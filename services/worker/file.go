@@ -0,0 +1,141 @@
+package worker
+
+import (
+	"github.com/czhj/ahfs/models"
+)
+
+// FileJob keeps something derived from each file of a user up to date, like
+// an index or thumbnails, files are examined once and then recorded. The job
+// follows the change journal of the user and only examines the files which
+// changed since its last run.
+type FileJob struct {
+	// Remove removes what was derived from the files among ids which no
+	// longer exist, from every file which no longer exists if ids is nil
+	Remove func(uid uint, ids []uint) error
+	// Pending returns at most limit files among ids which weren't examined
+	// yet, among all files if ids is nil
+	Pending func(uid uint, ids []uint, limit int) ([]*models.File, error)
+	// Examine derives from file and records it, files which are skipped
+	// have to be recorded as well or they are returned again by Pending
+	Examine func(file *models.File) error
+	// BatchSize is the number of files or changes fetched at once
+	BatchSize int
+
+	name string
+}
+
+// NewFileWorker creates the worker name running job, users are queued
+// whenever their files change and files once they become readable.
+func NewFileWorker(name string, job *FileJob) *Worker {
+	job.name = name
+	w := newWorker(name, job.run)
+	if w == nil {
+		return nil
+	}
+
+	models.AddFileChangedHook(w.Notify)
+	models.AddFileReadableHook(func(f *models.File) {
+		w.NotifyFiles(f.Owner, f.ID)
+	})
+	return w
+}
+
+func (job *FileJob) run(uid uint, fileIDs []uint) error {
+	if fileIDs != nil {
+		return job.examine(uid, fileIDs)
+	}
+
+	seq, ok, err := models.GetFileChangeCursor(uid, job.name)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		if err := job.follow(uid, seq); !models.IsErrFileChangeCursorExpired(err) {
+			return err
+		}
+	}
+	return job.resync(uid)
+}
+
+// follow examines the files changed after the change seq.
+func (job *FileJob) follow(uid uint, seq int64) error {
+	for {
+		changes, err := models.GetFileChanges(uid, seq, job.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(changes) == 0 {
+			return nil
+		}
+
+		ids, err := models.GetChangedFileIDs(changes)
+		if err != nil {
+			return err
+		}
+
+		if err := job.examine(uid, ids); err != nil {
+			return err
+		}
+
+		seq = changes[len(changes)-1].Seq
+		if err := models.SetFileChangeCursor(uid, job.name, seq); err != nil {
+			return err
+		}
+	}
+}
+
+func (job *FileJob) examine(uid uint, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := job.Remove(uid, ids); err != nil {
+		return err
+	}
+
+	files, err := job.Pending(uid, ids, len(ids))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := job.Examine(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resync examines every file, on the first run of the job or when the
+// changes it missed were pruned from the journal already.
+func (job *FileJob) resync(uid uint) error {
+	// changes made while resyncing are examined again by the next run
+	seq, err := models.GetLatestFileChangeSeq(uid)
+	if err != nil {
+		return err
+	}
+
+	if err := job.Remove(uid, nil); err != nil {
+		return err
+	}
+
+	for {
+		files, err := job.Pending(uid, nil, job.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			if err := job.Examine(file); err != nil {
+				return err
+			}
+		}
+
+		if len(files) < job.BatchSize {
+			break
+		}
+	}
+	return models.SetFileChangeCursor(uid, job.name, seq)
+}
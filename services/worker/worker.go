@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/czhj/ahfs/modules/locker"
+	"github.com/czhj/ahfs/modules/log"
+	"github.com/czhj/ahfs/modules/queue"
+	"go.uber.org/zap"
+)
+
+type task struct {
+	UID uint
+	// FileIDs are the files the job runs on, all files if it is nil
+	FileIDs []uint
+}
+
+// Worker runs a job on the files of a user in the background. Users are
+// queued by Notify, the jobs of a user never run concurrently.
+type Worker struct {
+	name  string
+	queue queue.Queue
+	job   func(uid uint, fileIDs []uint) error
+}
+
+// New creates the queue name and runs job for every queued user. It returns
+// nil if the queue can't be created, a nil Worker ignores notifications.
+func New(name string, job func(uid uint) error) *Worker {
+	return newWorker(name, func(uid uint, _ []uint) error {
+		return job(uid)
+	})
+}
+
+func newWorker(name string, job func(uid uint, fileIDs []uint) error) *Worker {
+	w := &Worker{name: name, job: job}
+	w.queue = queue.CreateQueue(name, func(data ...queue.Data) {
+		for _, dat := range data {
+			t := dat.(*task)
+			if err := w.run(t.UID, t.FileIDs); err != nil {
+				log.Error("Failed to run user job", zap.String("worker", name), zap.Uint("uid", t.UID), zap.Error(err))
+			}
+		}
+	}, &task{})
+
+	if w.queue == nil {
+		return nil
+	}
+
+	w.queue.Run(func(c context.Context, f func()) {
+		f()
+	}, func(c context.Context, f func()) {
+		f()
+	})
+	return w
+}
+
+// Notify queues the user uid.
+func (w *Worker) Notify(uid uint) {
+	w.push(&task{UID: uid})
+}
+
+// NotifyFiles queues the files ids of the user uid, jobs which don't run on
+// single files run on all files of the user.
+func (w *Worker) NotifyFiles(uid uint, ids ...uint) {
+	w.push(&task{UID: uid, FileIDs: ids})
+}
+
+func (w *Worker) push(t *task) {
+	if w == nil {
+		return
+	}
+
+	go func() {
+		if err := w.queue.Push(t); err != nil {
+			log.Warn("Failed to queue user job", zap.String("worker", w.name), zap.Uint("uid", t.UID), zap.Error(err))
+		}
+	}()
+}
+
+// Run runs the job of the user uid right away, waiting for a queued run of
+// the same user to finish.
+func (w *Worker) Run(uid uint) error {
+	return w.run(uid, nil)
+}
+
+func (w *Worker) run(uid uint, fileIDs []uint) error {
+	key := fmt.Sprintf("user-%d-%s", uid, w.name)
+	id, err := locker.Lock(context.Background(), key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := locker.Unlock(context.Background(), key, id); err != nil {
+			log.Error("Failed to unlock user job", zap.String("worker", w.name), zap.Uint("uid", uid), zap.Error(err))
+		}
+	}()
+
+	return w.job(uid, fileIDs)
+}
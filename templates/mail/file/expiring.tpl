@@ -0,0 +1,20 @@
+{{define "file/expiring"}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>文件即将过期(Files are about to expire)</title>
+</head>
+<body>
+    <span>{{.DisplayName}} 你好！</span>
+    <p>以下文件即将过期，过期后将被自动删除：</p>
+    <ul>
+        {{range .Files}}
+        <li>{{.FilePath}}（{{.ExpiresAt.Format "2006-01-02 15:04:05 MST"}}）</li>
+        {{end}}
+    </ul>
+    <p>如需保留，请在过期前修改或取消文件的过期时间。</p>
+</body>
+</html>
+{{end}}